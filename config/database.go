@@ -32,6 +32,45 @@ func InitDatabase() error {
 		&models.Task{},
 		&models.Agreement{},
 		&models.Payment{},
+		&models.LegalEntity{},
+		&models.TaskAssignment{},
+		&models.TaskWorkflow{},
+		&models.TaskTransition{},
+		&models.TaskChecklistItem{},
+		&models.TaskComment{},
+		&models.TaskAttachment{},
+		&models.Document{},
+		&models.Credential{},
+		&models.ExpiryReminder{},
+		&models.Notification{},
+		&models.NotificationPreference{},
+		&models.NotificationTemplate{},
+		&models.NotificationOutbox{},
+		&models.NotificationDispatch{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+		&models.EventLog{},
+		&models.AuditLog{},
+		&models.Handover{},
+		&models.HandoverItem{},
+		&models.ServiceCapacity{},
+		&models.CommissionRule{},
+		&models.PaymentAttribution{},
+		&models.CustomerStatusChange{},
+		&models.ServicePrice{},
+		&models.Lead{},
+		&models.Quotation{},
+		&models.QuotationItem{},
+		&models.AgreementItem{},
+		&models.CustomerAccountEntry{},
+		&models.PaymentRefund{},
+		&models.AgreementPriceChange{},
+		&models.Invoice{},
+		&models.InvoicePayment{},
+		&models.CustomerTaxProfile{},
+		&models.TaxObligation{},
+		&models.CustomerTaxProfileChange{},
+		&models.TaskTemplate{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
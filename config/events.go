@@ -0,0 +1,11 @@
+package config
+
+import "erp/services/eventlog"
+
+// Events 实时事件日志
+var Events *eventlog.Recorder
+
+// InitEvents 初始化实时事件日志（需在数据库初始化之后调用）
+func InitEvents() {
+	Events = eventlog.NewRecorder(DB)
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"erp/services/notification"
+	"log"
+	"os"
+	"strconv"
+)
+
+// Notifier 通知服务
+var Notifier *notification.Service
+
+// InitNotification 初始化通知服务（需在数据库初始化之后调用）
+// 通过环境变量配置邮件服务器：
+//
+//	SMTP_HOST      SMTP服务器地址，未配置时不发送邮件
+//	SMTP_PORT      端口，默认25（本地 MailHog/Mailpit 为1025）
+//	SMTP_USERNAME  用户名，为空时不认证
+//	SMTP_PASSWORD  密码
+//	SMTP_FROM      发件人地址
+func InitNotification() {
+	port, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	email := notification.NewEmailSender(notification.SMTPConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     getEnv("SMTP_FROM", "erp@localhost"),
+	})
+	if email == nil {
+		log.Println("SMTP_HOST is not set, email notifications are disabled")
+	}
+
+	Notifier = notification.NewService(DB, email, notification.NewWebhookSender())
+}
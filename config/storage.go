@@ -0,0 +1,61 @@
+package config
+
+import (
+	"crypto/rand"
+	"erp/services/storage"
+	"fmt"
+	"log"
+	"os"
+)
+
+// Storage 文件存储后端
+var Storage storage.Storage
+
+// DownloadURLSecret 文件下载链接签名密钥
+var DownloadURLSecret []byte
+
+// InitStorage 初始化文件存储
+// 通过环境变量配置：
+//
+//	STORAGE_DRIVER       local（默认）或 s3
+//	STORAGE_LOCAL_ROOT   本地存储根目录，默认 uploads/documents
+//	S3_ENDPOINT / S3_REGION / S3_BUCKET / S3_ACCESS_KEY / S3_SECRET_KEY / S3_USE_SSL
+//	DOWNLOAD_URL_SECRET  下载链接签名密钥，未配置时每次启动随机生成（重启后旧链接失效）
+func InitStorage() error {
+	cfg := storage.Config{
+		Driver:      storage.Driver(os.Getenv("STORAGE_DRIVER")),
+		LocalRoot:   getEnv("STORAGE_LOCAL_ROOT", "uploads/documents"),
+		S3Endpoint:  os.Getenv("S3_ENDPOINT"),
+		S3Region:    os.Getenv("S3_REGION"),
+		S3Bucket:    os.Getenv("S3_BUCKET"),
+		S3AccessKey: os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey: os.Getenv("S3_SECRET_KEY"),
+		S3UseSSL:    os.Getenv("S3_USE_SSL") == "true",
+	}
+
+	var err error
+	Storage, err = storage.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	if secret := os.Getenv("DOWNLOAD_URL_SECRET"); secret != "" {
+		DownloadURLSecret = []byte(secret)
+	} else {
+		DownloadURLSecret = make([]byte, 32)
+		if _, err := rand.Read(DownloadURLSecret); err != nil {
+			return fmt.Errorf("failed to generate download url secret: %w", err)
+		}
+	}
+
+	log.Printf("Storage initialized (driver: %s)", cfg.Driver)
+	return nil
+}
+
+// getEnv 读取环境变量，未设置时返回默认值
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,11 @@
+package config
+
+import "erp/services/webhook"
+
+// Webhooks 外部系统事件推送
+var Webhooks *webhook.Dispatcher
+
+// InitWebhooks 初始化Webhook事件分发器（需在数据库初始化之后调用）
+func InitWebhooks() {
+	Webhooks = webhook.NewDispatcher(DB)
+}
@@ -0,0 +1,501 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errInsufficientBalance 客户账户余额不足
+var errInsufficientBalance = errors.New("Insufficient account balance")
+
+// AccountEntryRequest 手工登记客户账户流水请求
+type AccountEntryRequest struct {
+	Type          models.AccountEntryType `json:"type" binding:"required"` // 预存/调整/退还
+	Amount        float64                 `json:"amount"`                  // 预存、退还填正数；调整为正增加余额、为负减少余额
+	EntryDate     string                  `json:"entry_date"`              // 业务日期 YYYY-MM-DD，默认今天
+	PaymentMethod string                  `json:"payment_method"`          // 预存/退还的收付款方式
+	Remark        string                  `json:"remark"`                  // 说明，调整时必填
+}
+
+// ApplyBalanceRequest 使用余额抵扣服务费请求
+type ApplyBalanceRequest struct {
+	AgreementID uint    `json:"agreement_id"`              // 抵扣的协议（可选）
+	Amount      float64 `json:"amount" binding:"required"` // 抵扣金额
+	PaymentDate string  `json:"payment_date"`              // 收款日期 YYYY-MM-DD，默认今天
+	Period      string  `json:"period"`                    // 费用所属期间 (如: 2024-01)
+	Remark      string  `json:"remark"`
+}
+
+// RefundRequest 收款退款请求
+type RefundRequest struct {
+	Amount     float64 `json:"amount" binding:"required"` // 退款金额
+	RefundDate string  `json:"refund_date"`               // 退款日期 YYYY-MM-DD，默认今天
+	Method     string  `json:"method"`                    // 退款方式，默认同收款方式
+	ToBalance  bool    `json:"to_balance"`                // 退回客户账户余额，余额抵扣的收款只能退回余额
+	Reason     string  `json:"reason"`                    // 退款原因（必填）
+	Version    uint    `json:"version"`                   // 收款记录版本号
+}
+
+// CustomerAccount 客户账户
+type CustomerAccount struct {
+	CustomerID   uint                          `json:"customer_id"`
+	CustomerName string                        `json:"customer_name"`
+	Balance      float64                       `json:"balance"`   // 当前余额
+	Deposited    float64                       `json:"deposited"` // 累计预存
+	Applied      float64                       `json:"applied"`   // 累计抵扣
+	Entries      []models.CustomerAccountEntry `json:"entries"`
+}
+
+// CustomerBalance 客户余额汇总行
+type CustomerBalance struct {
+	CustomerID   uint      `json:"customer_id"`
+	CustomerName string    `json:"customer_name"`
+	Balance      float64   `json:"balance"`
+	LastEntryAt  time.Time `json:"last_entry_at"` // 最近一笔流水的业务日期
+}
+
+// GetCustomerAccount 获取客户账户余额和流水
+func GetCustomerAccount(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid customer ID")
+		return
+	}
+
+	var customer models.Customer
+	if err := config.DB.First(&customer, id).Error; err != nil {
+		ErrorResponse(c, 404, "Customer not found")
+		return
+	}
+
+	query := config.DB.Where("customer_id = ?", customer.ID)
+	if entryType := c.Query("type"); entryType != "" {
+		query = query.Where("type = ?", entryType)
+	}
+	account := CustomerAccount{CustomerID: customer.ID, CustomerName: customer.Name, Entries: []models.CustomerAccountEntry{}}
+	if err := query.Order("id ASC").Find(&account.Entries).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch account entries: "+err.Error())
+		return
+	}
+
+	account.Balance = customerBalance(config.DB, customer.ID)
+	config.DB.Model(&models.CustomerAccountEntry{}).Where("customer_id = ? AND type = ?", customer.ID, models.AccountEntryDeposit).
+		Select("COALESCE(SUM(amount), 0)").Scan(&account.Deposited)
+	config.DB.Model(&models.CustomerAccountEntry{}).Where("customer_id = ? AND type = ?", customer.ID, models.AccountEntryApply).
+		Select("COALESCE(-SUM(amount), 0)").Scan(&account.Applied)
+	account.Deposited = roundMoney(account.Deposited)
+	account.Applied = roundMoney(account.Applied)
+
+	SuccessResponse(c, account)
+}
+
+// GetCustomerBalances 获取有余额的客户列表，按余额从高到低排列
+func GetCustomerBalances(c *gin.Context) {
+	// 每个客户最近一笔流水的余额即当前余额
+	latest := config.DB.Model(&models.CustomerAccountEntry{}).Select("MAX(id)").Group("customer_id")
+	var entries []models.CustomerAccountEntry
+	if err := config.DB.Where("id IN (?)", latest).Where("balance <> 0").
+		Order("balance DESC, customer_id ASC").Find(&entries).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch balances: "+err.Error())
+		return
+	}
+
+	names := map[uint]string{}
+	if len(entries) > 0 {
+		ids := make([]uint, len(entries))
+		for i, entry := range entries {
+			ids[i] = entry.CustomerID
+		}
+		var customers []models.Customer
+		config.DB.Select("id", "name").Where("id IN ?", ids).Find(&customers)
+		for _, customer := range customers {
+			names[customer.ID] = customer.Name
+		}
+	}
+
+	balances := make([]CustomerBalance, 0, len(entries))
+	var total float64
+	for _, entry := range entries {
+		balances = append(balances, CustomerBalance{
+			CustomerID:   entry.CustomerID,
+			CustomerName: names[entry.CustomerID],
+			Balance:      entry.Balance,
+			LastEntryAt:  entry.EntryDate,
+		})
+		total += entry.Balance
+	}
+
+	SuccessResponse(c, gin.H{"total_balance": roundMoney(total), "customers": balances})
+}
+
+// CreateAccountEntry 登记客户账户流水（预存、调整、退还）
+func CreateAccountEntry(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid customer ID")
+		return
+	}
+
+	var customer models.Customer
+	if err := config.DB.First(&customer, id).Error; err != nil {
+		ErrorResponse(c, 404, "Customer not found")
+		return
+	}
+
+	var req AccountEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	entry := models.CustomerAccountEntry{
+		CustomerID:    customer.ID,
+		Type:          req.Type,
+		Amount:        roundMoney(req.Amount),
+		PaymentMethod: req.PaymentMethod,
+		Remark:        req.Remark,
+		OperatorID:    CurrentPersonID(c),
+	}
+	switch req.Type {
+	case models.AccountEntryDeposit, models.AccountEntryWithdrawal:
+		if entry.Amount <= 0 {
+			ErrorResponse(c, 400, "Amount must be positive")
+			return
+		}
+		if req.Type == models.AccountEntryWithdrawal {
+			entry.Amount = -entry.Amount
+		}
+	case models.AccountEntryAdjustment:
+		if entry.Amount == 0 {
+			ErrorResponse(c, 400, "Amount must not be zero")
+			return
+		}
+		if req.Remark == "" {
+			ErrorResponse(c, 400, "Remark is required for adjustments")
+			return
+		}
+	default:
+		ErrorResponse(c, 400, fmt.Sprintf("Invalid entry type: %s (balance is applied via /account/apply, refunds via /payments/:id/refunds)", req.Type))
+		return
+	}
+
+	entry.EntryDate, err = parseDayOrToday(req.EntryDate)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid entry_date, expected YYYY-MM-DD")
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		return postAccountEntry(tx, &entry)
+	})
+	if err == errInsufficientBalance {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to create account entry: "+err.Error())
+		return
+	}
+
+	publishEvent(models.WebhookEventBalanceChanged, entry)
+
+	SuccessResponse(c, entry)
+}
+
+// ApplyCustomerBalance 使用客户余额抵扣服务费，生成收款方式为余额抵扣的收款记录
+func ApplyCustomerBalance(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid customer ID")
+		return
+	}
+
+	var customer models.Customer
+	if err := config.DB.First(&customer, id).Error; err != nil {
+		ErrorResponse(c, 404, "Customer not found")
+		return
+	}
+
+	var req ApplyBalanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+	if req.Amount <= 0 {
+		ErrorResponse(c, 400, "Amount must be positive")
+		return
+	}
+	if req.AgreementID != 0 {
+		var agreement models.Agreement
+		if err := config.DB.First(&agreement, req.AgreementID).Error; err != nil {
+			ErrorResponse(c, 404, "Agreement not found")
+			return
+		}
+		if agreement.CustomerID != customer.ID {
+			ErrorResponse(c, 400, "Agreement belongs to a different customer")
+			return
+		}
+	}
+	paymentDate, err := parseDayOrToday(req.PaymentDate)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid payment_date, expected YYYY-MM-DD")
+		return
+	}
+
+	payment := models.Payment{
+		CustomerID:    customer.ID,
+		AgreementID:   req.AgreementID,
+		Amount:        roundMoney(req.Amount),
+		PaymentDate:   paymentDate,
+		PaymentMethod: models.PaymentMethodBalance,
+		Period:        req.Period,
+		Remark:        req.Remark,
+	}
+	var entry models.CustomerAccountEntry
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&payment).Error; err != nil {
+			return err
+		}
+		if err := attributePayment(tx, &payment); err != nil {
+			return err
+		}
+		entry = models.CustomerAccountEntry{
+			CustomerID: customer.ID,
+			Type:       models.AccountEntryApply,
+			Amount:     -payment.Amount,
+			EntryDate:  paymentDate,
+			PaymentID:  &payment.ID,
+			Remark:     req.Remark,
+			OperatorID: CurrentPersonID(c),
+		}
+		return postAccountEntry(tx, &entry)
+	})
+	if err == errInsufficientBalance {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to apply balance: "+err.Error())
+		return
+	}
+
+	notifyPaymentRecorded(&payment)
+	publishEvent(models.WebhookEventPaymentCreated, payment)
+	publishEvent(models.WebhookEventBalanceChanged, entry)
+
+	SuccessResponse(c, gin.H{"payment": payment, "entry": entry})
+}
+
+// GetPaymentRefunds 获取收款的退款记录
+func GetPaymentRefunds(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid payment ID")
+		return
+	}
+
+	var refunds []models.PaymentRefund
+	if err := config.DB.Where("payment_id = ?", id).Order("refund_date ASC, id ASC").Find(&refunds).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch refunds: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, refunds)
+}
+
+// CreatePaymentRefund 登记收款退款，可原路退回或退回客户账户余额
+func CreatePaymentRefund(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid payment ID")
+		return
+	}
+
+	var payment models.Payment
+	if err := config.DB.First(&payment, id).Error; err != nil {
+		ErrorResponse(c, 404, "Payment not found")
+		return
+	}
+
+	var req RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+	if req.Reason == "" {
+		ErrorResponse(c, 400, "Reason is required")
+		return
+	}
+	amount := roundMoney(req.Amount)
+	refundable := roundMoney(payment.Amount - payment.RefundedAmount)
+	if amount <= 0 || amount > refundable {
+		ErrorResponse(c, 400, fmt.Sprintf("Amount must be between 0 and the refundable amount %.2f", refundable))
+		return
+	}
+	refundDate, err := parseDayOrToday(req.RefundDate)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid refund_date, expected YYYY-MM-DD")
+		return
+	}
+	if refundDate.Before(startOfDay(payment.PaymentDate)) {
+		ErrorResponse(c, 400, "refund_date cannot be earlier than the payment date")
+		return
+	}
+
+	refund := models.PaymentRefund{
+		PaymentID:  payment.ID,
+		CustomerID: payment.CustomerID,
+		Amount:     amount,
+		RefundDate: refundDate,
+		Method:     firstNonEmpty(req.Method, payment.PaymentMethod),
+		ToBalance:  req.ToBalance || payment.PaymentMethod == models.PaymentMethodBalance,
+		Reason:     req.Reason,
+		OperatorID: CurrentPersonID(c),
+	}
+	if refund.ToBalance {
+		refund.Method = models.PaymentMethodBalance
+	}
+
+	if !matchVersion(c, payment.Version, req.Version) {
+		return
+	}
+
+	var entry *models.CustomerAccountEntry
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Payment{}).Where("id = ? AND version = ?", payment.ID, payment.Version).
+			Updates(map[string]interface{}{"refunded_amount": roundMoney(payment.RefundedAmount + amount), "version": payment.Version + 1})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVersionConflict
+		}
+		if err := tx.Create(&refund).Error; err != nil {
+			return err
+		}
+		if !refund.ToBalance {
+			return nil
+		}
+		entry = &models.CustomerAccountEntry{
+			CustomerID: payment.CustomerID,
+			Type:       models.AccountEntryRefund,
+			Amount:     amount,
+			EntryDate:  refundDate,
+			PaymentID:  &payment.ID,
+			RefundID:   &refund.ID,
+			Remark:     req.Reason,
+			OperatorID: refund.OperatorID,
+		}
+		return postAccountEntry(tx, entry)
+	})
+	if err == errVersionConflict {
+		ErrorResponse(c, 409, err.Error())
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to create refund: "+err.Error())
+		return
+	}
+
+	config.DB.Preload("Refunds").First(&payment, payment.ID)
+
+	publishEvent(models.WebhookEventPaymentRefunded, gin.H{"refund": refund, "payment": payment})
+	if entry != nil {
+		publishEvent(models.WebhookEventBalanceChanged, entry)
+	}
+
+	setETag(c, payment.Version)
+	SuccessResponse(c, gin.H{"refund": refund, "payment": payment})
+}
+
+// ============ 辅助函数 ============
+
+// customerBalance 客户当前余额（最近一笔流水后的余额）
+func customerBalance(db *gorm.DB, customerID uint) float64 {
+	var last models.CustomerAccountEntry
+	if db.Where("customer_id = ?", customerID).Order("id DESC").First(&last).Error != nil {
+		return 0
+	}
+	return last.Balance
+}
+
+// postAccountEntry 在事务中记一笔账户流水并计算余额，余额不能为负
+func postAccountEntry(tx *gorm.DB, entry *models.CustomerAccountEntry) error {
+	balance := roundMoney(customerBalance(tx, entry.CustomerID) + entry.Amount)
+	if balance < 0 {
+		return errInsufficientBalance
+	}
+	entry.Balance = balance
+	return tx.Create(entry).Error
+}
+
+// checkPaymentDeletable 有退款或已关联发票的收款不能删除，以免退款、账户流水和发票失去依据
+func checkPaymentDeletable(db *gorm.DB, payment *models.Payment) error {
+	if payment.RefundedAmount > 0 {
+		return errors.New("Payment has refunds and cannot be deleted")
+	}
+	var count int64
+	db.Model(&models.InvoicePayment{}).Where("payment_id = ?", payment.ID).Count(&count)
+	if count > 0 {
+		return errors.New("Payment is linked to invoices and cannot be deleted")
+	}
+	return nil
+}
+
+// restorePaymentBalance 删除余额抵扣的收款时将金额退回客户余额，返回生成的流水（非余额抵扣时为nil）
+func restorePaymentBalance(tx *gorm.DB, payment *models.Payment, operatorID *uint) (*models.CustomerAccountEntry, error) {
+	if payment.PaymentMethod != models.PaymentMethodBalance {
+		return nil, nil
+	}
+	paymentID := payment.ID
+	entry := &models.CustomerAccountEntry{
+		CustomerID: payment.CustomerID,
+		Type:       models.AccountEntryAdjustment,
+		Amount:     payment.Amount,
+		EntryDate:  startOfDay(time.Now()),
+		PaymentID:  &paymentID,
+		Remark:     fmt.Sprintf("删除余额抵扣收款 #%d，退回余额", payment.ID),
+		OperatorID: operatorID,
+	}
+	return entry, postAccountEntry(tx, entry)
+}
+
+// checkPaymentChange 校验收款修改：金额不能低于已退款金额与已开票金额之和，已开票的收款不能更换客户；
+// 余额抵扣的收款不能修改客户、金额和收款方式，其他收款不能改为余额抵扣
+func checkPaymentChange(payment *models.Payment, customerID uint, amount float64, method string) error {
+	if payment.PaymentMethod == models.PaymentMethodBalance {
+		if customerID != payment.CustomerID || amount != payment.Amount || method != payment.PaymentMethod {
+			return errors.New("Customer, amount and payment method of a balance payment cannot be changed")
+		}
+		return nil
+	}
+	if method == models.PaymentMethodBalance {
+		return errors.New("Balance payments must be created via /api/customers/:id/account/apply")
+	}
+	if amount < payment.RefundedAmount {
+		return fmt.Errorf("Amount must not be less than the refunded amount %.2f", payment.RefundedAmount)
+	}
+	invoiced := invoicedAmount(config.DB, payment.ID, 0)
+	if invoiced > 0 && customerID != payment.CustomerID {
+		return errors.New("Invoiced payment cannot be moved to another customer")
+	}
+	if amount < roundMoney(payment.RefundedAmount+invoiced) {
+		return fmt.Errorf("Amount must not be less than the refunded and invoiced amount %.2f", roundMoney(payment.RefundedAmount+invoiced))
+	}
+	return nil
+}
+
+// parseDayOrToday 解析 YYYY-MM-DD 日期，为空时返回今天
+func parseDayOrToday(value string) (time.Time, error) {
+	if value == "" {
+		return startOfDay(time.Now()), nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
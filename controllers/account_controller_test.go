@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"erp/models"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestPostAccountEntry(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.CustomerAccountEntry{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 按顺序记账，各笔流水之间余额累计
+	tests := []struct {
+		name        string
+		customerID  uint
+		amount      float64
+		wantBalance float64
+		wantErr     error
+	}{
+		{"预存", 1, 1000, 1000, nil},
+		{"抵扣", 1, -333.33, 666.67, nil},
+		{"余额不足", 1, -666.68, 666.67, errInsufficientBalance},
+		{"其他客户余额独立计算", 2, 50.1, 50.1, nil},
+		{"小数累加后保留两位", 1, 0.1, 666.77, nil},
+		{"恰好用完余额", 1, -666.77, 0, nil},
+		{"余额为零时不能抵扣", 1, -0.01, 0, errInsufficientBalance},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := models.CustomerAccountEntry{CustomerID: tt.customerID, Type: models.AccountEntryAdjustment, Amount: tt.amount}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return postAccountEntry(tx, &entry)
+			})
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && entry.Balance != tt.wantBalance {
+				t.Errorf("entry balance = %v, want %v", entry.Balance, tt.wantBalance)
+			}
+			if got := customerBalance(db, tt.customerID); got != tt.wantBalance {
+				t.Errorf("customer balance = %v, want %v", got, tt.wantBalance)
+			}
+		})
+	}
+}
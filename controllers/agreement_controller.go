@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // CreateAgreement 创建协议
@@ -16,11 +17,29 @@ func CreateAgreement(c *gin.Context) {
 		return
 	}
 
+	// 有明细时协议金额由明细计算
+	if len(agreement.Items) > 0 {
+		if agreement.FeeType == "" {
+			agreement.FeeType = defaultAgreementFeeType(agreement.Items)
+		}
+		amount, oneTime, err := prepareAgreementItems(agreement.FeeType, agreement.Items)
+		if err != nil {
+			ErrorResponse(c, 400, err.Error())
+			return
+		}
+		agreement.Amount = amount
+		agreement.OneTimeAmount = oneTime
+	} else {
+		agreement.OneTimeAmount = 0
+	}
+
 	if err := config.DB.Create(&agreement).Error; err != nil {
 		ErrorResponse(c, 500, "Failed to create agreement: "+err.Error())
 		return
 	}
 
+	publishEvent(models.WebhookEventAgreementCreated, agreement)
+
 	SuccessResponse(c, agreement)
 }
 
@@ -72,11 +91,12 @@ func GetAgreement(c *gin.Context) {
 	}
 
 	var agreement models.Agreement
-	if err := config.DB.Preload("Customer").Preload("Payments").First(&agreement, id).Error; err != nil {
+	if err := config.DB.Preload("Customer").Preload("Payments").Preload("Items", orderByID).First(&agreement, id).Error; err != nil {
 		ErrorResponse(c, 404, "Agreement not found")
 		return
 	}
 
+	setETag(c, agreement.Version)
 	SuccessResponse(c, agreement)
 }
 
@@ -100,12 +120,146 @@ func UpdateAgreement(c *gin.Context) {
 		return
 	}
 
-	// 更新字段
-	config.DB.Model(&agreement).Updates(updateData)
+	// 明细单独处理：请求中包含 items 时整体替换，否则按现有明细重新计算金额
+	items := updateData.Items
+	updateData.Items = nil
+	updateData.OneTimeAmount = 0
+	feeType := updateData.FeeType
+	if feeType == "" {
+		feeType = agreement.FeeType
+	}
+	if items != nil && hasPendingItemPriceChange(agreement.ID) {
+		ErrorResponse(c, 400, errPendingPriceChange.Error())
+		return
+	}
+	var derived map[string]interface{}
+	if items == nil {
+		items = loadAgreementItems(agreement.ID)
+		if len(items) > 0 {
+			amount, oneTime, err := agreementItemTotals(feeType, items)
+			if err != nil {
+				ErrorResponse(c, 400, err.Error())
+				return
+			}
+			derived = map[string]interface{}{"amount": amount, "one_time_amount": oneTime}
+		}
+		items = nil
+	} else if len(items) > 0 {
+		amount, oneTime, err := prepareAgreementItems(feeType, items)
+		if err != nil {
+			ErrorResponse(c, 400, err.Error())
+			return
+		}
+		derived = map[string]interface{}{"amount": amount, "one_time_amount": oneTime}
+	} else {
+		derived = map[string]interface{}{"one_time_amount": 0}
+	}
+
+	if !matchVersion(c, agreement.Version, updateData.Version) {
+		return
+	}
+
+	// 更新字段（以读取时的版本为条件，防止覆盖他人的修改）
+	updateData.Version = agreement.Version + 1
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&agreement).Where("version = ?", agreement.Version).Updates(updateData)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVersionConflict
+		}
+		if derived != nil {
+			if err := tx.Model(&models.Agreement{}).Where("id = ?", agreement.ID).Updates(derived).Error; err != nil {
+				return err
+			}
+		}
+		if items != nil {
+			return replaceAgreementItems(tx, agreement.ID, items)
+		}
+		return nil
+	})
+	if err == errVersionConflict {
+		ErrorResponse(c, 409, err.Error())
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to update: "+err.Error())
+		return
+	}
 
 	// 重新获取更新后的数据
+	config.DB.Preload("Customer").Preload("Items", orderByID).First(&agreement, id)
+
+	publishEvent(models.WebhookEventAgreementUpdated, agreement)
+
+	setETag(c, agreement.Version)
+	SuccessResponse(c, agreement)
+}
+
+// agreementPatchFields 协议可通过 PATCH 修改的字段
+var agreementPatchFields = patchFields{
+	"customer_id":      "customer_id",
+	"agreement_number": "agreement_number",
+	"start_date":       "start_date",
+	"end_date":         "end_date",
+	"fee_type":         "fee_type",
+	"amount":           "amount",
+	"status":           "status",
+	"version":          "",
+}
+
+// PatchAgreement 部分更新协议（JSON Merge Patch），值为 null 的字段被清空
+func PatchAgreement(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid agreement ID")
+		return
+	}
+
+	var agreement models.Agreement
+	if err := config.DB.First(&agreement, id).Error; err != nil {
+		ErrorResponse(c, 404, "Agreement not found")
+		return
+	}
+
+	var patched models.Agreement
+	columns, ok := bindMergePatch(c, agreement, &patched, agreementPatchFields)
+	if !ok {
+		return
+	}
+
+	if patched.CustomerID == 0 {
+		ErrorResponse(c, 400, "Customer is required")
+		return
+	}
+
+	if !matchVersion(c, agreement.Version, patched.Version) {
+		return
+	}
+
+	// 有明细时金额不能手工修改，按（可能修改后的）收费类型重新计算
+	if items := loadAgreementItems(agreement.ID); len(items) > 0 {
+		amount, oneTime, err := agreementItemTotals(patched.FeeType, items)
+		if err != nil {
+			ErrorResponse(c, 400, err.Error())
+			return
+		}
+		patched.Amount = amount
+		patched.OneTimeAmount = oneTime
+		columns = appendColumns(columns, "amount", "one_time_amount")
+	}
+
+	patched.Version = agreement.Version + 1
+	if !updateVersioned(c, config.DB.Model(&agreement).Select(append(columns, "version")), agreement.Version, &patched) {
+		return
+	}
+
 	config.DB.Preload("Customer").First(&agreement, id)
 
+	publishEvent(models.WebhookEventAgreementUpdated, agreement)
+
+	setETag(c, agreement.Version)
 	SuccessResponse(c, agreement)
 }
 
@@ -117,10 +271,30 @@ func DeleteAgreement(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Delete(&models.Agreement{}, id).Error; err != nil {
+	var agreement models.Agreement
+	config.DB.First(&agreement, id)
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("agreement_id = ?", id).Delete(&models.AgreementItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("agreement_id = ?", id).Delete(&models.AgreementPriceChange{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM invoice_agreements WHERE agreement_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Agreement{}, id).Error
+	})
+	if err != nil {
 		ErrorResponse(c, 500, "Failed to delete agreement: "+err.Error())
 		return
 	}
 
+	// 删除协议文档
+	deleteOwnerDocuments(models.DocumentOwnerAgreement, uint(id))
+
+	publishEvent(models.WebhookEventAgreementDeleted, gin.H{"id": uint(id), "customer_id": agreement.CustomerID})
+
 	SuccessResponse(c, gin.H{"message": "Agreement deleted successfully"})
 }
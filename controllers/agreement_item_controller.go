@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AgreementItemsRequest 替换协议明细请求
+type AgreementItemsRequest struct {
+	FeeType models.FeeType         `json:"fee_type"` // 协议收费类型，为空时保持不变
+	Items   []models.AgreementItem `json:"items"`    // 为空表示清除明细，协议金额改为手工维护
+	Version uint                   `json:"version"`  // 协议版本号
+}
+
+// GetAgreementItems 获取协议明细
+func GetAgreementItems(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid agreement ID")
+		return
+	}
+
+	var items []models.AgreementItem
+	if err := config.DB.Where("agreement_id = ?", id).Order("id ASC").Find(&items).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch agreement items: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, items)
+}
+
+// UpdateAgreementItems 替换协议明细，并按明细重新计算协议金额
+func UpdateAgreementItems(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid agreement ID")
+		return
+	}
+
+	var agreement models.Agreement
+	if err := config.DB.First(&agreement, id).Error; err != nil {
+		ErrorResponse(c, 404, "Agreement not found")
+		return
+	}
+
+	var req AgreementItemsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+	if hasPendingItemPriceChange(agreement.ID) {
+		ErrorResponse(c, 400, errPendingPriceChange.Error())
+		return
+	}
+
+	feeType := req.FeeType
+	if feeType == "" {
+		feeType = agreement.FeeType
+	}
+	values := map[string]interface{}{"fee_type": feeType, "version": agreement.Version + 1}
+	if len(req.Items) > 0 {
+		if feeType == "" {
+			feeType = defaultAgreementFeeType(req.Items)
+			values["fee_type"] = feeType
+		}
+		amount, oneTime, err := prepareAgreementItems(feeType, req.Items)
+		if err != nil {
+			ErrorResponse(c, 400, err.Error())
+			return
+		}
+		values["amount"] = amount
+		values["one_time_amount"] = oneTime
+	} else {
+		values["one_time_amount"] = 0
+	}
+
+	if !matchVersion(c, agreement.Version, req.Version) {
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Agreement{}).Where("id = ? AND version = ?", agreement.ID, agreement.Version).Updates(values)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVersionConflict
+		}
+		return replaceAgreementItems(tx, agreement.ID, req.Items)
+	})
+	if err == errVersionConflict {
+		ErrorResponse(c, 409, err.Error())
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to update agreement items: "+err.Error())
+		return
+	}
+
+	config.DB.Preload("Items", orderByID).First(&agreement, id)
+
+	publishEvent(models.WebhookEventAgreementUpdated, agreement)
+
+	setETag(c, agreement.Version)
+	SuccessResponse(c, agreement)
+}
+
+// ============ 辅助函数 ============
+
+// prepareAgreementItems 校验协议明细，按服务目录补全名称、周期和单价，计算各行金额
+// 返回周期性明细按协议收费类型折算的合计，以及一次性费用合计
+func prepareAgreementItems(feeType models.FeeType, items []models.AgreementItem) (float64, float64, error) {
+	if err := validateFeeType(feeType); err != nil {
+		return 0, 0, err
+	}
+
+	for i := range items {
+		item := &items[i]
+		item.ID = 0
+		if item.Quantity == 0 {
+			item.Quantity = 1
+		}
+		if item.Quantity < 0 || item.UnitPrice < 0 || item.Discount < 0 {
+			return 0, 0, fmt.Errorf("Item %d: quantity, unit_price and discount must not be negative", i+1)
+		}
+
+		if item.ServicePriceID != nil {
+			var price models.ServicePrice
+			if err := config.DB.First(&price, *item.ServicePriceID).Error; err != nil {
+				return 0, 0, fmt.Errorf("Item %d: service price %d not found", i+1, *item.ServicePriceID)
+			}
+			if item.Name == "" {
+				item.Name = price.Name
+			}
+			if item.Description == "" {
+				item.Description = price.Description
+			}
+			if item.FeeType == "" {
+				item.FeeType = price.FeeType
+			}
+			if item.UnitPrice == 0 {
+				unitPrice, err := convertCatalogPrice(&price, item.FeeType)
+				if err != nil {
+					return 0, 0, fmt.Errorf("Item %d: %s", i+1, err.Error())
+				}
+				item.UnitPrice = unitPrice
+			}
+		}
+
+		if item.Name == "" {
+			return 0, 0, fmt.Errorf("Item %d: name is required", i+1)
+		}
+		if item.FeeType == "" {
+			item.FeeType = feeType
+		}
+		if err := validateItemFeeType(item.FeeType); err != nil {
+			return 0, 0, fmt.Errorf("Item %d: %s", i+1, err.Error())
+		}
+
+		gross := roundMoney(item.Quantity * item.UnitPrice)
+		if item.Discount > gross {
+			return 0, 0, fmt.Errorf("Item %d: discount must not exceed %.2f", i+1, gross)
+		}
+		item.UnitPrice = roundMoney(item.UnitPrice)
+		item.Discount = roundMoney(item.Discount)
+		item.Amount = roundMoney(gross - item.Discount)
+	}
+	return agreementItemTotals(feeType, items)
+}
+
+// agreementItemTotals 按协议收费类型汇总明细金额，周期性明细按月折算后乘以协议收费周期的月数
+func agreementItemTotals(feeType models.FeeType, items []models.AgreementItem) (float64, float64, error) {
+	if err := validateFeeType(feeType); err != nil {
+		return 0, 0, err
+	}
+
+	var amount, oneTime float64
+	for _, item := range items {
+		if item.FeeType == models.FeeTypeOneTime {
+			oneTime += item.Amount
+		} else {
+			amount += monthlyFee(item.FeeType, item.Amount) * feeTypeMonths(feeType)
+		}
+	}
+	return roundMoney(amount), roundMoney(oneTime), nil
+}
+
+// replaceAgreementItems 用新明细替换协议的全部明细
+func replaceAgreementItems(tx *gorm.DB, agreementID uint, items []models.AgreementItem) error {
+	if err := tx.Where("agreement_id = ?", agreementID).Delete(&models.AgreementItem{}).Error; err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	for i := range items {
+		items[i].AgreementID = agreementID
+	}
+	return tx.Create(&items).Error
+}
+
+// loadAgreementItems 加载协议明细
+func loadAgreementItems(agreementID uint) []models.AgreementItem {
+	var items []models.AgreementItem
+	config.DB.Where("agreement_id = ?", agreementID).Order("id ASC").Find(&items)
+	return items
+}
+
+// defaultAgreementFeeType 协议未指定收费类型时取第一项周期性明细的周期，均为一次性时按月度
+func defaultAgreementFeeType(items []models.AgreementItem) models.FeeType {
+	for _, item := range items {
+		if item.FeeType != "" && item.FeeType != models.FeeTypeOneTime {
+			return item.FeeType
+		}
+		if item.FeeType == "" && item.ServicePriceID != nil {
+			var price models.ServicePrice
+			if config.DB.First(&price, *item.ServicePriceID).Error == nil && price.FeeType != models.FeeTypeOneTime {
+				return price.FeeType
+			}
+		}
+	}
+	return models.FeeTypeMonthly
+}
+
+// convertCatalogPrice 将服务目录价格换算为指定收费周期的单价，一次性项目不能换算为周期性收费，反之亦然
+func convertCatalogPrice(price *models.ServicePrice, feeType models.FeeType) (float64, error) {
+	if (price.FeeType == models.FeeTypeOneTime) != (feeType == models.FeeTypeOneTime) {
+		return 0, fmt.Errorf("service %s is charged %s and cannot be billed %s", price.Name, price.FeeType, feeType)
+	}
+	if feeType == models.FeeTypeOneTime {
+		return price.Price, nil
+	}
+	return roundMoney(monthlyFee(price.FeeType, price.Price) * feeTypeMonths(feeType)), nil
+}
+
+// validateItemFeeType 校验明细的收费周期，允许一次性
+func validateItemFeeType(feeType models.FeeType) error {
+	if feeType == models.FeeTypeOneTime {
+		return nil
+	}
+	return validateFeeType(feeType)
+}
+
+// orderByID 预加载时按ID排序
+func orderByID(db *gorm.DB) *gorm.DB {
+	return db.Order("id ASC")
+}
+
+// appendColumns 追加需要写入的列，已存在的列不重复添加
+func appendColumns(columns []string, extra ...string) []string {
+	for _, column := range extra {
+		found := false
+		for _, existing := range columns {
+			if existing == column {
+				found = true
+				break
+			}
+		}
+		if !found {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"erp/models"
+	"testing"
+)
+
+func TestAgreementItemTotals(t *testing.T) {
+	tests := []struct {
+		name        string
+		feeType     models.FeeType
+		items       []models.AgreementItem
+		wantAmount  float64
+		wantOneTime float64
+		wantErr     bool
+	}{
+		{"无明细", models.FeeTypeMonthly, nil, 0, 0, false},
+		{"同周期明细直接相加", models.FeeTypeQuarterly, []models.AgreementItem{
+			{FeeType: models.FeeTypeQuarterly, Amount: 300},
+			{FeeType: models.FeeTypeQuarterly, Amount: 150.5},
+		}, 450.5, 0, false},
+		{"月度明细折算为年度", models.FeeTypeYearly, []models.AgreementItem{
+			{FeeType: models.FeeTypeMonthly, Amount: 200},
+		}, 2400, 0, false},
+		{"年度明细折算为季度", models.FeeTypeQuarterly, []models.AgreementItem{
+			{FeeType: models.FeeTypeYearly, Amount: 1000},
+		}, 250, 0, false},
+		{"折算后保留两位小数", models.FeeTypeMonthly, []models.AgreementItem{
+			{FeeType: models.FeeTypeYearly, Amount: 1000},
+		}, 83.33, 0, false},
+		{"一次性明细单独汇总", models.FeeTypeMonthly, []models.AgreementItem{
+			{FeeType: models.FeeTypeMonthly, Amount: 200},
+			{FeeType: models.FeeTypeOneTime, Amount: 500},
+			{FeeType: models.FeeTypeOneTime, Amount: 99.9},
+		}, 200, 599.9, false},
+		{"协议收费类型不能为一次性", models.FeeTypeOneTime, []models.AgreementItem{
+			{FeeType: models.FeeTypeOneTime, Amount: 500},
+		}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, oneTime, err := agreementItemTotals(tt.feeType, tt.items)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if amount != tt.wantAmount || oneTime != tt.wantOneTime {
+				t.Errorf("agreementItemTotals() = (%v, %v), want (%v, %v)", amount, oneTime, tt.wantAmount, tt.wantOneTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"encoding/json"
+	"erp/config"
+	"erp/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	auditLogDefaultLimit = 100  // 默认返回条数
+	auditLogMaxLimit     = 1000 // 单次最多返回条数
+)
+
+// GetAuditLogs 获取操作日志，按时间倒序
+func GetAuditLogs(c *gin.Context) {
+	var logs []models.AuditLog
+	var total int64
+
+	query := config.DB.Model(&models.AuditLog{})
+	if entityType := c.Query("entity_type"); entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	if entityID := c.Query("entity_id"); entityID != "" {
+		query = query.Where("entity_id = ?", entityID)
+	}
+	if operatorID := c.Query("operator_id"); operatorID != "" {
+		query = query.Where("operator_id = ?", operatorID)
+	}
+	if batchID := c.Query("batch_id"); batchID != "" {
+		query = query.Where("batch_id = ?", batchID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	query.Count(&total)
+
+	limit := auditLogDefaultLimit
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if limit > auditLogMaxLimit {
+		limit = auditLogMaxLimit
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	if err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&logs).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch audit logs: "+err.Error())
+		return
+	}
+
+	SuccessPaginatedResponse(c, total, logs)
+}
+
+// ============ 辅助函数 ============
+
+// recordAudit 记录操作日志，before/after 为修改前后的字段值
+func recordAudit(db *gorm.DB, batchID string, operatorID *uint, action, entityType string, entityID uint, before, after interface{}) error {
+	entry := models.AuditLog{
+		BatchID:    batchID,
+		OperatorID: operatorID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+	}
+	if before != nil {
+		data, _ := json.Marshal(before)
+		entry.Before = datatypes.JSON(data)
+	}
+	if after != nil {
+		data, _ := json.Marshal(after)
+		entry.After = datatypes.JSON(data)
+	}
+	return db.Create(&entry).Error
+}
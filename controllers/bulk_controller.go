@@ -0,0 +1,776 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"erp/config"
+	"erp/models"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const bulkMaxItems = 1000 // 单次批量操作最多处理的记录数
+
+// BulkRequest 批量操作请求，ids 与 filter 二选一
+type BulkRequest struct {
+	IDs    []uint            `json:"ids"`                       // 指定记录ID
+	Filter map[string]string `json:"filter"`                    // 按条件筛选记录，参数同列表接口
+	Action string            `json:"action" binding:"required"` // 操作类型
+	Params json.RawMessage   `json:"params"`                    // 操作参数
+	Atomic *bool             `json:"atomic"`                    // 是否全部成功才提交，默认true
+	DryRun bool              `json:"dry_run"`                   // 仅预演，不提交
+}
+
+// BulkItemResult 单条记录的处理结果
+type BulkItemResult struct {
+	ID      uint   `json:"id"`
+	Status  string `json:"status"` // success/failed/skipped
+	Message string `json:"message,omitempty"`
+}
+
+// BulkResult 批量操作结果
+type BulkResult struct {
+	BatchID   string           `json:"batch_id"` // 批次号，可用于查询操作日志
+	Action    string           `json:"action"`
+	Total     int              `json:"total"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Skipped   int              `json:"skipped"`
+	Committed bool             `json:"committed"` // 是否已提交
+	DryRun    bool             `json:"dry_run"`
+	Items     []BulkItemResult `json:"items"`
+}
+
+// bulkContext 批量操作上下文，事件在事务提交后统一推送
+type bulkContext struct {
+	tx         *gorm.DB
+	batchID    string
+	operatorID *uint
+	events     []bulkEvent
+}
+
+type bulkEvent struct {
+	eventType string
+	data      interface{}
+	audience  []uint // 额外的可见人员
+}
+
+// bulkSkip 记录无需处理（如已是目标状态）
+type bulkSkip string
+
+func (s bulkSkip) Error() string { return string(s) }
+
+// bulkApplyFunc 处理单条记录
+type bulkApplyFunc func(b *bulkContext, id uint) error
+
+// BulkCustomers 批量操作客户（调整服务人员）
+func BulkCustomers(c *gin.Context) {
+	var req BulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	apply, err := bulkCustomerAction(req.Action, req.Params)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	ids, err := resolveBulkIDs(req, &models.Customer{}, filterBulkCustomers)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	runBulk(c, req, ids, apply)
+}
+
+// BulkTasks 批量操作任务（分配、状态流转、优先级、截止日期）
+func BulkTasks(c *gin.Context) {
+	var req BulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	apply, err := bulkTaskAction(req.Action, req.Params)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	ids, err := resolveBulkIDs(req, &models.Task{}, filterBulkTasks)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	runBulk(c, req, ids, apply)
+}
+
+// BulkPayments 批量操作收款记录（关联协议、所属期间、删除）
+func BulkPayments(c *gin.Context) {
+	var req BulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	apply, err := bulkPaymentAction(req.Action, req.Params)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	ids, err := resolveBulkIDs(req, &models.Payment{}, filterBulkPayments)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	runBulk(c, req, ids, apply)
+}
+
+// ============ 辅助函数 ============
+
+// runBulk 在一个事务中逐条处理记录，每条记录使用保存点，失败时仅回滚该条
+// atomic 模式下任一记录失败则整体回滚；dry_run 时始终回滚
+func runBulk(c *gin.Context, req BulkRequest, ids []uint, apply bulkApplyFunc) {
+	atomic := req.Atomic == nil || *req.Atomic
+	result := BulkResult{
+		BatchID: newBatchID(),
+		Action:  req.Action,
+		Total:   len(ids),
+		DryRun:  req.DryRun,
+		Items:   []BulkItemResult{},
+	}
+	b := &bulkContext{batchID: result.BatchID, operatorID: CurrentPersonID(c)}
+
+	errRollback := errors.New("rollback")
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		b.tx = tx
+		for i, id := range ids {
+			savepoint := fmt.Sprintf("bulk_item_%d", i)
+			if err := tx.SavePoint(savepoint).Error; err != nil {
+				return err
+			}
+			queued := len(b.events)
+
+			item := BulkItemResult{ID: id, Status: "success"}
+			if err := apply(b, id); err != nil {
+				if rbErr := tx.RollbackTo(savepoint).Error; rbErr != nil {
+					return rbErr
+				}
+				b.events = b.events[:queued]
+
+				var skip bulkSkip
+				if errors.As(err, &skip) {
+					item.Status = "skipped"
+					result.Skipped++
+				} else {
+					item.Status = "failed"
+					result.Failed++
+				}
+				item.Message = err.Error()
+			} else {
+				result.Succeeded++
+			}
+			result.Items = append(result.Items, item)
+		}
+
+		if req.DryRun || (atomic && result.Failed > 0) {
+			return errRollback
+		}
+		return nil
+	})
+	if err != nil && err != errRollback {
+		ErrorResponse(c, 500, "Bulk operation failed: "+err.Error())
+		return
+	}
+
+	if err == errRollback {
+		if !req.DryRun {
+			c.JSON(200, Response{
+				Code:    400,
+				Message: fmt.Sprintf("%d item(s) failed, all changes have been rolled back", result.Failed),
+				Data:    result,
+			})
+			return
+		}
+		SuccessResponse(c, result)
+		return
+	}
+
+	result.Committed = true
+	for _, event := range b.events {
+		publishEvent(event.eventType, event.data, event.audience...)
+	}
+
+	SuccessResponse(c, result)
+}
+
+// resolveBulkIDs 取请求指定的记录ID（去重），或按筛选条件查询记录ID
+func resolveBulkIDs(req BulkRequest, model interface{}, applyFilter func(*gorm.DB, map[string]string) (*gorm.DB, error)) ([]uint, error) {
+	if (len(req.IDs) > 0) == (req.Filter != nil) {
+		return nil, errors.New("Exactly one of ids or filter is required")
+	}
+
+	var ids []uint
+	if len(req.IDs) > 0 {
+		for _, id := range req.IDs {
+			ids = appendUniqueID(ids, id)
+		}
+	} else {
+		query, err := applyFilter(config.DB.Model(model), req.Filter)
+		if err != nil {
+			return nil, err
+		}
+		if err := query.Order("id ASC").Pluck("id", &ids).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ids) > bulkMaxItems {
+		return nil, fmt.Errorf("Too many items: %d (max %d)", len(ids), bulkMaxItems)
+	}
+	return ids, nil
+}
+
+// checkBulkFilter 校验筛选条件只包含支持的参数，且至少有一个非空条件，避免空筛选误选全部记录
+func checkBulkFilter(filter map[string]string, allowed ...string) error {
+	var unknown []string
+	conditions := 0
+	for key, value := range filter {
+		if !containsString(allowed, key) {
+			unknown = append(unknown, key)
+		}
+		if strings.TrimSpace(value) != "" {
+			conditions++
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("Unsupported filter: %s", strings.Join(unknown, ", "))
+	}
+	if conditions == 0 {
+		return errors.New("Filter must contain at least one non-empty condition")
+	}
+	return nil
+}
+
+// filterBulkCustomers 客户筛选：keyword、type、service_person_id，及税务档案 taxpayer_type、tax_bureau、tax_type、filing_frequency
+func filterBulkCustomers(query *gorm.DB, filter map[string]string) (*gorm.DB, error) {
+	if err := checkBulkFilter(filter, "keyword", "type", "service_person_id",
+		"taxpayer_type", "tax_bureau", "tax_type", "filing_frequency"); err != nil {
+		return nil, err
+	}
+	if keyword := filter["keyword"]; keyword != "" {
+		query = query.Where("name LIKE ? OR tax_number LIKE ? OR phone LIKE ?",
+			"%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%")
+	}
+	if customerType := filter["type"]; customerType != "" {
+		query = query.Where("type = ?", customerType)
+	}
+	if personID := filter["service_person_id"]; personID != "" {
+		query = query.Where("',' || service_person_ids || ',' LIKE ?", "%,"+personID+",%")
+	}
+	return filterCustomersByTax(query, func(key string) string { return filter[key] }), nil
+}
+
+// filterBulkTasks 任务筛选：keyword、status、customer_id、assignee_id、priority、type、template_id、period、due_from、due_to
+func filterBulkTasks(query *gorm.DB, filter map[string]string) (*gorm.DB, error) {
+	if err := checkBulkFilter(filter, "keyword", "status", "customer_id", "assignee_id",
+		"priority", "type", "template_id", "period", "due_from", "due_to"); err != nil {
+		return nil, err
+	}
+	if keyword := filter["keyword"]; keyword != "" {
+		query = query.Where("title LIKE ? OR description LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+	}
+	for _, column := range []string{"status", "customer_id", "assignee_id", "priority", "type", "template_id", "period"} {
+		if value := filter[column]; value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if dueFrom := filter["due_from"]; dueFrom != "" {
+		t, err := time.ParseInLocation("2006-01-02", dueFrom, time.Local)
+		if err != nil {
+			return nil, errors.New("Invalid due_from, expected YYYY-MM-DD")
+		}
+		query = query.Where("due_date >= ?", t)
+	}
+	if dueTo := filter["due_to"]; dueTo != "" {
+		t, err := time.ParseInLocation("2006-01-02", dueTo, time.Local)
+		if err != nil {
+			return nil, errors.New("Invalid due_to, expected YYYY-MM-DD")
+		}
+		query = query.Where("due_date < ?", t.AddDate(0, 0, 1))
+	}
+	return query, nil
+}
+
+// filterBulkPayments 收款筛选：customer_id、agreement_id、period、payment_method、start_date、end_date
+func filterBulkPayments(query *gorm.DB, filter map[string]string) (*gorm.DB, error) {
+	if err := checkBulkFilter(filter, "customer_id", "agreement_id", "period",
+		"payment_method", "start_date", "end_date"); err != nil {
+		return nil, err
+	}
+	for _, column := range []string{"customer_id", "agreement_id", "period", "payment_method"} {
+		if value := filter[column]; value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if startDate := filter["start_date"]; startDate != "" {
+		t, err := time.ParseInLocation("2006-01-02", startDate, time.Local)
+		if err != nil {
+			return nil, errors.New("Invalid start_date, expected YYYY-MM-DD")
+		}
+		query = query.Where("payment_date >= ?", t)
+	}
+	if endDate := filter["end_date"]; endDate != "" {
+		t, err := time.ParseInLocation("2006-01-02", endDate, time.Local)
+		if err != nil {
+			return nil, errors.New("Invalid end_date, expected YYYY-MM-DD")
+		}
+		query = query.Where("payment_date < ?", t.AddDate(0, 0, 1))
+	}
+	return query, nil
+}
+
+// bindBulkParams 解析操作参数
+func bindBulkParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		params = json.RawMessage("{}")
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return errors.New("Invalid params: " + err.Error())
+	}
+	return nil
+}
+
+// bulkCustomerAction 解析客户批量操作
+func bulkCustomerAction(action string, raw json.RawMessage) (bulkApplyFunc, error) {
+	var params struct {
+		PersonID     uint `json:"person_id"`
+		FromPersonID uint `json:"from_person_id"`
+		ToPersonID   uint `json:"to_person_id"`
+	}
+	if err := bindBulkParams(raw, &params); err != nil {
+		return nil, err
+	}
+
+	var add, remove uint
+	switch action {
+	case "add_service_person":
+		add = params.PersonID
+	case "remove_service_person":
+		remove = params.PersonID
+		if remove == 0 {
+			return nil, errors.New("params.person_id is required")
+		}
+	case "replace_service_person":
+		if params.FromPersonID == 0 || params.ToPersonID == 0 {
+			return nil, errors.New("params.from_person_id and params.to_person_id are required")
+		}
+		if params.FromPersonID == params.ToPersonID {
+			return nil, errors.New("params.from_person_id and params.to_person_id must be different")
+		}
+		add, remove = params.ToPersonID, params.FromPersonID
+	default:
+		return nil, fmt.Errorf("Unsupported action: %s", action)
+	}
+	if add != 0 && !isServicePerson(add) {
+		return nil, errors.New("Person must be a service person")
+	}
+	if action == "add_service_person" && add == 0 {
+		return nil, errors.New("params.person_id is required")
+	}
+
+	return func(b *bulkContext, id uint) error {
+		var customer models.Customer
+		if err := b.tx.First(&customer, id).Error; err != nil {
+			return errors.New("Customer not found")
+		}
+
+		before := StringToIDs(customer.ServicePersonIDs)
+		if remove != 0 && !containsID(before, remove) {
+			return bulkSkip(fmt.Sprintf("Person %d is not a service person of this customer", remove))
+		}
+		after := before
+		if remove != 0 {
+			after = subtractIDs(after, []uint{remove})
+		}
+		if add != 0 {
+			after = appendUniqueID(after, add)
+		}
+		if IDsToString(after) == IDsToString(before) {
+			return bulkSkip(fmt.Sprintf("Person %d is already a service person of this customer", add))
+		}
+
+		if err := b.tx.Model(&customer).Updates(map[string]interface{}{
+			"service_person_ids": IDsToString(after),
+			"version":            bumpVersion(),
+		}).Error; err != nil {
+			return err
+		}
+
+		// 同步人员的服务客户列表
+		if remove != 0 {
+			if err := removeCustomerLink(b.tx, &models.Person{}, remove, "service_customer_ids", id); err != nil {
+				return err
+			}
+		}
+		if add != 0 && !containsID(before, add) {
+			if err := addCustomerLink(b.tx, &models.Person{}, add, "service_customer_ids", id); err != nil {
+				return err
+			}
+		}
+
+		if err := b.audit("customer."+action, "customer", id,
+			gin.H{"service_person_ids": IDsToString(before)},
+			gin.H{"service_person_ids": IDsToString(after)}); err != nil {
+			return err
+		}
+
+		// 原服务人员也需收到变更事件
+		b.tx.First(&customer, id)
+		b.publish(models.WebhookEventCustomerUpdated, customer, before...)
+		return nil
+	}, nil
+}
+
+// bulkTaskAction 解析任务批量操作
+func bulkTaskAction(action string, raw json.RawMessage) (bulkApplyFunc, error) {
+	switch action {
+	case "assign":
+		var params struct {
+			AssigneeID *uint  `json:"assignee_id"` // 为null时取消分配
+			Reason     string `json:"reason"`
+		}
+		if err := bindBulkParams(raw, &params); err != nil {
+			return nil, err
+		}
+		if params.AssigneeID != nil && !isServicePerson(*params.AssigneeID) {
+			return nil, errors.New("Assignee must be a service person")
+		}
+		return func(b *bulkContext, id uint) error {
+			task, err := b.loadTask(id)
+			if err != nil {
+				return err
+			}
+			if sameAssignee(task.AssigneeID, params.AssigneeID) {
+				return bulkSkip("Task is already assigned to this person")
+			}
+
+			previous := copyID(task.AssigneeID)
+			if err := b.tx.Model(task).Updates(map[string]interface{}{
+				"assignee_id": params.AssigneeID,
+				"version":     bumpVersion(),
+			}).Error; err != nil {
+				return err
+			}
+			assignment := models.TaskAssignment{
+				TaskID:       task.ID,
+				FromPersonID: previous,
+				ToPersonID:   params.AssigneeID,
+				OperatorID:   b.operatorID,
+				Reason:       params.Reason,
+			}
+			if err := b.tx.Create(&assignment).Error; err != nil {
+				return err
+			}
+			if err := b.audit("task.assign", "task", id,
+				gin.H{"assignee_id": previous}, gin.H{"assignee_id": params.AssigneeID}); err != nil {
+				return err
+			}
+
+			b.publish(models.WebhookEventTaskAssigned, assignment)
+			return b.publishTask(id)
+		}, nil
+
+	case "transition":
+		var params TaskTransitionRequest
+		if err := bindBulkParams(raw, &params); err != nil {
+			return nil, err
+		}
+		if params.To == "" {
+			return nil, errors.New("params.to is required")
+		}
+		return func(b *bulkContext, id uint) error {
+			task, err := b.loadTask(id)
+			if err != nil {
+				return err
+			}
+			if task.Status == params.To {
+				return bulkSkip("Task is already in state " + params.To)
+			}
+
+			from := task.Status
+			record, err := applyTaskTransition(b.tx, task, params, b.operatorID)
+			if err != nil {
+				return err
+			}
+			if err := b.audit("task.transition", "task", id,
+				gin.H{"status": from}, gin.H{"status": params.To}); err != nil {
+				return err
+			}
+
+			b.publish(models.WebhookEventTaskTransitioned, record)
+			return nil
+		}, nil
+
+	case "set_priority":
+		var params struct {
+			Priority models.TaskPriority `json:"priority"`
+		}
+		if err := bindBulkParams(raw, &params); err != nil {
+			return nil, err
+		}
+		if !isValidTaskPriority(params.Priority) {
+			return nil, errors.New("Invalid priority, must be one of: 低, 中, 高, 紧急")
+		}
+		return func(b *bulkContext, id uint) error {
+			task, err := b.loadTask(id)
+			if err != nil {
+				return err
+			}
+			if task.Priority == params.Priority {
+				return bulkSkip("Task already has priority " + string(params.Priority))
+			}
+			return b.updateTask(task, "task.set_priority",
+				gin.H{"priority": task.Priority}, gin.H{"priority": params.Priority})
+		}, nil
+
+	case "set_due_date":
+		var params struct {
+			DueDate *string `json:"due_date"` // YYYY-MM-DD，为null时清空
+		}
+		if err := bindBulkParams(raw, &params); err != nil {
+			return nil, err
+		}
+		var dueDate *time.Time
+		if params.DueDate != nil {
+			t, err := time.ParseInLocation("2006-01-02", *params.DueDate, time.Local)
+			if err != nil {
+				return nil, errors.New("Invalid params.due_date, expected YYYY-MM-DD")
+			}
+			dueDate = &t
+		}
+		return func(b *bulkContext, id uint) error {
+			task, err := b.loadTask(id)
+			if err != nil {
+				return err
+			}
+			if (task.DueDate == nil && dueDate == nil) ||
+				(task.DueDate != nil && dueDate != nil && task.DueDate.Equal(*dueDate)) {
+				return bulkSkip("Task already has this due date")
+			}
+			return b.updateTask(task, "task.set_due_date",
+				gin.H{"due_date": task.DueDate}, gin.H{"due_date": dueDate})
+		}, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported action: %s", action)
+}
+
+// bulkPaymentAction 解析收款批量操作
+func bulkPaymentAction(action string, raw json.RawMessage) (bulkApplyFunc, error) {
+	switch action {
+	case "set_agreement":
+		var params struct {
+			AgreementID uint `json:"agreement_id"` // 为0时取消关联
+		}
+		if err := bindBulkParams(raw, &params); err != nil {
+			return nil, err
+		}
+		var agreement models.Agreement
+		if params.AgreementID != 0 {
+			if err := config.DB.First(&agreement, params.AgreementID).Error; err != nil {
+				return nil, errors.New("Agreement not found")
+			}
+		}
+		return func(b *bulkContext, id uint) error {
+			payment, err := b.loadPayment(id)
+			if err != nil {
+				return err
+			}
+			if payment.AgreementID == params.AgreementID {
+				return bulkSkip("Payment is already linked to this agreement")
+			}
+			if params.AgreementID != 0 && agreement.CustomerID != payment.CustomerID {
+				return errors.New("Agreement belongs to a different customer")
+			}
+			return b.updatePayment(payment, "payment.set_agreement",
+				gin.H{"agreement_id": payment.AgreementID}, gin.H{"agreement_id": params.AgreementID})
+		}, nil
+
+	case "set_period":
+		var params struct {
+			Period string `json:"period"` // 如 2024-01
+		}
+		if err := bindBulkParams(raw, &params); err != nil {
+			return nil, err
+		}
+		if _, err := time.Parse("2006-01", params.Period); err != nil {
+			return nil, errors.New("Invalid params.period, expected YYYY-MM")
+		}
+		return func(b *bulkContext, id uint) error {
+			payment, err := b.loadPayment(id)
+			if err != nil {
+				return err
+			}
+			if payment.Period == params.Period {
+				return bulkSkip("Payment already belongs to period " + params.Period)
+			}
+			return b.updatePayment(payment, "payment.set_period",
+				gin.H{"period": payment.Period}, gin.H{"period": params.Period})
+		}, nil
+
+	case "delete":
+		return func(b *bulkContext, id uint) error {
+			payment, err := b.loadPayment(id)
+			if err != nil {
+				return err
+			}
+			if err := checkPaymentDeletable(b.tx, payment); err != nil {
+				return err
+			}
+			if err := b.tx.Delete(payment).Error; err != nil {
+				return err
+			}
+			entry, err := restorePaymentBalance(b.tx, payment, b.operatorID)
+			if err != nil {
+				return err
+			}
+			if entry != nil {
+				b.publish(models.WebhookEventBalanceChanged, entry)
+			}
+			if err := b.tx.Where("payment_id = ?", id).Delete(&models.PaymentAttribution{}).Error; err != nil {
+				return err
+			}
+			if err := b.audit("payment.delete", "payment", id, payment, nil); err != nil {
+				return err
+			}
+			b.publish(models.WebhookEventPaymentDeleted, gin.H{"id": id})
+			return nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported action: %s", action)
+}
+
+// publish 将事件加入队列，事务提交后推送
+func (b *bulkContext) publish(eventType string, data interface{}, audience ...uint) {
+	b.events = append(b.events, bulkEvent{eventType: eventType, data: data, audience: audience})
+}
+
+// audit 在事务中记录操作日志
+func (b *bulkContext) audit(action, entityType string, entityID uint, before, after interface{}) error {
+	return recordAudit(b.tx, b.batchID, b.operatorID, action, entityType, entityID, before, after)
+}
+
+// loadTask 在事务中读取任务
+func (b *bulkContext) loadTask(id uint) (*models.Task, error) {
+	var task models.Task
+	if err := b.tx.First(&task, id).Error; err != nil {
+		return nil, errors.New("Task not found")
+	}
+	return &task, nil
+}
+
+// updateTask 更新任务字段并记录操作日志，after 为需要写入的字段
+func (b *bulkContext) updateTask(task *models.Task, action string, before, after gin.H) error {
+	values := map[string]interface{}{"version": bumpVersion()}
+	for column, value := range after {
+		values[column] = value
+	}
+	if err := b.tx.Model(task).Updates(values).Error; err != nil {
+		return err
+	}
+	if err := b.audit(action, "task", task.ID, before, after); err != nil {
+		return err
+	}
+	return b.publishTask(task.ID)
+}
+
+// publishTask 重新读取任务并加入 task.updated 事件
+func (b *bulkContext) publishTask(id uint) error {
+	var task models.Task
+	if err := b.tx.First(&task, id).Error; err != nil {
+		return err
+	}
+	b.publish(models.WebhookEventTaskUpdated, task)
+	return nil
+}
+
+// loadPayment 在事务中读取收款记录
+func (b *bulkContext) loadPayment(id uint) (*models.Payment, error) {
+	var payment models.Payment
+	if err := b.tx.First(&payment, id).Error; err != nil {
+		return nil, errors.New("Payment not found")
+	}
+	return &payment, nil
+}
+
+// updatePayment 更新收款字段并记录操作日志，after 为需要写入的字段
+func (b *bulkContext) updatePayment(payment *models.Payment, action string, before, after gin.H) error {
+	values := map[string]interface{}{"version": bumpVersion()}
+	for column, value := range after {
+		values[column] = value
+	}
+	if err := b.tx.Model(payment).Updates(values).Error; err != nil {
+		return err
+	}
+	if err := b.audit(action, "payment", payment.ID, before, after); err != nil {
+		return err
+	}
+
+	var updated models.Payment
+	if err := b.tx.First(&updated, payment.ID).Error; err != nil {
+		return err
+	}
+	b.publish(models.WebhookEventPaymentUpdated, updated)
+	return nil
+}
+
+// sameAssignee 判断两个负责人是否相同（均为空视为相同）
+func sameAssignee(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// containsID 判断ID是否在数组中
+func containsID(ids []uint, target uint) bool {
+	for _, id := range ids {
+		if id == target {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString 判断字符串是否在数组中
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+// newBatchID 生成批量操作批次号
+func newBatchID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return time.Now().Format("20060102150405") + "-" + hex.EncodeToString(buf)
+}
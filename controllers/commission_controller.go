@@ -0,0 +1,944 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"erp/services/import_export"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// ============ 提成规则 ============
+
+// GetCommissionRules 获取提成规则列表
+func GetCommissionRules(c *gin.Context) {
+	var rules []models.CommissionRule
+	if err := config.DB.Order("priority DESC, id ASC").Find(&rules).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch commission rules: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, rules)
+}
+
+// CreateCommissionRule 创建提成规则
+func CreateCommissionRule(c *gin.Context) {
+	var rule models.CommissionRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	// 新规则默认从当月起生效，不能追溯到以前月份
+	if rule.EffectiveFrom == nil {
+		monthStart := revenueMonth(time.Now())
+		rule.EffectiveFrom = &monthStart
+	}
+	if err := validateCommissionRule(&rule); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	if err := checkCommissionRuleChange(nil, &rule); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	rule.ID = 0
+	rule.Version = 0
+	if err := config.DB.Create(&rule).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to create commission rule: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, rule)
+}
+
+// GetCommissionRule 获取提成规则详情
+func GetCommissionRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid commission rule ID")
+		return
+	}
+
+	var rule models.CommissionRule
+	if err := config.DB.First(&rule, id).Error; err != nil {
+		ErrorResponse(c, 404, "Commission rule not found")
+		return
+	}
+
+	setETag(c, rule.Version)
+	SuccessResponse(c, rule)
+}
+
+// UpdateCommissionRule 更新提成规则
+func UpdateCommissionRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid commission rule ID")
+		return
+	}
+
+	var rule models.CommissionRule
+	if err := config.DB.First(&rule, id).Error; err != nil {
+		ErrorResponse(c, 404, "Commission rule not found")
+		return
+	}
+
+	var updateData models.CommissionRule
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if err := validateCommissionRule(&updateData); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	if err := checkCommissionRuleChange(&rule, &updateData); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if !matchVersion(c, rule.Version, updateData.Version) {
+		return
+	}
+
+	updateData.ID = rule.ID
+	updateData.CreatedAt = rule.CreatedAt
+	updateData.Version = rule.Version + 1
+	if !updateVersioned(c, config.DB.Model(&rule).Select("*"), rule.Version, &updateData) {
+		return
+	}
+
+	config.DB.First(&rule, id)
+
+	setETag(c, rule.Version)
+	SuccessResponse(c, rule)
+}
+
+// commissionRulePatchFields 提成规则可通过 PATCH 修改的字段
+var commissionRulePatchFields = patchFields{
+	"name":           "name",
+	"customer_type":  "customer_type",
+	"fee_type":       "fee_type",
+	"agreement_kind": "agreement_kind",
+	"rate":           "rate",
+	"priority":       "priority",
+	"remark":         "remark",
+	"effective_from": "effective_from",
+	"effective_to":   "effective_to",
+	"version":        "",
+}
+
+// PatchCommissionRule 部分更新提成规则（JSON Merge Patch），值为 null 的条件表示不限
+func PatchCommissionRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid commission rule ID")
+		return
+	}
+
+	var rule models.CommissionRule
+	if err := config.DB.First(&rule, id).Error; err != nil {
+		ErrorResponse(c, 404, "Commission rule not found")
+		return
+	}
+
+	var patched models.CommissionRule
+	columns, ok := bindMergePatch(c, rule, &patched, commissionRulePatchFields)
+	if !ok {
+		return
+	}
+
+	if err := validateCommissionRule(&patched); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	if err := checkCommissionRuleChange(&rule, &patched); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if !matchVersion(c, rule.Version, patched.Version) {
+		return
+	}
+
+	patched.Version = rule.Version + 1
+	if !updateVersioned(c, config.DB.Model(&rule).Select(append(columns, "version")), rule.Version, &patched) {
+		return
+	}
+
+	config.DB.First(&rule, id)
+
+	setETag(c, rule.Version)
+	SuccessResponse(c, rule)
+}
+
+// DeleteCommissionRule 删除提成规则，已适用于以前月份的规则不能删除（可设置失效日期）
+func DeleteCommissionRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid commission rule ID")
+		return
+	}
+
+	var rule models.CommissionRule
+	if err := config.DB.First(&rule, id).Error; err != nil {
+		ErrorResponse(c, 404, "Commission rule not found")
+		return
+	}
+	if commissionRuleApplied(&rule, revenueMonth(time.Now())) {
+		ErrorResponse(c, 400, "Commission rule already applies to past months and cannot be deleted, set effective_to instead")
+		return
+	}
+
+	if err := config.DB.Delete(&models.CommissionRule{}, id).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to delete commission rule: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "Commission rule deleted successfully"})
+}
+
+// ============ 业绩归属 ============
+
+// PaymentAttributionItem 业绩归属设置项
+type PaymentAttributionItem struct {
+	PersonID uint    `json:"person_id" binding:"required"`
+	Share    float64 `json:"share" binding:"required"` // 分成比例（%）
+}
+
+// GetPaymentAttributions 获取收款的业绩归属
+func GetPaymentAttributions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid payment ID")
+		return
+	}
+
+	var attributions []models.PaymentAttribution
+	if err := config.DB.Preload("Person").Where("payment_id = ?", id).
+		Order("id ASC").Find(&attributions).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch attributions: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, attributions)
+}
+
+// UpdatePaymentAttributions 设置收款的业绩归属（整体替换），各人比例合计须为100；
+// 提交空列表表示该笔收款不归属任何人（不再按服务人员自动分配）
+func UpdatePaymentAttributions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid payment ID")
+		return
+	}
+
+	var payment models.Payment
+	if err := config.DB.First(&payment, id).Error; err != nil {
+		ErrorResponse(c, 404, "Payment not found")
+		return
+	}
+
+	var items []PaymentAttributionItem
+	if err := c.ShouldBindJSON(&items); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	var total float64
+	var seen []uint
+	for _, item := range items {
+		if containsID(seen, item.PersonID) {
+			ErrorResponse(c, 400, fmt.Sprintf("Duplicate person %d", item.PersonID))
+			return
+		}
+		seen = append(seen, item.PersonID)
+		if !isServicePerson(item.PersonID) {
+			ErrorResponse(c, 400, fmt.Sprintf("Person %d must be a service person", item.PersonID))
+			return
+		}
+		if item.Share <= 0 {
+			ErrorResponse(c, 400, "Share must be greater than 0")
+			return
+		}
+		total += item.Share
+	}
+	if len(items) > 0 && math.Abs(total-100) > 0.01 {
+		ErrorResponse(c, 400, fmt.Sprintf("Shares must add up to 100, got %.2f", total))
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("payment_id = ?", payment.ID).Delete(&models.PaymentAttribution{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&payment).Update("attribution_overridden", true).Error; err != nil {
+			return err
+		}
+		for _, item := range items {
+			attribution := models.PaymentAttribution{PaymentID: payment.ID, PersonID: item.PersonID, Share: item.Share}
+			if err := tx.Create(&attribution).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to save attributions: "+err.Error())
+		return
+	}
+
+	GetPaymentAttributions(c)
+}
+
+// ============ 提成结算单 ============
+
+// CommissionLine 提成明细（一笔收款或退款归属到一名服务人员的部分）
+type CommissionLine struct {
+	PaymentID        uint                 `json:"payment_id"`
+	PaymentDate      time.Time            `json:"payment_date"`        // 收款日期，退款明细为退款日期
+	RefundID         *uint                `json:"refund_id,omitempty"` // 退款冲减明细对应的退款记录，金额和提成为负数
+	CustomerID       uint                 `json:"customer_id"`
+	CustomerName     string               `json:"customer_name"`
+	CustomerType     models.CustomerType  `json:"customer_type"`
+	AgreementID      uint                 `json:"agreement_id"`
+	AgreementNumber  string               `json:"agreement_number"`
+	FeeType          models.FeeType       `json:"fee_type"`
+	AgreementKind    models.AgreementKind `json:"agreement_kind"`
+	Amount           float64              `json:"amount"`            // 收款金额，抵付一次性费用的部分单独列示
+	Share            float64              `json:"share"`             // 分成比例（%）
+	AttributedAmount float64              `json:"attributed_amount"` // 归属金额
+	RuleID           *uint                `json:"rule_id"`           // 适用的提成规则，无匹配规则时为null
+	RuleName         string               `json:"rule_name"`
+	Rate             float64              `json:"rate"`            // 提成比例（%）
+	Commission       float64              `json:"commission"`      // 提成金额
+	AutoAttributed   bool                 `json:"auto_attributed"` // 未设置归属，按客户当前服务人员平均分配
+}
+
+// CommissionStatement 服务人员月度提成结算单
+type CommissionStatement struct {
+	PersonID        uint             `json:"person_id"`
+	Name            string           `json:"name"`
+	Month           string           `json:"month"`
+	PaymentCount    int              `json:"payment_count"`    // 收款笔数
+	CollectedAmount float64          `json:"collected_amount"` // 归属的收款金额（已减去当月退款）
+	RefundedAmount  float64          `json:"refunded_amount"`  // 当月退款冲减的归属金额
+	Commission      float64          `json:"commission"`       // 提成合计
+	Lines           []CommissionLine `json:"lines,omitempty"`  // 明细（仅详情接口返回）
+}
+
+// CommissionSummary 月度提成汇总
+type CommissionSummary struct {
+	Month              string                `json:"month"`
+	TotalCollected     float64               `json:"total_collected"`     // 当月收款总额减去当月退款
+	TotalRefunded      float64               `json:"total_refunded"`      // 当月退款（按退款日期）
+	TotalCommission    float64               `json:"total_commission"`    // 提成总额
+	UnattributedAmount float64               `json:"unattributed_amount"` // 无法归属到服务人员的收款金额
+	Statements         []CommissionStatement `json:"statements"`
+}
+
+// GetCommissionStatements 获取月度提成汇总（按服务人员）
+func GetCommissionStatements(c *gin.Context) {
+	month, start, end, ok := parseCommissionMonth(c)
+	if !ok {
+		return
+	}
+
+	summary, err := buildCommissionSummary(month, start, end)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to calculate commissions: "+err.Error())
+		return
+	}
+
+	for i := range summary.Statements {
+		summary.Statements[i].Lines = nil
+	}
+
+	SuccessResponse(c, summary)
+}
+
+// GetCommissionStatement 获取服务人员的月度提成结算单及明细
+func GetCommissionStatement(c *gin.Context) {
+	personID, err := strconv.ParseUint(c.Param("person_id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid person ID")
+		return
+	}
+
+	month, start, end, ok := parseCommissionMonth(c)
+	if !ok {
+		return
+	}
+
+	var person models.Person
+	if err := config.DB.First(&person, personID).Error; err != nil {
+		ErrorResponse(c, 404, "Person not found")
+		return
+	}
+
+	summary, err := buildCommissionSummary(month, start, end)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to calculate commissions: "+err.Error())
+		return
+	}
+
+	statement := CommissionStatement{PersonID: person.ID, Name: person.Name, Month: month, Lines: []CommissionLine{}}
+	for _, s := range summary.Statements {
+		if s.PersonID == person.ID {
+			statement = s
+		}
+	}
+
+	SuccessResponse(c, statement)
+}
+
+// ExportCommissionStatements 导出月度提成结算单（汇总和明细两个工作表）
+func ExportCommissionStatements(c *gin.Context) {
+	month, start, end, ok := parseCommissionMonth(c)
+	if !ok {
+		return
+	}
+
+	summary, err := buildCommissionSummary(month, start, end)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to calculate commissions: "+err.Error())
+		return
+	}
+
+	content, err := commissionWorkbook(summary)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to export commissions: "+err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("提成结算单_%s.xlsx", month)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Data(200, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", content)
+}
+
+// ============ 辅助函数 ============
+
+// validateCommissionRule 校验提成规则
+func validateCommissionRule(rule *models.CommissionRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("Name is required")
+	}
+	if rule.Rate < 0 || rule.Rate > 100 {
+		return fmt.Errorf("Rate must be between 0 and 100")
+	}
+	switch rule.CustomerType {
+	case "", models.CustomerTypeLimitedCompany, models.CustomerTypeSoleProprietorship,
+		models.CustomerTypePartnership, models.CustomerTypeIndividualBusiness:
+	default:
+		return fmt.Errorf("Invalid customer type: %s", rule.CustomerType)
+	}
+	switch rule.FeeType {
+	case "", models.FeeTypeMonthly, models.FeeTypeQuarterly, models.FeeTypeYearly, models.FeeTypeOneTime:
+	default:
+		return fmt.Errorf("Invalid fee type: %s", rule.FeeType)
+	}
+	switch rule.AgreementKind {
+	case "", models.AgreementKindNew, models.AgreementKindRenewal:
+	default:
+		return fmt.Errorf("Invalid agreement kind: %s", rule.AgreementKind)
+	}
+	rule.EffectiveFrom = localDay(rule.EffectiveFrom)
+	rule.EffectiveTo = localDay(rule.EffectiveTo)
+	if rule.EffectiveFrom != nil && rule.EffectiveTo != nil && rule.EffectiveTo.Before(*rule.EffectiveFrom) {
+		return fmt.Errorf("effective_to must not be earlier than effective_from")
+	}
+	return nil
+}
+
+// checkCommissionRuleChange 保证以前月份的提成不因规则变更而改变：新建或尚未适用于以前月份的规则不能早于当月生效；
+// 已适用于以前月份的规则只能修改名称、备注和失效日期，失效日期不能早于上月末。rule 为 nil 表示新建
+func checkCommissionRuleChange(rule, updated *models.CommissionRule) error {
+	monthStart := revenueMonth(time.Now())
+	if rule == nil || !commissionRuleApplied(rule, monthStart) {
+		if commissionRuleApplied(updated, monthStart) {
+			return errors.New("effective_from must not be earlier than the current month")
+		}
+		return nil
+	}
+
+	if updated.CustomerType != rule.CustomerType || updated.FeeType != rule.FeeType ||
+		updated.AgreementKind != rule.AgreementKind || updated.Rate != rule.Rate ||
+		updated.Priority != rule.Priority || !sameDay(updated.EffectiveFrom, rule.EffectiveFrom) {
+		return errors.New("Commission rule already applies to past months, only name, remark and effective_to can be changed; set effective_to and create a new rule instead")
+	}
+	if !sameDay(updated.EffectiveTo, rule.EffectiveTo) {
+		lastMonthEnd := monthStart.AddDate(0, 0, -1)
+		for _, to := range []*time.Time{rule.EffectiveTo, updated.EffectiveTo} {
+			if to != nil && to.Before(lastMonthEnd) {
+				return errors.New("effective_to cannot be moved before the last day of the previous month")
+			}
+		}
+	}
+	return nil
+}
+
+// commissionRuleApplied 规则是否已适用于 monthStart 之前的收款
+func commissionRuleApplied(rule *models.CommissionRule, monthStart time.Time) bool {
+	return rule.EffectiveFrom == nil || rule.EffectiveFrom.Before(monthStart)
+}
+
+// commissionRuleEffective 规则在收款日期是否有效
+func commissionRuleEffective(rule *models.CommissionRule, date time.Time) bool {
+	if rule.EffectiveFrom != nil && date.Before(*rule.EffectiveFrom) {
+		return false
+	}
+	return rule.EffectiveTo == nil || date.Before(rule.EffectiveTo.AddDate(0, 0, 1))
+}
+
+// localDay 按日期部分取本地零点，为空时返回nil
+func localDay(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	return &day
+}
+
+// sameDay 比较两个可为空的日期
+func sameDay(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
+
+// parseCommissionMonth 解析结算月份（YYYY-MM），默认当月；按收款日期统计
+func parseCommissionMonth(c *gin.Context) (string, time.Time, time.Time, bool) {
+	month := c.Query("month")
+	if month == "" {
+		month = time.Now().Format("2006-01")
+	}
+	start, err := time.ParseInLocation("2006-01", month, time.Local)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid month, expected YYYY-MM")
+		return "", time.Time{}, time.Time{}, false
+	}
+	return month, start, start.AddDate(0, 1, 0), true
+}
+
+// attributePayment 将收款按客户当前的服务人员平均归属，替换已有归属（含手动设置）
+func attributePayment(db *gorm.DB, payment *models.Payment) error {
+	var customer models.Customer
+	if err := db.Select("id", "service_person_ids").First(&customer, payment.CustomerID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err := db.Where("payment_id = ?", payment.ID).Delete(&models.PaymentAttribution{}).Error; err != nil {
+		return err
+	}
+	if err := db.Model(payment).Update("attribution_overridden", false).Error; err != nil {
+		return err
+	}
+	for _, share := range evenShares(StringToIDs(customer.ServicePersonIDs)) {
+		share.PaymentID = payment.ID
+		if err := db.Create(&share).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackfillPaymentAttributions 为没有归属记录的收款按客户当前的服务人员写入归属，
+// 使早于业绩归属功能的收款固定归属，不再随客户服务人员的变更（如交接）而改变
+func BackfillPaymentAttributions() error {
+	var payments []models.Payment
+	if err := config.DB.Select("id", "customer_id").
+		Where("attribution_overridden = ?", false).
+		Where("id NOT IN (?)", config.DB.Model(&models.PaymentAttribution{}).Select("payment_id")).
+		Find(&payments).Error; err != nil {
+		return err
+	}
+	filled := 0
+	for i := range payments {
+		if customerServicePersonIDs(payments[i].CustomerID) == nil {
+			continue
+		}
+		if err := config.DB.Transaction(func(tx *gorm.DB) error {
+			return attributePayment(tx, &payments[i])
+		}); err != nil {
+			return err
+		}
+		filled++
+	}
+	if filled > 0 {
+		log.Printf("Backfilled attributions for %d payments", filled)
+	}
+	return nil
+}
+
+// evenShares 按人数平均分配比例，余数计入第一人，保证合计为100
+func evenShares(personIDs []uint) []models.PaymentAttribution {
+	if len(personIDs) == 0 {
+		return nil
+	}
+	each := math.Floor(10000/float64(len(personIDs))) / 100
+	shares := make([]models.PaymentAttribution, len(personIDs))
+	for i, id := range personIDs {
+		shares[i] = models.PaymentAttribution{PersonID: id, Share: each}
+	}
+	shares[0].Share = math.Round((100-each*float64(len(personIDs)-1))*100) / 100
+	return shares
+}
+
+// buildCommissionSummary 计算月度提成：收款按业绩归属拆分到服务人员，再按匹配的提成规则计算提成；
+// 当月的退款（按退款日期）按原收款的业绩归属和提成规则冲减
+func buildCommissionSummary(month string, start, end time.Time) (*CommissionSummary, error) {
+	summary := &CommissionSummary{Month: month, Statements: []CommissionStatement{}}
+
+	var payments []models.Payment
+	if err := config.DB.Preload("Customer").Preload("Agreement").
+		Where("payment_date >= ? AND payment_date < ?", start, end).
+		Order("payment_date ASC, id ASC").Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	var refunds []models.PaymentRefund
+	if err := config.DB.Where("refund_date >= ? AND refund_date < ?", start, end).
+		Order("refund_date ASC, id ASC").Find(&refunds).Error; err != nil {
+		return nil, err
+	}
+	if len(payments) == 0 && len(refunds) == 0 {
+		return summary, nil
+	}
+
+	// 退款对应的收款可能在以前月份
+	related := append([]models.Payment{}, payments...)
+	paymentByID := make(map[uint]models.Payment, len(payments))
+	for _, payment := range payments {
+		paymentByID[payment.ID] = payment
+	}
+	var missing []uint
+	for _, refund := range refunds {
+		if _, ok := paymentByID[refund.PaymentID]; !ok && !containsID(missing, refund.PaymentID) {
+			missing = append(missing, refund.PaymentID)
+		}
+	}
+	if len(missing) > 0 {
+		var earlier []models.Payment
+		if err := config.DB.Preload("Customer").Preload("Agreement").Where("id IN ?", missing).Find(&earlier).Error; err != nil {
+			return nil, err
+		}
+		for _, payment := range earlier {
+			paymentByID[payment.ID] = payment
+			related = append(related, payment)
+		}
+	}
+
+	var rules []models.CommissionRule
+	config.DB.Find(&rules)
+
+	paymentIDs := make([]uint, len(related))
+	for i, payment := range related {
+		paymentIDs[i] = payment.ID
+	}
+	var attributions []models.PaymentAttribution
+	config.DB.Where("payment_id IN ?", paymentIDs).Order("id ASC").Find(&attributions)
+	byPayment := map[uint][]models.PaymentAttribution{}
+	for _, a := range attributions {
+		byPayment[a.PaymentID] = append(byPayment[a.PaymentID], a)
+	}
+	kinds, err := agreementKinds(related)
+	if err != nil {
+		return nil, err
+	}
+	oneTime, err := oneTimePortions(related, end)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := map[uint]*CommissionStatement{}
+	// record 按收款的业绩归属和提成规则生成明细，refundID 非空时为退款冲减（amount 为负数）
+	record := func(payment models.Payment, date time.Time, amount float64, refundID *uint) {
+		summary.TotalCollected += amount
+
+		line := CommissionLine{
+			PaymentID:   payment.ID,
+			PaymentDate: date,
+			RefundID:    refundID,
+			CustomerID:  payment.CustomerID,
+			AgreementID: payment.AgreementID,
+			Amount:      amount,
+		}
+		if payment.Customer != nil {
+			line.CustomerName = payment.Customer.Name
+			line.CustomerType = payment.Customer.Type
+		}
+		if payment.Agreement != nil && payment.AgreementID != 0 {
+			line.AgreementNumber = payment.Agreement.AgreementNumber
+			line.FeeType = payment.Agreement.FeeType
+			line.AgreementKind = kinds[payment.AgreementID]
+		}
+
+		shares, auto := byPayment[payment.ID], false
+		if len(shares) == 0 && !payment.AttributionOverridden {
+			shares, auto = evenShares(customerServicePersonIDs(payment.CustomerID)), true
+		}
+		if len(shares) == 0 {
+			summary.UnattributedAmount += amount
+			return
+		}
+
+		// 抵付一次性费用的部分按收费类型「一次性」单独匹配提成规则，退款按金额比例冲减各部分
+		parts := []CommissionLine{line}
+		if portion := oneTime[payment.ID]; portion > 0 && payment.Amount > 0 {
+			oneTimeAmount := roundMoney(amount * portion / payment.Amount)
+			parts[0].FeeType, parts[0].Amount = models.FeeTypeOneTime, oneTimeAmount
+			if rest := roundMoney(amount - oneTimeAmount); rest != 0 {
+				periodic := line
+				periodic.Amount = rest
+				parts = append(parts, periodic)
+			}
+		}
+
+		for i, part := range parts {
+			// 退款按原收款日期匹配规则，冲减原收款计提的提成
+			if rule := matchCommissionRule(rules, payment.PaymentDate, part.CustomerType, part.FeeType, part.AgreementKind); rule != nil {
+				ruleID := rule.ID
+				part.RuleID = &ruleID
+				part.RuleName = rule.Name
+				part.Rate = rule.Rate
+			}
+			for _, share := range shares {
+				statement, ok := statements[share.PersonID]
+				if !ok {
+					statement = &CommissionStatement{PersonID: share.PersonID, Month: month, Lines: []CommissionLine{}}
+					statements[share.PersonID] = statement
+				}
+				personLine := part
+				personLine.Share = share.Share
+				personLine.AttributedAmount = math.Round(part.Amount*share.Share) / 100
+				personLine.Commission = math.Round(personLine.AttributedAmount*part.Rate) / 100
+				personLine.AutoAttributed = auto
+
+				if refundID != nil {
+					statement.RefundedAmount -= personLine.AttributedAmount
+				} else if i == 0 {
+					statement.PaymentCount++
+				}
+				statement.CollectedAmount += personLine.AttributedAmount
+				statement.Commission += personLine.Commission
+				statement.Lines = append(statement.Lines, personLine)
+			}
+		}
+	}
+
+	for _, payment := range payments {
+		record(payment, payment.PaymentDate, payment.Amount, nil)
+	}
+	for _, refund := range refunds {
+		refundID := refund.ID
+		summary.TotalRefunded += refund.Amount
+		record(paymentByID[refund.PaymentID], refund.RefundDate, -refund.Amount, &refundID)
+	}
+
+	personIDs := make([]uint, 0, len(statements))
+	for id := range statements {
+		personIDs = append(personIDs, id)
+	}
+	sort.Slice(personIDs, func(i, j int) bool { return personIDs[i] < personIDs[j] })
+
+	var people []models.Person
+	config.DB.Where("id IN ?", personIDs).Find(&people)
+	names := map[uint]string{}
+	for _, person := range people {
+		names[person.ID] = person.Name
+	}
+
+	for _, id := range personIDs {
+		statement := statements[id]
+		statement.Name = names[id]
+		statement.CollectedAmount = math.Round(statement.CollectedAmount*100) / 100
+		statement.RefundedAmount = math.Round(statement.RefundedAmount*100) / 100
+		statement.Commission = math.Round(statement.Commission*100) / 100
+		summary.TotalCommission += statement.Commission
+		summary.Statements = append(summary.Statements, *statement)
+	}
+	summary.TotalCollected = math.Round(summary.TotalCollected*100) / 100
+	summary.TotalRefunded = math.Round(summary.TotalRefunded*100) / 100
+	summary.TotalCommission = math.Round(summary.TotalCommission*100) / 100
+	summary.UnattributedAmount = math.Round(summary.UnattributedAmount*100) / 100
+
+	return summary, nil
+}
+
+// agreementKinds 判断收款关联的协议为新签还是续签（按协议ID）：客户最早开始的协议为新签，其余为续签
+func agreementKinds(payments []models.Payment) (map[uint]models.AgreementKind, error) {
+	kinds := map[uint]models.AgreementKind{}
+	var customerIDs []uint
+	for _, payment := range payments {
+		if payment.AgreementID != 0 && !containsID(customerIDs, payment.CustomerID) {
+			customerIDs = append(customerIDs, payment.CustomerID)
+		}
+	}
+	if len(customerIDs) == 0 {
+		return kinds, nil
+	}
+
+	var agreements []models.Agreement
+	if err := config.DB.Select("id", "customer_id", "start_date").Where("customer_id IN ?", customerIDs).
+		Order("start_date ASC, id ASC").Find(&agreements).Error; err != nil {
+		return nil, err
+	}
+	first := map[uint]bool{}
+	for _, agreement := range agreements {
+		if first[agreement.CustomerID] {
+			kinds[agreement.ID] = models.AgreementKindRenewal
+			continue
+		}
+		first[agreement.CustomerID] = true
+		kinds[agreement.ID] = models.AgreementKindNew
+	}
+	return kinds, nil
+}
+
+// oneTimePortions 收款中抵付协议一次性费用的金额（按收款ID）：协议的收款按收款日期顺序先抵付一次性费用，
+// 其余为周期性服务费；end 之前的收款均参与抵付
+func oneTimePortions(payments []models.Payment, end time.Time) (map[uint]float64, error) {
+	portions := map[uint]float64{}
+	remaining := map[uint]float64{}
+	var agreementIDs []uint
+	for _, payment := range payments {
+		if payment.Agreement != nil && payment.AgreementID != 0 && payment.Agreement.OneTimeAmount > 0 {
+			if _, ok := remaining[payment.AgreementID]; !ok {
+				remaining[payment.AgreementID] = payment.Agreement.OneTimeAmount
+				agreementIDs = append(agreementIDs, payment.AgreementID)
+			}
+		}
+	}
+	if len(agreementIDs) == 0 {
+		return portions, nil
+	}
+
+	var earlier []models.Payment
+	if err := config.DB.Select("id", "agreement_id", "amount").
+		Where("agreement_id IN ? AND payment_date < ?", agreementIDs, end).
+		Order("payment_date ASC, id ASC").Find(&earlier).Error; err != nil {
+		return nil, err
+	}
+	for _, payment := range earlier {
+		if portion := math.Min(payment.Amount, remaining[payment.AgreementID]); portion > 0 {
+			portions[payment.ID] = portion
+			remaining[payment.AgreementID] = roundMoney(remaining[payment.AgreementID] - portion)
+		}
+	}
+	return portions, nil
+}
+
+// matchCommissionRule 选择收款日期适用的提成规则：有效期内且条件全部满足的规则中取条件最多者，其次优先级高者，再次ID小者
+func matchCommissionRule(rules []models.CommissionRule, date time.Time, customerType models.CustomerType, feeType models.FeeType, kind models.AgreementKind) *models.CommissionRule {
+	var best *models.CommissionRule
+	bestScore := -1
+	for i := range rules {
+		rule := &rules[i]
+		if !commissionRuleEffective(rule, date) {
+			continue
+		}
+		score := 0
+		if rule.CustomerType != "" {
+			if rule.CustomerType != customerType {
+				continue
+			}
+			score++
+		}
+		if rule.FeeType != "" {
+			if rule.FeeType != feeType {
+				continue
+			}
+			score++
+		}
+		if rule.AgreementKind != "" {
+			if rule.AgreementKind != kind {
+				continue
+			}
+			score++
+		}
+		if best == nil || score > bestScore ||
+			(score == bestScore && (rule.Priority > best.Priority || (rule.Priority == best.Priority && rule.ID < best.ID))) {
+			best = rule
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// commissionWorkbook 生成提成结算单Excel
+func commissionWorkbook(summary *CommissionSummary) ([]byte, error) {
+	excelService := import_export.NewExcelService()
+	defer excelService.Close()
+	file := excelService.GetFile()
+
+	summarySheet := "提成汇总"
+	file.SetSheetName("Sheet1", summarySheet)
+	if err := excelService.SetSheetHeader(summarySheet, []string{"服务人员", "月份", "收款笔数", "归属收款金额", "其中退款冲减", "提成金额"}); err != nil {
+		return nil, err
+	}
+	rows := make([][]interface{}, 0, len(summary.Statements)+2)
+	for _, s := range summary.Statements {
+		rows = append(rows, []interface{}{s.Name, s.Month, s.PaymentCount, s.CollectedAmount, s.RefundedAmount, s.Commission})
+	}
+	rows = append(rows, []interface{}{"合计", summary.Month, "", roundMoney(summary.TotalCollected - summary.UnattributedAmount), "", summary.TotalCommission})
+	if summary.UnattributedAmount != 0 {
+		rows = append(rows, []interface{}{"未归属收款", summary.Month, "", summary.UnattributedAmount, "", 0})
+	}
+	if err := excelService.WriteRows(summarySheet, 2, rows); err != nil {
+		return nil, err
+	}
+	endCell, _ := excelize.CoordinatesToCellName(6, len(rows)+1)
+	excelService.SetBorderStyle(summarySheet, "A2", endCell)
+
+	detailSheet := "提成明细"
+	excelService.CreateSheet(detailSheet)
+	headers := []string{"服务人员", "日期", "类别", "客户", "客户类型", "协议编号", "收费类型", "签约类型",
+		"收款金额", "分成比例(%)", "归属金额", "提成规则", "提成比例(%)", "提成金额", "归属方式"}
+	if err := excelService.SetSheetHeader(detailSheet, headers); err != nil {
+		return nil, err
+	}
+	var details [][]interface{}
+	for _, s := range summary.Statements {
+		for _, line := range s.Lines {
+			attribution := "已设置"
+			if line.AutoAttributed {
+				attribution = "按服务人员平均"
+			}
+			category := "收款"
+			if line.RefundID != nil {
+				category = "退款"
+			}
+			details = append(details, []interface{}{
+				s.Name, line.PaymentDate.Format("2006-01-02"), category, line.CustomerName, string(line.CustomerType),
+				line.AgreementNumber, string(line.FeeType), string(line.AgreementKind),
+				line.Amount, line.Share, line.AttributedAmount, line.RuleName, line.Rate, line.Commission, attribution,
+			})
+		}
+	}
+	if err := excelService.WriteRows(detailSheet, 2, details); err != nil {
+		return nil, err
+	}
+	if len(details) > 0 {
+		endCell, _ := excelize.CoordinatesToCellName(len(headers), len(details)+1)
+		excelService.SetBorderStyle(detailSheet, "A2", endCell)
+	}
+
+	excelService.SetActiveSheet(summarySheet)
+
+	buf, err := file.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"erp/models"
+	"testing"
+	"time"
+)
+
+func TestMatchCommissionRule(t *testing.T) {
+	june, july := localDate(2024, 6, 1), localDate(2024, 7, 1)
+	juneEnd := localDate(2024, 6, 30)
+	rules := []models.CommissionRule{
+		{ID: 1, Name: "默认", Rate: 5},
+		{ID: 2, Name: "有限公司", CustomerType: models.CustomerTypeLimitedCompany, Rate: 6, EffectiveTo: &juneEnd},
+		{ID: 3, Name: "有限公司调整后", CustomerType: models.CustomerTypeLimitedCompany, Rate: 8, EffectiveFrom: &july},
+		{ID: 4, Name: "有限公司续签", CustomerType: models.CustomerTypeLimitedCompany, AgreementKind: models.AgreementKindRenewal, Rate: 10, EffectiveFrom: &june},
+		{ID: 5, Name: "一次性高优先级", FeeType: models.FeeTypeOneTime, Rate: 3, Priority: 1},
+		{ID: 6, Name: "一次性", FeeType: models.FeeTypeOneTime, Rate: 2},
+	}
+
+	tests := []struct {
+		name         string
+		date         time.Time
+		customerType models.CustomerType
+		feeType      models.FeeType
+		kind         models.AgreementKind
+		want         uint
+	}{
+		{"失效日期当天仍适用", time.Date(2024, 6, 30, 18, 0, 0, 0, time.Local), models.CustomerTypeLimitedCompany, models.FeeTypeMonthly, models.AgreementKindNew, 2},
+		{"失效后匹配新规则", july, models.CustomerTypeLimitedCompany, models.FeeTypeMonthly, models.AgreementKindNew, 3},
+		{"生效前不匹配", localDate(2024, 5, 31), models.CustomerTypeLimitedCompany, models.FeeTypeMonthly, models.AgreementKindRenewal, 2},
+		{"条件多者优先", june, models.CustomerTypeLimitedCompany, models.FeeTypeMonthly, models.AgreementKindRenewal, 4},
+		{"条件数相同取优先级高者", july, models.CustomerTypeIndividualBusiness, models.FeeTypeOneTime, models.AgreementKindNew, 5},
+		{"不满足条件时取不限规则", july, models.CustomerTypeIndividualBusiness, models.FeeTypeMonthly, models.AgreementKindNew, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := matchCommissionRule(rules, tt.date, tt.customerType, tt.feeType, tt.kind)
+			if rule == nil || rule.ID != tt.want {
+				t.Errorf("matched rule = %v, want %d", rule, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCommissionRuleChange(t *testing.T) {
+	monthStart := revenueMonth(time.Now())
+	lastMonth := monthStart.AddDate(0, -1, 0)
+	lastMonthEnd := monthStart.AddDate(0, 0, -1)
+	twoMonthsAgo := monthStart.AddDate(0, -2, 0)
+	nextMonth := monthStart.AddDate(0, 1, 0)
+
+	legacy := models.CommissionRule{Name: "默认", Rate: 5}
+	current := models.CommissionRule{Name: "当月", Rate: 5, EffectiveFrom: &monthStart}
+	ended := models.CommissionRule{Name: "已失效", Rate: 5, EffectiveTo: &twoMonthsAgo}
+
+	with := func(rule models.CommissionRule, change func(*models.CommissionRule)) *models.CommissionRule {
+		change(&rule)
+		return &rule
+	}
+
+	tests := []struct {
+		name    string
+		rule    *models.CommissionRule
+		updated *models.CommissionRule
+		wantErr bool
+	}{
+		{"新建从当月生效", nil, &current, false},
+		{"新建不能追溯", nil, with(current, func(r *models.CommissionRule) { r.EffectiveFrom = &lastMonth }), true},
+		{"新建不能不限生效日期", nil, &legacy, true},
+		{"当月生效的规则可改比例", &current, with(current, func(r *models.CommissionRule) { r.Rate = 8 }), false},
+		{"当月生效的规则不能改为追溯", &current, with(current, func(r *models.CommissionRule) { r.EffectiveFrom = &lastMonth }), true},
+		{"已适用的规则可改名称和备注", &legacy, with(legacy, func(r *models.CommissionRule) { r.Name, r.Remark = "原默认", "停用" }), false},
+		{"已适用的规则不能改比例", &legacy, with(legacy, func(r *models.CommissionRule) { r.Rate = 6 }), true},
+		{"已适用的规则不能改条件", &legacy, with(legacy, func(r *models.CommissionRule) { r.FeeType = models.FeeTypeMonthly }), true},
+		{"已适用的规则可在上月末失效", &legacy, with(legacy, func(r *models.CommissionRule) { r.EffectiveTo = &lastMonthEnd }), false},
+		{"已适用的规则可在以后失效", &legacy, with(legacy, func(r *models.CommissionRule) { r.EffectiveTo = &nextMonth }), false},
+		{"失效日期不能早于上月末", &legacy, with(legacy, func(r *models.CommissionRule) { r.EffectiveTo = &lastMonth }), true},
+		{"早已失效的规则不能恢复", &ended, with(ended, func(r *models.CommissionRule) { r.EffectiveTo = nil }), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCommissionRuleChange(tt.rule, tt.updated)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,8 +1,16 @@
 package controllers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // Response 统一响应格式
@@ -46,3 +54,161 @@ func SuccessPaginatedResponse(c *gin.Context, total int64, items interface{}) {
 		},
 	})
 }
+
+// CurrentPersonID 获取当前操作人员ID
+// 在接入登录认证前，通过请求头 X-Person-ID 标识当前操作人员，未提供时返回nil
+func CurrentPersonID(c *gin.Context) *uint {
+	id, err := strconv.ParseUint(c.GetHeader("X-Person-ID"), 10, 32)
+	if err != nil || id == 0 {
+		return nil
+	}
+	personID := uint(id)
+	return &personID
+}
+
+// errVersionConflict 记录在读取后已被其他请求修改
+var errVersionConflict = errors.New("Version conflict: the record has been modified by another request, please reload and retry")
+
+// setETag 设置ETag响应头，值为记录的版本号
+func setETag(c *gin.Context, version uint) {
+	c.Header("ETag", fmt.Sprintf("\"%d\"", version))
+}
+
+// matchVersion 校验客户端修改所基于的版本号，不一致时返回409
+// 优先取 If-Match 请求头（"3" 或 W/"3"，* 表示不校验），其次取请求体中的 version，均未提供时不校验
+func matchVersion(c *gin.Context, current, bodyVersion uint) bool {
+	expected := bodyVersion
+	if ifMatch := strings.TrimSpace(c.GetHeader("If-Match")); ifMatch != "" {
+		if ifMatch == "*" {
+			return true
+		}
+		version, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), "\""), 10, 32)
+		if err != nil {
+			ErrorResponse(c, 400, "Invalid If-Match header: "+ifMatch)
+			return false
+		}
+		expected = uint(version)
+	}
+
+	if expected != 0 && expected != current {
+		setETag(c, current)
+		ErrorResponse(c, 409, fmt.Sprintf("Version conflict: current version is %d, request is based on version %d", current, expected))
+		return false
+	}
+	return true
+}
+
+// updateVersioned 以读取时的版本号为条件执行更新，values 中须已将版本号设为 current+1
+// 记录在此期间被其他请求修改时返回409
+func updateVersioned(c *gin.Context, query *gorm.DB, current uint, values interface{}) bool {
+	result := query.Where("version = ?", current).Updates(values)
+	if result.Error != nil {
+		ErrorResponse(c, 500, "Failed to update: "+result.Error.Error())
+		return false
+	}
+	if result.RowsAffected == 0 {
+		ErrorResponse(c, 409, errVersionConflict.Error())
+		return false
+	}
+	return true
+}
+
+// bumpVersion 版本号加1，用于系统维护字段（如关联ID）的更新
+func bumpVersion() interface{} {
+	return gorm.Expr("version + 1")
+}
+
+// patchFields PATCH 允许修改的字段：JSON字段名 → 数据库列名
+// 列名为空的字段只参与合并、不直接写入（如用于并发控制的 version）
+type patchFields map[string]string
+
+// bindMergePatch 按 JSON Merge Patch（RFC 7396）将请求体合并到 current 的JSON表示，结果解析到 patched
+// 值为 null 的字段清空为零值；请求中包含 allowed 以外的字段（如ID、时间戳）时返回400
+// 返回需要写入的数据库列
+func bindMergePatch(c *gin.Context, current, patched interface{}, allowed patchFields) ([]string, bool) {
+	var patch map[string]json.RawMessage
+	err := c.ShouldBindJSON(&patch)
+	var typeErr *json.UnmarshalTypeError
+	if err != nil && !errors.As(err, &typeErr) {
+		ErrorResponse(c, 400, "Invalid merge patch: "+err.Error())
+		return nil, false
+	}
+	if err != nil || patch == nil {
+		ErrorResponse(c, 400, "Invalid merge patch: request body must be a JSON object")
+		return nil, false
+	}
+
+	var columns []string
+	for field := range patch {
+		column, ok := allowed[field]
+		if !ok {
+			ErrorResponse(c, 400, "Field cannot be patched: "+field)
+			return nil, false
+		}
+		if column != "" {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		ErrorResponse(c, 400, "No fields to update")
+		return nil, false
+	}
+	sort.Strings(columns)
+
+	document, err := json.Marshal(current)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to encode record: "+err.Error())
+		return nil, false
+	}
+	var target map[string]interface{}
+	if err := decodeJSONValue(document, &target); err != nil {
+		ErrorResponse(c, 500, "Failed to encode record: "+err.Error())
+		return nil, false
+	}
+	for field, raw := range patch {
+		var value interface{}
+		if err := decodeJSONValue(raw, &value); err != nil {
+			ErrorResponse(c, 400, "Invalid merge patch: "+err.Error())
+			return nil, false
+		}
+		if value == nil {
+			delete(target, field)
+		} else {
+			target[field] = mergePatchValue(target[field], value)
+		}
+	}
+
+	merged, _ := json.Marshal(target)
+	if err := json.Unmarshal(merged, patched); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return nil, false
+	}
+	return columns, true
+}
+
+// mergePatchValue 合并单个值：对象逐个字段递归合并（null 表示删除该字段），其他类型直接替换
+func mergePatchValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatchValue(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
+
+// decodeJSONValue 解析JSON，数字保留原始文本以免大整数丢失精度
+func decodeJSONValue(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
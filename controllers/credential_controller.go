@@ -0,0 +1,696 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CredentialReminderTaskType 证照到期提醒任务的任务类型
+const CredentialReminderTaskType = "证照到期提醒"
+
+// defaultExpiringDays 即将到期查询的默认天数
+const defaultExpiringDays = 30
+
+// CreateCredential 创建证照记录
+func CreateCredential(c *gin.Context) {
+	var credential models.Credential
+	if err := c.ShouldBindJSON(&credential); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if err := validateCredential(&credential); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	credential.ReminderTaskID = nil
+
+	if err := config.DB.Create(&credential).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to create credential: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, credential)
+}
+
+// GetCredentials 获取证照列表
+func GetCredentials(c *gin.Context) {
+	var credentials []models.Credential
+	var total int64
+
+	// 获取查询参数
+	ownerType := c.Query("owner_type")
+	ownerID := c.Query("owner_id")
+	credentialType := c.Query("type")
+	expired := c.Query("expired")
+
+	query := config.DB.Model(&models.Credential{})
+
+	if ownerType != "" {
+		query = query.Where("owner_type = ?", ownerType)
+	}
+	if ownerID != "" {
+		query = query.Where("owner_id = ?", ownerID)
+	}
+	if credentialType != "" {
+		query = query.Where("type = ?", credentialType)
+	}
+	switch expired {
+	case "true":
+		query = query.Where("expiry_date < ?", startOfDay(time.Now()))
+	case "false":
+		query = query.Where("expiry_date >= ?", startOfDay(time.Now()))
+	}
+
+	// 获取总数
+	query.Count(&total)
+
+	// 获取列表
+	if err := query.Order("expiry_date ASC").Find(&credentials).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch credentials: "+err.Error())
+		return
+	}
+
+	SuccessPaginatedResponse(c, total, credentials)
+}
+
+// GetCredential 获取证照详情
+func GetCredential(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid credential ID")
+		return
+	}
+
+	var credential models.Credential
+	if err := config.DB.First(&credential, id).Error; err != nil {
+		ErrorResponse(c, 404, "Credential not found")
+		return
+	}
+
+	setETag(c, credential.Version)
+	SuccessResponse(c, credential)
+}
+
+// UpdateCredential 更新证照记录，到期日期变更（如续期）后完成原提醒任务，进入新的提醒期后重新生成
+func UpdateCredential(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid credential ID")
+		return
+	}
+
+	var credential models.Credential
+	if err := config.DB.First(&credential, id).Error; err != nil {
+		ErrorResponse(c, 404, "Credential not found")
+		return
+	}
+
+	updateData := credential
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+	if !matchVersion(c, credential.Version, updateData.Version) {
+		return
+	}
+	updateData.ID = credential.ID
+	updateData.ReminderTaskID = credential.ReminderTaskID
+	updateData.CreatedAt = credential.CreatedAt
+	updateData.Version = credential.Version + 1
+
+	if err := validateCredential(&updateData); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	// 到期日期变更后清除已生成的提醒
+	renewed := !updateData.ExpiryDate.Equal(credential.ExpiryDate)
+	if renewed {
+		updateData.ReminderTaskID = nil
+	}
+
+	if !updateVersioned(c, config.DB.Model(&credential).Select("*"), credential.Version, &updateData) {
+		return
+	}
+	if renewed {
+		closeExpiryReminders(models.ExpiryReminderSourceCredential, credential.ID, &updateData.ExpiryDate)
+	}
+
+	setETag(c, updateData.Version)
+	SuccessResponse(c, updateData)
+}
+
+// credentialPatchFields 证照可通过 PATCH 修改的字段，提醒任务由到期扫描维护
+var credentialPatchFields = patchFields{
+	"owner_type":    "owner_type",
+	"owner_id":      "owner_id",
+	"type":          "type",
+	"name":          "name",
+	"number":        "number",
+	"issue_date":    "issue_date",
+	"expiry_date":   "expiry_date",
+	"reminder_days": "reminder_days",
+	"customer_id":   "customer_id",
+	"document_id":   "document_id",
+	"remark":        "remark",
+	"version":       "",
+}
+
+// PatchCredential 部分更新证照（JSON Merge Patch），值为 null 的字段被清空（如取消关联文档）
+func PatchCredential(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid credential ID")
+		return
+	}
+
+	var credential models.Credential
+	if err := config.DB.First(&credential, id).Error; err != nil {
+		ErrorResponse(c, 404, "Credential not found")
+		return
+	}
+
+	var patched models.Credential
+	columns, ok := bindMergePatch(c, credential, &patched, credentialPatchFields)
+	if !ok {
+		return
+	}
+
+	if err := validateCredential(&patched); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if !matchVersion(c, credential.Version, patched.Version) {
+		return
+	}
+
+	// 到期日期变更后清除已生成的提醒
+	columns = append(columns, "version")
+	renewed := !patched.ExpiryDate.Equal(credential.ExpiryDate)
+	if renewed {
+		patched.ReminderTaskID = nil
+		columns = append(columns, "reminder_task_id")
+	}
+
+	patched.Version = credential.Version + 1
+	if !updateVersioned(c, config.DB.Model(&credential).Select(columns), credential.Version, &patched) {
+		return
+	}
+	if renewed {
+		closeExpiryReminders(models.ExpiryReminderSourceCredential, credential.ID, &patched.ExpiryDate)
+	}
+
+	config.DB.First(&credential, id)
+
+	setETag(c, credential.Version)
+	SuccessResponse(c, credential)
+}
+
+// DeleteCredential 删除证照记录
+func DeleteCredential(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid credential ID")
+		return
+	}
+
+	var credential models.Credential
+	if err := config.DB.First(&credential, id).Error; err != nil {
+		ErrorResponse(c, 404, "Credential not found")
+		return
+	}
+
+	if err := deleteCredential(&credential); err != nil {
+		ErrorResponse(c, 500, "Failed to delete credential: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "Credential deleted successfully"})
+}
+
+// ExpiringItem 即将到期的证照或文档
+type ExpiringItem struct {
+	Source         string    `json:"source"` // credential / document
+	ID             uint      `json:"id"`
+	OwnerType      string    `json:"owner_type"`
+	OwnerID        uint      `json:"owner_id"`
+	OwnerName      string    `json:"owner_name"`
+	Category       string    `json:"category"` // 证照类型或文档分类
+	Name           string    `json:"name"`
+	ExpiryDate     time.Time `json:"expiry_date"`
+	DaysLeft       int       `json:"days_left"` // 剩余天数，已过期为负数
+	ReminderTaskID *uint     `json:"reminder_task_id,omitempty"`
+}
+
+// GetExpiringItems 获取即将到期（含已过期）的证照和文档
+func GetExpiringItems(c *gin.Context) {
+	days := defaultExpiringDays
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			ErrorResponse(c, 400, "Invalid days")
+			return
+		}
+		days = parsed
+	}
+
+	today := startOfDay(time.Now())
+	deadline := today.AddDate(0, 0, days+1)
+
+	var credentials []models.Credential
+	if err := config.DB.Where("expiry_date < ?", deadline).Find(&credentials).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch credentials: "+err.Error())
+		return
+	}
+
+	var documents []models.Document
+	if err := config.DB.Where("is_latest = ? AND expiry_date IS NOT NULL AND expiry_date < ?", true, deadline).
+		Find(&documents).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch documents: "+err.Error())
+		return
+	}
+
+	names := newOwnerNameResolver()
+	items := []ExpiringItem{}
+	for _, credential := range credentials {
+		name := credential.Name
+		if name == "" {
+			name = string(credential.Type)
+		}
+		items = append(items, ExpiringItem{
+			Source:         "credential",
+			ID:             credential.ID,
+			OwnerType:      string(credential.OwnerType),
+			OwnerID:        credential.OwnerID,
+			OwnerName:      names.resolve(credential.OwnerType, credential.OwnerID),
+			Category:       string(credential.Type),
+			Name:           name,
+			ExpiryDate:     credential.ExpiryDate,
+			DaysLeft:       daysUntil(today, credential.ExpiryDate),
+			ReminderTaskID: credential.ReminderTaskID,
+		})
+	}
+	for _, document := range documents {
+		items = append(items, ExpiringItem{
+			Source:     "document",
+			ID:         document.ID,
+			OwnerType:  string(document.OwnerType),
+			OwnerID:    document.OwnerID,
+			OwnerName:  names.resolve(document.OwnerType, document.OwnerID),
+			Category:   string(document.Category),
+			Name:       document.Title,
+			ExpiryDate: *document.ExpiryDate,
+			DaysLeft:   daysUntil(today, *document.ExpiryDate),
+		})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].ExpiryDate.Before(items[j].ExpiryDate)
+	})
+
+	SuccessResponse(c, items)
+}
+
+// ScanCredentials 手动执行证照到期扫描
+func ScanCredentials(c *gin.Context) {
+	created, err := ScanExpiringCredentials()
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to scan credentials: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"created_tasks": created})
+}
+
+// ScanExpiringCredentials 为进入提醒期且尚未提醒的证照和文档生成提醒任务，返回生成的任务数
+// 由每日定时任务调用，按 来源+到期日期 去重，重复或并发执行不会重复生成
+func ScanExpiringCredentials() (int, error) {
+	today := startOfDay(time.Now())
+
+	var credentials []models.Credential
+	if err := config.DB.Where("reminder_task_id IS NULL").Find(&credentials).Error; err != nil {
+		return 0, err
+	}
+
+	// 已由证照记录跟踪有效期的扫描件不再单独提醒
+	var documents []models.Document
+	if err := config.DB.
+		Where("is_latest = ? AND expiry_date IS NOT NULL AND expiry_date < ?",
+			true, today.AddDate(0, 0, models.DefaultCredentialReminderDays+1)).
+		Where("id NOT IN (?)", config.DB.Model(&models.Credential{}).Select("document_id").Where("document_id IS NOT NULL")).
+		Find(&documents).Error; err != nil {
+		return 0, err
+	}
+
+	names := newOwnerNameResolver()
+	created := 0
+	for _, credential := range credentials {
+		reminderDays := credential.ReminderDays
+		if reminderDays <= 0 {
+			reminderDays = models.DefaultCredentialReminderDays
+		}
+		if daysUntil(today, credential.ExpiryDate) > reminderDays {
+			continue
+		}
+
+		customerID := credentialCustomerID(&credential)
+		if customerID == 0 {
+			log.Printf("Credential %d has no related customer, skip reminder", credential.ID)
+			continue
+		}
+
+		name := credential.Name
+		if name == "" {
+			name = string(credential.Type)
+		}
+		taskID, err := createExpiryReminder(models.ExpiryReminderSourceCredential, credential.ID, customerID,
+			name, credential.Number, names.resolve(credential.OwnerType, credential.OwnerID), credential.ExpiryDate, today)
+		if err != nil {
+			return created, err
+		}
+		if taskID == nil {
+			continue
+		}
+
+		if err := config.DB.Model(&credential).Update("reminder_task_id", *taskID).Error; err != nil {
+			return created, err
+		}
+		created++
+	}
+
+	for _, document := range documents {
+		customerID := documentCustomerID(&document)
+		if customerID == 0 {
+			log.Printf("Document %d has no related customer, skip reminder", document.ID)
+			continue
+		}
+
+		taskID, err := createExpiryReminder(models.ExpiryReminderSourceDocument, document.GroupID, customerID,
+			document.Title, "", names.resolve(document.OwnerType, document.OwnerID), *document.ExpiryDate, today)
+		if err != nil {
+			return created, err
+		}
+		if taskID != nil {
+			created++
+		}
+	}
+
+	if created > 0 {
+		log.Printf("Created %d credential reminder tasks", created)
+	}
+	return created, nil
+}
+
+// ============ 辅助函数 ============
+
+// validateCredential 校验证照数据
+func validateCredential(credential *models.Credential) error {
+	switch credential.OwnerType {
+	case models.DocumentOwnerCustomer, models.DocumentOwnerPerson:
+	default:
+		return fmt.Errorf("Invalid owner type: %s", credential.OwnerType)
+	}
+	if err := validateDocumentOwner(credential.OwnerType, credential.OwnerID); err != nil {
+		return err
+	}
+
+	switch credential.Type {
+	case models.CredentialTypeBusinessLicense, models.CredentialTypeTaxCertificate,
+		models.CredentialTypeIDCard, models.CredentialTypeOther:
+	default:
+		return fmt.Errorf("Invalid credential type: %s", credential.Type)
+	}
+
+	if credential.ExpiryDate.IsZero() {
+		return fmt.Errorf("Expiry date is required")
+	}
+	if credential.ReminderDays < 0 {
+		return fmt.Errorf("Reminder days must not be negative")
+	}
+	if credential.ReminderDays == 0 {
+		credential.ReminderDays = models.DefaultCredentialReminderDays
+	}
+
+	if credential.CustomerID != nil {
+		if err := validateDocumentOwner(models.DocumentOwnerCustomer, *credential.CustomerID); err != nil {
+			return err
+		}
+	}
+	if credential.DocumentID != nil {
+		var count int64
+		config.DB.Model(&models.Document{}).Where("id = ?", *credential.DocumentID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("Document %d not found", *credential.DocumentID)
+		}
+	}
+	return nil
+}
+
+// createExpiryReminder 登记 来源+到期日期 的提醒并生成提醒任务，已登记过时返回 nil
+// 先以唯一索引占位再建任务，并发扫描时只有一方能登记成功；建任务失败时撤销登记以便下次重试
+func createExpiryReminder(sourceType string, sourceID, customerID uint, name, number, ownerName string, expiryDate, today time.Time) (*uint, error) {
+	reminder := models.ExpiryReminder{
+		SourceType: sourceType,
+		SourceID:   sourceID,
+		ExpiryDate: expiryDateKey(expiryDate),
+	}
+	result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&reminder)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	daysLeft := daysUntil(today, expiryDate)
+	title := fmt.Sprintf("%s即将到期：%s", name, ownerName)
+	if daysLeft < 0 {
+		title = fmt.Sprintf("%s已过期：%s", name, ownerName)
+	}
+
+	priority := models.TaskPriorityNormal
+	if daysLeft <= 7 {
+		priority = models.TaskPriorityHigh
+	}
+
+	description := fmt.Sprintf("%s将于 %s 到期，请及时办理续期。", name, reminder.ExpiryDate)
+	if number != "" {
+		description = fmt.Sprintf("%s（编号：%s）将于 %s 到期，请及时办理续期。", name, number, reminder.ExpiryDate)
+	}
+
+	dueDate := expiryDate
+	task := models.Task{
+		CustomerID:  customerID,
+		Title:       title,
+		Description: description,
+		Type:        CredentialReminderTaskType,
+		Priority:    priority,
+		DueDate:     &dueDate,
+	}
+	if _, err := createSystemTask(&task); err != nil {
+		config.DB.Delete(&reminder)
+		return nil, err
+	}
+
+	if err := config.DB.Model(&reminder).Update("task_id", task.ID).Error; err != nil {
+		return nil, err
+	}
+	return &task.ID, nil
+}
+
+// deleteCredential 删除证照，同时完成其未关闭的提醒任务并清除提醒登记
+func deleteCredential(credential *models.Credential) error {
+	var records []*models.TaskTransition
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		records, err = closeExpiryReminderTasks(tx, models.ExpiryReminderSourceCredential, credential.ID, nil, "证照已删除")
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("source_type = ? AND source_id = ?", models.ExpiryReminderSourceCredential, credential.ID).
+			Delete(&models.ExpiryReminder{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(credential).Error
+	})
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		publishEvent(models.WebhookEventTaskTransitioned, record)
+	}
+	return nil
+}
+
+// deleteOwnerCredentials 删除客户或人员的全部证照
+func deleteOwnerCredentials(ownerType models.DocumentOwnerType, ownerID uint) {
+	var credentials []models.Credential
+	config.DB.Where("owner_type = ? AND owner_id = ?", ownerType, ownerID).Find(&credentials)
+	for i := range credentials {
+		if err := deleteCredential(&credentials[i]); err != nil {
+			log.Printf("Failed to delete credential %d: %v", credentials[i].ID, err)
+		}
+	}
+}
+
+// closeExpiryReminders 到期日期变更（续期）后完成该来源其他到期日期的未关闭提醒任务
+func closeExpiryReminders(sourceType string, sourceID uint, expiryDate *time.Time) {
+	comment := "到期日期已清除"
+	if expiryDate != nil {
+		comment = "已续期，到期日期更新为 " + expiryDateKey(*expiryDate)
+	}
+
+	var records []*models.TaskTransition
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		records, err = closeExpiryReminderTasks(tx, sourceType, sourceID, expiryDate, comment)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to close reminder tasks of %s %d: %v", sourceType, sourceID, err)
+		return
+	}
+	for _, record := range records {
+		publishEvent(models.WebhookEventTaskTransitioned, record)
+	}
+}
+
+// closeExpiryReminderTasks 在事务中将该来源的未关闭提醒任务流转到完成状态，
+// expiryDate 不为空时保留该到期日期的提醒；流转事件由调用方在提交后发布
+func closeExpiryReminderTasks(tx *gorm.DB, sourceType string, sourceID uint, expiryDate *time.Time, comment string) ([]*models.TaskTransition, error) {
+	query := tx.Where("source_type = ? AND source_id = ? AND task_id IS NOT NULL", sourceType, sourceID)
+	if expiryDate != nil {
+		query = query.Where("expiry_date <> ?", expiryDateKey(*expiryDate))
+	}
+
+	var reminders []models.ExpiryReminder
+	if err := query.Find(&reminders).Error; err != nil {
+		return nil, err
+	}
+
+	var records []*models.TaskTransition
+	for _, reminder := range reminders {
+		var task models.Task
+		if tx.Where("id = ?", *reminder.TaskID).Where(openTaskCondition()).First(&task).Error != nil {
+			continue
+		}
+
+		def := loadTaskWorkflow(task.Type)
+		from := task.Status
+		if from == "" {
+			from = def.InitialState
+		}
+		var target string
+		for _, state := range def.States {
+			if state.Category == models.TaskStateCategoryCompleted && def.findTransition(from, state.Key) != nil {
+				target = state.Key
+				break
+			}
+		}
+		if target == "" {
+			log.Printf("Reminder task %d: no transition from %s to a completed state", task.ID, from)
+			continue
+		}
+		record, err := applyTaskTransition(tx, &task, TaskTransitionRequest{To: target, Comment: comment}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to close reminder task %d: %v", task.ID, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// expiryDateKey 到期提醒登记使用的日期（本地时区 YYYY-MM-DD）
+func expiryDateKey(date time.Time) string {
+	return date.In(time.Local).Format("2006-01-02")
+}
+
+// documentCustomerID 文档提醒任务关联的客户：客户文档为客户本身，协议文档为协议所属客户，
+// 人员文档为其担任法人的企业，其次为持股的企业
+func documentCustomerID(document *models.Document) uint {
+	switch document.OwnerType {
+	case models.DocumentOwnerCustomer:
+		return document.OwnerID
+	case models.DocumentOwnerAgreement:
+		var agreement models.Agreement
+		if config.DB.Select("customer_id").First(&agreement, document.OwnerID).Error != nil {
+			return 0
+		}
+		return agreement.CustomerID
+	}
+	return credentialCustomerID(&models.Credential{OwnerType: document.OwnerType, OwnerID: document.OwnerID})
+}
+
+// credentialCustomerID 提醒任务关联的客户：客户证照为客户本身；
+// 人员证照优先使用指定客户，其次为担任法人的企业、持股的企业
+func credentialCustomerID(credential *models.Credential) uint {
+	if credential.OwnerType == models.DocumentOwnerCustomer {
+		return credential.OwnerID
+	}
+	if credential.CustomerID != nil {
+		return *credential.CustomerID
+	}
+
+	var person models.Person
+	if config.DB.First(&person, credential.OwnerID).Error != nil {
+		return 0
+	}
+	for _, ids := range []string{person.RepresentativeCustomerIDs, person.InvestorCustomerIDs} {
+		if customerIDs := StringToIDs(ids); len(customerIDs) > 0 {
+			return customerIDs[0]
+		}
+	}
+	return 0
+}
+
+// ownerNameResolver 查询并缓存客户/人员/协议名称
+type ownerNameResolver struct {
+	cache map[string]string
+}
+
+func newOwnerNameResolver() *ownerNameResolver {
+	return &ownerNameResolver{cache: make(map[string]string)}
+}
+
+// resolve 返回归属对象名称
+func (r *ownerNameResolver) resolve(ownerType models.DocumentOwnerType, ownerID uint) string {
+	key := fmt.Sprintf("%s:%d", ownerType, ownerID)
+	if name, ok := r.cache[key]; ok {
+		return name
+	}
+
+	var name string
+	switch ownerType {
+	case models.DocumentOwnerCustomer:
+		config.DB.Model(&models.Customer{}).Where("id = ?", ownerID).Select("name").Scan(&name)
+	case models.DocumentOwnerPerson:
+		config.DB.Model(&models.Person{}).Where("id = ?", ownerID).Select("name").Scan(&name)
+	case models.DocumentOwnerAgreement:
+		config.DB.Model(&models.Agreement{}).Where("id = ?", ownerID).Select("agreement_number").Scan(&name)
+	}
+	r.cache[key] = name
+	return name
+}
+
+// startOfDay 返回当天零点
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// daysUntil 计算从 today 到 date 所在日期的天数
+func daysUntil(today, date time.Time) int {
+	date = date.In(today.Location())
+	return int(math.Round(startOfDay(date).Sub(today).Hours() / 24))
+}
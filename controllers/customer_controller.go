@@ -4,9 +4,11 @@ import (
 	"erp/config"
 	"erp/models"
 	"encoding/json"
+	"fmt"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -18,13 +20,38 @@ func CreateCustomer(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Create(&customer).Error; err != nil {
+	if err := validateInvestors(customer.Investors, 0); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	// 未指定状态时默认为服务中，之后的状态变更须通过状态接口
+	if customer.Status == "" {
+		customer.Status = models.CustomerStatusActive
+	} else if !isValidCustomerStatus(customer.Status) {
+		ErrorResponse(c, 400, "Invalid status: "+string(customer.Status))
+		return
+	}
+	customer.StatusChangedAt = nil
+	// 税务档案须通过税务档案接口设置，以记录变更历史
+	customer.TaxProfile = nil
+
+	// 客户、初始状态记录及Person表关联字段在同一事务中写入
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&customer).Error; err != nil {
+			return err
+		}
+		if err := recordInitialCustomerStatus(tx, &customer, CurrentPersonID(c)); err != nil {
+			return err
+		}
+		return syncPersonRelations(tx, &customer)
+	})
+	if err != nil {
 		ErrorResponse(c, 500, "Failed to create customer: "+err.Error())
 		return
 	}
 
-	// 同步更新Person表的关联字段
-	syncPersonRelations(&customer)
+	publishEvent(models.WebhookEventCustomerCreated, customer)
 
 	SuccessResponse(c, customer)
 }
@@ -39,9 +66,18 @@ func GetCustomers(c *gin.Context) {
 	representative := c.Query("representative")
 	investor := c.Query("investor")
 	servicePerson := c.Query("service_person")
+	status := c.Query("status")
 
 	query := config.DB.Model(&models.Customer{})
 
+	// 按生命周期状态筛选
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	// 按税务档案筛选：纳税人类型、主管税务机关、税种及申报周期
+	query = filterCustomersByTax(query, c.Query)
+
 	// 按名称/税号/电话搜索
 	if keyword != "" {
 		query = query.Where("name LIKE ? OR tax_number LIKE ? OR phone LIKE ?",
@@ -67,7 +103,7 @@ func GetCustomers(c *gin.Context) {
 		}
 	}
 
-	// 按投资人搜索
+	// 按投资人搜索（自然人、本系统客户、外部法人）
 	if investor != "" {
 		// 通过JSON字段搜索
 		var customerIDs []uint
@@ -77,13 +113,25 @@ func GetCustomers(c *gin.Context) {
 			AND EXISTS (
 				SELECT 1 FROM json_each(investors)
 				WHERE json_valid(investors)
-				AND CAST(json_extract(value, '$.person_id') AS INTEGER) IN (
-					SELECT id FROM people
-					WHERE type IN ? AND (name LIKE ? OR phone LIKE ? OR id_card LIKE ?)
+				AND (
+					CAST(json_extract(value, '$.person_id') AS INTEGER) IN (
+						SELECT id FROM people
+						WHERE type IN ? AND (name LIKE ? OR phone LIKE ? OR id_card LIKE ?)
+					)
+					OR CAST(json_extract(value, '$.customer_id') AS INTEGER) IN (
+						SELECT c.id FROM customers c
+						WHERE c.name LIKE ? OR c.tax_number LIKE ?
+					)
+					OR CAST(json_extract(value, '$.entity_id') AS INTEGER) IN (
+						SELECT id FROM legal_entities
+						WHERE name LIKE ? OR credit_code LIKE ?
+					)
 				)
 			)
 		`, []models.PersonType{models.PersonTypeInvestor, models.PersonTypeMixed},
-			"%"+investor+"%", "%"+investor+"%", "%"+investor+"%").Scan(&customerIDs)
+			"%"+investor+"%", "%"+investor+"%", "%"+investor+"%",
+			"%"+investor+"%", "%"+investor+"%",
+			"%"+investor+"%", "%"+investor+"%").Scan(&customerIDs)
 
 		if len(customerIDs) > 0 {
 			query = query.Where("id IN ?", customerIDs)
@@ -125,7 +173,7 @@ func GetCustomers(c *gin.Context) {
 	query.Count(&total)
 
 	// 获取列表
-	if err := query.Find(&customers).Error; err != nil {
+	if err := query.Preload("TaxProfile.Obligations", orderByID).Find(&customers).Error; err != nil {
 		ErrorResponse(c, 500, "Failed to fetch customers: "+err.Error())
 		return
 	}
@@ -151,8 +199,9 @@ func GetCustomer(c *gin.Context) {
 	loadCustomerRelations(&customer)
 
 	// 加载原有关联
-	config.DB.Preload("Tasks").Preload("Payments").First(&customer, id)
+	config.DB.Preload("Tasks").Preload("Payments").Preload("TaxProfile.Obligations", orderByID).First(&customer, id)
 
+	setETag(c, customer.Version)
 	SuccessResponse(c, customer)
 }
 
@@ -176,16 +225,108 @@ func UpdateCustomer(c *gin.Context) {
 		return
 	}
 
-	// 更新字段
-	config.DB.Model(&customer).Updates(updateData)
+	if err := validateInvestors(updateData.Investors, customer.ID); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
 
-	// 同步更新Person表的关联字段
-	syncPersonRelations(&updateData)
+	if !matchVersion(c, customer.Version, updateData.Version) {
+		return
+	}
 
-	// 重新获取更新后的数据
+	// 更新字段（以读取时的版本为条件，防止覆盖他人的修改）
+	// 状态和税务档案只能通过各自的接口变更，这里忽略
+	before := customer
+	updateData.Status = ""
+	updateData.StatusChangedAt = nil
+	updateData.TaxProfile = nil
+	updateData.Version = customer.Version + 1
+	if !updateVersioned(c, config.DB.Model(&customer), customer.Version, updateData) {
+		return
+	}
+
+	// 重新获取更新后的数据，并同步更新Person表的关联字段
 	config.DB.First(&customer, id)
+	unlinkRemovedRelations(config.DB, &before, &customer)
+	syncPersonRelations(config.DB, &customer)
 	loadCustomerRelations(&customer)
 
+	publishEvent(models.WebhookEventCustomerUpdated, customer, StringToIDs(before.ServicePersonIDs)...)
+
+	setETag(c, customer.Version)
+	SuccessResponse(c, customer)
+}
+
+// customerPatchFields 客户可通过 PATCH 修改的字段
+var customerPatchFields = patchFields{
+	"name":               "name",
+	"phone":              "phone",
+	"address":            "address",
+	"tax_number":         "tax_number",
+	"type":               "type",
+	"representative_id":  "representative_id",
+	"investors":          "investors",
+	"service_person_ids": "service_person_ids",
+	"registered_capital": "registered_capital",
+	"version":            "",
+}
+
+// PatchCustomer 部分更新客户（JSON Merge Patch），值为 null 的字段被清空
+// 清除的法定代表人、投资人、服务人员同时从其反向关联中移除
+func PatchCustomer(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid customer ID")
+		return
+	}
+
+	var customer models.Customer
+	if err := config.DB.First(&customer, id).Error; err != nil {
+		ErrorResponse(c, 404, "Customer not found")
+		return
+	}
+
+	var patched models.Customer
+	columns, ok := bindMergePatch(c, customer, &patched, customerPatchFields)
+	if !ok {
+		return
+	}
+
+	if patched.Name == "" || patched.Type == "" {
+		ErrorResponse(c, 400, "Name and type are required")
+		return
+	}
+	if patched.RepresentativeID != nil {
+		var count int64
+		config.DB.Model(&models.Person{}).Where("id = ?", *patched.RepresentativeID).Count(&count)
+		if count == 0 {
+			ErrorResponse(c, 400, fmt.Sprintf("Representative person %d not found", *patched.RepresentativeID))
+			return
+		}
+	}
+	if err := validateInvestors(patched.Investors, customer.ID); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if !matchVersion(c, customer.Version, patched.Version) {
+		return
+	}
+
+	before := customer
+	patched.Version = customer.Version + 1
+	if !updateVersioned(c, config.DB.Model(&customer).Select(append(columns, "version")), customer.Version, &patched) {
+		return
+	}
+
+	config.DB.First(&customer, id)
+	unlinkRemovedRelations(config.DB, &before, &customer)
+	syncPersonRelations(config.DB, &customer)
+	loadCustomerRelations(&customer)
+
+	publishEvent(models.WebhookEventCustomerUpdated, customer, StringToIDs(before.ServicePersonIDs)...)
+
+	setETag(c, customer.Version)
 	SuccessResponse(c, customer)
 }
 
@@ -197,24 +338,71 @@ func DeleteCustomer(c *gin.Context) {
 		return
 	}
 
+	var customer models.Customer
+	if err := config.DB.First(&customer, id).Error; err != nil {
+		ErrorResponse(c, 404, "Customer not found")
+		return
+	}
+
+	// 仍被其他客户引用为企业股东时不允许删除
+	var count int64
+	config.DB.Raw(`
+		SELECT COUNT(*) FROM customers
+		WHERE id <> ?
+		AND investors IS NOT NULL
+		AND json_valid(investors)
+		AND EXISTS (
+			SELECT 1 FROM json_each(investors)
+			WHERE CAST(json_extract(value, '$.customer_id') AS INTEGER) = ?
+		)
+	`, id, id).Scan(&count)
+	if count > 0 {
+		ErrorResponse(c, 400, "Customer is still a corporate investor of other customers")
+		return
+	}
+
+	// 有预存余额、收款或发票的客户不允许删除，避免账户流水和财务记录失去归属
+	if balance := customerBalance(config.DB, uint(id)); balance != 0 {
+		ErrorResponse(c, 400, fmt.Sprintf("Customer has a prepaid balance of %.2f and cannot be deleted", balance))
+		return
+	}
+	config.DB.Model(&models.Payment{}).Where("customer_id = ?", id).Count(&count)
+	if count > 0 {
+		ErrorResponse(c, 400, "Customer has payments and cannot be deleted")
+		return
+	}
+	config.DB.Model(&models.Invoice{}).Where("customer_id = ?", id).Count(&count)
+	if count > 0 {
+		ErrorResponse(c, 400, "Customer has invoices and cannot be deleted")
+		return
+	}
+
 	if err := config.DB.Delete(&models.Customer{}, id).Error; err != nil {
 		ErrorResponse(c, 500, "Failed to delete customer: "+err.Error())
 		return
 	}
 
-	// 清理Person表中的关联ID
+	// 清理Person表等的关联ID
 	customerID := uint(id)
-	config.DB.Model(&models.Person{}).
-		Where("representative_customer_ids LIKE ?", "%,"+strconv.Itoa(int(customerID))+",%").
-		Update("representative_customer_ids", gorm.Expr("REPLACE(representative_customer_ids, ?, '')", ","+strconv.Itoa(int(customerID))+","))
+	removeCustomerLinksAll(&models.Person{}, "representative_customer_ids", customerID)
+	removeCustomerLinksAll(&models.Person{}, "investor_customer_ids", customerID)
+	removeCustomerLinksAll(&models.Person{}, "service_customer_ids", customerID)
+	removeCustomerLinksAll(&models.Customer{}, "invested_customer_ids", customerID)
+	removeCustomerLinksAll(&models.LegalEntity{}, "investor_customer_ids", customerID)
+
+	// 删除客户文档和证照
+	deleteOwnerDocuments(models.DocumentOwnerCustomer, customerID)
+	deleteOwnerCredentials(models.DocumentOwnerCustomer, customerID)
 
-	config.DB.Model(&models.Person{}).
-		Where("investor_customer_ids LIKE ?", "%,"+strconv.Itoa(int(customerID))+",%").
-		Update("investor_customer_ids", gorm.Expr("REPLACE(investor_customer_ids, ?, '')", ","+strconv.Itoa(int(customerID))+","))
+	// 删除税务档案及变更记录
+	config.DB.Where("customer_id = ?", customerID).Delete(&models.TaxObligation{})
+	config.DB.Where("customer_id = ?", customerID).Delete(&models.CustomerTaxProfile{})
+	config.DB.Where("customer_id = ?", customerID).Delete(&models.CustomerTaxProfileChange{})
 
-	config.DB.Model(&models.Person{}).
-		Where("service_customer_ids LIKE ?", "%,"+strconv.Itoa(int(customerID))+",%").
-		Update("service_customer_ids", gorm.Expr("REPLACE(service_customer_ids, ?, '')", ","+strconv.Itoa(int(customerID))+","))
+	// 删除余额为零的账户流水
+	config.DB.Where("customer_id = ?", customerID).Delete(&models.CustomerAccountEntry{})
+
+	publishEvent(models.WebhookEventCustomerDeleted, gin.H{"id": customerID, "service_person_ids": customer.ServicePersonIDs})
 
 	SuccessResponse(c, gin.H{"message": "Customer deleted successfully"})
 }
@@ -265,19 +453,36 @@ func loadCustomerRelations(customer *models.Customer) {
 		}
 	}
 
-	// 加载投资人列表
+	// 加载投资人列表（按投资人类型分别加载）
 	if customer.Investors != nil {
 		var investorInfos []models.InvestorInfo
 		if err := json.Unmarshal(customer.Investors, &investorInfos); err == nil {
-			var investorIDs []uint
+			var investorIDs, corporateIDs, entityIDs []uint
 			for _, info := range investorInfos {
-				investorIDs = append(investorIDs, info.PersonID)
+				switch info.ResolvedType() {
+				case models.InvestorTypePerson:
+					investorIDs = append(investorIDs, info.PersonID)
+				case models.InvestorTypeCustomer:
+					corporateIDs = append(corporateIDs, info.CustomerID)
+				case models.InvestorTypeEntity:
+					entityIDs = append(entityIDs, info.EntityID)
+				}
 			}
 			if len(investorIDs) > 0 {
 				var investors []models.Person
 				config.DB.Where("id IN ?", investorIDs).Find(&investors)
 				customer.InvestorList = investors
 			}
+			if len(corporateIDs) > 0 {
+				var corporates []models.Customer
+				config.DB.Where("id IN ?", corporateIDs).Find(&corporates)
+				customer.CorporateInvestors = corporates
+			}
+			if len(entityIDs) > 0 {
+				var entities []models.LegalEntity
+				config.DB.Where("id IN ?", entityIDs).Find(&entities)
+				customer.EntityInvestors = entities
+			}
 		}
 	}
 
@@ -302,50 +507,189 @@ func loadCustomerRelations(customer *models.Customer) {
 	}
 }
 
-// syncPersonRelations 同步更新Person表的客户关联字段
-func syncPersonRelations(customer *models.Customer) {
-	customerID := customer.ID
+// syncPersonRelations 同步更新法定代表人、投资人（人员、企业股东、外部法人）和服务人员的客户反向关联字段
+func syncPersonRelations(db *gorm.DB, customer *models.Customer) error {
+	links := collectCustomerLinks(customer)
+	for _, id := range links.representatives {
+		if err := addCustomerLink(db, &models.Person{}, id, "representative_customer_ids", customer.ID); err != nil {
+			return err
+		}
+	}
+	for _, id := range links.personInvestors {
+		if err := addCustomerLink(db, &models.Person{}, id, "investor_customer_ids", customer.ID); err != nil {
+			return err
+		}
+	}
+	for _, id := range links.corpInvestors {
+		if err := addCustomerLink(db, &models.Customer{}, id, "invested_customer_ids", customer.ID); err != nil {
+			return err
+		}
+	}
+	for _, id := range links.entityInvestors {
+		if err := addCustomerLink(db, &models.LegalEntity{}, id, "investor_customer_ids", customer.ID); err != nil {
+			return err
+		}
+	}
+	for _, id := range links.servicePersons {
+		if err := addCustomerLink(db, &models.Person{}, id, "service_customer_ids", customer.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// customerLinks 客户引用的人员、企业股东和外部法人
+type customerLinks struct {
+	representatives []uint
+	personInvestors []uint
+	corpInvestors   []uint
+	entityInvestors []uint
+	servicePersons  []uint
+}
 
-	// 更新法定代表人关联
+// collectCustomerLinks 收集客户引用的对象ID
+func collectCustomerLinks(customer *models.Customer) customerLinks {
+	var links customerLinks
 	if customer.RepresentativeID != nil {
-		var rep models.Person
-		if config.DB.First(&rep, *customer.RepresentativeID).Error == nil {
-			ids := StringToIDs(rep.RepresentativeCustomerIDs)
-			ids = appendUniqueID(ids, customerID)
-			rep.RepresentativeCustomerIDs = IDsToString(ids)
-			config.DB.Save(&rep)
+		links.representatives = []uint{*customer.RepresentativeID}
+	}
+	var investorInfos []models.InvestorInfo
+	if customer.Investors != nil && json.Unmarshal(customer.Investors, &investorInfos) == nil {
+		for _, info := range investorInfos {
+			switch info.ResolvedType() {
+			case models.InvestorTypePerson:
+				links.personInvestors = append(links.personInvestors, info.PersonID)
+			case models.InvestorTypeCustomer:
+				links.corpInvestors = append(links.corpInvestors, info.CustomerID)
+			case models.InvestorTypeEntity:
+				links.entityInvestors = append(links.entityInvestors, info.EntityID)
+			}
 		}
 	}
+	links.servicePersons = StringToIDs(customer.ServicePersonIDs)
+	return links
+}
 
-	// 更新投资人关联
-	if customer.Investors != nil {
-		var investorInfos []models.InvestorInfo
-		if err := json.Unmarshal(customer.Investors, &investorInfos); err == nil {
-			for _, info := range investorInfos {
-				var inv models.Person
-				if config.DB.First(&inv, info.PersonID).Error == nil {
-					ids := StringToIDs(inv.InvestorCustomerIDs)
-					ids = appendUniqueID(ids, customerID)
-					inv.InvestorCustomerIDs = IDsToString(ids)
-					config.DB.Save(&inv)
-				}
+// unlinkRemovedRelations 客户不再引用的法定代表人、投资人、服务人员，从其反向关联字段中移除该客户
+func unlinkRemovedRelations(db *gorm.DB, before, after *models.Customer) error {
+	old, current := collectCustomerLinks(before), collectCustomerLinks(after)
+	removals := []struct {
+		model  interface{}
+		ids    []uint
+		column string
+	}{
+		{&models.Person{}, subtractIDs(old.representatives, current.representatives), "representative_customer_ids"},
+		{&models.Person{}, subtractIDs(old.personInvestors, current.personInvestors), "investor_customer_ids"},
+		{&models.Customer{}, subtractIDs(old.corpInvestors, current.corpInvestors), "invested_customer_ids"},
+		{&models.LegalEntity{}, subtractIDs(old.entityInvestors, current.entityInvestors), "investor_customer_ids"},
+		{&models.Person{}, subtractIDs(old.servicePersons, current.servicePersons), "service_customer_ids"},
+	}
+	for _, removal := range removals {
+		for _, id := range removal.ids {
+			if err := removeCustomerLink(db, removal.model, id, removal.column, before.ID); err != nil {
+				return err
 			}
 		}
 	}
+	return nil
+}
 
-	// 更新服务人员关联
-	if customer.ServicePersonIDs != "" {
-		ids := StringToIDs(customer.ServicePersonIDs)
-		for _, personID := range ids {
-			var sp models.Person
-			if config.DB.First(&sp, personID).Error == nil {
-				customerIDs := StringToIDs(sp.ServiceCustomerIDs)
-				customerIDs = appendUniqueID(customerIDs, customerID)
-				sp.ServiceCustomerIDs = IDsToString(customerIDs)
-				config.DB.Save(&sp)
+// removeCustomerLink 从记录的逗号分隔客户ID字段中移除客户ID
+func removeCustomerLink(db *gorm.DB, model interface{}, id uint, column string, customerID uint) error {
+	var value string
+	if err := db.Model(model).Where("id = ?", id).Select(column).Scan(&value).Error; err != nil {
+		return err
+	}
+	updated := IDsToString(subtractIDs(StringToIDs(value), []uint{customerID}))
+	if updated == value {
+		return nil
+	}
+	return db.Model(model).Where("id = ?", id).Updates(map[string]interface{}{
+		column:    updated,
+		"version": bumpVersion(),
+	}).Error
+}
+
+// addCustomerLink 向记录的逗号分隔客户ID字段追加客户ID（已存在则跳过）
+func addCustomerLink(db *gorm.DB, model interface{}, id uint, column string, customerID uint) error {
+	var value string
+	if err := db.Model(model).Where("id = ?", id).Select(column).Scan(&value).Error; err != nil {
+		return err
+	}
+	updated := IDsToString(appendUniqueID(StringToIDs(value), customerID))
+	if updated == value {
+		return nil
+	}
+	return db.Model(model).Where("id = ?", id).Updates(map[string]interface{}{
+		column:    updated,
+		"version": bumpVersion(),
+	}).Error
+}
+
+// removeCustomerLinksAll 从所有记录的关联字段中移除客户ID（删除客户时使用）
+func removeCustomerLinksAll(model interface{}, column string, customerID uint) {
+	var ids []uint
+	config.DB.Model(model).Where(column+" LIKE ?", "%"+strconv.Itoa(int(customerID))+"%").Pluck("id", &ids)
+	for _, id := range ids {
+		removeCustomerLink(config.DB, model, id, column, customerID)
+	}
+}
+
+// subtractIDs 返回在 ids 中但不在 remove 中的ID
+func subtractIDs(ids, remove []uint) []uint {
+	var result []uint
+	for _, id := range ids {
+		found := false
+		for _, r := range remove {
+			if id == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// validateInvestors 校验投资人JSON：类型合法且引用的人员/客户/外部法人存在
+// selfID 为当前客户ID（新建时为0），企业不能作为自身的股东
+func validateInvestors(investors datatypes.JSON, selfID uint) error {
+	if investors == nil {
+		return nil
+	}
+	var investorInfos []models.InvestorInfo
+	if err := json.Unmarshal(investors, &investorInfos); err != nil {
+		return fmt.Errorf("Invalid investors: %v", err)
+	}
+
+	for _, info := range investorInfos {
+		var count int64
+		switch info.ResolvedType() {
+		case models.InvestorTypePerson:
+			config.DB.Model(&models.Person{}).Where("id = ?", info.PersonID).Count(&count)
+			if count == 0 {
+				return fmt.Errorf("Investor person %d not found", info.PersonID)
+			}
+		case models.InvestorTypeCustomer:
+			if selfID != 0 && info.CustomerID == selfID {
+				return fmt.Errorf("Customer cannot be its own investor")
+			}
+			config.DB.Model(&models.Customer{}).Where("id = ?", info.CustomerID).Count(&count)
+			if count == 0 {
+				return fmt.Errorf("Investor customer %d not found", info.CustomerID)
+			}
+		case models.InvestorTypeEntity:
+			config.DB.Model(&models.LegalEntity{}).Where("id = ?", info.EntityID).Count(&count)
+			if count == 0 {
+				return fmt.Errorf("Investor legal entity %d not found", info.EntityID)
 			}
+		default:
+			return fmt.Errorf("Invalid investor type: %s", info.InvestorType)
 		}
 	}
+	return nil
 }
 
 // appendUniqueID 追加ID到数组，避免重复
@@ -0,0 +1,550 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// customerStatusTransitions 允许的客户状态变更
+var customerStatusTransitions = map[models.CustomerStatus][]models.CustomerStatus{
+	models.CustomerStatusProspect:   {models.CustomerStatusOnboarding, models.CustomerStatusActive, models.CustomerStatusTerminated},
+	models.CustomerStatusOnboarding: {models.CustomerStatusActive, models.CustomerStatusSuspended, models.CustomerStatusTerminated},
+	models.CustomerStatusActive:     {models.CustomerStatusSuspended, models.CustomerStatusTerminated},
+	models.CustomerStatusSuspended:  {models.CustomerStatusActive, models.CustomerStatusTerminated},
+	models.CustomerStatusTerminated: {models.CustomerStatusOnboarding, models.CustomerStatusActive},
+}
+
+// CustomerStatusRequest 客户状态变更请求
+type CustomerStatusRequest struct {
+	Status        models.CustomerStatus `json:"status" binding:"required"`
+	EffectiveDate string                `json:"effective_date"` // 生效日期 YYYY-MM-DD，默认今天
+	Reason        string                `json:"reason"`         // 原因，暂停和终止时必填
+	Version       uint                  `json:"version"`        // 客户版本号
+}
+
+// CustomerStatusResult 客户状态变更结果
+type CustomerStatusResult struct {
+	Customer            models.Customer             `json:"customer"`
+	Change              models.CustomerStatusChange `json:"change"`
+	EndedAgreements     []uint                      `json:"ended_agreements"`     // 结束日期调整为终止日期的协议
+	CancelledAgreements []uint                      `json:"cancelled_agreements"` // 终止日期后才开始、被取消的协议
+	CancelledTasks      []uint                      `json:"cancelled_tasks"`      // 自动取消的任务
+	SkippedTasks        []BulkItemResult            `json:"skipped_tasks"`        // 流程不允许取消、需手动处理的任务
+}
+
+// ChangeCustomerStatus 变更客户生命周期状态
+// 终止时自动结束客户的有效协议并取消未完成任务
+func ChangeCustomerStatus(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid customer ID")
+		return
+	}
+
+	var customer models.Customer
+	if err := config.DB.First(&customer, id).Error; err != nil {
+		ErrorResponse(c, 404, "Customer not found")
+		return
+	}
+
+	var req CustomerStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if !isValidCustomerStatus(req.Status) {
+		ErrorResponse(c, 400, "Invalid status: "+string(req.Status))
+		return
+	}
+	from := customer.Status
+	if from == req.Status {
+		ErrorResponse(c, 400, "Customer is already in status "+string(req.Status))
+		return
+	}
+	if !containsCustomerStatus(customerStatusTransitions[from], req.Status) {
+		ErrorResponse(c, 400, fmt.Sprintf("Status change from %s to %s is not allowed", from, req.Status))
+		return
+	}
+	if req.Reason == "" && (req.Status == models.CustomerStatusSuspended || req.Status == models.CustomerStatusTerminated) {
+		ErrorResponse(c, 400, "Reason is required when suspending or terminating a customer")
+		return
+	}
+
+	today := startOfDay(time.Now())
+	effective := today
+	if req.EffectiveDate != "" {
+		t, err := time.ParseInLocation("2006-01-02", req.EffectiveDate, time.Local)
+		if err != nil {
+			ErrorResponse(c, 400, "Invalid effective_date, expected YYYY-MM-DD")
+			return
+		}
+		effective = t
+	}
+	if effective.After(today) {
+		ErrorResponse(c, 400, "effective_date cannot be in the future")
+		return
+	}
+	var last models.CustomerStatusChange
+	if config.DB.Where("customer_id = ?", customer.ID).Order("effective_date DESC, id DESC").First(&last).Error == nil &&
+		effective.Before(last.EffectiveDate) {
+		ErrorResponse(c, 400, "effective_date cannot be earlier than the previous status change on "+last.EffectiveDate.Format("2006-01-02"))
+		return
+	}
+
+	if !matchVersion(c, customer.Version, req.Version) {
+		return
+	}
+
+	operatorID := CurrentPersonID(c)
+	result := CustomerStatusResult{
+		EndedAgreements:     []uint{},
+		CancelledAgreements: []uint{},
+		CancelledTasks:      []uint{},
+		SkippedTasks:        []BulkItemResult{},
+	}
+	var events []bulkEvent
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		update := tx.Model(&models.Customer{}).Where("id = ? AND version = ?", customer.ID, customer.Version).
+			Updates(map[string]interface{}{"status": req.Status, "status_changed_at": effective, "version": customer.Version + 1})
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return errVersionConflict
+		}
+
+		if req.Status == models.CustomerStatusTerminated {
+			var err error
+			if events, err = terminateCustomerRecords(tx, &customer, effective, req.Reason, operatorID, &result); err != nil {
+				return err
+			}
+		}
+
+		result.Change = models.CustomerStatusChange{
+			CustomerID:      customer.ID,
+			FromStatus:      from,
+			ToStatus:        req.Status,
+			EffectiveDate:   effective,
+			Reason:          req.Reason,
+			OperatorID:      operatorID,
+			EndedAgreements: len(result.EndedAgreements) + len(result.CancelledAgreements),
+			CancelledTasks:  len(result.CancelledTasks),
+		}
+		return tx.Create(&result.Change).Error
+	})
+	if err == errVersionConflict {
+		ErrorResponse(c, 409, err.Error())
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to change customer status: "+err.Error())
+		return
+	}
+
+	config.DB.First(&result.Customer, id)
+
+	for _, event := range events {
+		publishEvent(event.eventType, event.data, event.audience...)
+	}
+	publishEvent(models.WebhookEventCustomerStatus, gin.H{
+		"customer_id":    customer.ID,
+		"from_status":    from,
+		"to_status":      req.Status,
+		"effective_date": effective,
+		"reason":         req.Reason,
+	})
+
+	setETag(c, result.Customer.Version)
+	SuccessResponse(c, result)
+}
+
+// GetCustomerStatusHistory 获取客户状态变更记录
+func GetCustomerStatusHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid customer ID")
+		return
+	}
+
+	var changes []models.CustomerStatusChange
+	if err := config.DB.Preload("Operator").Where("customer_id = ?", id).
+		Order("effective_date ASC, id ASC").Find(&changes).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch status history: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, changes)
+}
+
+// ============ 流失与留存统计 ============
+
+// CustomerChurnMonth 月度客户流失情况
+type CustomerChurnMonth struct {
+	Month       string   `json:"month"`
+	ActiveStart int      `json:"active_start"` // 月初在服务客户数（建账中/服务中/暂停服务）
+	Acquired    int      `json:"acquired"`     // 新转为在服务的客户（含终止后重新合作）
+	Churned     int      `json:"churned"`      // 终止合作的客户
+	ActiveEnd   int      `json:"active_end"`   // 月末在服务客户数
+	ChurnRate   *float64 `json:"churn_rate"`   // 流失率（%）= 流失 ÷ 月初在服务，月初为0时为null
+}
+
+// CustomerChurnReason 终止原因统计
+type CustomerChurnReason struct {
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+// CustomerChurnStats 客户流失统计
+type CustomerChurnStats struct {
+	StartMonth       string                `json:"start_month"`
+	EndMonth         string                `json:"end_month"`
+	Acquired         int                   `json:"acquired"`
+	Churned          int                   `json:"churned"`
+	AverageChurnRate *float64              `json:"average_churn_rate"` // 各月流失率的平均值
+	Months           []CustomerChurnMonth  `json:"months"`
+	Reasons          []CustomerChurnReason `json:"reasons"`
+}
+
+// CustomerCohort 按开始服务月份划分的客户群
+type CustomerCohort struct {
+	Cohort        string    `json:"cohort"`         // 开始服务的月份
+	Size          int       `json:"size"`           // 客户数
+	Retained      []int     `json:"retained"`       // 第 N 个月末仍在服务的客户数，下标0为当月
+	RetentionRate []float64 `json:"retention_rate"` // 对应的留存率（%）
+}
+
+// GetCustomerChurnStats 获取按月的客户流失统计及终止原因
+func GetCustomerChurnStats(c *gin.Context) {
+	start, end, ok := parseLifecycleMonths(c)
+	if !ok {
+		return
+	}
+
+	timelines, err := loadCustomerTimelines()
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to load status history: "+err.Error())
+		return
+	}
+
+	stats := CustomerChurnStats{
+		StartMonth: start.Format("2006-01"),
+		EndMonth:   end.AddDate(0, -1, 0).Format("2006-01"),
+		Months:     []CustomerChurnMonth{},
+		Reasons:    []CustomerChurnReason{},
+	}
+	reasons := map[string]int{}
+	var rateSum float64
+	var rateCount int
+	for month := start; month.Before(end); month = month.AddDate(0, 1, 0) {
+		monthEnd := month.AddDate(0, 1, 0)
+		row := CustomerChurnMonth{Month: month.Format("2006-01")}
+		for _, timeline := range timelines {
+			if inService(timeline.statusBefore(month)) {
+				row.ActiveStart++
+			}
+			if inService(timeline.statusBefore(monthEnd)) {
+				row.ActiveEnd++
+			}
+			for _, point := range timeline {
+				if point.date.Before(month) || !point.date.Before(monthEnd) {
+					continue
+				}
+				switch {
+				case inService(point.to) && !inService(point.from):
+					row.Acquired++
+				case point.to == models.CustomerStatusTerminated && inService(point.from):
+					row.Churned++
+					reason := point.reason
+					if reason == "" {
+						reason = "未填写"
+					}
+					reasons[reason]++
+				}
+			}
+		}
+		if row.ActiveStart > 0 {
+			rate := math.Round(float64(row.Churned)*10000/float64(row.ActiveStart)) / 100
+			row.ChurnRate = &rate
+			rateSum += rate
+			rateCount++
+		}
+		stats.Acquired += row.Acquired
+		stats.Churned += row.Churned
+		stats.Months = append(stats.Months, row)
+	}
+	if rateCount > 0 {
+		average := math.Round(rateSum*100/float64(rateCount)) / 100
+		stats.AverageChurnRate = &average
+	}
+
+	for reason, count := range reasons {
+		stats.Reasons = append(stats.Reasons, CustomerChurnReason{Reason: reason, Count: count})
+	}
+	sort.Slice(stats.Reasons, func(i, j int) bool {
+		if stats.Reasons[i].Count != stats.Reasons[j].Count {
+			return stats.Reasons[i].Count > stats.Reasons[j].Count
+		}
+		return stats.Reasons[i].Reason < stats.Reasons[j].Reason
+	})
+
+	SuccessResponse(c, stats)
+}
+
+// GetCustomerRetentionStats 获取按开始服务月份划分的客户留存情况
+func GetCustomerRetentionStats(c *gin.Context) {
+	start, end, ok := parseLifecycleMonths(c)
+	if !ok {
+		return
+	}
+
+	timelines, err := loadCustomerTimelines()
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to load status history: "+err.Error())
+		return
+	}
+
+	// 观察截止到区间结束或当月末（取较早者）
+	observeEnd := end
+	if current := revenueMonth(time.Now()).AddDate(0, 1, 0); current.Before(observeEnd) {
+		observeEnd = current
+	}
+
+	cohorts := map[string]*CustomerCohort{}
+	members := map[string][]customerTimeline{}
+	for _, timeline := range timelines {
+		joined := timeline.firstInService()
+		if joined == nil || joined.Before(start) || !joined.Before(end) {
+			continue
+		}
+		label := joined.Format("2006-01")
+		if cohorts[label] == nil {
+			cohorts[label] = &CustomerCohort{Cohort: label}
+		}
+		cohorts[label].Size++
+		members[label] = append(members[label], timeline)
+	}
+
+	result := []CustomerCohort{}
+	for month := start; month.Before(end); month = month.AddDate(0, 1, 0) {
+		cohort := cohorts[month.Format("2006-01")]
+		if cohort == nil {
+			continue
+		}
+		for offset := month.AddDate(0, 1, 0); !offset.After(observeEnd); offset = offset.AddDate(0, 1, 0) {
+			retained := 0
+			for _, timeline := range members[cohort.Cohort] {
+				if inService(timeline.statusBefore(offset)) {
+					retained++
+				}
+			}
+			cohort.Retained = append(cohort.Retained, retained)
+			cohort.RetentionRate = append(cohort.RetentionRate, math.Round(float64(retained)*10000/float64(cohort.Size))/100)
+		}
+		result = append(result, *cohort)
+	}
+
+	SuccessResponse(c, gin.H{
+		"start_month": start.Format("2006-01"),
+		"end_month":   end.AddDate(0, -1, 0).Format("2006-01"),
+		"cohorts":     result,
+	})
+}
+
+// ============ 辅助函数 ============
+
+// isValidCustomerStatus 检查客户状态是否有效
+func isValidCustomerStatus(status models.CustomerStatus) bool {
+	_, ok := customerStatusTransitions[status]
+	return ok
+}
+
+// containsCustomerStatus 检查状态列表中是否包含指定状态
+func containsCustomerStatus(statuses []models.CustomerStatus, status models.CustomerStatus) bool {
+	for _, item := range statuses {
+		if item == status {
+			return true
+		}
+	}
+	return false
+}
+
+// inService 是否为在服务状态（建账中、服务中、暂停服务）
+func inService(status models.CustomerStatus) bool {
+	return status == models.CustomerStatusOnboarding || status == models.CustomerStatusActive ||
+		status == models.CustomerStatusSuspended
+}
+
+// inServiceCustomerStatuses 在服务状态列表，用于查询条件
+func inServiceCustomerStatuses() []models.CustomerStatus {
+	return []models.CustomerStatus{models.CustomerStatusOnboarding, models.CustomerStatusActive, models.CustomerStatusSuspended}
+}
+
+// recordInitialCustomerStatus 记录新建客户的初始状态
+func recordInitialCustomerStatus(db *gorm.DB, customer *models.Customer, operatorID *uint) error {
+	return db.Create(&models.CustomerStatusChange{
+		CustomerID:    customer.ID,
+		ToStatus:      customer.Status,
+		EffectiveDate: startOfDay(customer.CreatedAt),
+		OperatorID:    operatorID,
+	}).Error
+}
+
+// terminateCustomerRecords 终止合作时处理客户的协议和任务：
+// 终止日期后才开始的有效协议改为已取消，其余有效协议结束日期截至终止日期并改为已过期；
+// 未完成任务流转到其流程的已取消状态，流程不允许时跳过
+func terminateCustomerRecords(tx *gorm.DB, customer *models.Customer, effective time.Time, reason string, operatorID *uint, result *CustomerStatusResult) ([]bulkEvent, error) {
+	var events []bulkEvent
+
+	var agreements []models.Agreement
+	if err := tx.Where("customer_id = ? AND status = ?", customer.ID, models.AgreementStatusActive).
+		Order("id ASC").Find(&agreements).Error; err != nil {
+		return nil, err
+	}
+	for _, agreement := range agreements {
+		updates := map[string]interface{}{"version": bumpVersion()}
+		if agreement.StartDate.After(effective) {
+			updates["status"] = models.AgreementStatusCancelled
+			result.CancelledAgreements = append(result.CancelledAgreements, agreement.ID)
+		} else {
+			updates["status"] = models.AgreementStatusExpired
+			if agreement.EndDate.IsZero() || agreement.EndDate.After(effective) {
+				updates["end_date"] = effective
+			}
+			result.EndedAgreements = append(result.EndedAgreements, agreement.ID)
+		}
+		if err := tx.Model(&models.Agreement{}).Where("id = ?", agreement.ID).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+		tx.First(&agreement, agreement.ID)
+		events = append(events, bulkEvent{eventType: models.WebhookEventAgreementUpdated, data: agreement})
+	}
+
+	var tasks []models.Task
+	if err := tx.Where("customer_id = ?", customer.ID).Where(openTaskCondition()).
+		Order("id ASC").Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	comment := "客户终止合作：" + reason
+	for i := range tasks {
+		task := &tasks[i]
+		def := loadTaskWorkflow(task.Type)
+		from := task.Status
+		if from == "" {
+			from = def.InitialState
+		}
+
+		var target string
+		for _, state := range def.States {
+			if state.Category == models.TaskStateCategoryCancelled && def.findTransition(from, state.Key) != nil {
+				target = state.Key
+				break
+			}
+		}
+		if target == "" {
+			result.SkippedTasks = append(result.SkippedTasks, BulkItemResult{ID: task.ID, Status: "skipped",
+				Message: fmt.Sprintf("No transition from %s to a cancelled state", from)})
+			continue
+		}
+
+		tx.SavePoint("task")
+		record, err := applyTaskTransition(tx, task, TaskTransitionRequest{To: target, Comment: comment}, operatorID)
+		if err != nil {
+			tx.RollbackTo("task")
+			result.SkippedTasks = append(result.SkippedTasks, BulkItemResult{ID: task.ID, Status: "skipped", Message: err.Error()})
+			continue
+		}
+		result.CancelledTasks = append(result.CancelledTasks, task.ID)
+		events = append(events, bulkEvent{eventType: models.WebhookEventTaskTransitioned, data: record})
+	}
+
+	return events, nil
+}
+
+// statusPoint 客户状态时间线上的一次变更
+type statusPoint struct {
+	date   time.Time
+	from   models.CustomerStatus
+	to     models.CustomerStatus
+	reason string
+}
+
+// customerTimeline 客户的状态时间线，按生效日期排序
+type customerTimeline []statusPoint
+
+// statusBefore 返回 t 之前最后生效的状态，t 之前尚无记录时为空
+func (t customerTimeline) statusBefore(at time.Time) models.CustomerStatus {
+	var status models.CustomerStatus
+	for _, point := range t {
+		if !point.date.Before(at) {
+			break
+		}
+		status = point.to
+	}
+	return status
+}
+
+// firstInService 返回首次进入在服务状态的月份
+func (t customerTimeline) firstInService() *time.Time {
+	for _, point := range t {
+		if inService(point.to) {
+			month := revenueMonth(point.date)
+			return &month
+		}
+	}
+	return nil
+}
+
+// loadCustomerTimelines 加载所有客户的状态时间线
+// 早于状态记录功能创建的客户没有初始记录，以创建日期和当时状态（首条变更的原状态或当前状态）补齐
+func loadCustomerTimelines() (map[uint]customerTimeline, error) {
+	var customers []models.Customer
+	if err := config.DB.Select("id", "status", "created_at").Find(&customers).Error; err != nil {
+		return nil, err
+	}
+	var changes []models.CustomerStatusChange
+	if err := config.DB.Order("effective_date ASC, id ASC").Find(&changes).Error; err != nil {
+		return nil, err
+	}
+	byCustomer := map[uint][]models.CustomerStatusChange{}
+	for _, change := range changes {
+		byCustomer[change.CustomerID] = append(byCustomer[change.CustomerID], change)
+	}
+
+	timelines := make(map[uint]customerTimeline, len(customers))
+	for _, customer := range customers {
+		var timeline customerTimeline
+		records := byCustomer[customer.ID]
+		if len(records) == 0 || records[0].FromStatus != "" {
+			initial := customer.Status
+			if len(records) > 0 {
+				initial = records[0].FromStatus
+			}
+			timeline = append(timeline, statusPoint{date: startOfDay(customer.CreatedAt), to: initial})
+		}
+		for _, record := range records {
+			timeline = append(timeline, statusPoint{date: record.EffectiveDate, from: record.FromStatus, to: record.ToStatus, reason: record.Reason})
+		}
+		timelines[customer.ID] = timeline
+	}
+	return timelines, nil
+}
+
+// parseLifecycleMonths 解析 start_month/end_month，默认最近12个月
+func parseLifecycleMonths(c *gin.Context) (time.Time, time.Time, bool) {
+	current := revenueMonth(time.Now())
+	filter := revenueFilter{start: current.AddDate(0, -11, 0), end: current.AddDate(0, 1, 0)}
+	if !parseRevenueMonths(c, &filter) {
+		return filter.start, filter.end, false
+	}
+	return filter.start, filter.end, true
+}
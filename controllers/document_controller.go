@@ -0,0 +1,737 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"erp/config"
+	"erp/models"
+	"erp/services/storage"
+	"erp/utils"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultDownloadURLTTL = 10 * time.Minute   // 下载链接默认有效期
+	maxDownloadURLTTL     = 7 * 24 * time.Hour // 下载链接最长有效期
+)
+
+// GetDocumentCategories 获取文档分类列表
+func GetDocumentCategories(c *gin.Context) {
+	SuccessResponse(c, models.DocumentCategories)
+}
+
+// GetDocuments 获取文档列表（默认仅返回各文档的最新版本）
+func GetDocuments(c *gin.Context) {
+	var documents []models.Document
+	var total int64
+
+	// 获取查询参数
+	ownerType := c.Query("owner_type")
+	ownerID := c.Query("owner_id")
+	category := c.Query("category")
+	keyword := c.Query("keyword")
+	expiringWithin := c.Query("expiring_within")
+	allVersions := c.Query("all_versions") == "true"
+
+	query := config.DB.Model(&models.Document{})
+
+	if !allVersions {
+		query = query.Where("is_latest = ?", true)
+	}
+	if ownerType != "" {
+		query = query.Where("owner_type = ?", ownerType)
+	}
+	if ownerID != "" {
+		query = query.Where("owner_id = ?", ownerID)
+	}
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if keyword != "" {
+		query = query.Where("title LIKE ? OR file_name LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+	}
+	// 指定天数内到期（含已过期）
+	if expiringWithin != "" {
+		days, err := strconv.Atoi(expiringWithin)
+		if err != nil || days < 0 {
+			ErrorResponse(c, 400, "Invalid expiring_within")
+			return
+		}
+		query = query.Where("expiry_date IS NOT NULL AND expiry_date <= ?", time.Now().AddDate(0, 0, days))
+	}
+
+	// 获取总数
+	query.Count(&total)
+
+	// 获取列表
+	if err := query.Order("created_at DESC").Find(&documents).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch documents: "+err.Error())
+		return
+	}
+
+	SuccessPaginatedResponse(c, total, documents)
+}
+
+// GetDocument 获取文档详情
+func GetDocument(c *gin.Context) {
+	document, ok := findDocument(c)
+	if !ok {
+		return
+	}
+
+	setETag(c, document.Revision)
+	SuccessResponse(c, document)
+}
+
+// UploadDocument 上传文档
+// 表单字段：file、owner_type、owner_id、category、title、expiry_date、remark
+func UploadDocument(c *gin.Context) {
+	ownerType := models.DocumentOwnerType(c.PostForm("owner_type"))
+	ownerID, err := strconv.ParseUint(c.PostForm("owner_id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid owner ID")
+		return
+	}
+	if err := validateDocumentOwner(ownerType, uint(ownerID)); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	category := models.DocumentCategory(c.DefaultPostForm("category", string(models.DocumentCategoryOther)))
+	if !isValidDocumentCategory(category) {
+		ErrorResponse(c, 400, "Invalid document category: "+string(category))
+		return
+	}
+
+	expiryDate, err := parseDocumentDate(c.PostForm("expiry_date"))
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid expiry_date: "+err.Error())
+		return
+	}
+
+	blob, err := storeDocumentBlob(c)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	// 同一对象下内容相同的文档只保留一份
+	var existing models.Document
+	if err := config.DB.Where("owner_type = ? AND owner_id = ? AND sha256 = ? AND is_latest = ?",
+		ownerType, ownerID, blob.SHA256, true).First(&existing).Error; err == nil {
+		ErrorResponse(c, 409, fmt.Sprintf("Identical document already exists (id: %d)", existing.ID))
+		return
+	}
+
+	title := c.PostForm("title")
+	if title == "" {
+		title = blob.FileName
+	}
+
+	document := models.Document{
+		Version:     1,
+		IsLatest:    true,
+		OwnerType:   ownerType,
+		OwnerID:     uint(ownerID),
+		Category:    category,
+		Title:       title,
+		FileName:    blob.FileName,
+		ContentType: blob.ContentType,
+		Size:        blob.Size,
+		SHA256:      blob.SHA256,
+		StorageKey:  blob.StorageKey,
+		ExpiryDate:  expiryDate,
+		Remark:      c.PostForm("remark"),
+		UploadedBy:  CurrentPersonID(c),
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&document).Error; err != nil {
+			return err
+		}
+		document.GroupID = document.ID
+		return tx.Model(&document).Update("group_id", document.ID).Error
+	})
+	if err != nil {
+		discardDocumentBlob(blob)
+		ErrorResponse(c, 500, "Failed to create document: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, document)
+}
+
+// UpdateDocumentRequest 更新文档元数据请求
+type UpdateDocumentRequest struct {
+	Title      string                  `json:"title"`
+	Category   models.DocumentCategory `json:"category"`
+	ExpiryDate *string                 `json:"expiry_date"` // 传空字符串清除到期日期
+	Remark     *string                 `json:"remark"`
+	Revision   uint                    `json:"revision"` // 更新时所基于的修订号（也可使用 If-Match 请求头）
+}
+
+// UpdateDocument 更新文档元数据
+func UpdateDocument(c *gin.Context) {
+	document, ok := findDocument(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Title != "" {
+		updates["title"] = req.Title
+	}
+	if req.Category != "" {
+		if !isValidDocumentCategory(req.Category) {
+			ErrorResponse(c, 400, "Invalid document category: "+string(req.Category))
+			return
+		}
+		updates["category"] = req.Category
+	}
+	if req.ExpiryDate != nil {
+		expiryDate, err := parseDocumentDate(*req.ExpiryDate)
+		if err != nil {
+			ErrorResponse(c, 400, "Invalid expiry_date: "+err.Error())
+			return
+		}
+		updates["expiry_date"] = expiryDate
+	}
+	if req.Remark != nil {
+		updates["remark"] = *req.Remark
+	}
+
+	if !matchVersion(c, document.Revision, req.Revision) {
+		return
+	}
+
+	previousExpiry := copyTime(document.ExpiryDate)
+	if len(updates) > 0 {
+		// 文档的 version 为文件版本，元数据以 revision 作为乐观锁
+		updates["revision"] = document.Revision + 1
+		result := config.DB.Model(&document).Where("revision = ?", document.Revision).Updates(updates)
+		if result.Error != nil {
+			ErrorResponse(c, 500, "Failed to update document: "+result.Error.Error())
+			return
+		}
+		if result.RowsAffected == 0 {
+			ErrorResponse(c, 409, errVersionConflict.Error())
+			return
+		}
+	}
+
+	config.DB.First(&document, document.ID)
+	closeRenewedDocumentReminders(document, previousExpiry)
+
+	setETag(c, document.Revision)
+	SuccessResponse(c, document)
+}
+
+// documentPatchFields 文档可通过 PATCH 修改的元数据字段，文件内容通过上传新版本修改
+var documentPatchFields = patchFields{
+	"title":       "title",
+	"category":    "category",
+	"expiry_date": "expiry_date",
+	"remark":      "remark",
+	"revision":    "",
+}
+
+// PatchDocument 部分更新文档元数据（JSON Merge Patch），值为 null 的字段被清空
+func PatchDocument(c *gin.Context) {
+	document, ok := findDocument(c)
+	if !ok {
+		return
+	}
+
+	var patched models.Document
+	columns, ok := bindMergePatch(c, document, &patched, documentPatchFields)
+	if !ok {
+		return
+	}
+
+	if !isValidDocumentCategory(patched.Category) {
+		ErrorResponse(c, 400, "Invalid document category: "+string(patched.Category))
+		return
+	}
+
+	if !matchVersion(c, document.Revision, patched.Revision) {
+		return
+	}
+
+	previousExpiry := copyTime(document.ExpiryDate)
+	// 文档的 version 为文件版本，元数据以 revision 作为乐观锁
+	patched.Revision = document.Revision + 1
+	result := config.DB.Model(&document).
+		Select(append(columns, "revision")).
+		Where("revision = ?", document.Revision).
+		Updates(&patched)
+	if result.Error != nil {
+		ErrorResponse(c, 500, "Failed to update document: "+result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		ErrorResponse(c, 409, errVersionConflict.Error())
+		return
+	}
+
+	config.DB.First(&document, document.ID)
+	closeRenewedDocumentReminders(document, previousExpiry)
+
+	setETag(c, document.Revision)
+	SuccessResponse(c, document)
+}
+
+// DeleteDocument 删除文档（包括所有版本）
+func DeleteDocument(c *gin.Context) {
+	document, ok := findDocument(c)
+	if !ok {
+		return
+	}
+
+	if err := deleteDocumentGroups([]uint{document.GroupID}); err != nil {
+		ErrorResponse(c, 500, "Failed to delete document: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "Document deleted successfully"})
+}
+
+// UploadDocumentVersion 上传文档新版本
+// 表单字段：file，可选 title、expiry_date、remark（未提供时沿用上一版本）
+func UploadDocumentVersion(c *gin.Context) {
+	document, ok := findDocument(c)
+	if !ok {
+		return
+	}
+
+	var latest models.Document
+	if err := config.DB.Where("group_id = ? AND is_latest = ?", document.GroupID, true).First(&latest).Error; err != nil {
+		ErrorResponse(c, 404, "Document not found")
+		return
+	}
+
+	expiryDate := latest.ExpiryDate
+	if value, exists := c.GetPostForm("expiry_date"); exists {
+		parsed, err := parseDocumentDate(value)
+		if err != nil {
+			ErrorResponse(c, 400, "Invalid expiry_date: "+err.Error())
+			return
+		}
+		expiryDate = parsed
+	}
+
+	blob, err := storeDocumentBlob(c)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	if blob.SHA256 == latest.SHA256 {
+		ErrorResponse(c, 409, "File is identical to the latest version")
+		return
+	}
+
+	version := models.Document{
+		GroupID:     latest.GroupID,
+		Version:     latest.Version + 1,
+		IsLatest:    true,
+		OwnerType:   latest.OwnerType,
+		OwnerID:     latest.OwnerID,
+		Category:    latest.Category,
+		Title:       c.DefaultPostForm("title", latest.Title),
+		FileName:    blob.FileName,
+		ContentType: blob.ContentType,
+		Size:        blob.Size,
+		SHA256:      blob.SHA256,
+		StorageKey:  blob.StorageKey,
+		ExpiryDate:  expiryDate,
+		Remark:      c.DefaultPostForm("remark", latest.Remark),
+		UploadedBy:  CurrentPersonID(c),
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Document{}).Where("group_id = ?", latest.GroupID).Update("is_latest", false).Error; err != nil {
+			return err
+		}
+		return tx.Create(&version).Error
+	})
+	if err != nil {
+		discardDocumentBlob(blob)
+		ErrorResponse(c, 500, "Failed to create document version: "+err.Error())
+		return
+	}
+	closeRenewedDocumentReminders(version, latest.ExpiryDate)
+
+	SuccessResponse(c, version)
+}
+
+// GetDocumentVersions 获取文档的所有版本（新版本在前）
+func GetDocumentVersions(c *gin.Context) {
+	document, ok := findDocument(c)
+	if !ok {
+		return
+	}
+
+	var versions []models.Document
+	if err := config.DB.Where("group_id = ?", document.GroupID).Order("version DESC").Find(&versions).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch document versions: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, versions)
+}
+
+// GetDocumentDownloadURL 生成带签名的限时下载链接（仅限可访问文档所属对象的人员）
+func GetDocumentDownloadURL(c *gin.Context) {
+	document, ok := findDocument(c)
+	if !ok {
+		return
+	}
+
+	personID := CurrentPersonID(c)
+	if personID == nil {
+		ErrorResponse(c, 401, "Missing X-Person-ID header")
+		return
+	}
+	if !canAccessDocument(*personID, document) {
+		ErrorResponse(c, 403, "No access to this document")
+		return
+	}
+
+	ttl := defaultDownloadURLTTL
+	if value := c.Query("expires_in"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			ErrorResponse(c, 400, "Invalid expires_in")
+			return
+		}
+		ttl = time.Duration(seconds) * time.Second
+		if ttl > maxDownloadURLTTL {
+			ttl = maxDownloadURLTTL
+		}
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	expires := expiresAt.Unix()
+	downloadURL := fmt.Sprintf("/api/documents/%d/download?expires=%d&signature=%s",
+		document.ID, expires, signDocumentDownload(document.ID, expires))
+
+	SuccessResponse(c, gin.H{
+		"url":        downloadURL,
+		"expires_at": expiresAt,
+	})
+}
+
+// DownloadDocument 通过签名链接下载文档
+func DownloadDocument(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid document ID")
+		return
+	}
+
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		ErrorResponse(c, 403, "Invalid download link")
+		return
+	}
+	expected := signDocumentDownload(uint(id), expires)
+	if !hmac.Equal([]byte(expected), []byte(c.Query("signature"))) {
+		ErrorResponse(c, 403, "Invalid download link")
+		return
+	}
+	if time.Now().Unix() > expires {
+		ErrorResponse(c, 403, "Download link has expired")
+		return
+	}
+
+	var document models.Document
+	if err := config.DB.First(&document, id).Error; err != nil {
+		ErrorResponse(c, 404, "Document not found")
+		return
+	}
+
+	serveStoredBlob(c, document.StorageKey, document.FileName, document.ContentType, document.Size)
+}
+
+// ============ 辅助函数 ============
+
+// documentBlob 已写入存储后端的文件
+type documentBlob struct {
+	FileName    string
+	ContentType string
+	Size        int64
+	SHA256      string
+	StorageKey  string
+	Created     bool // 本次上传新写入了存储（此前不存在相同内容）
+}
+
+// storeDocumentBlob 读取上传文件，计算SHA-256并写入存储后端
+// 存储key由内容摘要决定，相同内容只存储一份
+func storeDocumentBlob(c *gin.Context) (*documentBlob, error) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("获取上传文件失败: %w", err)
+	}
+	if file.Size > utils.MaxAttachmentSize {
+		return nil, fmt.Errorf("文件大小超过限制（%dMB）", utils.MaxAttachmentSize>>20)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("读取上传文件失败: %w", err)
+	}
+	defer src.Close()
+
+	// 先写入临时文件，同时计算摘要
+	tmp, err := os.CreateTemp("", "document-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), src)
+	if err != nil {
+		return nil, fmt.Errorf("读取上传文件失败: %w", err)
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	key := "sha256/" + sum[:2] + "/" + sum
+
+	exists, err := config.Storage.Exists(key)
+	if err != nil {
+		return nil, fmt.Errorf("访问存储失败: %w", err)
+	}
+	if !exists {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("读取临时文件失败: %w", err)
+		}
+		if err := config.Storage.Put(key, tmp, size, file.Header.Get("Content-Type")); err != nil {
+			return nil, fmt.Errorf("保存文件失败: %w", err)
+		}
+	}
+
+	return &documentBlob{
+		FileName:    filepath.Base(file.Filename),
+		ContentType: file.Header.Get("Content-Type"),
+		Size:        size,
+		SHA256:      sum,
+		StorageKey:  key,
+		Created:     !exists,
+	}, nil
+}
+
+// serveStoredBlob 从存储后端读取文件并作为附件下载返回
+func serveStoredBlob(c *gin.Context, key, fileName, contentType string, size int64) {
+	reader, err := config.Storage.Get(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		ErrorResponse(c, 404, "File not found in storage")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to read file: "+err.Error())
+		return
+	}
+	defer reader.Close()
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.DataFromReader(200, size, contentType, reader, map[string]string{
+		"Content-Disposition": "attachment; filename*=UTF-8''" + url.PathEscape(fileName),
+	})
+}
+
+// discardDocumentBlob 文档记录未能保存时清理本次新写入的文件（仍被其他文档引用时保留）
+func discardDocumentBlob(blob *documentBlob) {
+	if blob.Created {
+		deleteUnreferencedBlob(blob.StorageKey)
+	}
+}
+
+// deleteUnreferencedBlob 删除不再被任何文档或任务附件引用的文件
+func deleteUnreferencedBlob(key string) error {
+	var count int64
+	config.DB.Model(&models.Document{}).Where("storage_key = ?", key).Count(&count)
+	if count > 0 {
+		return nil
+	}
+	config.DB.Model(&models.TaskAttachment{}).Where("storage_key = ?", key).Count(&count)
+	if count > 0 {
+		return nil
+	}
+	if err := config.Storage.Delete(key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// findDocument 根据路径参数查找文档
+func findDocument(c *gin.Context) (models.Document, bool) {
+	var document models.Document
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid document ID")
+		return document, false
+	}
+	if err := config.DB.First(&document, id).Error; err != nil {
+		ErrorResponse(c, 404, "Document not found")
+		return document, false
+	}
+	return document, true
+}
+
+// validateDocumentOwner 检查文档归属对象是否存在
+func validateDocumentOwner(ownerType models.DocumentOwnerType, ownerID uint) error {
+	var model interface{}
+	switch ownerType {
+	case models.DocumentOwnerCustomer:
+		model = &models.Customer{}
+	case models.DocumentOwnerAgreement:
+		model = &models.Agreement{}
+	case models.DocumentOwnerPerson:
+		model = &models.Person{}
+	default:
+		return fmt.Errorf("Invalid owner type: %s", ownerType)
+	}
+
+	var count int64
+	config.DB.Model(model).Where("id = ?", ownerID).Count(&count)
+	if count == 0 {
+		return fmt.Errorf("%s %d not found", ownerType, ownerID)
+	}
+	return nil
+}
+
+// canAccessDocument 检查人员能否访问文档：客户、协议文档限所属客户的服务人员；
+// 人员文档限本人，以及其担任法定代表人、持股或服务的客户的服务人员
+func canAccessDocument(personID uint, document models.Document) bool {
+	var customerIDs []uint
+	switch document.OwnerType {
+	case models.DocumentOwnerCustomer:
+		customerIDs = []uint{document.OwnerID}
+	case models.DocumentOwnerAgreement:
+		var agreement models.Agreement
+		if config.DB.Select("customer_id").First(&agreement, document.OwnerID).Error != nil {
+			return false
+		}
+		customerIDs = []uint{agreement.CustomerID}
+	case models.DocumentOwnerPerson:
+		if document.OwnerID == personID {
+			return true
+		}
+		var owner models.Person
+		if config.DB.First(&owner, document.OwnerID).Error != nil {
+			return false
+		}
+		customerIDs = append(customerIDs, StringToIDs(owner.RepresentativeCustomerIDs)...)
+		customerIDs = append(customerIDs, StringToIDs(owner.InvestorCustomerIDs)...)
+		customerIDs = append(customerIDs, StringToIDs(owner.ServiceCustomerIDs)...)
+	}
+	if len(customerIDs) == 0 {
+		return false
+	}
+
+	var count int64
+	config.DB.Model(&models.Customer{}).
+		Where("id IN ?", customerIDs).
+		Where("',' || service_person_ids || ',' LIKE ?", fmt.Sprintf("%%,%d,%%", personID)).
+		Count(&count)
+	return count > 0
+}
+
+// isValidDocumentCategory 检查文档分类是否有效
+func isValidDocumentCategory(category models.DocumentCategory) bool {
+	for _, item := range models.DocumentCategories {
+		if item == category {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDocumentDate 解析日期（YYYY-MM-DD），空字符串返回nil
+func parseDocumentDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, errors.New("expected format YYYY-MM-DD")
+	}
+	return &date, nil
+}
+
+// signDocumentDownload 计算下载链接签名
+func signDocumentDownload(id uint, expires int64) string {
+	mac := hmac.New(sha256.New, config.DownloadURLSecret)
+	fmt.Fprintf(mac, "%d:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// closeRenewedDocumentReminders 文档（最新版本）的到期日期变更后完成原到期日期的提醒任务
+func closeRenewedDocumentReminders(document models.Document, previousExpiry *time.Time) {
+	if !document.IsLatest || previousExpiry == nil {
+		return
+	}
+	if document.ExpiryDate != nil && document.ExpiryDate.Equal(*previousExpiry) {
+		return
+	}
+	closeExpiryReminders(models.ExpiryReminderSourceDocument, document.GroupID, document.ExpiryDate)
+}
+
+// copyTime 复制时间指针，避免重新读取记录时被覆盖
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	value := *t
+	return &value
+}
+
+// deleteDocumentGroups 删除文档的所有版本，并清理不再被引用的文件
+func deleteDocumentGroups(groupIDs []uint) error {
+	if len(groupIDs) == 0 {
+		return nil
+	}
+
+	var keys []string
+	config.DB.Model(&models.Document{}).Where("group_id IN ?", groupIDs).Distinct().Pluck("storage_key", &keys)
+
+	if err := config.DB.Where("group_id IN ?", groupIDs).Delete(&models.Document{}).Error; err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := deleteUnreferencedBlob(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteOwnerDocuments 删除归属于指定对象的全部文档
+func deleteOwnerDocuments(ownerType models.DocumentOwnerType, ownerID uint) error {
+	var groupIDs []uint
+	config.DB.Model(&models.Document{}).
+		Where("owner_type = ? AND owner_id = ?", ownerType, ownerID).
+		Distinct().
+		Pluck("group_id", &groupIDs)
+	return deleteDocumentGroups(groupIDs)
+}
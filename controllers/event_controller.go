@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"erp/config"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	eventStreamPollInterval = time.Second      // 轮询事件日志的间隔
+	eventStreamHeartbeat    = 15 * time.Second // 心跳间隔，防止代理断开空闲连接
+	eventStreamBatchSize    = 100              // 每次读取的事件数
+	eventStreamRetryMillis  = 3000             // 客户端断线后的重连间隔
+)
+
+// StreamEvents 以 Server-Sent Events 推送当前人员可见对象的创建、更新、删除事件
+// 浏览器 EventSource 无法设置请求头，可通过 person_id 查询参数指定人员；
+// 断线重连时根据 Last-Event-ID 请求头（或 last_event_id 参数）补发错过的事件
+func StreamEvents(c *gin.Context) {
+	personID := CurrentPersonID(c)
+	if personID == nil {
+		if id, err := strconv.ParseUint(c.Query("person_id"), 10, 32); err == nil && id != 0 {
+			pid := uint(id)
+			personID = &pid
+		}
+	}
+	if personID == nil {
+		ErrorResponse(c, 401, "Missing X-Person-ID header or person_id parameter")
+		return
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	// 未指定时只推送连接之后的新事件
+	var lastID uint
+	if lastEventID == "" {
+		lastID = config.Events.LatestID()
+	} else {
+		id, err := strconv.ParseUint(lastEventID, 10, 32)
+		if err != nil {
+			ErrorResponse(c, 400, "Invalid Last-Event-ID")
+			return
+		}
+		lastID = uint(id)
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	fmt.Fprintf(w, "retry: %d\n\n", eventStreamRetryMillis)
+
+	// 断线期间的事件已被清理时通知客户端重新加载数据
+	if oldest := config.Events.OldestID(); lastEventID != "" && oldest > lastID+1 {
+		lastID = config.Events.LatestID()
+		fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {}\n\n", lastID)
+	}
+	w.Flush()
+
+	poll := time.NewTicker(eventStreamPollInterval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		events, err := config.Events.Since(*personID, lastID, eventStreamBatchSize)
+		if err != nil {
+			log.Printf("Failed to read event log: %v", err)
+		}
+		for _, event := range events {
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+			lastID = event.ID
+		}
+		if len(events) > 0 {
+			w.Flush()
+		}
+		// 还有未读完的事件时立即继续读取
+		if len(events) == eventStreamBatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			w.Flush()
+		case <-poll.C:
+		}
+	}
+}
+
+// ============ 辅助函数 ============
+
+// publishEvent 记录实时事件并推送Webhook，失败只记录日志，不影响业务操作
+// audience 为实时事件额外的可见人员（如变更前的服务人员），不影响Webhook
+func publishEvent(eventType string, data interface{}, audience ...uint) {
+	if config.Events != nil {
+		if err := config.Events.Record(eventType, data, audience...); err != nil {
+			log.Printf("Failed to record event %s: %v", eventType, err)
+		}
+	}
+	if config.Webhooks != nil {
+		if err := config.Webhooks.Emit(eventType, data); err != nil {
+			log.Printf("Failed to emit webhook event %s: %v", eventType, err)
+		}
+	}
+}
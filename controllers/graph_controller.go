@@ -0,0 +1,503 @@
+package controllers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"erp/config"
+	"erp/models"
+	"erp/utils"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 关系图默认/最大展开层数
+	defaultGraphDepth = 3
+	maxGraphDepth     = 6
+
+	// 节点类型
+	GraphNodePerson   = "person"
+	GraphNodeCustomer = "customer"
+	GraphNodeEntity   = "entity"
+
+	// 关系类型
+	GraphRelationRepresentative = "representative"
+	GraphRelationInvestor       = "investor"
+	GraphRelationService        = "service"
+)
+
+// GraphNode 关系图节点
+type GraphNode struct {
+	ID               string            `json:"id"`                          // 节点标识，如 person:1、customer:3、entity:2
+	Kind             string            `json:"kind"`                        // 节点类型: person/customer/entity
+	RefID            uint              `json:"ref_id"`                      // 对应记录ID
+	Label            string            `json:"label"`                       // 显示名称
+	Depth            int               `json:"depth"`                       // 与查询人员的距离
+	UltimateShare    float64           `json:"ultimate_share,omitempty"`    // 查询人员对该企业的最终持股比例(%)
+	BeneficialOwners []BeneficialOwner `json:"beneficial_owners,omitempty"` // 企业的最终受益人（图内可见部分）
+}
+
+// GraphEdge 关系图边（方向: 人员/股东 -> 企业）
+type GraphEdge struct {
+	Source     string  `json:"source"`
+	Target     string  `json:"target"`
+	Relation   string  `json:"relation"`              // representative/investor/service
+	ShareRatio float64 `json:"share_ratio,omitempty"` // 直接持股比例(%)，仅投资关系
+}
+
+// BeneficialOwner 最终受益人
+type BeneficialOwner struct {
+	NodeID string  `json:"node_id"`
+	Name   string  `json:"name"`
+	Share  float64 `json:"share"` // 穿透后的持股比例(%)
+}
+
+// RelationGraph 关系图
+type RelationGraph struct {
+	Root  string      `json:"root"`
+	Depth int         `json:"depth"`
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// graphOptions 关系图查询选项
+type graphOptions struct {
+	Depth          int
+	IncludeService bool
+}
+
+// GetPersonGraph 获取人员的关联关系图
+func GetPersonGraph(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid person ID")
+		return
+	}
+
+	var person models.Person
+	if err := config.DB.First(&person, id).Error; err != nil {
+		ErrorResponse(c, 404, "Person not found")
+		return
+	}
+
+	graph := buildPersonGraph(&person, parseGraphOptions(c))
+	SuccessResponse(c, graph)
+}
+
+// ExportPersonGraph 导出人员的关联关系图（GraphML/JSON）
+func ExportPersonGraph(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid person ID")
+		return
+	}
+
+	var person models.Person
+	if err := config.DB.First(&person, id).Error; err != nil {
+		ErrorResponse(c, 404, "Person not found")
+		return
+	}
+
+	graph := buildPersonGraph(&person, parseGraphOptions(c))
+	baseName := utils.SanitizeFilename(fmt.Sprintf("关系图_%s_%s", person.Name, utils.GetTimestamp()))
+
+	switch c.DefaultQuery("format", "graphml") {
+	case "graphml":
+		content, err := encodeGraphML(graph)
+		if err != nil {
+			ErrorResponse(c, 500, "Failed to export graph: "+err.Error())
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.graphml\"", baseName))
+		c.Data(200, "application/xml; charset=utf-8", content)
+	case "json":
+		content, err := json.MarshalIndent(graph, "", "  ")
+		if err != nil {
+			ErrorResponse(c, 500, "Failed to export graph: "+err.Error())
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.json\"", baseName))
+		c.Data(200, "application/json; charset=utf-8", content)
+	default:
+		ErrorResponse(c, 400, "Invalid format, must be graphml or json")
+	}
+}
+
+// ============ 辅助函数 ============
+
+// parseGraphOptions 解析关系图查询参数
+func parseGraphOptions(c *gin.Context) graphOptions {
+	opts := graphOptions{Depth: defaultGraphDepth}
+	if depth, err := strconv.Atoi(c.Query("depth")); err == nil && depth > 0 {
+		opts.Depth = depth
+	}
+	if opts.Depth > maxGraphDepth {
+		opts.Depth = maxGraphDepth
+	}
+	opts.IncludeService = c.Query("include_service") == "true"
+	return opts
+}
+
+// graphBuilder 以广度优先方式展开关系图
+type graphBuilder struct {
+	opts    graphOptions
+	nodes   map[string]*GraphNode
+	order   []string
+	edges   []GraphEdge
+	edgeSet map[string]bool
+	queue   []string
+}
+
+// buildPersonGraph 从指定人员出发构建关系图并计算穿透持股比例
+func buildPersonGraph(person *models.Person, opts graphOptions) *RelationGraph {
+	b := &graphBuilder{
+		opts:    opts,
+		nodes:   make(map[string]*GraphNode),
+		edgeSet: make(map[string]bool),
+	}
+	root := b.addNode(GraphNodePerson, person.ID, person.Name, 0)
+
+	for len(b.queue) > 0 {
+		nodeID := b.queue[0]
+		b.queue = b.queue[1:]
+		node := b.nodes[nodeID]
+		if node.Depth >= opts.Depth {
+			continue
+		}
+		switch node.Kind {
+		case GraphNodePerson:
+			b.expandPerson(node)
+		case GraphNodeCustomer:
+			b.expandCustomer(node)
+		case GraphNodeEntity:
+			b.expandEntity(node)
+		}
+	}
+
+	b.computeOwnership(root)
+
+	graph := &RelationGraph{Root: root, Depth: opts.Depth, Edges: b.edges}
+	for _, id := range b.order {
+		graph.Nodes = append(graph.Nodes, *b.nodes[id])
+	}
+	if graph.Edges == nil {
+		graph.Edges = []GraphEdge{}
+	}
+	return graph
+}
+
+// addNode 添加节点（已存在则直接返回），新节点加入待展开队列
+func (b *graphBuilder) addNode(kind string, refID uint, label string, depth int) string {
+	id := kind + ":" + strconv.Itoa(int(refID))
+	if _, exists := b.nodes[id]; exists {
+		return id
+	}
+	b.nodes[id] = &GraphNode{ID: id, Kind: kind, RefID: refID, Label: label, Depth: depth}
+	b.order = append(b.order, id)
+	b.queue = append(b.queue, id)
+	return id
+}
+
+// addEdge 添加边，同一对节点的同类关系只保留一条
+func (b *graphBuilder) addEdge(source, target, relation string, shareRatio float64) {
+	key := source + "|" + target + "|" + relation
+	if b.edgeSet[key] {
+		return
+	}
+	b.edgeSet[key] = true
+	b.edges = append(b.edges, GraphEdge{Source: source, Target: target, Relation: relation, ShareRatio: shareRatio})
+}
+
+// expandPerson 展开人员节点：担任法人、持股、服务的企业
+func (b *graphBuilder) expandPerson(node *GraphNode) {
+	var person models.Person
+	if config.DB.First(&person, node.RefID).Error != nil {
+		return
+	}
+
+	// 担任法定代表人的企业
+	var repCustomers []models.Customer
+	config.DB.Where("representative_id = ?", person.ID).Find(&repCustomers)
+	for _, customer := range repCustomers {
+		target := b.addNode(GraphNodeCustomer, customer.ID, customer.Name, node.Depth+1)
+		b.addEdge(node.ID, target, GraphRelationRepresentative, 0)
+	}
+
+	// 持股的企业
+	b.addInvestments(node, models.InvestorTypePerson)
+
+	// 服务的企业
+	if b.opts.IncludeService && person.ServiceCustomerIDs != "" {
+		var svcCustomers []models.Customer
+		config.DB.Where("id IN ?", StringToIDs(person.ServiceCustomerIDs)).Find(&svcCustomers)
+		for _, customer := range svcCustomers {
+			target := b.addNode(GraphNodeCustomer, customer.ID, customer.Name, node.Depth+1)
+			b.addEdge(node.ID, target, GraphRelationService, 0)
+		}
+	}
+}
+
+// expandCustomer 展开企业节点：法定代表人、投资人、服务人员
+func (b *graphBuilder) expandCustomer(node *GraphNode) {
+	var customer models.Customer
+	if config.DB.First(&customer, node.RefID).Error != nil {
+		return
+	}
+
+	// 法定代表人
+	if customer.RepresentativeID != nil {
+		var rep models.Person
+		if config.DB.First(&rep, *customer.RepresentativeID).Error == nil {
+			source := b.addNode(GraphNodePerson, rep.ID, rep.Name, node.Depth+1)
+			b.addEdge(source, node.ID, GraphRelationRepresentative, 0)
+		}
+	}
+
+	// 投资人（自然人、本系统客户、外部法人）
+	for _, info := range parseInvestorInfos(&customer) {
+		var source string
+		switch info.ResolvedType() {
+		case models.InvestorTypePerson:
+			var inv models.Person
+			if config.DB.First(&inv, info.PersonID).Error == nil {
+				source = b.addNode(GraphNodePerson, inv.ID, inv.Name, node.Depth+1)
+			}
+		case models.InvestorTypeCustomer:
+			var corp models.Customer
+			if config.DB.First(&corp, info.CustomerID).Error == nil {
+				source = b.addNode(GraphNodeCustomer, corp.ID, corp.Name, node.Depth+1)
+			}
+		case models.InvestorTypeEntity:
+			var entity models.LegalEntity
+			if config.DB.First(&entity, info.EntityID).Error == nil {
+				source = b.addNode(GraphNodeEntity, entity.ID, entity.Name, node.Depth+1)
+			}
+		}
+		if source != "" {
+			b.addEdge(source, node.ID, GraphRelationInvestor, info.ShareRatio)
+		}
+	}
+
+	// 作为企业股东持股的企业
+	b.addInvestments(node, models.InvestorTypeCustomer)
+
+	// 服务人员
+	if b.opts.IncludeService && customer.ServicePersonIDs != "" {
+		var servicePersons []models.Person
+		config.DB.Where("id IN ?", StringToIDs(customer.ServicePersonIDs)).Find(&servicePersons)
+		for _, sp := range servicePersons {
+			source := b.addNode(GraphNodePerson, sp.ID, sp.Name, node.Depth+1)
+			b.addEdge(source, node.ID, GraphRelationService, 0)
+		}
+	}
+}
+
+// expandEntity 展开外部法人节点：持股的企业
+func (b *graphBuilder) expandEntity(node *GraphNode) {
+	b.addInvestments(node, models.InvestorTypeEntity)
+}
+
+// addInvestments 添加节点作为股东持股的企业（以客户的投资人JSON为准）
+func (b *graphBuilder) addInvestments(node *GraphNode, investorType models.InvestorType) {
+	for _, customer := range customersInvestedBy(investorType, node.RefID) {
+		target := b.addNode(GraphNodeCustomer, customer.ID, customer.Name, node.Depth+1)
+		for _, info := range parseInvestorInfos(&customer) {
+			if info.ResolvedType() == investorType && investorRefID(info) == node.RefID {
+				b.addEdge(node.ID, target, GraphRelationInvestor, info.ShareRatio)
+			}
+		}
+	}
+}
+
+// computeOwnership 计算穿透持股比例
+// 对图中每个人员沿投资关系（含经企业股东的间接持股）逐层相乘、多条路径累加，得到其对各企业的最终持股比例。
+// 计算范围仅限于已展开的节点，超出查询层数的股权不计入。
+func (b *graphBuilder) computeOwnership(root string) {
+	owned := make(map[string][]GraphEdge)
+	for _, edge := range b.edges {
+		if edge.Relation == GraphRelationInvestor && edge.ShareRatio > 0 {
+			owned[edge.Source] = append(owned[edge.Source], edge)
+		}
+	}
+
+	for _, id := range b.order {
+		owner := b.nodes[id]
+		if owner.Kind != GraphNodePerson {
+			continue
+		}
+		for target, share := range ownershipFrom(id, owned) {
+			share = math.Round(share*10000) / 10000
+			company := b.nodes[target]
+			company.BeneficialOwners = append(company.BeneficialOwners, BeneficialOwner{
+				NodeID: owner.ID,
+				Name:   owner.Label,
+				Share:  share,
+			})
+			if id == root {
+				company.UltimateShare = share
+			}
+		}
+	}
+
+	for _, node := range b.nodes {
+		sort.Slice(node.BeneficialOwners, func(i, j int) bool {
+			return node.BeneficialOwners[i].Share > node.BeneficialOwners[j].Share
+		})
+	}
+}
+
+// ownershipFrom 计算某个股东对下游各企业的穿透持股比例(%)，跳过环路
+func ownershipFrom(source string, owned map[string][]GraphEdge) map[string]float64 {
+	result := make(map[string]float64)
+	onPath := map[string]bool{source: true}
+
+	var walk func(node string, factor float64)
+	walk = func(node string, factor float64) {
+		for _, edge := range owned[node] {
+			if onPath[edge.Target] {
+				continue
+			}
+			share := factor * edge.ShareRatio / 100
+			result[edge.Target] += share * 100
+			onPath[edge.Target] = true
+			walk(edge.Target, share)
+			delete(onPath, edge.Target)
+		}
+	}
+	walk(source, 1)
+
+	return result
+}
+
+// customersInvestedBy 查询指定股东持股的企业
+func customersInvestedBy(investorType models.InvestorType, refID uint) []models.Customer {
+	field := "$.person_id"
+	switch investorType {
+	case models.InvestorTypeCustomer:
+		field = "$.customer_id"
+	case models.InvestorTypeEntity:
+		field = "$.entity_id"
+	}
+
+	var customerIDs []uint
+	config.DB.Raw(`
+		SELECT id FROM customers
+		WHERE investors IS NOT NULL
+		AND json_valid(investors)
+		AND EXISTS (
+			SELECT 1 FROM json_each(investors)
+			WHERE CAST(json_extract(value, ?) AS INTEGER) = ?
+		)
+	`, field, refID).Scan(&customerIDs)
+
+	var customers []models.Customer
+	if len(customerIDs) > 0 {
+		config.DB.Where("id IN ?", customerIDs).Find(&customers)
+	}
+	return customers
+}
+
+// investorRefID 返回投资人对应记录的ID
+func investorRefID(info models.InvestorInfo) uint {
+	switch info.ResolvedType() {
+	case models.InvestorTypeCustomer:
+		return info.CustomerID
+	case models.InvestorTypeEntity:
+		return info.EntityID
+	}
+	return info.PersonID
+}
+
+// parseInvestorInfos 解析客户的投资人JSON
+func parseInvestorInfos(customer *models.Customer) []models.InvestorInfo {
+	var infos []models.InvestorInfo
+	if customer.Investors != nil {
+		json.Unmarshal(customer.Investors, &infos)
+	}
+	return infos
+}
+
+// ============ GraphML 导出 ============
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// encodeGraphML 将关系图编码为GraphML
+func encodeGraphML(graph *RelationGraph) ([]byte, error) {
+	doc := graphMLDocument{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "kind", For: "node", AttrName: "kind", AttrType: "string"},
+			{ID: "label", For: "node", AttrName: "label", AttrType: "string"},
+			{ID: "depth", For: "node", AttrName: "depth", AttrType: "int"},
+			{ID: "ultimate_share", For: "node", AttrName: "ultimate_share", AttrType: "double"},
+			{ID: "relation", For: "edge", AttrName: "relation", AttrType: "string"},
+			{ID: "share_ratio", For: "edge", AttrName: "share_ratio", AttrType: "double"},
+		},
+		Graph: graphMLGraph{ID: graph.Root, EdgeDefault: "directed"},
+	}
+
+	for _, node := range graph.Nodes {
+		data := []graphMLData{
+			{Key: "kind", Value: node.Kind},
+			{Key: "label", Value: node.Label},
+			{Key: "depth", Value: strconv.Itoa(node.Depth)},
+		}
+		if node.UltimateShare > 0 {
+			data = append(data, graphMLData{Key: "ultimate_share", Value: strconv.FormatFloat(node.UltimateShare, 'f', -1, 64)})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: node.ID, Data: data})
+	}
+
+	for _, edge := range graph.Edges {
+		data := []graphMLData{{Key: "relation", Value: edge.Relation}}
+		if edge.ShareRatio > 0 {
+			data = append(data, graphMLData{Key: "share_ratio", Value: strconv.FormatFloat(edge.ShareRatio, 'f', -1, 64)})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{Source: edge.Source, Target: edge.Target, Data: data})
+	}
+
+	content, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), content...), nil
+}
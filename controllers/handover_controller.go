@@ -0,0 +1,607 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"erp/services/notification"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// HandoverRequest 工作交接请求
+type HandoverRequest struct {
+	SuccessorIDs []uint               `json:"successor_ids" binding:"required"` // 接手人员
+	Assignments  []HandoverAssignment `json:"assignments"`                      // 指定客户的接手人，其余客户自动分配
+	Reason       string               `json:"reason"`                           // 交接原因，如离职、调岗
+}
+
+// HandoverAssignment 指定客户的接手人
+type HandoverAssignment struct {
+	CustomerID  uint `json:"customer_id" binding:"required"`
+	SuccessorID uint `json:"successor_id" binding:"required"`
+}
+
+// HandoverSuccessorSummary 接手人员的工作量
+type HandoverSuccessorSummary struct {
+	PersonID         uint   `json:"person_id"`
+	Name             string `json:"name"`
+	CurrentCustomers int64  `json:"current_customers"`  // 交接前服务的客户数
+	CurrentOpenTasks int64  `json:"current_open_tasks"` // 交接前未完成的任务数
+	Customers        int    `json:"customers"`          // 接手的客户数
+	Tasks            int    `json:"tasks"`              // 接手的任务数
+}
+
+// HandoverPreview 交接预览
+type HandoverPreview struct {
+	Handover   models.Handover            `json:"handover"` // 交接记录及清单（未保存）
+	Successors []HandoverSuccessorSummary `json:"successors"`
+}
+
+// PreviewHandover 预览工作交接：列出将转移的客户、未完成任务以及需移交的文档和证照，不做修改
+func PreviewHandover(c *gin.Context) {
+	person, req, ok := bindHandoverRequest(c)
+	if !ok {
+		return
+	}
+
+	plan, err := buildHandoverPlan(config.DB, person, req)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	SuccessResponse(c, HandoverPreview{Handover: plan.handover, Successors: plan.successors})
+}
+
+// CreateHandover 执行工作交接：将人员的客户和未完成任务转给接手人员，同步双向关联并生成交接清单
+func CreateHandover(c *gin.Context) {
+	person, req, ok := bindHandoverRequest(c)
+	if !ok {
+		return
+	}
+
+	b := &bulkContext{batchID: newBatchID(), operatorID: CurrentPersonID(c)}
+	var plan *handoverPlan
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		b.tx = tx
+		if err := tx.First(person, person.ID).Error; err != nil {
+			return err
+		}
+
+		var err error
+		plan, err = buildHandoverPlan(tx, person, req)
+		if err != nil {
+			return err
+		}
+		if len(plan.customers) == 0 && len(plan.tasks) == 0 {
+			return errors.New("Person has no customers or open tasks to hand over")
+		}
+		return applyHandover(b, person, plan, req.Reason)
+	})
+	if err != nil {
+		ErrorResponse(c, 400, "Failed to hand over: "+err.Error())
+		return
+	}
+
+	for _, event := range b.events {
+		publishEvent(event.eventType, event.data, event.audience...)
+	}
+	notifyHandoverSuccessors(person, plan)
+
+	var handover models.Handover
+	config.DB.Preload("FromPerson").Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("sort_order ASC, id ASC")
+	}).First(&handover, plan.handover.ID)
+
+	SuccessResponse(c, handover)
+}
+
+// GetHandovers 获取交接记录列表
+func GetHandovers(c *gin.Context) {
+	var handovers []models.Handover
+	var total int64
+
+	query := config.DB.Model(&models.Handover{}).Preload("FromPerson")
+
+	// 按移交人筛选
+	if personID := c.Query("person_id"); personID != "" {
+		query = query.Where("from_person_id = ?", personID)
+	}
+
+	// 按接手人筛选
+	if successorID := c.Query("successor_id"); successorID != "" {
+		query = query.Where("',' || successor_ids || ',' LIKE ?", "%,"+successorID+",%")
+	}
+
+	// 按状态筛选
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	query.Count(&total)
+
+	if err := query.Order("created_at DESC").Find(&handovers).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch handovers: "+err.Error())
+		return
+	}
+
+	SuccessPaginatedResponse(c, total, handovers)
+}
+
+// GetHandover 获取交接记录详情及交接清单
+func GetHandover(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid handover ID")
+		return
+	}
+
+	var handover models.Handover
+	if err := config.DB.Preload("FromPerson").Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("sort_order ASC, id ASC")
+	}).First(&handover, id).Error; err != nil {
+		ErrorResponse(c, 404, "Handover not found")
+		return
+	}
+
+	SuccessResponse(c, handover)
+}
+
+// UpdateHandoverItemRequest 确认交接清单项请求
+type UpdateHandoverItemRequest struct {
+	Completed *bool `json:"completed" binding:"required"` // 是否已确认
+	Version   uint  `json:"version"`                      // 修改所基于的版本号
+}
+
+// UpdateHandoverItem 确认或取消确认交接清单项，全部确认后交接记录标记为已完成
+func UpdateHandoverItem(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid handover ID")
+		return
+	}
+
+	var item models.HandoverItem
+	if err := config.DB.Where("handover_id = ?", id).First(&item, c.Param("item_id")).Error; err != nil {
+		ErrorResponse(c, 404, "Handover item not found")
+		return
+	}
+
+	var req UpdateHandoverItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if !matchVersion(c, item.Version, req.Version) {
+		return
+	}
+
+	if *req.Completed != item.Completed {
+		updates := map[string]interface{}{
+			"completed":    *req.Completed,
+			"completed_at": nil,
+			"completed_by": nil,
+			"version":      item.Version + 1,
+		}
+		if *req.Completed {
+			updates["completed_at"] = time.Now()
+			updates["completed_by"] = CurrentPersonID(c)
+		}
+		if !updateVersioned(c, config.DB.Model(&item), item.Version, updates) {
+			return
+		}
+		refreshHandoverStatus(item.HandoverID)
+	}
+
+	config.DB.First(&item, item.ID)
+
+	setETag(c, item.Version)
+	SuccessResponse(c, item)
+}
+
+// ============ 辅助函数 ============
+
+// handoverPlan 交接方案：转移的客户、任务及各自的接手人
+type handoverPlan struct {
+	handover          models.Handover
+	successors        []HandoverSuccessorSummary
+	customers         []models.Customer
+	customerSuccessor map[uint]uint
+	tasks             []models.Task
+	taskSuccessor     map[uint]uint
+	staleCustomerIDs  []uint // 人员服务客户列表中已删除的客户
+}
+
+// bindHandoverRequest 解析移交人和交接请求
+func bindHandoverRequest(c *gin.Context) (*models.Person, HandoverRequest, bool) {
+	var req HandoverRequest
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid person ID")
+		return nil, req, false
+	}
+
+	var person models.Person
+	if err := config.DB.First(&person, id).Error; err != nil {
+		ErrorResponse(c, 404, "Person not found")
+		return nil, req, false
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return nil, req, false
+	}
+
+	return &person, req, true
+}
+
+// buildHandoverPlan 计算交接方案
+// 客户优先交给指定的接手人，其次交给已在服务该客户的接手人，否则交给当前服务客户最少的接手人；
+// 任务跟随所属客户的接手人，客户不在交接范围内时按同样规则以未完成任务数分配
+func buildHandoverPlan(db *gorm.DB, person *models.Person, req HandoverRequest) (*handoverPlan, error) {
+	var successorIDs []uint
+	for _, id := range req.SuccessorIDs {
+		if id == person.ID {
+			return nil, errors.New("Successor cannot be the person handing over")
+		}
+		successorIDs = appendUniqueID(successorIDs, id)
+	}
+	if len(successorIDs) == 0 {
+		return nil, errors.New("At least one successor is required")
+	}
+
+	plan := &handoverPlan{
+		customerSuccessor: map[uint]uint{},
+		taskSuccessor:     map[uint]uint{},
+	}
+	load := map[uint]*HandoverSuccessorSummary{}
+	for _, id := range successorIDs {
+		var successor models.Person
+		if err := db.First(&successor, id).Error; err != nil {
+			return nil, fmt.Errorf("Successor %d not found", id)
+		}
+		if successor.Type != models.PersonTypeServicePerson && successor.Type != models.PersonTypeMixed {
+			return nil, fmt.Errorf("Successor %d must be a service person", id)
+		}
+		summary := HandoverSuccessorSummary{PersonID: id, Name: successor.Name}
+		db.Model(&models.Customer{}).
+			Where("',' || service_person_ids || ',' LIKE ?", fmt.Sprintf("%%,%d,%%", id)).
+			Count(&summary.CurrentCustomers)
+		db.Model(&models.Task{}).
+			Where("assignee_id = ?", id).Where(openTaskCondition()).
+			Count(&summary.CurrentOpenTasks)
+		plan.successors = append(plan.successors, summary)
+	}
+	for i := range plan.successors {
+		load[plan.successors[i].PersonID] = &plan.successors[i]
+	}
+
+	// 服务客户以人员和客户两侧的关联合并计算，避免关联不同步时遗漏
+	customerIDs := StringToIDs(person.ServiceCustomerIDs)
+	var linkedIDs []uint
+	db.Model(&models.Customer{}).
+		Where("',' || service_person_ids || ',' LIKE ?", fmt.Sprintf("%%,%d,%%", person.ID)).
+		Pluck("id", &linkedIDs)
+	for _, id := range linkedIDs {
+		customerIDs = appendUniqueID(customerIDs, id)
+	}
+	if len(customerIDs) > 0 {
+		db.Where("id IN ?", customerIDs).Order("id ASC").Find(&plan.customers)
+	}
+	for _, id := range customerIDs {
+		found := false
+		for _, customer := range plan.customers {
+			if customer.ID == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			plan.staleCustomerIDs = append(plan.staleCustomerIDs, id)
+		}
+	}
+
+	for _, assignment := range req.Assignments {
+		if !containsID(successorIDs, assignment.SuccessorID) {
+			return nil, fmt.Errorf("Successor %d is not in successor_ids", assignment.SuccessorID)
+		}
+		if !containsID(customerIDs, assignment.CustomerID) || containsID(plan.staleCustomerIDs, assignment.CustomerID) {
+			return nil, fmt.Errorf("Customer %d is not served by this person", assignment.CustomerID)
+		}
+		plan.customerSuccessor[assignment.CustomerID] = assignment.SuccessorID
+	}
+
+	customerNames := map[uint]string{}
+	for _, customer := range plan.customers {
+		customerNames[customer.ID] = customer.Name
+		successorID, ok := plan.customerSuccessor[customer.ID]
+		if !ok {
+			successorID = pickSuccessor(plan.successors, StringToIDs(customer.ServicePersonIDs), func(s *HandoverSuccessorSummary) int64 {
+				return s.CurrentCustomers + int64(s.Customers)
+			})
+			plan.customerSuccessor[customer.ID] = successorID
+		}
+		load[successorID].Customers++
+	}
+
+	db.Where("assignee_id = ?", person.ID).Where(openTaskCondition()).
+		Order("id ASC").Find(&plan.tasks)
+	for _, task := range plan.tasks {
+		successorID, ok := plan.customerSuccessor[task.CustomerID]
+		if !ok {
+			var servicePersonIDs string
+			db.Model(&models.Customer{}).Where("id = ?", task.CustomerID).Select("service_person_ids").Scan(&servicePersonIDs)
+			successorID = pickSuccessor(plan.successors, StringToIDs(servicePersonIDs), func(s *HandoverSuccessorSummary) int64 {
+				return s.CurrentOpenTasks + int64(s.Tasks)
+			})
+		}
+		plan.taskSuccessor[task.ID] = successorID
+		load[successorID].Tasks++
+
+		if _, ok := customerNames[task.CustomerID]; !ok {
+			var name string
+			db.Model(&models.Customer{}).Where("id = ?", task.CustomerID).Select("name").Scan(&name)
+			customerNames[task.CustomerID] = name
+		}
+	}
+
+	// 客户的文档和证照需随客户移交
+	var documents []models.Document
+	var credentials []models.Credential
+	if len(plan.customers) > 0 {
+		ids := make([]uint, len(plan.customers))
+		for i, customer := range plan.customers {
+			ids[i] = customer.ID
+		}
+		db.Where("owner_type = ? AND owner_id IN ? AND is_latest = ?", models.DocumentOwnerCustomer, ids, true).
+			Order("id ASC").Find(&documents)
+		db.Where("owner_type = ? AND owner_id IN ?", models.DocumentOwnerCustomer, ids).
+			Order("expiry_date ASC").Find(&credentials)
+	}
+
+	// 按接手人分组生成清单：客户及其文档、证照、任务，最后是其他客户的任务
+	var items []models.HandoverItem
+	add := func(item models.HandoverItem) {
+		item.SortOrder = len(items) + 1
+		items = append(items, item)
+	}
+	for _, successor := range plan.successors {
+		for _, customer := range plan.customers {
+			if plan.customerSuccessor[customer.ID] != successor.PersonID {
+				continue
+			}
+			add(models.HandoverItem{
+				ItemType:   models.HandoverItemCustomer,
+				EntityID:   customer.ID,
+				CustomerID: customer.ID,
+				ToPersonID: successor.PersonID,
+				Title:      fmt.Sprintf("移交客户「%s」：告知客户新的服务人员，交接账务及往来资料", customer.Name),
+			})
+			for _, document := range documents {
+				if document.OwnerID != customer.ID {
+					continue
+				}
+				title := document.Title
+				if title == "" {
+					title = document.FileName
+				}
+				add(models.HandoverItem{
+					ItemType:   models.HandoverItemDocument,
+					EntityID:   document.GroupID,
+					CustomerID: customer.ID,
+					ToPersonID: successor.PersonID,
+					Title:      fmt.Sprintf("核对文档「%s」（%s）", title, document.Category),
+				})
+			}
+			for _, credential := range credentials {
+				if credential.OwnerID != customer.ID {
+					continue
+				}
+				name := credential.Name
+				if name == "" {
+					name = string(credential.Type)
+				}
+				add(models.HandoverItem{
+					ItemType:   models.HandoverItemCredential,
+					EntityID:   credential.ID,
+					CustomerID: customer.ID,
+					ToPersonID: successor.PersonID,
+					Title:      fmt.Sprintf("移交证照「%s」（到期 %s），确认实物或UKey已交接", name, credential.ExpiryDate.Format("2006-01-02")),
+				})
+			}
+			for _, task := range plan.tasks {
+				if task.CustomerID == customer.ID && plan.taskSuccessor[task.ID] == successor.PersonID {
+					add(handoverTaskItem(task, customerNames[task.CustomerID], successor.PersonID))
+				}
+			}
+		}
+		for _, task := range plan.tasks {
+			if _, ok := plan.customerSuccessor[task.CustomerID]; !ok && plan.taskSuccessor[task.ID] == successor.PersonID {
+				add(handoverTaskItem(task, customerNames[task.CustomerID], successor.PersonID))
+			}
+		}
+	}
+
+	plan.handover = models.Handover{
+		FromPersonID:    person.ID,
+		SuccessorIDs:    IDsToString(successorIDs),
+		Reason:          req.Reason,
+		CustomerCount:   len(plan.customers),
+		TaskCount:       len(plan.tasks),
+		DocumentCount:   len(documents),
+		CredentialCount: len(credentials),
+		Status:          models.HandoverStatusInProgress,
+		FromPerson:      person,
+		Items:           items,
+	}
+	return plan, nil
+}
+
+// pickSuccessor 选择接手人：优先已在服务该客户的接手人，否则选择负载最小的接手人（相同时按请求顺序）
+func pickSuccessor(successors []HandoverSuccessorSummary, servicePersonIDs []uint, load func(*HandoverSuccessorSummary) int64) uint {
+	for _, s := range successors {
+		if containsID(servicePersonIDs, s.PersonID) {
+			return s.PersonID
+		}
+	}
+	best := &successors[0]
+	for i := range successors {
+		if load(&successors[i]) < load(best) {
+			best = &successors[i]
+		}
+	}
+	return best.PersonID
+}
+
+// handoverTaskItem 生成任务清单项
+func handoverTaskItem(task models.Task, customerName string, successorID uint) models.HandoverItem {
+	title := fmt.Sprintf("接手任务「%s」（客户：%s，状态：%s", task.Title, customerName, task.Status)
+	if task.DueDate != nil {
+		title += "，截止 " + task.DueDate.Format("2006-01-02")
+	}
+	return models.HandoverItem{
+		ItemType:   models.HandoverItemTask,
+		EntityID:   task.ID,
+		CustomerID: task.CustomerID,
+		ToPersonID: successorID,
+		Title:      title + "）",
+	}
+}
+
+// applyHandover 在事务中执行交接：更新客户服务人员和人员服务客户两侧的关联，重新分配任务，保存交接记录和清单
+func applyHandover(b *bulkContext, person *models.Person, plan *handoverPlan, reason string) error {
+	for _, customer := range plan.customers {
+		successorID := plan.customerSuccessor[customer.ID]
+		before := StringToIDs(customer.ServicePersonIDs)
+		after := appendUniqueID(subtractIDs(before, []uint{person.ID}), successorID)
+
+		if IDsToString(after) != IDsToString(before) {
+			if err := b.tx.Model(&customer).Updates(map[string]interface{}{
+				"service_person_ids": IDsToString(after),
+				"version":            bumpVersion(),
+			}).Error; err != nil {
+				return err
+			}
+		}
+		if err := removeCustomerLink(b.tx, &models.Person{}, person.ID, "service_customer_ids", customer.ID); err != nil {
+			return err
+		}
+		if err := addCustomerLink(b.tx, &models.Person{}, successorID, "service_customer_ids", customer.ID); err != nil {
+			return err
+		}
+		if err := b.audit("customer.handover", "customer", customer.ID,
+			gin.H{"service_person_ids": IDsToString(before)},
+			gin.H{"service_person_ids": IDsToString(after)}); err != nil {
+			return err
+		}
+
+		var updated models.Customer
+		b.tx.First(&updated, customer.ID)
+		b.publish(models.WebhookEventCustomerUpdated, updated, before...)
+	}
+
+	for _, id := range plan.staleCustomerIDs {
+		if err := removeCustomerLink(b.tx, &models.Person{}, person.ID, "service_customer_ids", id); err != nil {
+			return err
+		}
+	}
+
+	assignReason := "工作交接"
+	if reason != "" {
+		assignReason += "：" + reason
+	}
+	for _, task := range plan.tasks {
+		successorID := plan.taskSuccessor[task.ID]
+		previous := copyID(task.AssigneeID)
+		if err := b.tx.Model(&task).Updates(map[string]interface{}{
+			"assignee_id": successorID,
+			"version":     bumpVersion(),
+		}).Error; err != nil {
+			return err
+		}
+		assignment := models.TaskAssignment{
+			TaskID:       task.ID,
+			FromPersonID: previous,
+			ToPersonID:   &successorID,
+			OperatorID:   b.operatorID,
+			Reason:       assignReason,
+		}
+		if err := b.tx.Create(&assignment).Error; err != nil {
+			return err
+		}
+		if err := b.audit("task.handover", "task", task.ID,
+			gin.H{"assignee_id": previous}, gin.H{"assignee_id": successorID}); err != nil {
+			return err
+		}
+
+		b.publish(models.WebhookEventTaskAssigned, assignment)
+		if err := b.publishTask(task.ID); err != nil {
+			return err
+		}
+	}
+
+	handover := plan.handover
+	handover.OperatorID = b.operatorID
+	handover.BatchID = b.batchID
+	handover.FromPerson = nil
+	handover.Items = nil
+	if err := b.tx.Create(&handover).Error; err != nil {
+		return err
+	}
+	for i := range plan.handover.Items {
+		plan.handover.Items[i].HandoverID = handover.ID
+	}
+	if len(plan.handover.Items) > 0 {
+		if err := b.tx.Create(&plan.handover.Items).Error; err != nil {
+			return err
+		}
+	}
+	plan.handover.ID = handover.ID
+
+	b.publish(models.WebhookEventPersonHandover, handover)
+	return nil
+}
+
+// refreshHandoverStatus 按清单确认情况更新交接状态
+func refreshHandoverStatus(handoverID uint) {
+	var pending int64
+	config.DB.Model(&models.HandoverItem{}).Where("handover_id = ? AND completed = ?", handoverID, false).Count(&pending)
+
+	updates := map[string]interface{}{"status": models.HandoverStatusInProgress, "completed_at": nil}
+	if pending == 0 {
+		updates = map[string]interface{}{"status": models.HandoverStatusCompleted, "completed_at": time.Now()}
+	}
+	config.DB.Model(&models.Handover{}).Where("id = ? AND status <> ?", handoverID, updates["status"]).Updates(updates)
+}
+
+// notifyHandoverSuccessors 通知接手人员
+func notifyHandoverSuccessors(person *models.Person, plan *handoverPlan) {
+	for _, successor := range plan.successors {
+		if successor.Customers == 0 && successor.Tasks == 0 {
+			continue
+		}
+		_, err := config.Notifier.Notify(notification.Message{
+			Event:     models.NotificationEventHandoverReceived,
+			PersonIDs: []uint{successor.PersonID},
+			Data: map[string]interface{}{
+				"FromPersonName": person.Name,
+				"CustomerCount":  successor.Customers,
+				"TaskCount":      successor.Tasks,
+				"Reason":         plan.handover.Reason,
+			},
+			RefType: "handover",
+			RefID:   plan.handover.ID,
+		})
+		if err != nil {
+			log.Printf("Failed to notify handover %d: %v", plan.handover.ID, err)
+		}
+	}
+}
@@ -0,0 +1,758 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"erp/services/import_export"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errUninvoicedAmountChanged 事务内重新校验时，收款的未开票金额已被其他发票或退款占用
+var errUninvoicedAmountChanged = errors.New("Uninvoiced amount has changed, please reload and retry")
+
+// InvoicePaymentInput 发票关联的收款
+type InvoicePaymentInput struct {
+	PaymentID uint    `json:"payment_id" binding:"required"`
+	Amount    float64 `json:"amount"` // 对应金额，默认为收款的未开票金额（不超过发票剩余金额）
+}
+
+// InvoiceRequest 创建/更新发票请求
+type InvoiceRequest struct {
+	InvoiceCode    string                `json:"invoice_code"`
+	InvoiceNumber  string                `json:"invoice_number" binding:"required"`
+	Type           models.InvoiceType    `json:"type" binding:"required"`
+	CustomerID     uint                  `json:"customer_id" binding:"required"`
+	BuyerName      string                `json:"buyer_name"`
+	BuyerTaxNumber string                `json:"buyer_tax_number"`
+	Amount         float64               `json:"amount" binding:"required"` // 价税合计
+	TaxRate        float64               `json:"tax_rate"`
+	TaxAmount      *float64              `json:"tax_amount"` // 税额，默认按价税合计和税率计算
+	IssueDate      string                `json:"issue_date"` // 开票日期 YYYY-MM-DD，默认今天
+	Status         models.InvoiceStatus  `json:"status"`
+	Remark         string                `json:"remark"`
+	Payments       []InvoicePaymentInput `json:"payments"`
+	AgreementIDs   []uint                `json:"agreement_ids"` // 不传时取关联收款的协议
+	Version        uint                  `json:"version"`
+}
+
+// UninvoicedPayment 未开票收款
+type UninvoicedPayment struct {
+	PaymentID        uint      `json:"payment_id"`
+	CustomerID       uint      `json:"customer_id"`
+	CustomerName     string    `json:"customer_name"`
+	AgreementID      uint      `json:"agreement_id"`
+	AgreementNumber  string    `json:"agreement_number"`
+	PaymentDate      time.Time `json:"payment_date"`
+	PaymentMethod    string    `json:"payment_method"`
+	Amount           float64   `json:"amount"`            // 收款金额
+	RefundedAmount   float64   `json:"refunded_amount"`   // 已退款金额
+	InvoicedAmount   float64   `json:"invoiced_amount"`   // 已开票金额（不含作废、红冲发票）
+	UninvoicedAmount float64   `json:"uninvoiced_amount"` // 未开票金额 = 收款 − 退款 − 已开票
+	Days             int       `json:"days"`              // 收款至今天数
+}
+
+// UnpaidInvoice 未收款发票
+type UnpaidInvoice struct {
+	InvoiceID     uint               `json:"invoice_id"`
+	InvoiceCode   string             `json:"invoice_code"`
+	InvoiceNumber string             `json:"invoice_number"`
+	Type          models.InvoiceType `json:"type"`
+	CustomerID    uint               `json:"customer_id"`
+	CustomerName  string             `json:"customer_name"`
+	IssueDate     time.Time          `json:"issue_date"`
+	Amount        float64            `json:"amount"`        // 价税合计
+	PaidAmount    float64            `json:"paid_amount"`   // 已关联收款金额
+	UnpaidAmount  float64            `json:"unpaid_amount"` // 未收款金额
+	Days          int                `json:"days"`          // 开票至今天数
+}
+
+// GetInvoices 获取发票列表
+func GetInvoices(c *gin.Context) {
+	query := config.DB.Model(&models.Invoice{}).Preload("Customer").Preload("Payments")
+
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if invoiceType := c.Query("type"); invoiceType != "" {
+		query = query.Where("type = ?", invoiceType)
+	}
+	if paymentID := c.Query("payment_id"); paymentID != "" {
+		query = query.Where("id IN (?)", config.DB.Model(&models.InvoicePayment{}).Select("invoice_id").Where("payment_id = ?", paymentID))
+	}
+	if agreementID := c.Query("agreement_id"); agreementID != "" {
+		query = query.Where("id IN (?)", config.DB.Table("invoice_agreements").Select("invoice_id").Where("agreement_id = ?", agreementID))
+	}
+	// 按发票号码/购买方搜索
+	if keyword := c.Query("keyword"); keyword != "" {
+		query = query.Where("invoice_number LIKE ? OR buyer_name LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		if t, err := time.ParseInLocation("2006-01-02", startDate, time.Local); err == nil {
+			query = query.Where("issue_date >= ?", t)
+		}
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		if t, err := time.ParseInLocation("2006-01-02", endDate, time.Local); err == nil {
+			query = query.Where("issue_date < ?", t.AddDate(0, 0, 1))
+		}
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var invoices []models.Invoice
+	if err := query.Order("issue_date DESC, id DESC").Find(&invoices).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch invoices: "+err.Error())
+		return
+	}
+
+	SuccessPaginatedResponse(c, total, invoices)
+}
+
+// GetInvoice 获取发票详情，含关联收款和协议
+func GetInvoice(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid invoice ID")
+		return
+	}
+
+	var invoice models.Invoice
+	if err := loadInvoice(config.DB, &invoice, uint(id)); err != nil {
+		ErrorResponse(c, 404, "Invoice not found")
+		return
+	}
+
+	setETag(c, invoice.Version)
+	SuccessResponse(c, invoice)
+}
+
+// CreateInvoice 登记发票
+func CreateInvoice(c *gin.Context) {
+	var req InvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	invoice, links, agreements, err := prepareInvoice(config.DB, &req, nil)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	invoice.OperatorID = CurrentPersonID(c)
+
+	err = createInvoice(invoice, links, agreements)
+	if errors.Is(err, errUninvoicedAmountChanged) {
+		ErrorResponse(c, 409, err.Error())
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to create invoice: "+err.Error())
+		return
+	}
+
+	loadInvoice(config.DB, invoice, invoice.ID)
+	publishEvent(models.WebhookEventInvoiceCreated, invoice)
+
+	setETag(c, invoice.Version)
+	SuccessResponse(c, invoice)
+}
+
+// UpdateInvoice 更新发票，整体替换关联的收款和协议
+func UpdateInvoice(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid invoice ID")
+		return
+	}
+
+	var current models.Invoice
+	if err := config.DB.First(&current, id).Error; err != nil {
+		ErrorResponse(c, 404, "Invoice not found")
+		return
+	}
+
+	var req InvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	invoice, links, agreements, err := prepareInvoice(config.DB, &req, &current)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if !matchVersion(c, current.Version, req.Version) {
+		return
+	}
+
+	err = updateInvoice(invoice, &current, links, agreements)
+	if err == errVersionConflict || errors.Is(err, errUninvoicedAmountChanged) {
+		ErrorResponse(c, 409, err.Error())
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to update invoice: "+err.Error())
+		return
+	}
+
+	loadInvoice(config.DB, invoice, invoice.ID)
+	publishEvent(models.WebhookEventInvoiceUpdated, invoice)
+
+	setETag(c, invoice.Version)
+	SuccessResponse(c, invoice)
+}
+
+// DeleteInvoice 删除发票及其关联
+func DeleteInvoice(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid invoice ID")
+		return
+	}
+
+	var invoice models.Invoice
+	if err := config.DB.First(&invoice, id).Error; err != nil {
+		ErrorResponse(c, 404, "Invoice not found")
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("invoice_id = ?", invoice.ID).Delete(&models.InvoicePayment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&invoice).Association("Agreements").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&invoice).Error
+	})
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to delete invoice: "+err.Error())
+		return
+	}
+
+	publishEvent(models.WebhookEventInvoiceDeleted, gin.H{"id": invoice.ID, "customer_id": invoice.CustomerID, "invoice_number": invoice.InvoiceNumber})
+
+	SuccessResponse(c, gin.H{"message": "Invoice deleted successfully"})
+}
+
+// GetUninvoicedPayments 未开票收款报表：收款净额（扣除退款）尚未全部开票的收款
+func GetUninvoicedPayments(c *gin.Context) {
+	rows, err := uninvoicedPayments(c)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to build uninvoiced payments: "+err.Error())
+		return
+	}
+
+	var totalAmount float64
+	for _, row := range rows {
+		totalAmount += row.UninvoicedAmount
+	}
+
+	SuccessResponse(c, gin.H{
+		"count":        len(rows),
+		"total_amount": roundMoney(totalAmount),
+		"items":        rows,
+	})
+}
+
+// GetUnpaidInvoices 未收款发票报表：已开具发票中尚未关联足额收款的发票
+func GetUnpaidInvoices(c *gin.Context) {
+	rows, err := unpaidInvoices(c)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to build unpaid invoices: "+err.Error())
+		return
+	}
+
+	var totalAmount float64
+	for _, row := range rows {
+		totalAmount += row.UnpaidAmount
+	}
+
+	SuccessResponse(c, gin.H{
+		"count":        len(rows),
+		"total_amount": roundMoney(totalAmount),
+		"items":        rows,
+	})
+}
+
+// ExportInvoiceReconciliation 导出开票对账表（未开票收款、未收款发票）
+func ExportInvoiceReconciliation(c *gin.Context) {
+	payments, err := uninvoicedPayments(c)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to build uninvoiced payments: "+err.Error())
+		return
+	}
+	invoices, err := unpaidInvoices(c)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to build unpaid invoices: "+err.Error())
+		return
+	}
+
+	content, err := invoiceReconciliationWorkbook(payments, invoices)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to export invoice reconciliation: "+err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("开票对账表_%s.xlsx", time.Now().Format("20060102"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Data(200, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", content)
+}
+
+// ============ 辅助函数 ============
+
+// prepareInvoice 校验发票请求，计算税额，校验关联的收款和协议
+// current 为更新前的发票，创建时为 nil
+func prepareInvoice(db *gorm.DB, req *InvoiceRequest, current *models.Invoice) (*models.Invoice, []models.InvoicePayment, []models.Agreement, error) {
+	invoice := &models.Invoice{
+		InvoiceCode:    strings.TrimSpace(req.InvoiceCode),
+		InvoiceNumber:  strings.TrimSpace(req.InvoiceNumber),
+		Type:           req.Type,
+		CustomerID:     req.CustomerID,
+		BuyerName:      req.BuyerName,
+		BuyerTaxNumber: req.BuyerTaxNumber,
+		Amount:         roundMoney(req.Amount),
+		TaxRate:        req.TaxRate,
+		Status:         req.Status,
+		Remark:         req.Remark,
+	}
+	if current != nil {
+		invoice.ID = current.ID
+		invoice.OperatorID = current.OperatorID
+		invoice.CreatedAt = current.CreatedAt
+	}
+
+	if invoice.InvoiceNumber == "" {
+		return nil, nil, nil, errors.New("invoice_number is required")
+	}
+	if invoice.Type != models.InvoiceTypeNormal && invoice.Type != models.InvoiceTypeSpecial {
+		return nil, nil, nil, fmt.Errorf("Invalid invoice type: %s", invoice.Type)
+	}
+	if invoice.Status == "" {
+		invoice.Status = models.InvoiceStatusIssued
+	}
+	if err := validateInvoiceStatus(invoice.Status); err != nil {
+		return nil, nil, nil, err
+	}
+	if invoice.Amount <= 0 {
+		return nil, nil, nil, errors.New("Amount must be positive, red-letter invoices are recorded by setting the original invoice to 已红冲")
+	}
+	if invoice.TaxRate < 0 || invoice.TaxRate >= 1 {
+		return nil, nil, nil, errors.New("tax_rate must be between 0 and 1, e.g. 0.06")
+	}
+
+	invoice.TaxAmount = roundMoney(invoice.Amount * invoice.TaxRate / (1 + invoice.TaxRate))
+	if req.TaxAmount != nil {
+		invoice.TaxAmount = roundMoney(*req.TaxAmount)
+	}
+	if invoice.TaxAmount < 0 || invoice.TaxAmount > invoice.Amount {
+		return nil, nil, nil, errors.New("tax_amount must be between 0 and the invoice amount")
+	}
+	invoice.PretaxAmount = roundMoney(invoice.Amount - invoice.TaxAmount)
+
+	issueDate, err := parseDayOrToday(req.IssueDate)
+	if err != nil {
+		return nil, nil, nil, errors.New("Invalid issue_date, expected YYYY-MM-DD")
+	}
+	invoice.IssueDate = issueDate
+
+	var customer models.Customer
+	if err := db.First(&customer, invoice.CustomerID).Error; err != nil {
+		return nil, nil, nil, errors.New("Customer not found")
+	}
+	invoice.BuyerName = firstNonEmpty(invoice.BuyerName, customer.Name)
+	invoice.BuyerTaxNumber = firstNonEmpty(invoice.BuyerTaxNumber, customer.TaxNumber)
+
+	var count int64
+	db.Model(&models.Invoice{}).Where("invoice_code = ? AND invoice_number = ? AND id <> ?", invoice.InvoiceCode, invoice.InvoiceNumber, invoice.ID).Count(&count)
+	if count > 0 {
+		return nil, nil, nil, fmt.Errorf("Invoice %s already exists", invoice.InvoiceCode+invoice.InvoiceNumber)
+	}
+
+	links, err := invoicePaymentLinks(db, invoice, req.Payments)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	agreements, err := invoiceAgreements(db, invoice.CustomerID, req.AgreementIDs, links)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return invoice, links, agreements, nil
+}
+
+// invoicePaymentLinks 校验发票关联的收款：须属于同一客户，已开具发票的对应金额不能超过收款的未开票金额，合计不能超过发票金额
+func invoicePaymentLinks(db *gorm.DB, invoice *models.Invoice, inputs []InvoicePaymentInput) ([]models.InvoicePayment, error) {
+	links := make([]models.InvoicePayment, 0, len(inputs))
+	seen := make(map[uint]bool)
+	remaining := invoice.Amount
+	for _, input := range inputs {
+		if seen[input.PaymentID] {
+			return nil, fmt.Errorf("Payment %d is listed more than once", input.PaymentID)
+		}
+		seen[input.PaymentID] = true
+
+		var payment models.Payment
+		if err := db.First(&payment, input.PaymentID).Error; err != nil {
+			return nil, fmt.Errorf("Payment %d not found", input.PaymentID)
+		}
+		if payment.CustomerID != invoice.CustomerID {
+			return nil, fmt.Errorf("Payment %d belongs to another customer", payment.ID)
+		}
+
+		uninvoiced := roundMoney(payment.Amount - payment.RefundedAmount - invoicedAmount(db, payment.ID, invoice.ID))
+		amount := roundMoney(input.Amount)
+		if amount == 0 {
+			amount = roundMoney(math.Min(uninvoiced, remaining))
+		}
+		if amount <= 0 {
+			return nil, fmt.Errorf("Payment %d has no uninvoiced amount left", payment.ID)
+		}
+		if invoice.Status == models.InvoiceStatusIssued && amount > uninvoiced {
+			return nil, fmt.Errorf("Payment %d: amount exceeds the uninvoiced amount %.2f", payment.ID, uninvoiced)
+		}
+		remaining = roundMoney(remaining - amount)
+		links = append(links, models.InvoicePayment{PaymentID: payment.ID, Amount: amount})
+	}
+	if remaining < 0 {
+		return nil, errors.New("Total of linked payment amounts exceeds the invoice amount")
+	}
+	return links, nil
+}
+
+// invoiceAgreements 校验发票关联的协议，未指定时取关联收款的协议
+func invoiceAgreements(db *gorm.DB, customerID uint, agreementIDs []uint, links []models.InvoicePayment) ([]models.Agreement, error) {
+	if agreementIDs == nil && len(links) > 0 {
+		paymentIDs := make([]uint, len(links))
+		for i, link := range links {
+			paymentIDs[i] = link.PaymentID
+		}
+		db.Model(&models.Payment{}).Where("id IN ? AND agreement_id <> 0", paymentIDs).Distinct().Pluck("agreement_id", &agreementIDs)
+	}
+	if len(agreementIDs) == 0 {
+		return nil, nil
+	}
+
+	var agreements []models.Agreement
+	if err := db.Where("id IN ?", agreementIDs).Order("id ASC").Find(&agreements).Error; err != nil {
+		return nil, err
+	}
+	found := make(map[uint]bool)
+	for _, agreement := range agreements {
+		if agreement.CustomerID != customerID {
+			return nil, fmt.Errorf("Agreement %d belongs to another customer", agreement.ID)
+		}
+		found[agreement.ID] = true
+	}
+	for _, id := range agreementIDs {
+		if !found[id] {
+			return nil, fmt.Errorf("Agreement %d not found", id)
+		}
+	}
+	return agreements, nil
+}
+
+// createInvoice 在同一事务中创建发票及其关联
+func createInvoice(invoice *models.Invoice, links []models.InvoicePayment, agreements []models.Agreement) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(invoice).Error; err != nil {
+			return err
+		}
+		if err := recheckInvoicePayments(tx, invoice, links); err != nil {
+			return err
+		}
+		return saveInvoiceLinks(tx, invoice, links, agreements)
+	})
+}
+
+// updateInvoice 在同一事务中按版本号更新发票并替换其关联
+func updateInvoice(invoice, current *models.Invoice, links []models.InvoicePayment, agreements []models.Agreement) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Invoice{}).Where("id = ? AND version = ?", current.ID, current.Version).Updates(map[string]interface{}{
+			"invoice_code":     invoice.InvoiceCode,
+			"invoice_number":   invoice.InvoiceNumber,
+			"type":             invoice.Type,
+			"customer_id":      invoice.CustomerID,
+			"buyer_name":       invoice.BuyerName,
+			"buyer_tax_number": invoice.BuyerTaxNumber,
+			"amount":           invoice.Amount,
+			"tax_rate":         invoice.TaxRate,
+			"tax_amount":       invoice.TaxAmount,
+			"pretax_amount":    invoice.PretaxAmount,
+			"issue_date":       invoice.IssueDate,
+			"status":           invoice.Status,
+			"remark":           invoice.Remark,
+			"version":          current.Version + 1,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVersionConflict
+		}
+		if err := tx.Where("invoice_id = ?", current.ID).Delete(&models.InvoicePayment{}).Error; err != nil {
+			return err
+		}
+		if err := recheckInvoicePayments(tx, invoice, links); err != nil {
+			return err
+		}
+		return saveInvoiceLinks(tx, invoice, links, agreements)
+	})
+}
+
+// recheckInvoicePayments 在事务内（已写入发票之后）重新校验已开具发票的关联金额不超过收款的未开票金额，
+// 防止并发开票或退款使收款超开
+func recheckInvoicePayments(tx *gorm.DB, invoice *models.Invoice, links []models.InvoicePayment) error {
+	if invoice.Status != models.InvoiceStatusIssued {
+		return nil
+	}
+	for _, link := range links {
+		var payment models.Payment
+		if err := tx.First(&payment, link.PaymentID).Error; err != nil {
+			return err
+		}
+		uninvoiced := roundMoney(payment.Amount - payment.RefundedAmount - invoicedAmount(tx, payment.ID, invoice.ID))
+		if link.Amount > uninvoiced {
+			return fmt.Errorf("%w: payment %d has %.2f uninvoiced", errUninvoicedAmountChanged, payment.ID, uninvoiced)
+		}
+	}
+	return nil
+}
+
+// saveInvoiceLinks 写入发票与收款、协议的关联
+func saveInvoiceLinks(tx *gorm.DB, invoice *models.Invoice, links []models.InvoicePayment, agreements []models.Agreement) error {
+	for i := range links {
+		links[i].InvoiceID = invoice.ID
+	}
+	if len(links) > 0 {
+		if err := tx.Create(&links).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Model(invoice).Association("Agreements").Replace(agreements)
+}
+
+// loadInvoice 加载发票及其客户、收款和协议
+func loadInvoice(db *gorm.DB, invoice *models.Invoice, id uint) error {
+	*invoice = models.Invoice{}
+	return db.Preload("Customer").Preload("Payments", func(db *gorm.DB) *gorm.DB {
+		return db.Order("payment_id ASC")
+	}).Preload("Payments.Payment").Preload("Agreements", orderByID).First(invoice, id).Error
+}
+
+// validateInvoiceStatus 校验发票状态
+func validateInvoiceStatus(status models.InvoiceStatus) error {
+	switch status {
+	case models.InvoiceStatusIssued, models.InvoiceStatusVoided, models.InvoiceStatusReversed:
+		return nil
+	}
+	return fmt.Errorf("Invalid invoice status: %s", status)
+}
+
+// invoicedAmount 收款在已开具发票中的开票金额，excludeInvoiceID 为正在更新的发票
+func invoicedAmount(db *gorm.DB, paymentID, excludeInvoiceID uint) float64 {
+	var total float64
+	db.Model(&models.InvoicePayment{}).
+		Joins("JOIN invoices ON invoices.id = invoice_payments.invoice_id").
+		Where("invoice_payments.payment_id = ? AND invoices.status = ? AND invoices.id <> ?", paymentID, models.InvoiceStatusIssued, excludeInvoiceID).
+		Select("COALESCE(SUM(invoice_payments.amount), 0)").Scan(&total)
+	return total
+}
+
+// invoiceLinkTotals 按收款或发票汇总已开具发票的关联金额，groupColumn 为 payment_id 或 invoice_id
+func invoiceLinkTotals(db *gorm.DB, groupColumn string) map[uint]float64 {
+	var rows []struct {
+		ID     uint
+		Amount float64
+	}
+	db.Model(&models.InvoicePayment{}).
+		Joins("JOIN invoices ON invoices.id = invoice_payments.invoice_id").
+		Where("invoices.status = ?", models.InvoiceStatusIssued).
+		Select("invoice_payments." + groupColumn + " AS id, SUM(invoice_payments.amount) AS amount").
+		Group("invoice_payments." + groupColumn).Scan(&rows)
+
+	totals := make(map[uint]float64, len(rows))
+	for _, row := range rows {
+		totals[row.ID] = row.Amount
+	}
+	return totals
+}
+
+// uninvoicedPayments 按客户、协议和收款日期筛选未开票收款，按收款日期升序
+func uninvoicedPayments(c *gin.Context) ([]UninvoicedPayment, error) {
+	query := config.DB.Model(&models.Payment{}).Preload("Customer").Preload("Agreement")
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	if agreementID := c.Query("agreement_id"); agreementID != "" {
+		query = query.Where("agreement_id = ?", agreementID)
+	}
+	if method := c.Query("payment_method"); method != "" {
+		query = query.Where("payment_method = ?", method)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		if t, err := time.ParseInLocation("2006-01-02", startDate, time.Local); err == nil {
+			query = query.Where("payment_date >= ?", t)
+		}
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		if t, err := time.ParseInLocation("2006-01-02", endDate, time.Local); err == nil {
+			query = query.Where("payment_date < ?", t.AddDate(0, 0, 1))
+		}
+	}
+
+	var payments []models.Payment
+	if err := query.Order("payment_date ASC, id ASC").Find(&payments).Error; err != nil {
+		return nil, err
+	}
+
+	invoiced := invoiceLinkTotals(config.DB, "payment_id")
+	today := startOfDay(time.Now())
+	rows := []UninvoicedPayment{}
+	for _, payment := range payments {
+		uninvoiced := roundMoney(payment.Amount - payment.RefundedAmount - invoiced[payment.ID])
+		if uninvoiced <= 0 {
+			continue
+		}
+		row := UninvoicedPayment{
+			PaymentID:        payment.ID,
+			CustomerID:       payment.CustomerID,
+			AgreementID:      payment.AgreementID,
+			PaymentDate:      payment.PaymentDate,
+			PaymentMethod:    payment.PaymentMethod,
+			Amount:           payment.Amount,
+			RefundedAmount:   payment.RefundedAmount,
+			InvoicedAmount:   roundMoney(invoiced[payment.ID]),
+			UninvoicedAmount: uninvoiced,
+			Days:             -daysUntil(today, payment.PaymentDate),
+		}
+		if payment.Customer != nil {
+			row.CustomerName = payment.Customer.Name
+		}
+		if payment.Agreement != nil {
+			row.AgreementNumber = payment.Agreement.AgreementNumber
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// unpaidInvoices 按客户、类型和开票日期筛选未收款发票，按开票日期升序
+func unpaidInvoices(c *gin.Context) ([]UnpaidInvoice, error) {
+	query := config.DB.Model(&models.Invoice{}).Preload("Customer").Where("status = ?", models.InvoiceStatusIssued)
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	if invoiceType := c.Query("type"); invoiceType != "" {
+		query = query.Where("type = ?", invoiceType)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		if t, err := time.ParseInLocation("2006-01-02", startDate, time.Local); err == nil {
+			query = query.Where("issue_date >= ?", t)
+		}
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		if t, err := time.ParseInLocation("2006-01-02", endDate, time.Local); err == nil {
+			query = query.Where("issue_date < ?", t.AddDate(0, 0, 1))
+		}
+	}
+
+	var invoices []models.Invoice
+	if err := query.Order("issue_date ASC, id ASC").Find(&invoices).Error; err != nil {
+		return nil, err
+	}
+
+	paid := invoiceLinkTotals(config.DB, "invoice_id")
+	today := startOfDay(time.Now())
+	rows := []UnpaidInvoice{}
+	for _, invoice := range invoices {
+		unpaid := roundMoney(invoice.Amount - paid[invoice.ID])
+		if unpaid <= 0 {
+			continue
+		}
+		row := UnpaidInvoice{
+			InvoiceID:     invoice.ID,
+			InvoiceCode:   invoice.InvoiceCode,
+			InvoiceNumber: invoice.InvoiceNumber,
+			Type:          invoice.Type,
+			CustomerID:    invoice.CustomerID,
+			IssueDate:     invoice.IssueDate,
+			Amount:        invoice.Amount,
+			PaidAmount:    roundMoney(paid[invoice.ID]),
+			UnpaidAmount:  unpaid,
+			Days:          -daysUntil(today, invoice.IssueDate),
+		}
+		if invoice.Customer != nil {
+			row.CustomerName = invoice.Customer.Name
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// invoiceReconciliationWorkbook 生成开票对账表Excel
+func invoiceReconciliationWorkbook(payments []UninvoicedPayment, invoices []UnpaidInvoice) ([]byte, error) {
+	excelService := import_export.NewExcelService()
+	defer excelService.Close()
+	file := excelService.GetFile()
+
+	paymentSheet := "未开票收款"
+	file.SetSheetName("Sheet1", paymentSheet)
+	if err := excelService.SetSheetHeader(paymentSheet, []string{"收款记录ID", "客户", "协议编号", "收款日期", "收款方式",
+		"收款金额", "已退款", "已开票", "未开票金额", "收款天数"}); err != nil {
+		return nil, err
+	}
+	var paymentTotal float64
+	paymentRows := make([][]interface{}, 0, len(payments)+1)
+	for _, p := range payments {
+		paymentRows = append(paymentRows, []interface{}{p.PaymentID, p.CustomerName, p.AgreementNumber, p.PaymentDate.Format("2006-01-02"),
+			p.PaymentMethod, p.Amount, p.RefundedAmount, p.InvoicedAmount, p.UninvoicedAmount, p.Days})
+		paymentTotal += p.UninvoicedAmount
+	}
+	paymentRows = append(paymentRows, []interface{}{"合计", "", "", "", "", "", "", "", roundMoney(paymentTotal), ""})
+	if err := excelService.WriteRows(paymentSheet, 2, paymentRows); err != nil {
+		return nil, err
+	}
+	excelService.SetBorderStyle(paymentSheet, "A2", fmt.Sprintf("J%d", len(paymentRows)+1))
+
+	invoiceSheet := "未收款发票"
+	excelService.CreateSheet(invoiceSheet)
+	if err := excelService.SetSheetHeader(invoiceSheet, []string{"发票代码", "发票号码", "发票类型", "客户", "开票日期",
+		"价税合计", "已收款", "未收款金额", "开票天数"}); err != nil {
+		return nil, err
+	}
+	var invoiceTotal float64
+	invoiceRows := make([][]interface{}, 0, len(invoices)+1)
+	for _, inv := range invoices {
+		invoiceRows = append(invoiceRows, []interface{}{inv.InvoiceCode, inv.InvoiceNumber, string(inv.Type), inv.CustomerName,
+			inv.IssueDate.Format("2006-01-02"), inv.Amount, inv.PaidAmount, inv.UnpaidAmount, inv.Days})
+		invoiceTotal += inv.UnpaidAmount
+	}
+	invoiceRows = append(invoiceRows, []interface{}{"合计", "", "", "", "", "", "", roundMoney(invoiceTotal), ""})
+	if err := excelService.WriteRows(invoiceSheet, 2, invoiceRows); err != nil {
+		return nil, err
+	}
+	excelService.SetBorderStyle(invoiceSheet, "A2", fmt.Sprintf("I%d", len(invoiceRows)+1))
+
+	excelService.SetActiveSheet(paymentSheet)
+
+	buf, err := file.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"erp/models"
+	"errors"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestRecheckInvoicePayments(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Payment{}, &models.Invoice{}, &models.InvoicePayment{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 收款1000，已退款100；已开具发票占用600，已作废发票的关联不占用
+	db.Create(&models.Payment{ID: 1, CustomerID: 1, Amount: 1000, RefundedAmount: 100})
+	db.Create(&models.Invoice{ID: 1, CustomerID: 1, InvoiceNumber: "1", Amount: 600, Status: models.InvoiceStatusIssued})
+	db.Create(&models.Invoice{ID: 2, CustomerID: 1, InvoiceNumber: "2", Amount: 300, Status: models.InvoiceStatusVoided})
+	db.Create(&models.InvoicePayment{InvoiceID: 1, PaymentID: 1, Amount: 600})
+	db.Create(&models.InvoicePayment{InvoiceID: 2, PaymentID: 1, Amount: 300})
+
+	tests := []struct {
+		name    string
+		invoice models.Invoice
+		amount  float64
+		wantErr bool
+	}{
+		{"新发票开满剩余金额", models.Invoice{ID: 3, Status: models.InvoiceStatusIssued}, 300, false},
+		{"新发票超过剩余金额", models.Invoice{ID: 3, Status: models.InvoiceStatusIssued}, 300.01, true},
+		{"更新发票时不计本发票原有关联", models.Invoice{ID: 1, Status: models.InvoiceStatusIssued}, 900, false},
+		{"更新发票超过未开票金额", models.Invoice{ID: 1, Status: models.InvoiceStatusIssued}, 900.01, true},
+		{"作废发票不校验", models.Invoice{ID: 2, Status: models.InvoiceStatusVoided}, 5000, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links := []models.InvoicePayment{{PaymentID: 1, Amount: tt.amount}}
+			err := recheckInvoicePayments(db, &tt.invoice, links)
+			if got := errors.Is(err, errUninvoicedAmountChanged); got != tt.wantErr {
+				t.Errorf("err = %v, want conflict %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"erp/services/import_export"
+	"erp/utils"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// invoiceColumnAliases 发票导入的列名，兼容开票平台导出文件和本系统模板，按顺序取第一个有值的列
+var invoiceColumnAliases = map[string][]string{
+	"number":     {"数电票号码", "发票号码"},
+	"code":       {"发票代码"},
+	"type":       {"发票票种", "发票类型", "发票种类"},
+	"buyer":      {"购买方名称", "购方名称"},
+	"tax_number": {"购方识别号", "购买方纳税人识别号", "购方纳税人识别号", "购买方识别号"},
+	"date":       {"开票日期"},
+	"tax":        {"税额"},
+	"amount":     {"价税合计"},
+	"rate":       {"税率", "税率/征收率"},
+	"status":     {"发票状态"},
+	"positive":   {"是否正数发票"},
+	"remark":     {"备注"},
+	"payments":   {"收款记录ID"},
+	"agreements": {"协议编号"},
+}
+
+// ImportInvoices 从开票平台导出的Excel导入发票
+// 按发票代码+号码判断是否已存在：skip 跳过，update 更新票面信息和状态（保留已关联的收款和协议）
+func ImportInvoices(c *gin.Context) {
+	filePath, err := utils.SaveUploadedFile(c, "file")
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	defer utils.CleanupTempFile(filePath)
+
+	strategy := import_export.ImportStrategy(firstNonEmpty(c.PostForm("strategy"), string(import_export.StrategySkip)))
+	if strategy != import_export.StrategySkip && strategy != import_export.StrategyUpdate {
+		ErrorResponse(c, 400, "无效的冲突策略，必须是: skip, update")
+		return
+	}
+
+	result, err := importInvoiceFile(filePath, strategy, CurrentPersonID(c))
+	if err != nil {
+		ErrorResponse(c, 400, fmt.Sprintf("导入失败: %v", err))
+		return
+	}
+
+	publishEvent(models.WebhookEventImportCompleted, gin.H{
+		"type":    "invoices",
+		"total":   result.Total,
+		"success": result.Success,
+		"failed":  result.Failed,
+	})
+
+	SuccessResponse(c, result)
+}
+
+// ============ 辅助函数 ============
+
+// importInvoiceFile 读取第一个工作表逐行导入发票
+func importInvoiceFile(filePath string, strategy import_export.ImportStrategy, operatorID *uint) (*import_export.ImportResult, error) {
+	excelService, err := import_export.NewExcelServiceFromFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("打开Excel文件失败: %w", err)
+	}
+	defer excelService.Close()
+
+	sheets := excelService.GetFile().GetSheetList()
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("Excel文件没有工作表")
+	}
+	rows, err := excelService.GetRows(sheets[0])
+	if err != nil {
+		return nil, fmt.Errorf("读取Excel数据失败: %w", err)
+	}
+	if len(rows) < 2 {
+		return nil, fmt.Errorf("Excel文件没有数据行")
+	}
+
+	colIndex := make(map[string]int)
+	for i, header := range rows[0] {
+		colIndex[strings.TrimSpace(header)] = i
+	}
+	for _, key := range []string{"number", "amount", "date"} {
+		if !hasInvoiceColumn(colIndex, key) {
+			return nil, fmt.Errorf("缺少必需的列: %s", strings.Join(invoiceColumnAliases[key], "或"))
+		}
+	}
+	if !hasInvoiceColumn(colIndex, "buyer") && !hasInvoiceColumn(colIndex, "tax_number") {
+		return nil, fmt.Errorf("缺少必需的列: 购买方名称或购方识别号")
+	}
+
+	result := &import_export.ImportResult{
+		Total:  len(rows) - 1,
+		Errors: []import_export.ImportError{},
+	}
+	for i := 1; i < len(rows); i++ {
+		getCell := func(key string) string {
+			for _, name := range invoiceColumnAliases[key] {
+				if idx, ok := colIndex[name]; ok && idx < len(rows[i]) {
+					if value := strings.TrimSpace(rows[i][idx]); value != "" {
+						return value
+					}
+				}
+			}
+			return ""
+		}
+		if importErr := importInvoiceRow(getCell, i+1, strategy, operatorID); importErr != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, *importErr)
+		} else {
+			result.Success++
+		}
+	}
+	return result, nil
+}
+
+// importInvoiceRow 导入单张发票，新发票未指定收款时自动关联金额相符的唯一一笔未开票收款
+func importInvoiceRow(getCell func(string) string, rowNum int, strategy import_export.ImportStrategy, operatorID *uint) *import_export.ImportError {
+	rowError := func(column, format string, args ...interface{}) *import_export.ImportError {
+		return &import_export.ImportError{Row: rowNum, Column: column, Message: fmt.Sprintf(format, args...)}
+	}
+
+	req := InvoiceRequest{
+		InvoiceNumber:  getCell("number"),
+		Type:           models.InvoiceTypeNormal,
+		BuyerName:      getCell("buyer"),
+		BuyerTaxNumber: getCell("tax_number"),
+		Status:         models.InvoiceStatusIssued,
+		Remark:         getCell("remark"),
+	}
+	if req.InvoiceNumber == "" {
+		return rowError("发票号码", "发票号码不能为空")
+	}
+	// 数电票只有20位号码，税控发票为代码+号码
+	if len(req.InvoiceNumber) != 20 {
+		req.InvoiceCode = getCell("code")
+	}
+	if strings.Contains(getCell("type"), "专") {
+		req.Type = models.InvoiceTypeSpecial
+	}
+	status := getCell("status")
+	switch {
+	case strings.Contains(status, "作废"):
+		req.Status = models.InvoiceStatusVoided
+	case strings.Contains(status, "红冲") && !strings.Contains(status, "部分"):
+		req.Status = models.InvoiceStatusReversed
+	}
+
+	amount, err := parseInvoiceMoney(getCell("amount"))
+	if err != nil {
+		return rowError("价税合计", "价税合计格式错误: %s", getCell("amount"))
+	}
+	if amount < 0 || getCell("positive") == "否" {
+		return rowError("价税合计", "红字发票不单独导入，请将对应蓝字发票的状态更新为已红冲")
+	}
+	req.Amount = amount
+
+	if value := getCell("tax"); value != "" {
+		tax, err := parseInvoiceMoney(value)
+		if err != nil {
+			return rowError("税额", "税额格式错误: %s", value)
+		}
+		req.TaxAmount = &tax
+	}
+	if value := getCell("rate"); value != "" {
+		rate, err := parseInvoiceTaxRate(value)
+		if err != nil {
+			return rowError("税率", "税率格式错误: %s", value)
+		}
+		req.TaxRate = rate
+	} else if req.TaxAmount != nil && amount > *req.TaxAmount {
+		// 平台基础信息表不含税率，按税额 ÷ 不含税金额推算
+		req.TaxRate = math.Round(*req.TaxAmount/(amount-*req.TaxAmount)*100) / 100
+	}
+
+	// 平台导出的开票日期带时间
+	dateValue := getCell("date")
+	if fields := strings.Fields(dateValue); len(fields) > 0 {
+		dateValue = fields[0]
+	}
+	issueDate, err := import_export.ParseDate(dateValue)
+	if err != nil {
+		return rowError("开票日期", "开票日期格式错误: %s", getCell("date"))
+	}
+	req.IssueDate = issueDate.Format("2006-01-02")
+
+	// 按购方识别号、名称匹配客户
+	var customer models.Customer
+	found := req.BuyerTaxNumber != "" && config.DB.Where("tax_number = ?", req.BuyerTaxNumber).First(&customer).Error == nil
+	if !found && req.BuyerName != "" {
+		found = config.DB.Where("name = ?", req.BuyerName).First(&customer).Error == nil
+	}
+	if !found {
+		return rowError("购买方名称", "未找到购买方对应的客户: %s %s", req.BuyerName, req.BuyerTaxNumber)
+	}
+	req.CustomerID = customer.ID
+
+	var existing models.Invoice
+	if config.DB.Where("invoice_code = ? AND invoice_number = ?", req.InvoiceCode, req.InvoiceNumber).First(&existing).Error == nil {
+		if strategy == import_export.StrategySkip {
+			return nil
+		}
+		return updateImportedInvoice(&req, &existing, rowNum)
+	}
+
+	for _, value := range splitInvoiceList(getCell("payments")) {
+		paymentID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return rowError("收款记录ID", "收款记录ID必须是整数: %s", value)
+		}
+		req.Payments = append(req.Payments, InvoicePaymentInput{PaymentID: uint(paymentID)})
+	}
+	for _, number := range splitInvoiceList(getCell("agreements")) {
+		var agreement models.Agreement
+		if err := config.DB.Where("agreement_number = ?", number).First(&agreement).Error; err != nil {
+			return rowError("协议编号", "协议不存在: %s", number)
+		}
+		req.AgreementIDs = append(req.AgreementIDs, agreement.ID)
+	}
+	if len(req.Payments) == 0 && req.Status == models.InvoiceStatusIssued {
+		req.Payments = matchInvoicePayment(customer.ID, req.Amount)
+	}
+
+	invoice, links, agreements, err := prepareInvoice(config.DB, &req, nil)
+	if err != nil {
+		return rowError("", "%s", err.Error())
+	}
+	invoice.OperatorID = operatorID
+	if err := createInvoice(invoice, links, agreements); err != nil {
+		return rowError("", "创建失败: %v", err)
+	}
+
+	loadInvoice(config.DB, invoice, invoice.ID)
+	publishEvent(models.WebhookEventInvoiceCreated, invoice)
+	return nil
+}
+
+// updateImportedInvoice 用导入数据更新已存在的发票，保留已关联的收款和协议
+func updateImportedInvoice(req *InvoiceRequest, current *models.Invoice, rowNum int) *import_export.ImportError {
+	var links []models.InvoicePayment
+	config.DB.Where("invoice_id = ?", current.ID).Order("payment_id ASC").Find(&links)
+	req.Payments = make([]InvoicePaymentInput, len(links))
+	for i, link := range links {
+		req.Payments[i] = InvoicePaymentInput{PaymentID: link.PaymentID, Amount: link.Amount}
+	}
+	req.AgreementIDs = []uint{}
+	config.DB.Table("invoice_agreements").Where("invoice_id = ?", current.ID).Order("agreement_id ASC").Pluck("agreement_id", &req.AgreementIDs)
+
+	invoice, newLinks, agreements, err := prepareInvoice(config.DB, req, current)
+	if err != nil {
+		return &import_export.ImportError{Row: rowNum, Message: err.Error()}
+	}
+	if err := updateInvoice(invoice, current, newLinks, agreements); err != nil {
+		return &import_export.ImportError{Row: rowNum, Message: fmt.Sprintf("更新失败: %v", err)}
+	}
+
+	loadInvoice(config.DB, invoice, invoice.ID)
+	publishEvent(models.WebhookEventInvoiceUpdated, invoice)
+	return nil
+}
+
+// matchInvoicePayment 客户恰有一笔未开票金额等于发票金额的收款时返回该收款
+func matchInvoicePayment(customerID uint, amount float64) []InvoicePaymentInput {
+	var payments []models.Payment
+	config.DB.Where("customer_id = ?", customerID).Find(&payments)
+
+	invoiced := invoiceLinkTotals(config.DB, "payment_id")
+	var matched []InvoicePaymentInput
+	for _, payment := range payments {
+		if roundMoney(payment.Amount-payment.RefundedAmount-invoiced[payment.ID]) == roundMoney(amount) {
+			matched = append(matched, InvoicePaymentInput{PaymentID: payment.ID})
+		}
+	}
+	if len(matched) != 1 {
+		return nil
+	}
+	return matched
+}
+
+// hasInvoiceColumn 表头是否包含某项的任一列名
+func hasInvoiceColumn(colIndex map[string]int, key string) bool {
+	for _, name := range invoiceColumnAliases[key] {
+		if _, ok := colIndex[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseInvoiceMoney 解析金额，忽略千分位和货币符号
+func parseInvoiceMoney(value string) (float64, error) {
+	value = strings.NewReplacer(",", "", "¥", "", "￥", "").Replace(value)
+	return strconv.ParseFloat(strings.TrimSpace(value), 64)
+}
+
+// parseInvoiceTaxRate 解析税率，支持 6%、0.06 和免税/不征税
+func parseInvoiceTaxRate(value string) (float64, error) {
+	if strings.Contains(value, "免税") || strings.Contains(value, "不征税") {
+		return 0, nil
+	}
+	if strings.HasSuffix(value, "%") {
+		rate, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		return rate / 100, err
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// splitInvoiceList 拆分逗号或顿号分隔的列表
+func splitInvoiceList(value string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '，' || r == '、' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
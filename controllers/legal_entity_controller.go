@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateLegalEntity 创建外部法人实体
+func CreateLegalEntity(c *gin.Context) {
+	var entity models.LegalEntity
+	if err := c.ShouldBindJSON(&entity); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if entity.Name == "" || entity.CreditCode == "" {
+		ErrorResponse(c, 400, "Name and credit code are required")
+		return
+	}
+
+	if err := config.DB.Create(&entity).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to create legal entity: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, entity)
+}
+
+// GetLegalEntities 获取外部法人实体列表
+func GetLegalEntities(c *gin.Context) {
+	var entities []models.LegalEntity
+	var total int64
+
+	// 获取查询参数
+	keyword := c.Query("keyword")
+
+	query := config.DB.Model(&models.LegalEntity{})
+
+	// 按名称/统一社会信用代码搜索
+	if keyword != "" {
+		query = query.Where("name LIKE ? OR credit_code LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+	}
+
+	// 获取总数
+	query.Count(&total)
+
+	// 获取列表
+	if err := query.Find(&entities).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch legal entities: "+err.Error())
+		return
+	}
+
+	SuccessPaginatedResponse(c, total, entities)
+}
+
+// GetLegalEntity 获取外部法人实体详情（含持股的企业）
+func GetLegalEntity(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid legal entity ID")
+		return
+	}
+
+	var entity models.LegalEntity
+	if err := config.DB.First(&entity, id).Error; err != nil {
+		ErrorResponse(c, 404, "Legal entity not found")
+		return
+	}
+
+	var customers []models.Customer
+	if entity.InvestorCustomerIDs != "" {
+		config.DB.Where("id IN ?", StringToIDs(entity.InvestorCustomerIDs)).Find(&customers)
+	}
+
+	setETag(c, entity.Version)
+	SuccessResponse(c, gin.H{
+		"entity":    entity,
+		"customers": customers,
+	})
+}
+
+// UpdateLegalEntity 更新外部法人实体
+func UpdateLegalEntity(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid legal entity ID")
+		return
+	}
+
+	var entity models.LegalEntity
+	if err := config.DB.First(&entity, id).Error; err != nil {
+		ErrorResponse(c, 404, "Legal entity not found")
+		return
+	}
+
+	var updateData models.LegalEntity
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if !matchVersion(c, entity.Version, updateData.Version) {
+		return
+	}
+
+	// 持股的企业ID由客户维护，不接受客户端写入（零值字段不会被更新）
+	updateData.InvestorCustomerIDs = ""
+
+	// 更新字段（以读取时的版本为条件，防止覆盖他人的修改）
+	updateData.Version = entity.Version + 1
+	if !updateVersioned(c, config.DB.Model(&entity), entity.Version, updateData) {
+		return
+	}
+
+	// 重新获取更新后的数据
+	config.DB.First(&entity, id)
+
+	setETag(c, entity.Version)
+	SuccessResponse(c, entity)
+}
+
+// legalEntityPatchFields 外部法人可通过 PATCH 修改的字段，持股的企业ID由客户维护
+var legalEntityPatchFields = patchFields{
+	"name":        "name",
+	"credit_code": "credit_code",
+	"remark":      "remark",
+	"version":     "",
+}
+
+// PatchLegalEntity 部分更新外部法人实体（JSON Merge Patch），值为 null 的字段被清空
+func PatchLegalEntity(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid legal entity ID")
+		return
+	}
+
+	var entity models.LegalEntity
+	if err := config.DB.First(&entity, id).Error; err != nil {
+		ErrorResponse(c, 404, "Legal entity not found")
+		return
+	}
+
+	var patched models.LegalEntity
+	columns, ok := bindMergePatch(c, entity, &patched, legalEntityPatchFields)
+	if !ok {
+		return
+	}
+
+	if patched.Name == "" || patched.CreditCode == "" {
+		ErrorResponse(c, 400, "Name and credit code are required")
+		return
+	}
+
+	if !matchVersion(c, entity.Version, patched.Version) {
+		return
+	}
+
+	patched.Version = entity.Version + 1
+	if !updateVersioned(c, config.DB.Model(&entity).Select(append(columns, "version")), entity.Version, &patched) {
+		return
+	}
+
+	config.DB.First(&entity, id)
+
+	setETag(c, entity.Version)
+	SuccessResponse(c, entity)
+}
+
+// DeleteLegalEntity 删除外部法人实体
+func DeleteLegalEntity(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid legal entity ID")
+		return
+	}
+
+	// 仍被客户引用为股东时不允许删除
+	var count int64
+	config.DB.Raw(`
+		SELECT COUNT(*) FROM customers
+		WHERE investors IS NOT NULL
+		AND json_valid(investors)
+		AND EXISTS (
+			SELECT 1 FROM json_each(investors)
+			WHERE CAST(json_extract(value, '$.entity_id') AS INTEGER) = ?
+		)
+	`, id).Scan(&count)
+	if count > 0 {
+		ErrorResponse(c, 400, "Legal entity is still an investor of existing customers")
+		return
+	}
+
+	if err := config.DB.Delete(&models.LegalEntity{}, id).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to delete legal entity: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "Legal entity deleted successfully"})
+}
@@ -0,0 +1,437 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"erp/services/notification"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	taskDueSoonDays       = 3  // 任务到期前提醒天数
+	agreementExpiringDays = 30 // 协议到期前提醒天数
+)
+
+// ============ 站内信 ============
+
+// GetMyNotifications 获取当前人员的站内信
+func GetMyNotifications(c *gin.Context) {
+	personID := CurrentPersonID(c)
+	if personID == nil {
+		ErrorResponse(c, 401, "Missing X-Person-ID header")
+		return
+	}
+
+	var notifications []models.Notification
+	var total int64
+
+	query := config.DB.Model(&models.Notification{}).Where("person_id = ?", *personID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read = ?", false)
+	}
+
+	query.Count(&total)
+
+	if err := query.Order("created_at DESC").Find(&notifications).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch notifications: "+err.Error())
+		return
+	}
+
+	SuccessPaginatedResponse(c, total, notifications)
+}
+
+// GetMyUnreadNotificationCount 获取当前人员的未读站内信数量
+func GetMyUnreadNotificationCount(c *gin.Context) {
+	personID := CurrentPersonID(c)
+	if personID == nil {
+		ErrorResponse(c, 401, "Missing X-Person-ID header")
+		return
+	}
+
+	var count int64
+	config.DB.Model(&models.Notification{}).Where("person_id = ? AND read = ?", *personID, false).Count(&count)
+
+	SuccessResponse(c, gin.H{"unread": count})
+}
+
+// MarkNotificationRead 标记站内信为已读
+func MarkNotificationRead(c *gin.Context) {
+	personID := CurrentPersonID(c)
+	if personID == nil {
+		ErrorResponse(c, 401, "Missing X-Person-ID header")
+		return
+	}
+
+	result := config.DB.Model(&models.Notification{}).
+		Where("id = ? AND person_id = ?", c.Param("id"), *personID).
+		Updates(map[string]interface{}{"read": true, "read_at": time.Now()})
+	if result.Error != nil {
+		ErrorResponse(c, 500, "Failed to update notification: "+result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		ErrorResponse(c, 404, "Notification not found")
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "Notification marked as read"})
+}
+
+// MarkAllNotificationsRead 标记当前人员的全部站内信为已读
+func MarkAllNotificationsRead(c *gin.Context) {
+	personID := CurrentPersonID(c)
+	if personID == nil {
+		ErrorResponse(c, 401, "Missing X-Person-ID header")
+		return
+	}
+
+	result := config.DB.Model(&models.Notification{}).
+		Where("person_id = ? AND read = ?", *personID, false).
+		Updates(map[string]interface{}{"read": true, "read_at": time.Now()})
+	if result.Error != nil {
+		ErrorResponse(c, 500, "Failed to update notifications: "+result.Error.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"updated": result.RowsAffected})
+}
+
+// ============ 通知偏好 ============
+
+// NotificationPreferenceItem 通知偏好设置项
+type NotificationPreferenceItem struct {
+	Event      models.NotificationEvent     `json:"event"`
+	Channels   []models.NotificationChannel `json:"channels"`
+	WebhookURL string                       `json:"webhook_url"`
+}
+
+// GetMyNotificationPreferences 获取当前人员的通知偏好（含各事件的生效渠道）
+func GetMyNotificationPreferences(c *gin.Context) {
+	personID := CurrentPersonID(c)
+	if personID == nil {
+		ErrorResponse(c, 401, "Missing X-Person-ID header")
+		return
+	}
+
+	var prefs []models.NotificationPreference
+	config.DB.Where("person_id = ?", *personID).Find(&prefs)
+
+	effective := make([]NotificationPreferenceItem, 0, len(models.NotificationEvents))
+	for _, event := range models.NotificationEvents {
+		channels, webhookURL := config.Notifier.Channels(*personID, event)
+		effective = append(effective, NotificationPreferenceItem{
+			Event:      event,
+			Channels:   channels,
+			WebhookURL: webhookURL,
+		})
+	}
+
+	SuccessResponse(c, gin.H{
+		"preferences": prefs,
+		"effective":   effective,
+	})
+}
+
+// UpdateMyNotificationPreferences 设置当前人员的通知偏好（按事件覆盖，event 为 "*" 表示默认设置）
+func UpdateMyNotificationPreferences(c *gin.Context) {
+	personID := CurrentPersonID(c)
+	if personID == nil {
+		ErrorResponse(c, 401, "Missing X-Person-ID header")
+		return
+	}
+
+	var items []NotificationPreferenceItem
+	if err := c.ShouldBindJSON(&items); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	for _, item := range items {
+		if item.Event != models.NotificationEventAll && !isValidNotificationEvent(item.Event) {
+			ErrorResponse(c, 400, "Invalid notification event: "+string(item.Event))
+			return
+		}
+		names := make([]string, 0, len(item.Channels))
+		for _, channel := range item.Channels {
+			if len(notification.ParseChannels(string(channel))) == 0 {
+				ErrorResponse(c, 400, "Invalid notification channel: "+string(channel))
+				return
+			}
+			names = append(names, string(channel))
+		}
+
+		pref := models.NotificationPreference{PersonID: *personID, Event: item.Event}
+		config.DB.Where(pref).FirstOrInit(&pref)
+		pref.Channels = strings.Join(names, ",")
+		pref.WebhookURL = item.WebhookURL
+		if err := config.DB.Save(&pref).Error; err != nil {
+			ErrorResponse(c, 500, "Failed to save notification preference: "+err.Error())
+			return
+		}
+	}
+
+	GetMyNotificationPreferences(c)
+}
+
+// ============ 通知模板 ============
+
+// GetNotificationTemplates 获取所有事件的有效模板
+func GetNotificationTemplates(c *gin.Context) {
+	templates := make([]notification.Template, 0, len(models.NotificationEvents))
+	for _, event := range models.NotificationEvents {
+		templates = append(templates, config.Notifier.Template(event))
+	}
+
+	SuccessResponse(c, templates)
+}
+
+// UpdateNotificationTemplate 自定义事件的通知模板
+func UpdateNotificationTemplate(c *gin.Context) {
+	event := models.NotificationEvent(c.Param("event"))
+	if !isValidNotificationEvent(event) {
+		ErrorResponse(c, 400, "Invalid notification event: "+string(event))
+		return
+	}
+
+	var req models.NotificationTemplate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+	if req.Subject == "" || req.Body == "" {
+		ErrorResponse(c, 400, "Subject and body are required")
+		return
+	}
+	if err := notification.ValidateTemplate(req.Subject, req.Body); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	tmpl := models.NotificationTemplate{Event: event}
+	config.DB.Where(tmpl).FirstOrInit(&tmpl)
+	tmpl.Subject = req.Subject
+	tmpl.Body = req.Body
+	if err := config.DB.Save(&tmpl).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to save notification template: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, config.Notifier.Template(event))
+}
+
+// DeleteNotificationTemplate 删除自定义模板，恢复为内置模板
+func DeleteNotificationTemplate(c *gin.Context) {
+	event := models.NotificationEvent(c.Param("event"))
+	if err := config.DB.Where("event = ?", event).Delete(&models.NotificationTemplate{}).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to delete notification template: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, config.Notifier.Template(event))
+}
+
+// ============ 发件箱 ============
+
+// GetNotificationOutbox 获取邮件/Webhook发件箱
+func GetNotificationOutbox(c *gin.Context) {
+	var items []models.NotificationOutbox
+	var total int64
+
+	status := c.Query("status")
+	channel := c.Query("channel")
+
+	query := config.DB.Model(&models.NotificationOutbox{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if channel != "" {
+		query = query.Where("channel = ?", channel)
+	}
+
+	query.Count(&total)
+
+	if err := query.Order("created_at DESC").Find(&items).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch outbox: "+err.Error())
+		return
+	}
+
+	SuccessPaginatedResponse(c, total, items)
+}
+
+// RetryNotificationOutbox 立即重新投递发件箱记录
+func RetryNotificationOutbox(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid outbox ID")
+		return
+	}
+
+	item, err := config.Notifier.Retry(uint(id))
+	if item == nil {
+		ErrorResponse(c, 404, "Outbox item not found")
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	SuccessResponse(c, item)
+}
+
+// ScanNotifications 手动执行通知事件扫描
+func ScanNotifications(c *gin.Context) {
+	if err := ScanNotificationEvents(); err != nil {
+		ErrorResponse(c, 500, "Failed to scan notification events: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "Notification events scanned successfully"})
+}
+
+// ============ 事件触发 ============
+
+// ScanNotificationEvents 扫描任务到期、任务逾期和协议到期事件并发送通知
+// 由每日定时任务调用，同一事件对同一接收人只通知一次
+func ScanNotificationEvents() error {
+	today := startOfDay(time.Now())
+
+	// 3天内到期的任务（含今天），漏跑或新建的任务在后续扫描中补发
+	var dueSoon []models.Task
+	if err := config.DB.Preload("Customer").
+		Where(openTaskCondition()).Where("due_date >= ? AND due_date < ?", today, today.AddDate(0, 0, taskDueSoonDays+1)).
+		Find(&dueSoon).Error; err != nil {
+		return err
+	}
+	for _, task := range dueSoon {
+		if err := notifyTask(models.NotificationEventTaskDueSoon, &task); err != nil {
+			return err
+		}
+	}
+
+	// 已逾期的任务
+	var overdue []models.Task
+	if err := config.DB.Preload("Customer").
+		Where(openTaskCondition()).Where("due_date < ?", today).
+		Find(&overdue).Error; err != nil {
+		return err
+	}
+	for _, task := range overdue {
+		if err := notifyTask(models.NotificationEventTaskOverdue, &task); err != nil {
+			return err
+		}
+	}
+
+	// 即将到期的有效协议
+	var agreements []models.Agreement
+	if err := config.DB.Preload("Customer").
+		Where("status = ? AND end_date >= ? AND end_date < ?", models.AgreementStatusActive, today, today.AddDate(0, 0, agreementExpiringDays+1)).
+		Find(&agreements).Error; err != nil {
+		return err
+	}
+	for _, agreement := range agreements {
+		customerName := ""
+		if agreement.Customer != nil {
+			customerName = agreement.Customer.Name
+		}
+		_, err := config.Notifier.Notify(notification.Message{
+			Event:     models.NotificationEventAgreementExpiring,
+			PersonIDs: customerServicePersonIDs(agreement.CustomerID),
+			Data: map[string]interface{}{
+				"AgreementNumber": agreement.AgreementNumber,
+				"CustomerName":    customerName,
+				"EndDate":         agreement.EndDate.Format("2006-01-02"),
+				"DaysLeft":        daysUntil(today, agreement.EndDate),
+				"Amount":          agreement.Amount,
+			},
+			RefType:  "agreement",
+			RefID:    agreement.ID,
+			DedupKey: fmt.Sprintf("%s:%d:%s", models.NotificationEventAgreementExpiring, agreement.ID, agreement.EndDate.Format("2006-01-02")),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// notifyTask 通知任务负责人，未分配时通知客户的服务人员
+func notifyTask(event models.NotificationEvent, task *models.Task) error {
+	recipients := customerServicePersonIDs(task.CustomerID)
+	if task.AssigneeID != nil {
+		recipients = []uint{*task.AssigneeID}
+	}
+
+	customerName := ""
+	if task.Customer != nil {
+		customerName = task.Customer.Name
+	}
+	dueDate := task.DueDate.Format("2006-01-02")
+
+	_, err := config.Notifier.Notify(notification.Message{
+		Event:     event,
+		PersonIDs: recipients,
+		Data: map[string]interface{}{
+			"TaskTitle":    task.Title,
+			"CustomerName": customerName,
+			"DueDate":      dueDate,
+			"Status":       task.Status,
+			"Priority":     task.Priority,
+		},
+		RefType:  "task",
+		RefID:    task.ID,
+		DedupKey: fmt.Sprintf("%s:%d:%s", event, task.ID, dueDate),
+	})
+	return err
+}
+
+// notifyPaymentRecorded 通知客户的服务人员已登记收款
+func notifyPaymentRecorded(payment *models.Payment) {
+	var customer models.Customer
+	config.DB.First(&customer, payment.CustomerID)
+
+	_, err := config.Notifier.Notify(notification.Message{
+		Event:     models.NotificationEventPaymentRecorded,
+		PersonIDs: customerServicePersonIDs(payment.CustomerID),
+		Data: map[string]interface{}{
+			"CustomerName":  customer.Name,
+			"Amount":        payment.Amount,
+			"PaymentDate":   payment.PaymentDate.Format("2006-01-02"),
+			"PaymentMethod": payment.PaymentMethod,
+			"Period":        payment.Period,
+		},
+		RefType: "payment",
+		RefID:   payment.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to notify payment %d: %v", payment.ID, err)
+	}
+}
+
+// ============ 辅助函数 ============
+
+// customerServicePersonIDs 获取客户的服务人员ID
+func customerServicePersonIDs(customerID uint) []uint {
+	var customer models.Customer
+	if config.DB.First(&customer, customerID).Error != nil {
+		return nil
+	}
+	return StringToIDs(customer.ServicePersonIDs)
+}
+
+// isValidNotificationEvent 检查通知事件是否有效
+func isValidNotificationEvent(event models.NotificationEvent) bool {
+	for _, item := range models.NotificationEvents {
+		if item == event {
+			return true
+		}
+	}
+	return false
+}
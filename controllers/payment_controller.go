@@ -3,10 +3,12 @@ package controllers
 import (
 	"erp/config"
 	"erp/models"
+	"errors"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // CreatePayment 创建收款记录
@@ -17,11 +19,30 @@ func CreatePayment(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Create(&payment).Error; err != nil {
+	// 余额抵扣通过客户账户接口生成，退款金额由退款记录维护
+	if payment.PaymentMethod == models.PaymentMethodBalance {
+		ErrorResponse(c, 400, "Balance payments must be created via /api/customers/:id/account/apply")
+		return
+	}
+	payment.RefundedAmount = 0
+	payment.AttributionOverridden = false
+
+	// 业绩默认归属客户当前的服务人员，与收款在同一事务中写入
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&payment).Error; err != nil {
+			return err
+		}
+		return attributePayment(tx, &payment)
+	})
+	if err != nil {
 		ErrorResponse(c, 500, "Failed to create payment: "+err.Error())
 		return
 	}
 
+	// 通知客户的服务人员
+	notifyPaymentRecorded(&payment)
+	publishEvent(models.WebhookEventPaymentCreated, payment)
+
 	SuccessResponse(c, payment)
 }
 
@@ -75,11 +96,12 @@ func GetPayment(c *gin.Context) {
 	}
 
 	var payment models.Payment
-	if err := config.DB.Preload("Customer").Preload("Agreement").First(&payment, id).Error; err != nil {
+	if err := config.DB.Preload("Customer").Preload("Agreement").Preload("Refunds").First(&payment, id).Error; err != nil {
 		ErrorResponse(c, 404, "Payment not found")
 		return
 	}
 
+	setETag(c, payment.Version)
 	SuccessResponse(c, payment)
 }
 
@@ -103,12 +125,112 @@ func UpdatePayment(c *gin.Context) {
 		return
 	}
 
-	// 更新字段
-	config.DB.Model(&payment).Updates(updateData)
+	// 未提交的字段保持不变（零值不更新）
+	updateData.RefundedAmount = 0
+	updateData.AttributionOverridden = false
+	customerID, amount := payment.CustomerID, payment.Amount
+	if updateData.CustomerID != 0 {
+		customerID = updateData.CustomerID
+	}
+	if updateData.Amount != 0 {
+		amount = updateData.Amount
+	}
+	if err := checkPaymentChange(&payment, customerID, amount, firstNonEmpty(updateData.PaymentMethod, payment.PaymentMethod)); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if !matchVersion(c, payment.Version, updateData.Version) {
+		return
+	}
+
+	// 更新字段（以读取时的版本为条件，防止覆盖他人的修改）
+	previousCustomerID := payment.CustomerID
+	updateData.Version = payment.Version + 1
+	if !updateVersioned(c, config.DB.Model(&payment), payment.Version, updateData) {
+		return
+	}
 
 	// 重新获取更新后的数据
 	config.DB.Preload("Customer").Preload("Agreement").First(&payment, id)
 
+	// 收款改挂其他客户时，业绩改为归属新客户的服务人员
+	if payment.CustomerID != previousCustomerID {
+		if err := attributePayment(config.DB, &payment); err != nil {
+			ErrorResponse(c, 500, "Failed to attribute payment: "+err.Error())
+			return
+		}
+	}
+
+	publishEvent(models.WebhookEventPaymentUpdated, payment)
+
+	setETag(c, payment.Version)
+	SuccessResponse(c, payment)
+}
+
+// paymentPatchFields 收款记录可通过 PATCH 修改的字段
+var paymentPatchFields = patchFields{
+	"customer_id":    "customer_id",
+	"agreement_id":   "agreement_id",
+	"amount":         "amount",
+	"payment_date":   "payment_date",
+	"payment_method": "payment_method",
+	"period":         "period",
+	"remark":         "remark",
+	"version":        "",
+}
+
+// PatchPayment 部分更新收款记录（JSON Merge Patch），值为 null 的字段被清空（如取消关联协议）
+func PatchPayment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid payment ID")
+		return
+	}
+
+	var payment models.Payment
+	if err := config.DB.First(&payment, id).Error; err != nil {
+		ErrorResponse(c, 404, "Payment not found")
+		return
+	}
+
+	var patched models.Payment
+	columns, ok := bindMergePatch(c, payment, &patched, paymentPatchFields)
+	if !ok {
+		return
+	}
+
+	if patched.CustomerID == 0 {
+		ErrorResponse(c, 400, "Customer is required")
+		return
+	}
+	if err := checkPaymentChange(&payment, patched.CustomerID, patched.Amount, patched.PaymentMethod); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if !matchVersion(c, payment.Version, patched.Version) {
+		return
+	}
+
+	previousCustomerID := payment.CustomerID
+	patched.Version = payment.Version + 1
+	if !updateVersioned(c, config.DB.Model(&payment).Select(append(columns, "version")), payment.Version, &patched) {
+		return
+	}
+
+	config.DB.Preload("Customer").Preload("Agreement").First(&payment, id)
+
+	if payment.CustomerID != previousCustomerID {
+		if err := attributePayment(config.DB, &payment); err != nil {
+			ErrorResponse(c, 500, "Failed to attribute payment: "+err.Error())
+			return
+		}
+	}
+
+	publishEvent(models.WebhookEventPaymentUpdated, payment)
+
+	setETag(c, payment.Version)
 	SuccessResponse(c, payment)
 }
 
@@ -120,10 +242,48 @@ func DeletePayment(c *gin.Context) {
 		return
 	}
 
-	if err := config.DB.Delete(&models.Payment{}, id).Error; err != nil {
+	// 校验、删除、退回余额和删除业绩归属在同一事务中完成，并发删除时只有一方生效
+	var payment models.Payment
+	var entry *models.CustomerAccountEntry
+	var rejected error
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&payment, id).Error; err != nil {
+			return err
+		}
+		if rejected = checkPaymentDeletable(tx, &payment); rejected != nil {
+			return rejected
+		}
+		result := tx.Delete(&models.Payment{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return gorm.ErrRecordNotFound
+		}
+		// 余额抵扣的收款删除后金额退回客户余额
+		var err error
+		if entry, err = restorePaymentBalance(tx, &payment, CurrentPersonID(c)); err != nil {
+			return err
+		}
+		return tx.Where("payment_id = ?", id).Delete(&models.PaymentAttribution{}).Error
+	})
+	if rejected != nil {
+		ErrorResponse(c, 400, rejected.Error())
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ErrorResponse(c, 404, "Payment not found")
+		return
+	}
+	if err != nil {
 		ErrorResponse(c, 500, "Failed to delete payment: "+err.Error())
 		return
 	}
 
+	publishEvent(models.WebhookEventPaymentDeleted, gin.H{"id": uint(id), "customer_id": payment.CustomerID})
+	if entry != nil {
+		publishEvent(models.WebhookEventBalanceChanged, entry)
+	}
+
 	SuccessResponse(c, gin.H{"message": "Payment deleted successfully"})
 }
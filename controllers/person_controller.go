@@ -87,6 +87,7 @@ func GetPerson(c *gin.Context) {
 		"service":        customers["service"],
 	}
 
+	setETag(c, person.Version)
 	SuccessResponse(c, personData)
 }
 
@@ -110,8 +111,15 @@ func UpdatePerson(c *gin.Context) {
 		return
 	}
 
-	// 更新字段
-	config.DB.Model(&person).Updates(updateData)
+	if !matchVersion(c, person.Version, updateData.Version) {
+		return
+	}
+
+	// 更新字段（以读取时的版本为条件，防止覆盖他人的修改）
+	updateData.Version = person.Version + 1
+	if !updateVersioned(c, config.DB.Model(&person), person.Version, updateData) {
+		return
+	}
 
 	// 更新关联客户的ID字段
 	updatePersonCustomerIDs(&updateData)
@@ -119,6 +127,57 @@ func UpdatePerson(c *gin.Context) {
 	// 重新获取更新后的数据
 	config.DB.First(&person, id)
 
+	setETag(c, person.Version)
+	SuccessResponse(c, person)
+}
+
+// personPatchFields 人员可通过 PATCH 修改的字段，关联客户ID由客户维护
+var personPatchFields = patchFields{
+	"type":    "type",
+	"name":    "name",
+	"phone":   "phone",
+	"email":   "email",
+	"id_card": "id_card",
+	"version": "",
+}
+
+// PatchPerson 部分更新人员（JSON Merge Patch），值为 null 的字段被清空
+func PatchPerson(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid person ID")
+		return
+	}
+
+	var person models.Person
+	if err := config.DB.First(&person, id).Error; err != nil {
+		ErrorResponse(c, 404, "Person not found")
+		return
+	}
+
+	var patched models.Person
+	columns, ok := bindMergePatch(c, person, &patched, personPatchFields)
+	if !ok {
+		return
+	}
+
+	if patched.Name == "" || patched.Type == "" || patched.Phone == "" {
+		ErrorResponse(c, 400, "Name, type and phone are required")
+		return
+	}
+
+	if !matchVersion(c, person.Version, patched.Version) {
+		return
+	}
+
+	patched.Version = person.Version + 1
+	if !updateVersioned(c, config.DB.Model(&person).Select(append(columns, "version")), person.Version, &patched) {
+		return
+	}
+
+	config.DB.First(&person, id)
+
+	setETag(c, person.Version)
 	SuccessResponse(c, person)
 }
 
@@ -135,6 +194,10 @@ func DeletePerson(c *gin.Context) {
 		return
 	}
 
+	// 删除人员文档和证照
+	deleteOwnerDocuments(models.DocumentOwnerPerson, uint(id))
+	deleteOwnerCredentials(models.DocumentOwnerPerson, uint(id))
+
 	SuccessResponse(c, gin.H{"message": "Person deleted successfully"})
 }
 
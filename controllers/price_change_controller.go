@@ -0,0 +1,406 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errPendingPriceChange 协议明细有待生效的价格变更
+var errPendingPriceChange = errors.New("Agreement has a pending price change on its items, delete it before replacing the items")
+
+// PriceChangeRequest 协议价格变更请求
+// 无明细的协议填写 new_amount；有明细的协议填写 agreement_item_id 及调整后的 unit_price 和/或 discount
+type PriceChangeRequest struct {
+	Kind            models.PriceChangeKind `json:"kind"`                              // 调价/优惠，默认调价
+	EffectiveDate   string                 `json:"effective_date" binding:"required"` // 生效日期 YYYY-MM-DD
+	NewAmount       *float64               `json:"new_amount"`                        // 变更后的协议金额（每个收费周期）
+	AgreementItemID *uint                  `json:"agreement_item_id"`                 // 调整的协议明细
+	UnitPrice       *float64               `json:"unit_price"`                        // 明细调整后的单价
+	Discount        *float64               `json:"discount"`                          // 明细调整后的优惠
+	Reason          string                 `json:"reason"`                            // 变更原因
+}
+
+// GetAgreementPriceChanges 获取协议的价格变更记录
+func GetAgreementPriceChanges(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid agreement ID")
+		return
+	}
+
+	var changes []models.AgreementPriceChange
+	if err := config.DB.Where("agreement_id = ?", id).Order("effective_date ASC, id ASC").Find(&changes).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch price changes: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, changes)
+}
+
+// GetPriceChanges 获取价格变更列表，可按状态、生效日期筛选（如查看即将生效的调价）
+func GetPriceChanges(c *gin.Context) {
+	query := config.DB.Model(&models.AgreementPriceChange{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		if t, err := time.ParseInLocation("2006-01-02", startDate, time.Local); err == nil {
+			query = query.Where("effective_date >= ?", t)
+		}
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		if t, err := time.ParseInLocation("2006-01-02", endDate, time.Local); err == nil {
+			query = query.Where("effective_date < ?", t.AddDate(0, 0, 1))
+		}
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var changes []models.AgreementPriceChange
+	if err := query.Order("effective_date ASC, id ASC").Find(&changes).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch price changes: "+err.Error())
+		return
+	}
+
+	SuccessPaginatedResponse(c, total, changes)
+}
+
+// CreateAgreementPriceChange 登记协议价格变更，生效日期不晚于今天的立即生效，否则由每日任务在生效日更新协议金额
+func CreateAgreementPriceChange(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid agreement ID")
+		return
+	}
+
+	var agreement models.Agreement
+	if err := config.DB.First(&agreement, id).Error; err != nil {
+		ErrorResponse(c, 404, "Agreement not found")
+		return
+	}
+	if agreement.Status == models.AgreementStatusCancelled {
+		ErrorResponse(c, 400, "Cannot change the price of a cancelled agreement")
+		return
+	}
+
+	var req PriceChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	change, err := buildPriceChange(&req, &agreement)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	change.OperatorID = CurrentPersonID(c)
+
+	due := !change.EffectiveDate.After(startOfDay(time.Now()))
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(change).Error; err != nil {
+			return err
+		}
+		if due {
+			return applyPriceChange(tx, change)
+		}
+		return nil
+	})
+	if err == errVersionConflict {
+		ErrorResponse(c, 409, err.Error())
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to create price change: "+err.Error())
+		return
+	}
+
+	publishEvent(models.WebhookEventPriceChanged, change)
+	if due {
+		config.DB.Preload("Items", orderByID).First(&agreement, agreement.ID)
+		publishEvent(models.WebhookEventAgreementUpdated, agreement)
+	}
+
+	SuccessResponse(c, change)
+}
+
+// DeleteAgreementPriceChange 删除待生效的价格变更，已生效的变更不能删除（可再登记一次变更恢复价格）
+func DeleteAgreementPriceChange(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid agreement ID")
+		return
+	}
+	changeID, err := strconv.ParseUint(c.Param("changeId"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid price change ID")
+		return
+	}
+
+	var change models.AgreementPriceChange
+	if err := config.DB.Where("agreement_id = ?", id).First(&change, changeID).Error; err != nil {
+		ErrorResponse(c, 404, "Price change not found")
+		return
+	}
+	if change.Status != models.PriceChangePending {
+		ErrorResponse(c, 400, "Applied price changes cannot be deleted")
+		return
+	}
+
+	if err := config.DB.Where("status = ?", models.PriceChangePending).Delete(&change).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to delete price change: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "Price change deleted successfully"})
+}
+
+// ApplyDuePriceChanges 使生效日期已到的价格变更生效（每日定时任务）
+func ApplyDuePriceChanges() error {
+	var changes []models.AgreementPriceChange
+	if err := config.DB.Where("status = ? AND effective_date < ?", models.PriceChangePending, startOfDay(time.Now()).AddDate(0, 0, 1)).
+		Order("effective_date ASC, id ASC").Find(&changes).Error; err != nil {
+		return err
+	}
+
+	for i := range changes {
+		change := &changes[i]
+		if err := config.DB.Transaction(func(tx *gorm.DB) error {
+			return applyPriceChange(tx, change)
+		}); err != nil {
+			log.Printf("Failed to apply price change %d: %v", change.ID, err)
+			continue
+		}
+
+		var agreement models.Agreement
+		config.DB.Preload("Items", orderByID).First(&agreement, change.AgreementID)
+		publishEvent(models.WebhookEventPriceChanged, change)
+		publishEvent(models.WebhookEventAgreementUpdated, agreement)
+	}
+	return nil
+}
+
+// ============ 辅助函数 ============
+
+// buildPriceChange 校验请求并生成价格变更，变更前后金额按协议当前价格计算
+func buildPriceChange(req *PriceChangeRequest, agreement *models.Agreement) (*models.AgreementPriceChange, error) {
+	kind := req.Kind
+	if kind == "" {
+		kind = models.PriceChangeAdjustment
+	}
+	if kind != models.PriceChangeAdjustment && kind != models.PriceChangeDiscount {
+		return nil, fmt.Errorf("Invalid kind: %s", kind)
+	}
+
+	effective, err := time.ParseInLocation("2006-01-02", req.EffectiveDate, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid effective_date, expected YYYY-MM-DD")
+	}
+	if !agreement.StartDate.IsZero() && effective.Before(startOfDay(agreement.StartDate)) {
+		return nil, fmt.Errorf("effective_date cannot be earlier than the agreement start date")
+	}
+	if !agreement.EndDate.IsZero() && effective.After(agreement.EndDate) {
+		return nil, fmt.Errorf("effective_date cannot be later than the agreement end date")
+	}
+
+	// 同一协议同时只能有一项待生效的变更，生效日期不能早于已生效的变更
+	var last models.AgreementPriceChange
+	if config.DB.Where("agreement_id = ?", agreement.ID).Order("effective_date DESC, id DESC").First(&last).Error == nil {
+		if last.Status == models.PriceChangePending {
+			return nil, fmt.Errorf("Agreement already has a pending price change effective %s", last.EffectiveDate.Format("2006-01-02"))
+		}
+		if effective.Before(last.EffectiveDate) {
+			return nil, fmt.Errorf("effective_date cannot be earlier than the previous price change on %s", last.EffectiveDate.Format("2006-01-02"))
+		}
+	}
+
+	change := &models.AgreementPriceChange{
+		AgreementID:   agreement.ID,
+		Kind:          kind,
+		EffectiveDate: effective,
+		OldAmount:     agreement.Amount,
+		Reason:        req.Reason,
+		Status:        models.PriceChangePending,
+	}
+
+	items := loadAgreementItems(agreement.ID)
+	if len(items) == 0 {
+		if req.NewAmount == nil || *req.NewAmount < 0 {
+			return nil, fmt.Errorf("new_amount is required and must not be negative")
+		}
+		if req.AgreementItemID != nil || req.UnitPrice != nil || req.Discount != nil {
+			return nil, fmt.Errorf("Agreement has no items, use new_amount")
+		}
+		change.NewAmount = roundMoney(*req.NewAmount)
+	} else {
+		if req.AgreementItemID == nil || (req.UnitPrice == nil && req.Discount == nil) {
+			return nil, fmt.Errorf("Agreement has items, agreement_item_id and unit_price or discount are required")
+		}
+		if req.NewAmount != nil {
+			return nil, fmt.Errorf("new_amount is derived from the items and cannot be set")
+		}
+		item := findAgreementItem(items, *req.AgreementItemID)
+		if item == nil {
+			return nil, fmt.Errorf("Agreement item %d not found", *req.AgreementItemID)
+		}
+		if item.FeeType == models.FeeTypeOneTime {
+			return nil, fmt.Errorf("One-off items cannot have price changes")
+		}
+		if req.UnitPrice != nil {
+			if *req.UnitPrice < 0 {
+				return nil, fmt.Errorf("unit_price must not be negative")
+			}
+			unitPrice := roundMoney(*req.UnitPrice)
+			change.UnitPrice = &unitPrice
+		}
+		if req.Discount != nil {
+			if *req.Discount < 0 {
+				return nil, fmt.Errorf("discount must not be negative")
+			}
+			discount := roundMoney(*req.Discount)
+			change.Discount = &discount
+		}
+		change.AgreementItemID = &item.ID
+		if err := changeAgreementItem(item, change); err != nil {
+			return nil, err
+		}
+		amount, _, err := agreementItemTotals(agreement.FeeType, items)
+		if err != nil {
+			return nil, err
+		}
+		change.NewAmount = amount
+	}
+
+	if kind == models.PriceChangeDiscount && change.NewAmount > change.OldAmount {
+		return nil, fmt.Errorf("A discount cannot increase the agreement amount")
+	}
+	if change.NewAmount == change.OldAmount {
+		return nil, fmt.Errorf("The new price is the same as the current price")
+	}
+	return change, nil
+}
+
+// applyPriceChange 在事务中使价格变更生效：更新协议金额（有明细时先更新明细再重新计算），记录实际的变更前后金额
+func applyPriceChange(tx *gorm.DB, change *models.AgreementPriceChange) error {
+	var agreement models.Agreement
+	if err := tx.First(&agreement, change.AgreementID).Error; err != nil {
+		return err
+	}
+
+	change.OldAmount = agreement.Amount
+	if change.AgreementItemID != nil {
+		var items []models.AgreementItem
+		if err := tx.Where("agreement_id = ?", agreement.ID).Order("id ASC").Find(&items).Error; err != nil {
+			return err
+		}
+		item := findAgreementItem(items, *change.AgreementItemID)
+		if item == nil {
+			return fmt.Errorf("agreement item %d no longer exists", *change.AgreementItemID)
+		}
+		if err := changeAgreementItem(item, change); err != nil {
+			return err
+		}
+		if err := tx.Model(item).Updates(map[string]interface{}{
+			"unit_price": item.UnitPrice,
+			"discount":   item.Discount,
+			"amount":     item.Amount,
+		}).Error; err != nil {
+			return err
+		}
+		amount, _, err := agreementItemTotals(agreement.FeeType, items)
+		if err != nil {
+			return err
+		}
+		change.NewAmount = amount
+	}
+
+	result := tx.Model(&models.Agreement{}).Where("id = ? AND version = ?", agreement.ID, agreement.Version).
+		Updates(map[string]interface{}{"amount": change.NewAmount, "version": agreement.Version + 1})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errVersionConflict
+	}
+
+	now := time.Now()
+	change.Status = models.PriceChangeApplied
+	change.AppliedAt = &now
+	return tx.Model(change).Updates(map[string]interface{}{
+		"status":     change.Status,
+		"applied_at": change.AppliedAt,
+		"old_amount": change.OldAmount,
+		"new_amount": change.NewAmount,
+	}).Error
+}
+
+// changeAgreementItem 按价格变更调整明细的单价、优惠并重新计算金额
+func changeAgreementItem(item *models.AgreementItem, change *models.AgreementPriceChange) error {
+	if change.UnitPrice != nil {
+		item.UnitPrice = *change.UnitPrice
+	}
+	if change.Discount != nil {
+		item.Discount = *change.Discount
+	}
+	gross := roundMoney(item.Quantity * item.UnitPrice)
+	if item.Discount > gross {
+		return fmt.Errorf("discount must not exceed %.2f", gross)
+	}
+	item.Amount = roundMoney(gross - item.Discount)
+	return nil
+}
+
+// findAgreementItem 按ID查找协议明细
+func findAgreementItem(items []models.AgreementItem, id uint) *models.AgreementItem {
+	for i := range items {
+		if items[i].ID == id {
+			return &items[i]
+		}
+	}
+	return nil
+}
+
+// hasPendingItemPriceChange 协议是否有针对明细的待生效价格变更（替换明细会使其失效）
+func hasPendingItemPriceChange(agreementID uint) bool {
+	var count int64
+	config.DB.Model(&models.AgreementPriceChange{}).
+		Where("agreement_id = ? AND status = ? AND agreement_item_id IS NOT NULL", agreementID, models.PriceChangePending).
+		Count(&count)
+	return count > 0
+}
+
+// agreementPriceAt 协议在指定日期适用的金额（每个收费周期）
+// 首次变更前按其变更前金额，两次变更之间按前一次的变更后金额，最近一次已生效变更之后按协议当前金额（含此后的手工修改），
+// 待生效变更的生效日期之后按其变更后金额
+func agreementPriceAt(agreement *models.Agreement, changes []models.AgreementPriceChange, date time.Time) float64 {
+	if len(changes) == 0 {
+		return agreement.Amount
+	}
+	current := -1
+	for i, change := range changes {
+		if date.Before(change.EffectiveDate) {
+			break
+		}
+		current = i
+	}
+	if current < 0 {
+		return changes[0].OldAmount
+	}
+	if changes[current].Status == models.PriceChangeApplied &&
+		(current == len(changes)-1 || changes[current+1].Status != models.PriceChangeApplied) {
+		return agreement.Amount
+	}
+	return changes[current].NewAmount
+}
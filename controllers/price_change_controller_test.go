@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"erp/models"
+	"testing"
+)
+
+func TestAgreementPriceAt(t *testing.T) {
+	applied := func(month int, oldAmount, newAmount float64) models.AgreementPriceChange {
+		return models.AgreementPriceChange{EffectiveDate: localDate(2024, 1, 1).AddDate(0, month-1, 0),
+			OldAmount: oldAmount, NewAmount: newAmount, Status: models.PriceChangeApplied}
+	}
+	pending := func(month int, oldAmount, newAmount float64) models.AgreementPriceChange {
+		change := applied(month, oldAmount, newAmount)
+		change.Status = models.PriceChangePending
+		return change
+	}
+
+	tests := []struct {
+		name    string
+		amount  float64 // 协议当前金额
+		changes []models.AgreementPriceChange
+		month   int // 2024年的月份，取当月1日
+		want    float64
+	}{
+		{"无价格变更", 100, nil, 6, 100},
+		{"首次变更前按变更前金额", 150, []models.AgreementPriceChange{applied(3, 100, 150)}, 2, 100},
+		{"变更生效当日按新金额", 150, []models.AgreementPriceChange{applied(3, 100, 150)}, 3, 150},
+		{"两次变更之间按前一次变更后金额", 200,
+			[]models.AgreementPriceChange{applied(3, 100, 150), applied(6, 150, 200)}, 4, 150},
+		{"最近一次已生效变更后按协议当前金额（含手工修改）", 180,
+			[]models.AgreementPriceChange{applied(3, 100, 150), applied(6, 150, 200)}, 7, 180},
+		{"待生效变更前按协议当前金额", 150,
+			[]models.AgreementPriceChange{applied(3, 100, 150), pending(9, 150, 120)}, 8, 150},
+		{"待生效变更的生效日期后按变更后金额", 150,
+			[]models.AgreementPriceChange{applied(3, 100, 150), pending(9, 150, 120)}, 10, 120},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agreement := models.Agreement{Amount: tt.amount}
+			date := localDate(2024, 1, 1).AddDate(0, tt.month-1, 0)
+			if got := agreementPriceAt(&agreement, tt.changes, date); got != tt.want {
+				t.Errorf("agreementPriceAt(%s) = %v, want %v", date.Format("2006-01-02"), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,605 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"erp/services/import_export"
+	"erp/services/pdf"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// quotationValidDays 报价单默认有效天数
+const quotationValidDays = 30
+
+// QuotationItemRequest 报价明细：价格目录项目按目录价格折算，自定义项目须填写名称和单价
+type QuotationItemRequest struct {
+	ServicePriceID *uint          `json:"service_price_id"`
+	Name           string         `json:"name"` // 自定义项目名称，目录项目可留空
+	Description    string         `json:"description"`
+	FeeType        models.FeeType `json:"fee_type"`   // 自定义项目的收费周期：为空同报价单，一次性项目填“一次性”
+	Quantity       float64        `json:"quantity"`   // 数量，默认1
+	UnitPrice      *float64       `json:"unit_price"` // 自定义项目的单价（周期性项目按报价单收费方式）
+}
+
+// QuotationRequest 创建/修改报价单请求
+type QuotationRequest struct {
+	FeeType    models.FeeType         `json:"fee_type" binding:"required"` // 收费方式
+	Items      []QuotationItemRequest `json:"items"`                       // 为空时使用适用于线索客户类型的标准服务
+	Discount   float64                `json:"discount"`                    // 优惠金额
+	ValidUntil string                 `json:"valid_until"`                 // 有效期至 YYYY-MM-DD，默认30天后
+	Remark     string                 `json:"remark"`
+	Version    uint                   `json:"version"` // 修改时的报价单版本号
+}
+
+// QuotationStatusRequest 报价单状态变更请求
+type QuotationStatusRequest struct {
+	Status  models.QuotationStatus `json:"status" binding:"required"`
+	Version uint                   `json:"version"`
+}
+
+// CreateQuotation 根据价格目录为线索生成报价单
+func CreateQuotation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid lead ID")
+		return
+	}
+
+	var lead models.Lead
+	if err := config.DB.First(&lead, id).Error; err != nil {
+		ErrorResponse(c, 404, "Lead not found")
+		return
+	}
+	if lead.Stage == models.LeadStageWon || lead.Stage == models.LeadStageLost {
+		ErrorResponse(c, 400, "Cannot quote a lead in stage "+string(lead.Stage))
+		return
+	}
+
+	var req QuotationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	quotation, err := buildQuotation(&req, &lead)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	quotation.LeadID = lead.ID
+	quotation.Status = models.QuotationStatusDraft
+	quotation.CreatorID = CurrentPersonID(c)
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		quotation.QuotationNumber = nextSerialNumber(tx, &models.Quotation{}, "quotation_number", "BJ")
+		if err := tx.Create(quotation).Error; err != nil {
+			return err
+		}
+		// 线索尚在初期阶段时推进到已报价
+		if lead.Stage == models.LeadStageNew || lead.Stage == models.LeadStageContacted {
+			return tx.Model(&models.Lead{}).Where("id = ?", lead.ID).
+				Updates(map[string]interface{}{"stage": models.LeadStageQuoted, "version": bumpVersion()}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to create quotation: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, quotation)
+}
+
+// GetQuotations 获取报价单列表
+func GetQuotations(c *gin.Context) {
+	var quotations []models.Quotation
+	var total int64
+
+	query := config.DB.Model(&models.Quotation{}).Preload("Lead")
+	if leadID := c.Query("lead_id"); leadID != "" {
+		query = query.Where("lead_id = ?", leadID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	query.Count(&total)
+
+	if err := query.Order("id DESC").Find(&quotations).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch quotations: "+err.Error())
+		return
+	}
+
+	SuccessPaginatedResponse(c, total, quotations)
+}
+
+// GetQuotation 获取报价单详情
+func GetQuotation(c *gin.Context) {
+	quotation, ok := loadQuotation(c)
+	if !ok {
+		return
+	}
+
+	setETag(c, quotation.Version)
+	SuccessResponse(c, quotation)
+}
+
+// UpdateQuotation 修改报价单，重新生成明细；已接受或已转化的报价单不能修改
+func UpdateQuotation(c *gin.Context) {
+	quotation, ok := loadQuotation(c)
+	if !ok {
+		return
+	}
+	if quotation.Status == models.QuotationStatusAccepted || quotation.AgreementID != nil {
+		ErrorResponse(c, 400, "Accepted quotation cannot be modified")
+		return
+	}
+
+	var req QuotationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	updated, err := buildQuotation(&req, quotation.Lead)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if !matchVersion(c, quotation.Version, req.Version) {
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Quotation{}).Where("id = ? AND version = ?", quotation.ID, quotation.Version).
+			Updates(map[string]interface{}{
+				"fee_type":        updated.FeeType,
+				"subtotal":        updated.Subtotal,
+				"discount":        updated.Discount,
+				"amount":          updated.Amount,
+				"one_time_amount": updated.OneTimeAmount,
+				"valid_until":     updated.ValidUntil,
+				"remark":          updated.Remark,
+				"version":         quotation.Version + 1,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVersionConflict
+		}
+		if err := tx.Where("quotation_id = ?", quotation.ID).Delete(&models.QuotationItem{}).Error; err != nil {
+			return err
+		}
+		for i := range updated.Items {
+			updated.Items[i].QuotationID = quotation.ID
+		}
+		return tx.Create(&updated.Items).Error
+	})
+	if err == errVersionConflict {
+		ErrorResponse(c, 409, err.Error())
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to update quotation: "+err.Error())
+		return
+	}
+
+	config.DB.Preload("Items").First(quotation, quotation.ID)
+
+	setETag(c, quotation.Version)
+	SuccessResponse(c, quotation)
+}
+
+// UpdateQuotationStatus 变更报价单状态（发送、接受、拒绝），已转化的报价单不能变更
+func UpdateQuotationStatus(c *gin.Context) {
+	quotation, ok := loadQuotation(c)
+	if !ok {
+		return
+	}
+	if quotation.AgreementID != nil {
+		ErrorResponse(c, 400, "Quotation has been converted to an agreement")
+		return
+	}
+
+	var req QuotationStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+	switch req.Status {
+	case models.QuotationStatusDraft, models.QuotationStatusSent, models.QuotationStatusAccepted, models.QuotationStatusRejected:
+	default:
+		ErrorResponse(c, 400, "Invalid status: "+string(req.Status))
+		return
+	}
+
+	if !matchVersion(c, quotation.Version, req.Version) {
+		return
+	}
+
+	if !updateVersioned(c, config.DB.Model(&models.Quotation{}).Where("id = ?", quotation.ID), quotation.Version,
+		map[string]interface{}{"status": req.Status, "version": quotation.Version + 1}) {
+		return
+	}
+
+	config.DB.Preload("Items").First(quotation, quotation.ID)
+
+	setETag(c, quotation.Version)
+	SuccessResponse(c, quotation)
+}
+
+// DeleteQuotation 删除报价单，已转化的报价单不能删除
+func DeleteQuotation(c *gin.Context) {
+	quotation, ok := loadQuotation(c)
+	if !ok {
+		return
+	}
+	if quotation.AgreementID != nil {
+		ErrorResponse(c, 400, "Quotation has been converted to an agreement")
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("quotation_id = ?", quotation.ID).Delete(&models.QuotationItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Quotation{}, quotation.ID).Error
+	})
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to delete quotation: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "Quotation deleted successfully"})
+}
+
+// ExportQuotationPDF 导出报价单PDF
+func ExportQuotationPDF(c *gin.Context) {
+	quotation, ok := loadQuotation(c)
+	if !ok {
+		return
+	}
+
+	content := quotationPDF(quotation)
+
+	filename := fmt.Sprintf("报价单_%s.pdf", quotation.QuotationNumber)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Data(200, "application/pdf", content)
+}
+
+// ExportQuotationExcel 导出报价单Excel
+func ExportQuotationExcel(c *gin.Context) {
+	quotation, ok := loadQuotation(c)
+	if !ok {
+		return
+	}
+
+	content, err := quotationWorkbook(quotation)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to export quotation: "+err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("报价单_%s.xlsx", quotation.QuotationNumber)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Data(200, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", content)
+}
+
+// ============ 辅助函数 ============
+
+// loadQuotation 按路径参数加载报价单及其明细和线索
+func loadQuotation(c *gin.Context) (*models.Quotation, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid quotation ID")
+		return nil, false
+	}
+
+	var quotation models.Quotation
+	if err := config.DB.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).Preload("Lead").First(&quotation, id).Error; err != nil {
+		ErrorResponse(c, 404, "Quotation not found")
+		return nil, false
+	}
+	return &quotation, true
+}
+
+// buildQuotation 校验请求并计算报价明细和金额，目录价格按月折算后换算为报价单的收费方式
+// 一次性项目按原价计入一次性费用，不参与优惠和周期性合计
+func buildQuotation(req *QuotationRequest, lead *models.Lead) (*models.Quotation, error) {
+	if err := validateFeeType(req.FeeType); err != nil {
+		return nil, err
+	}
+	if req.Discount < 0 {
+		return nil, fmt.Errorf("Discount must not be negative")
+	}
+
+	validUntil := startOfDay(time.Now()).AddDate(0, 0, quotationValidDays)
+	if req.ValidUntil != "" {
+		t, err := time.ParseInLocation("2006-01-02", req.ValidUntil, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid valid_until, expected YYYY-MM-DD")
+		}
+		validUntil = t
+	}
+
+	items := req.Items
+	if len(items) == 0 {
+		var standard []models.ServicePrice
+		config.DB.Where("standard = ? AND disabled = ? AND (customer_type = '' OR customer_type = ?)", true, false, lead.CustomerType).
+			Order("id ASC").Find(&standard)
+		if len(standard) == 0 {
+			return nil, fmt.Errorf("No standard services in the price catalog for this customer type, please specify items")
+		}
+		for i := range standard {
+			items = append(items, QuotationItemRequest{ServicePriceID: &standard[i].ID})
+		}
+	}
+
+	quotation := &models.Quotation{
+		FeeType:    req.FeeType,
+		Discount:   roundMoney(req.Discount),
+		ValidUntil: &validUntil,
+		Remark:     req.Remark,
+	}
+	for _, item := range items {
+		quantity := item.Quantity
+		if quantity == 0 {
+			quantity = 1
+		}
+		if quantity < 0 {
+			return nil, fmt.Errorf("Quantity must be positive")
+		}
+
+		line := models.QuotationItem{Name: item.Name, Description: item.Description, FeeType: req.FeeType, Quantity: quantity}
+		if item.ServicePriceID != nil {
+			var price models.ServicePrice
+			if err := config.DB.First(&price, *item.ServicePriceID).Error; err != nil {
+				return nil, fmt.Errorf("Service price %d not found", *item.ServicePriceID)
+			}
+			if price.Disabled {
+				return nil, fmt.Errorf("Service price %s is disabled", price.Name)
+			}
+			if price.CustomerType != "" && lead.CustomerType != "" && price.CustomerType != lead.CustomerType {
+				return nil, fmt.Errorf("Service price %s does not apply to %s", price.Name, lead.CustomerType)
+			}
+			line.ServicePriceID = &price.ID
+			line.Name = firstNonEmpty(item.Name, price.Name)
+			line.Description = firstNonEmpty(item.Description, price.Description)
+			if price.FeeType == models.FeeTypeOneTime {
+				line.FeeType = models.FeeTypeOneTime
+			}
+			unitPrice, err := convertCatalogPrice(&price, line.FeeType)
+			if err != nil {
+				return nil, err
+			}
+			line.UnitPrice = unitPrice
+		} else {
+			if item.Name == "" || item.UnitPrice == nil {
+				return nil, fmt.Errorf("Custom items require name and unit_price")
+			}
+			if item.FeeType != "" && item.FeeType != req.FeeType && item.FeeType != models.FeeTypeOneTime {
+				return nil, fmt.Errorf("Item fee type must be %s or %s", req.FeeType, models.FeeTypeOneTime)
+			}
+			if item.FeeType != "" {
+				line.FeeType = item.FeeType
+			}
+			if *item.UnitPrice < 0 {
+				return nil, fmt.Errorf("Unit price must not be negative")
+			}
+			line.UnitPrice = roundMoney(*item.UnitPrice)
+		}
+		line.Amount = roundMoney(line.UnitPrice * quantity)
+		if line.FeeType == models.FeeTypeOneTime {
+			quotation.OneTimeAmount += line.Amount
+		} else {
+			quotation.Subtotal += line.Amount
+		}
+		quotation.Items = append(quotation.Items, line)
+	}
+
+	quotation.Subtotal = roundMoney(quotation.Subtotal)
+	quotation.OneTimeAmount = roundMoney(quotation.OneTimeAmount)
+	if quotation.Discount > quotation.Subtotal {
+		return nil, fmt.Errorf("Discount must not exceed the subtotal %.2f", quotation.Subtotal)
+	}
+	quotation.Amount = roundMoney(quotation.Subtotal - quotation.Discount)
+	return quotation, nil
+}
+
+// feeTypeMonths 收费周期包含的月数
+func feeTypeMonths(feeType models.FeeType) float64 {
+	switch feeType {
+	case models.FeeTypeQuarterly:
+		return 3
+	case models.FeeTypeYearly:
+		return 12
+	}
+	return 1
+}
+
+// quotationPDF 生成报价单PDF
+func quotationPDF(quotation *models.Quotation) []byte {
+	doc := pdf.New()
+	doc.AddPage()
+
+	const left, right = 50.0, pdf.PageWidth - 50
+	doc.TextCenter(pdf.PageWidth/2, 70, 20, "报 价 单")
+
+	customer, contact := "", ""
+	if quotation.Lead != nil {
+		customer = quotation.Lead.Name
+		contact = quotation.Lead.ContactName
+		if quotation.Lead.ContactPhone != "" {
+			contact += "  " + quotation.Lead.ContactPhone
+		}
+	}
+	validUntil := ""
+	if quotation.ValidUntil != nil {
+		validUntil = quotation.ValidUntil.Format("2006-01-02")
+	}
+	doc.Text(left, 110, 10.5, "报价单号："+quotation.QuotationNumber)
+	doc.TextRight(right, 110, 10.5, "报价日期："+quotation.CreatedAt.Format("2006-01-02"))
+	doc.Text(left, 130, 10.5, "客户："+customer)
+	doc.TextRight(right, 130, 10.5, "有效期至："+validUntil)
+	doc.Text(left, 150, 10.5, "联系人："+contact)
+	doc.TextRight(right, 150, 10.5, "收费方式："+string(quotation.FeeType))
+
+	// 明细表：序号、服务项目、说明、数量、单价、金额
+	columns := []struct {
+		title string
+		x     float64 // 左对齐列为左边界，右对齐列为右边界
+		right bool
+	}{
+		{"序号", left + 6, false},
+		{"服务项目", left + 40, false},
+		{"说明", left + 170, false},
+		{"数量", right - 170, true},
+		{"单价", right - 90, true},
+		{"金额", right - 6, true},
+	}
+	const rowHeight = 22.0
+	y := 175.0
+	doc.FillRect(left, y, right-left, rowHeight, 0.9)
+	for _, col := range columns {
+		if col.right {
+			doc.TextRight(col.x, y+15, 10, col.title)
+		} else {
+			doc.Text(col.x, y+15, 10, col.title)
+		}
+	}
+	doc.Line(left, y, right, y, 0.8)
+	y += rowHeight
+	doc.Line(left, y, right, y, 0.5)
+
+	for i, item := range quotation.Items {
+		if y > pdf.PageHeight-150 {
+			doc.AddPage()
+			y = 60
+			doc.Line(left, y, right, y, 0.5)
+		}
+		doc.Text(columns[0].x, y+15, 10, strconv.Itoa(i+1))
+		name := item.Name
+		if item.FeeType == models.FeeTypeOneTime {
+			name += "（一次性）"
+		}
+		doc.Text(columns[1].x, y+15, 10, pdf.Truncate(name, 10, columns[2].x-columns[1].x-8))
+		doc.Text(columns[2].x, y+15, 9, pdf.Truncate(item.Description, 9, columns[3].x-columns[2].x-40))
+		doc.TextRight(columns[3].x, y+15, 10, strconv.FormatFloat(item.Quantity, 'f', -1, 64))
+		doc.TextRight(columns[4].x, y+15, 10, fmt.Sprintf("%.2f", item.UnitPrice))
+		doc.TextRight(columns[5].x, y+15, 10, fmt.Sprintf("%.2f", item.Amount))
+		y += rowHeight
+		doc.Line(left, y, right, y, 0.3)
+	}
+	doc.Line(left, y, right, y, 0.8)
+
+	// 合计
+	y += 22
+	doc.TextRight(columns[4].x, y, 10.5, "周期性合计")
+	doc.TextRight(columns[5].x, y, 10.5, fmt.Sprintf("%.2f", quotation.Subtotal))
+	if quotation.Discount > 0 {
+		y += 18
+		doc.TextRight(columns[4].x, y, 10.5, "优惠金额")
+		doc.TextRight(columns[5].x, y, 10.5, fmt.Sprintf("-%.2f", quotation.Discount))
+	}
+	y += 22
+	doc.TextRight(columns[4].x, y, 12, "报价金额")
+	doc.TextRight(columns[5].x, y, 12, fmt.Sprintf("%.2f", quotation.Amount))
+	y += 18
+	doc.TextRight(right, y, 9, fmt.Sprintf("（人民币元/%s）", feeTypePeriod(quotation.FeeType)))
+	if quotation.OneTimeAmount > 0 {
+		y += 22
+		doc.TextRight(columns[4].x, y, 12, "一次性费用")
+		doc.TextRight(columns[5].x, y, 12, fmt.Sprintf("%.2f", quotation.OneTimeAmount))
+		y += 18
+		doc.TextRight(right, y, 9, "（人民币元，签约时一次性收取）")
+	}
+
+	if quotation.Remark != "" {
+		y += 30
+		doc.Text(left, y, 10, pdf.Truncate("备注："+quotation.Remark, 10, right-left))
+	}
+
+	return doc.Bytes()
+}
+
+// quotationWorkbook 生成报价单Excel
+func quotationWorkbook(quotation *models.Quotation) ([]byte, error) {
+	excelService := import_export.NewExcelService()
+	defer excelService.Close()
+	file := excelService.GetFile()
+
+	sheet := "报价单"
+	file.SetSheetName("Sheet1", sheet)
+
+	customer, contact, phone := "", "", ""
+	if quotation.Lead != nil {
+		customer = quotation.Lead.Name
+		contact = quotation.Lead.ContactName
+		phone = quotation.Lead.ContactPhone
+	}
+	validUntil := ""
+	if quotation.ValidUntil != nil {
+		validUntil = quotation.ValidUntil.Format("2006-01-02")
+	}
+	info := [][]interface{}{
+		{"报价单号", quotation.QuotationNumber, "", "报价日期", quotation.CreatedAt.Format("2006-01-02")},
+		{"客户", customer, "", "有效期至", validUntil},
+		{"联系人", contact, "", "联系电话", phone},
+		{"收费方式", string(quotation.FeeType), "", "状态", string(quotation.Status)},
+	}
+	if err := excelService.WriteRows(sheet, 1, info); err != nil {
+		return nil, err
+	}
+
+	const headerRow = 6
+	if err := excelService.WriteRow(sheet, headerRow, []interface{}{"序号", "服务项目", "说明", "收费周期", "数量", "单价", "金额"}); err != nil {
+		return nil, err
+	}
+	excelService.SetHeaderStyleByRange(sheet, fmt.Sprintf("A%d", headerRow), fmt.Sprintf("G%d", headerRow))
+
+	rows := make([][]interface{}, 0, len(quotation.Items)+3)
+	for i, item := range quotation.Items {
+		rows = append(rows, []interface{}{i + 1, item.Name, item.Description, string(item.FeeType), item.Quantity, item.UnitPrice, item.Amount})
+	}
+	rows = append(rows, []interface{}{"", "周期性费用合计", "", "", "", "", quotation.Subtotal})
+	rows = append(rows, []interface{}{"", "优惠金额", "", "", "", "", -quotation.Discount})
+	rows = append(rows, []interface{}{"", "报价金额（元/" + feeTypePeriod(quotation.FeeType) + "）", "", "", "", "", quotation.Amount})
+	if quotation.OneTimeAmount > 0 {
+		rows = append(rows, []interface{}{"", "一次性费用（元）", "", "", "", "", quotation.OneTimeAmount})
+	}
+	if err := excelService.WriteRows(sheet, headerRow+1, rows); err != nil {
+		return nil, err
+	}
+	excelService.SetBorderStyle(sheet, fmt.Sprintf("A%d", headerRow), fmt.Sprintf("G%d", headerRow+len(rows)))
+
+	if quotation.Remark != "" {
+		excelService.WriteRow(sheet, headerRow+len(rows)+2, []interface{}{"备注", quotation.Remark})
+	}
+	file.SetColWidth(sheet, "B", "C", 28)
+
+	buf, err := file.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// feeTypePeriod 收费方式对应的计费周期名称
+func feeTypePeriod(feeType models.FeeType) string {
+	switch feeType {
+	case models.FeeTypeQuarterly:
+		return "季"
+	case models.FeeTypeYearly:
+		return "年"
+	}
+	return "月"
+}
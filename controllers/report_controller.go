@@ -0,0 +1,575 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"erp/services/import_export"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// 报表周期类型
+const (
+	ReportPeriodMonth   = "month"
+	ReportPeriodQuarter = "quarter"
+	ReportPeriodYear    = "year"
+)
+
+// ReportCustomer 报表中的客户变动记录
+type ReportCustomer struct {
+	ID     uint                `json:"id"`
+	Name   string              `json:"name"`
+	Type   models.CustomerType `json:"type"`
+	Date   time.Time           `json:"date"`             // 新增客户为创建日期，流失客户为终止合作的生效日期
+	Reason string              `json:"reason,omitempty"` // 流失客户的终止原因
+}
+
+// ReportCustomerStats 客户变动统计
+type ReportCustomerStats struct {
+	NewCount         int              `json:"new_count"`         // 新增客户数
+	ChurnedCount     int              `json:"churned_count"`     // 流失客户数
+	TotalAtEnd       int              `json:"total_at_end"`      // 期末在服务客户数
+	NewCustomers     []ReportCustomer `json:"new_customers"`     // 新增客户
+	ChurnedCustomers []ReportCustomer `json:"churned_customers"` // 流失客户
+}
+
+// ReportAgreementStats 协议统计
+type ReportAgreementStats struct {
+	ActiveCount int64            `json:"active_count"` // 期内有效的协议数
+	ByFeeType   map[string]int64 `json:"by_fee_type"`  // 按收费类型
+}
+
+// ReportRevenueStats 收入统计
+type ReportRevenueStats struct {
+	Billed         float64  `json:"billed"`          // 应收：有效协议按月折算的服务费，加上当月开始的协议的一次性费用
+	Collected      float64  `json:"collected"`       // 实收：期内收款减期内退款
+	Refunded       float64  `json:"refunded"`        // 期内退款
+	Outstanding    float64  `json:"outstanding"`     // 应收未收（应收-实收，不小于0）
+	CollectionRate *float64 `json:"collection_rate"` // 收款率（%），应收为0时为null
+}
+
+// ReportTaskStats 任务统计
+type ReportTaskStats struct {
+	Created      int64    `json:"created"`       // 新建任务数
+	Completed    int64    `json:"completed"`     // 完成任务数
+	DueCount     int64    `json:"due_count"`     // 期内到期的任务数（不含已取消和尚未到期的）
+	OverdueCount int64    `json:"overdue_count"` // 其中逾期完成或逾期未完成的任务数
+	OverdueRate  *float64 `json:"overdue_rate"`  // 逾期率（%），无到期任务时为null
+}
+
+// ReportPaymentMethod 按收款方式汇总
+type ReportPaymentMethod struct {
+	Method string  `json:"method"`
+	Count  int64   `json:"count"`
+	Amount float64 `json:"amount"`
+	Ratio  float64 `json:"ratio"` // 金额占比（%）
+}
+
+// ReportMonth 报表周期内的月度明细
+type ReportMonth struct {
+	Month            string  `json:"month"`
+	NewCustomers     int     `json:"new_customers"`
+	ChurnedCustomers int     `json:"churned_customers"`
+	ActiveAgreements int64   `json:"active_agreements"`
+	Billed           float64 `json:"billed"`
+	Collected        float64 `json:"collected"`
+	TasksCreated     int64   `json:"tasks_created"`
+	TasksCompleted   int64   `json:"tasks_completed"`
+	OverdueTasks     int64   `json:"overdue_tasks"`
+}
+
+// PeriodReport 月度/季度/年度经营报表
+type PeriodReport struct {
+	PeriodType     string                `json:"period_type"` // month/quarter/year
+	Period         string                `json:"period"`      // 2024-01 / 2024-Q1 / 2024
+	StartDate      time.Time             `json:"start_date"`
+	EndDate        time.Time             `json:"end_date"` // 周期最后一天
+	GeneratedAt    time.Time             `json:"generated_at"`
+	Customers      ReportCustomerStats   `json:"customers"`
+	Agreements     ReportAgreementStats  `json:"agreements"`
+	Revenue        ReportRevenueStats    `json:"revenue"`
+	Tasks          ReportTaskStats       `json:"tasks"`
+	PaymentMethods []ReportPaymentMethod `json:"payment_methods"`
+	Months         []ReportMonth         `json:"months"`
+}
+
+// GetPeriodReport 生成月度/季度/年度经营报表
+func GetPeriodReport(c *gin.Context) {
+	periodType, period, start, end, ok := parseReportPeriod(c)
+	if !ok {
+		return
+	}
+
+	report, err := buildPeriodReport(periodType, period, start, end)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to build report: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, report)
+}
+
+// ExportPeriodReport 导出经营报表Excel（概览、月度趋势、收款方式、客户变动，含图表）
+func ExportPeriodReport(c *gin.Context) {
+	periodType, period, start, end, ok := parseReportPeriod(c)
+	if !ok {
+		return
+	}
+
+	report, err := buildPeriodReport(periodType, period, start, end)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to build report: "+err.Error())
+		return
+	}
+
+	content, err := reportWorkbook(report)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to export report: "+err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("经营报表_%s.xlsx", report.Period)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Data(200, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", content)
+}
+
+// ============ 辅助函数 ============
+
+// parseReportPeriod 解析报表周期：type 为 month/quarter/year，period 分别为 2024-01、2024-Q1、2024，默认当前周期
+func parseReportPeriod(c *gin.Context) (string, string, time.Time, time.Time, bool) {
+	periodType := c.DefaultQuery("type", ReportPeriodMonth)
+	period := c.Query("period")
+	now := time.Now()
+
+	var start time.Time
+	var months int
+	switch periodType {
+	case ReportPeriodMonth:
+		months = 1
+		if period == "" {
+			period = now.Format("2006-01")
+		}
+		t, err := time.ParseInLocation("2006-01", period, time.Local)
+		if err != nil {
+			ErrorResponse(c, 400, "Invalid period, expected YYYY-MM")
+			return "", "", start, start, false
+		}
+		start = t
+	case ReportPeriodQuarter:
+		months = 3
+		if period == "" {
+			period = fmt.Sprintf("%d-Q%d", now.Year(), (int(now.Month())+2)/3)
+		}
+		parts := strings.Split(strings.ToUpper(period), "-Q")
+		year, yearErr := strconv.Atoi(parts[0])
+		quarter := 0
+		if len(parts) == 2 {
+			quarter, _ = strconv.Atoi(parts[1])
+		}
+		if yearErr != nil || quarter < 1 || quarter > 4 {
+			ErrorResponse(c, 400, "Invalid period, expected YYYY-Qn")
+			return "", "", start, start, false
+		}
+		period = fmt.Sprintf("%d-Q%d", year, quarter)
+		start = time.Date(year, time.Month(quarter*3-2), 1, 0, 0, 0, 0, time.Local)
+	case ReportPeriodYear:
+		months = 12
+		if period == "" {
+			period = now.Format("2006")
+		}
+		t, err := time.ParseInLocation("2006", period, time.Local)
+		if err != nil {
+			ErrorResponse(c, 400, "Invalid period, expected YYYY")
+			return "", "", start, start, false
+		}
+		start = t
+	default:
+		ErrorResponse(c, 400, "Invalid type, expected month, quarter or year")
+		return "", "", start, start, false
+	}
+
+	return periodType, period, start, start.AddDate(0, months, 0), true
+}
+
+// buildPeriodReport 按月统计后汇总为整个周期的报表
+func buildPeriodReport(periodType, period string, start, end time.Time) (*PeriodReport, error) {
+	now := time.Now()
+	report := &PeriodReport{
+		PeriodType:     periodType,
+		Period:         period,
+		StartDate:      start,
+		EndDate:        end.AddDate(0, 0, -1),
+		GeneratedAt:    now,
+		Agreements:     ReportAgreementStats{ByFeeType: map[string]int64{}},
+		PaymentMethods: []ReportPaymentMethod{},
+		Customers:      ReportCustomerStats{NewCustomers: []ReportCustomer{}, ChurnedCustomers: []ReportCustomer{}},
+	}
+
+	var months []time.Time
+	for m := start; m.Before(end); m = m.AddDate(0, 1, 0) {
+		months = append(months, m)
+		report.Months = append(report.Months, ReportMonth{Month: m.Format("2006-01")})
+	}
+	monthIndex := func(t time.Time) int {
+		if t.Before(start) || !t.Before(end) {
+			return -1
+		}
+		return (t.Year()-start.Year())*12 + int(t.Month()) - int(start.Month())
+	}
+
+	// 客户：新增按创建时间；流失按生命周期状态由在服务转为已终止的生效日期；期末总数为期末在服务的客户
+	var customers []models.Customer
+	if err := config.DB.Select("id", "name", "type", "created_at").Order("id ASC").Find(&customers).Error; err != nil {
+		return nil, err
+	}
+	var agreements []models.Agreement
+	if err := config.DB.Where("status <> ?", models.AgreementStatusCancelled).Find(&agreements).Error; err != nil {
+		return nil, err
+	}
+	timelines, err := loadCustomerTimelines()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, customer := range customers {
+		timeline := timelines[customer.ID]
+		if inService(timeline.statusBefore(end)) {
+			report.Customers.TotalAtEnd++
+		}
+		if i := monthIndex(customer.CreatedAt); i >= 0 {
+			report.Months[i].NewCustomers++
+			report.Customers.NewCustomers = append(report.Customers.NewCustomers,
+				ReportCustomer{ID: customer.ID, Name: customer.Name, Type: customer.Type, Date: customer.CreatedAt})
+		}
+		for _, point := range timeline {
+			if point.to != models.CustomerStatusTerminated || !inService(point.from) {
+				continue
+			}
+			if i := monthIndex(point.date); i >= 0 {
+				report.Months[i].ChurnedCustomers++
+				report.Customers.ChurnedCustomers = append(report.Customers.ChurnedCustomers,
+					ReportCustomer{ID: customer.ID, Name: customer.Name, Type: customer.Type, Date: point.date, Reason: point.reason})
+			}
+		}
+	}
+	report.Customers.NewCount = len(report.Customers.NewCustomers)
+	report.Customers.ChurnedCount = len(report.Customers.ChurnedCustomers)
+	sort.SliceStable(report.Customers.ChurnedCustomers, func(i, j int) bool {
+		return report.Customers.ChurnedCustomers[i].Date.Before(report.Customers.ChurnedCustomers[j].Date)
+	})
+
+	// 协议与应收：协议覆盖某月即计入该月有效协议，应收为按月折算的服务费（按该月适用的价格），一次性费用计入协议开始的月份
+	var priceChanges []models.AgreementPriceChange
+	if err := config.DB.Order("effective_date ASC, id ASC").Find(&priceChanges).Error; err != nil {
+		return nil, err
+	}
+	changes := map[uint][]models.AgreementPriceChange{}
+	for _, change := range priceChanges {
+		changes[change.AgreementID] = append(changes[change.AgreementID], change)
+	}
+	for _, agreement := range agreements {
+		if i := monthIndex(agreement.StartDate); i >= 0 {
+			report.Months[i].Billed += agreement.OneTimeAmount
+		}
+		counted := false
+		for i, m := range months {
+			if !agreementCovers(agreement, m, m.AddDate(0, 1, 0)) {
+				continue
+			}
+			report.Months[i].ActiveAgreements++
+			report.Months[i].Billed += monthlyFee(agreement.FeeType, agreementPriceAt(&agreement, changes[agreement.ID], m))
+			counted = true
+		}
+		if counted {
+			report.Agreements.ActiveCount++
+			report.Agreements.ByFeeType[string(agreement.FeeType)]++
+		}
+	}
+
+	// 实收及收款方式
+	var payments []models.Payment
+	if err := config.DB.Select("amount", "payment_date", "payment_method").
+		Where("payment_date >= ? AND payment_date < ?", start, end).Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	methods := map[string]*ReportPaymentMethod{}
+	for _, payment := range payments {
+		if i := monthIndex(payment.PaymentDate); i >= 0 {
+			report.Months[i].Collected += payment.Amount
+		}
+		method := payment.PaymentMethod
+		if method == "" {
+			method = "未填写"
+		}
+		if methods[method] == nil {
+			methods[method] = &ReportPaymentMethod{Method: method}
+		}
+		methods[method].Count++
+		methods[method].Amount += payment.Amount
+		report.Revenue.Collected += payment.Amount
+	}
+	for _, method := range methods {
+		method.Amount = math.Round(method.Amount*100) / 100
+		if report.Revenue.Collected > 0 {
+			method.Ratio = math.Round(method.Amount*10000/report.Revenue.Collected) / 100
+		}
+		report.PaymentMethods = append(report.PaymentMethods, *method)
+	}
+	sort.Slice(report.PaymentMethods, func(i, j int) bool {
+		if report.PaymentMethods[i].Amount != report.PaymentMethods[j].Amount {
+			return report.PaymentMethods[i].Amount > report.PaymentMethods[j].Amount
+		}
+		return report.PaymentMethods[i].Method < report.PaymentMethods[j].Method
+	})
+
+	// 退款按退款日期冲减实收（收款方式占比仍按收款金额计算）
+	var refunds []models.PaymentRefund
+	if err := config.DB.Select("amount", "refund_date").
+		Where("refund_date >= ? AND refund_date < ?", start, end).Find(&refunds).Error; err != nil {
+		return nil, err
+	}
+	for _, refund := range refunds {
+		if i := monthIndex(refund.RefundDate); i >= 0 {
+			report.Months[i].Collected -= refund.Amount
+		}
+		report.Revenue.Refunded += refund.Amount
+		report.Revenue.Collected -= refund.Amount
+	}
+	report.Revenue.Refunded = math.Round(report.Revenue.Refunded*100) / 100
+
+	// 任务：新建、完成，以及到期任务的逾期情况（完成时间晚于截止日期当天，或已过截止日期仍未完成）
+	var tasks []models.Task
+	if err := config.DB.Select("type", "status", "due_date", "completed_at", "created_at").
+		Where("(created_at >= ? AND created_at < ?) OR (completed_at >= ? AND completed_at < ?) OR (due_date >= ? AND due_date < ?)",
+			start, end, start, end, start, end).
+		Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	today := startOfDay(now)
+	for _, task := range tasks {
+		if i := monthIndex(task.CreatedAt); i >= 0 {
+			report.Months[i].TasksCreated++
+			report.Tasks.Created++
+		}
+		if task.CompletedAt != nil {
+			if i := monthIndex(*task.CompletedAt); i >= 0 {
+				report.Months[i].TasksCompleted++
+				report.Tasks.Completed++
+			}
+		}
+		if task.DueDate == nil || taskStateCategory(task.Type, task.Status) == models.TaskStateCategoryCancelled {
+			continue
+		}
+		i := monthIndex(*task.DueDate)
+		deadline := startOfDay(*task.DueDate).AddDate(0, 0, 1)
+		if i < 0 || (task.CompletedAt == nil && deadline.After(today)) {
+			continue
+		}
+		report.Tasks.DueCount++
+		if task.CompletedAt == nil || !task.CompletedAt.Before(deadline) {
+			report.Months[i].OverdueTasks++
+			report.Tasks.OverdueCount++
+		}
+	}
+	if report.Tasks.DueCount > 0 {
+		rate := math.Round(float64(report.Tasks.OverdueCount)*10000/float64(report.Tasks.DueCount)) / 100
+		report.Tasks.OverdueRate = &rate
+	}
+
+	for i := range report.Months {
+		month := &report.Months[i]
+		month.Billed = math.Round(month.Billed*100) / 100
+		month.Collected = math.Round(month.Collected*100) / 100
+		report.Revenue.Billed += month.Billed
+	}
+	report.Revenue.Billed = math.Round(report.Revenue.Billed*100) / 100
+	report.Revenue.Collected = math.Round(report.Revenue.Collected*100) / 100
+	report.Revenue.Outstanding = math.Max(0, math.Round((report.Revenue.Billed-report.Revenue.Collected)*100)/100)
+	if report.Revenue.Billed > 0 {
+		rate := math.Round(report.Revenue.Collected*10000/report.Revenue.Billed) / 100
+		report.Revenue.CollectionRate = &rate
+	}
+
+	return report, nil
+}
+
+// agreementCovers 判断协议期间与 [start, end) 是否有交集，未填写的开始/结束日期视为不限
+func agreementCovers(agreement models.Agreement, start, end time.Time) bool {
+	if !agreement.StartDate.IsZero() && !agreement.StartDate.Before(end) {
+		return false
+	}
+	if !agreement.EndDate.IsZero() && agreement.EndDate.Before(start) {
+		return false
+	}
+	return true
+}
+
+// reportWorkbook 生成经营报表Excel
+func reportWorkbook(report *PeriodReport) ([]byte, error) {
+	excelService := import_export.NewExcelService()
+	defer excelService.Close()
+	file := excelService.GetFile()
+
+	// 概览
+	overviewSheet := "报表概览"
+	file.SetSheetName("Sheet1", overviewSheet)
+	if err := excelService.SetSheetHeader(overviewSheet, []string{"指标", "数值"}); err != nil {
+		return nil, err
+	}
+	overview := [][]interface{}{
+		{"报表周期", report.Period},
+		{"起止日期", report.StartDate.Format("2006-01-02") + " 至 " + report.EndDate.Format("2006-01-02")},
+		{"新增客户", report.Customers.NewCount},
+		{"流失客户", report.Customers.ChurnedCount},
+		{"期末在服务客户数", report.Customers.TotalAtEnd},
+		{"有效协议", report.Agreements.ActiveCount},
+		{"应收金额", report.Revenue.Billed},
+		{"实收金额", report.Revenue.Collected},
+		{"退款金额", report.Revenue.Refunded},
+		{"应收未收", report.Revenue.Outstanding},
+		{"收款率(%)", reportRate(report.Revenue.CollectionRate)},
+		{"新建任务", report.Tasks.Created},
+		{"完成任务", report.Tasks.Completed},
+		{"到期任务", report.Tasks.DueCount},
+		{"逾期任务", report.Tasks.OverdueCount},
+		{"逾期率(%)", reportRate(report.Tasks.OverdueRate)},
+		{"生成时间", report.GeneratedAt.Format("2006-01-02 15:04:05")},
+	}
+	if err := excelService.WriteRows(overviewSheet, 2, overview); err != nil {
+		return nil, err
+	}
+	excelService.SetBorderStyle(overviewSheet, "A2", fmt.Sprintf("B%d", len(overview)+1))
+
+	// 月度趋势
+	trendSheet := "月度趋势"
+	excelService.CreateSheet(trendSheet)
+	if err := excelService.SetSheetHeader(trendSheet, []string{"月份", "新增客户", "流失客户", "有效协议",
+		"应收金额", "实收金额", "新建任务", "完成任务", "逾期任务"}); err != nil {
+		return nil, err
+	}
+	trend := make([][]interface{}, len(report.Months))
+	for i, m := range report.Months {
+		trend[i] = []interface{}{m.Month, m.NewCustomers, m.ChurnedCustomers, m.ActiveAgreements,
+			m.Billed, m.Collected, m.TasksCreated, m.TasksCompleted, m.OverdueTasks}
+	}
+	if err := excelService.WriteRows(trendSheet, 2, trend); err != nil {
+		return nil, err
+	}
+	lastRow := len(trend) + 1
+	excelService.SetBorderStyle(trendSheet, "A2", fmt.Sprintf("I%d", lastRow))
+
+	categories := fmt.Sprintf("'%s'!$A$2:$A$%d", trendSheet, lastRow)
+	series := func(col string) excelize.ChartSeries {
+		return excelize.ChartSeries{
+			Name:       fmt.Sprintf("'%s'!$%s$1", trendSheet, col),
+			Categories: categories,
+			Values:     fmt.Sprintf("'%s'!$%s$2:$%s$%d", trendSheet, col, col, lastRow),
+		}
+	}
+	revenueChart := &excelize.Chart{
+		Type:      excelize.Col,
+		Series:    []excelize.ChartSeries{series("E"), series("F")},
+		Title:     []excelize.RichTextRun{{Text: "应收与实收"}},
+		Legend:    excelize.ChartLegend{Position: "bottom"},
+		Dimension: excelize.ChartDimension{Width: 640, Height: 320},
+	}
+	if err := file.AddChart(overviewSheet, "D2", revenueChart); err != nil {
+		return nil, err
+	}
+	customerChart := &excelize.Chart{
+		Type:      excelize.Line,
+		Series:    []excelize.ChartSeries{series("B"), series("C")},
+		Title:     []excelize.RichTextRun{{Text: "客户增减"}},
+		Legend:    excelize.ChartLegend{Position: "bottom"},
+		Dimension: excelize.ChartDimension{Width: 640, Height: 320},
+	}
+	if err := file.AddChart(trendSheet, "K2", customerChart); err != nil {
+		return nil, err
+	}
+	taskChart := &excelize.Chart{
+		Type:      excelize.Col,
+		Series:    []excelize.ChartSeries{series("G"), series("H"), series("I")},
+		Title:     []excelize.RichTextRun{{Text: "任务处理"}},
+		Legend:    excelize.ChartLegend{Position: "bottom"},
+		Dimension: excelize.ChartDimension{Width: 640, Height: 320},
+	}
+	if err := file.AddChart(trendSheet, "K20", taskChart); err != nil {
+		return nil, err
+	}
+
+	// 收款方式
+	methodSheet := "收款方式"
+	excelService.CreateSheet(methodSheet)
+	if err := excelService.SetSheetHeader(methodSheet, []string{"收款方式", "笔数", "金额", "占比(%)"}); err != nil {
+		return nil, err
+	}
+	methods := make([][]interface{}, len(report.PaymentMethods))
+	for i, m := range report.PaymentMethods {
+		methods[i] = []interface{}{m.Method, m.Count, m.Amount, m.Ratio}
+	}
+	if err := excelService.WriteRows(methodSheet, 2, methods); err != nil {
+		return nil, err
+	}
+	if len(methods) > 0 {
+		lastRow := len(methods) + 1
+		excelService.SetBorderStyle(methodSheet, "A2", fmt.Sprintf("D%d", lastRow))
+		methodChart := &excelize.Chart{
+			Type: excelize.Pie,
+			Series: []excelize.ChartSeries{{
+				Name:       fmt.Sprintf("'%s'!$C$1", methodSheet),
+				Categories: fmt.Sprintf("'%s'!$A$2:$A$%d", methodSheet, lastRow),
+				Values:     fmt.Sprintf("'%s'!$C$2:$C$%d", methodSheet, lastRow),
+			}},
+			Title:     []excelize.RichTextRun{{Text: "收款方式分布"}},
+			Legend:    excelize.ChartLegend{Position: "right"},
+			PlotArea:  excelize.ChartPlotArea{ShowPercent: true},
+			Dimension: excelize.ChartDimension{Width: 480, Height: 320},
+		}
+		if err := file.AddChart(methodSheet, "F2", methodChart); err != nil {
+			return nil, err
+		}
+	}
+
+	// 客户变动
+	customerSheet := "客户变动"
+	excelService.CreateSheet(customerSheet)
+	if err := excelService.SetSheetHeader(customerSheet, []string{"变动类型", "客户", "客户类型", "日期", "终止原因"}); err != nil {
+		return nil, err
+	}
+	var changes [][]interface{}
+	for _, customer := range report.Customers.NewCustomers {
+		changes = append(changes, []interface{}{"新增", customer.Name, string(customer.Type), customer.Date.Format("2006-01-02"), ""})
+	}
+	for _, customer := range report.Customers.ChurnedCustomers {
+		changes = append(changes, []interface{}{"流失", customer.Name, string(customer.Type), customer.Date.Format("2006-01-02"), customer.Reason})
+	}
+	if err := excelService.WriteRows(customerSheet, 2, changes); err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		excelService.SetBorderStyle(customerSheet, "A2", fmt.Sprintf("E%d", len(changes)+1))
+	}
+
+	excelService.SetActiveSheet(overviewSheet)
+
+	buf, err := file.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// reportRate 比率为空时在Excel中显示为“-”
+func reportRate(rate *float64) interface{} {
+	if rate == nil {
+		return "-"
+	}
+	return *rate
+}
@@ -0,0 +1,750 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"erp/services/import_export"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// 收入确认明细账使用的会计科目
+const (
+	AccountBank       = "银行存款"
+	AccountCash       = "库存现金"
+	AccountReceivable = "应收账款"
+	AccountDeferred   = "预收账款"
+	AccountRevenue    = "主营业务收入"
+	AccountDeposit    = "其他应付款" // 客户预存款，余额抵扣和退回余额时使用
+)
+
+// RevenueMonth 月度收入确认情况
+type RevenueMonth struct {
+	Month            string  `json:"month"`
+	Recognized       float64 `json:"recognized"`         // 当月确认收入
+	Collected        float64 `json:"collected"`          // 当月收款
+	RecognizedToDate float64 `json:"recognized_to_date"` // 截至月末累计确认收入
+	CollectedToDate  float64 `json:"collected_to_date"`  // 截至月末累计收款
+	Deferred         float64 `json:"deferred"`           // 月末递延收入（已收款未确认）
+	Unbilled         float64 `json:"unbilled"`           // 月末应收未收（已确认未收款）
+}
+
+// RevenueAgreement 协议的收入确认汇总
+type RevenueAgreement struct {
+	AgreementID      uint           `json:"agreement_id"`
+	AgreementNumber  string         `json:"agreement_number"`
+	CustomerID       uint           `json:"customer_id"`
+	CustomerName     string         `json:"customer_name"`
+	FeeType          models.FeeType `json:"fee_type"`
+	Amount           float64        `json:"amount"`          // 协议服务费
+	OneTimeAmount    float64        `json:"one_time_amount"` // 一次性费用，在首个服务月确认
+	MonthlyRevenue   float64        `json:"monthly_revenue"` // 每个服务月确认的收入
+	TermStart        time.Time      `json:"term_start"`
+	TermEnd          *time.Time     `json:"term_end"`       // 未填写结束日期时为null，按月持续确认
+	TermMonths       int            `json:"term_months"`    // 服务月数，未填写结束日期时为0
+	ContractValue    *float64       `json:"contract_value"` // 协议总价值，未填写结束日期时为null
+	Recognized       float64        `json:"recognized"`     // 区间内确认收入
+	Collected        float64        `json:"collected"`      // 区间内收款
+	RecognizedToDate float64        `json:"recognized_to_date"`
+	CollectedToDate  float64        `json:"collected_to_date"`
+	Deferred         float64        `json:"deferred"`
+	Unbilled         float64        `json:"unbilled"`
+	Months           []RevenueMonth `json:"months,omitempty"` // 月度明细（仅协议详情接口返回）
+}
+
+// RevenueBalance 期初/期末余额
+type RevenueBalance struct {
+	Deferred float64 `json:"deferred"`
+	Unbilled float64 `json:"unbilled"`
+}
+
+// RevenueUnallocated 无法按协议确认收入的收款（未关联协议，或关联的协议已取消/未填写开始日期）
+type RevenueUnallocated struct {
+	Count  int     `json:"count"`
+	Amount float64 `json:"amount"`
+}
+
+// RevenueSchedule 收入确认计划
+type RevenueSchedule struct {
+	StartMonth  string             `json:"start_month"`
+	EndMonth    string             `json:"end_month"`
+	Opening     RevenueBalance     `json:"opening"` // 期初余额
+	Closing     RevenueBalance     `json:"closing"` // 期末余额
+	Recognized  float64            `json:"recognized"`
+	Collected   float64            `json:"collected"`
+	Months      []RevenueMonth     `json:"months"`
+	Agreements  []RevenueAgreement `json:"agreements"`
+	Unallocated RevenueUnallocated `json:"unallocated"`
+}
+
+// RevenueLedgerEntry 收入确认明细账分录（一借一贷）
+type RevenueLedgerEntry struct {
+	Date            time.Time `json:"date"`
+	Summary         string    `json:"summary"` // 摘要
+	CustomerID      uint      `json:"customer_id"`
+	CustomerName    string    `json:"customer_name"`
+	AgreementID     uint      `json:"agreement_id"`
+	AgreementNumber string    `json:"agreement_number"`
+	PaymentID       *uint     `json:"payment_id"` // 收款/退款分录对应的收款记录
+	RefundID        *uint     `json:"refund_id"`  // 退款分录对应的退款记录
+	Debit           string    `json:"debit"`      // 借方科目
+	Credit          string    `json:"credit"`     // 贷方科目
+	Amount          float64   `json:"amount"`
+}
+
+// revenueFilter 收入确认的筛选条件和区间，区间为 [start, end) 的整月
+type revenueFilter struct {
+	customerID  string
+	agreementID string
+	start       time.Time
+	end         time.Time
+}
+
+// revenueAgreementInput 计算单份协议收入确认所需的数据，均按日期升序
+type revenueAgreementInput struct {
+	payments []models.Payment
+	refunds  []models.PaymentRefund
+	changes  []models.AgreementPriceChange // 价格变更，按生效日期确定各服务月的服务费
+}
+
+// revenueAgreementPlan 单份协议的完整计算结果
+type revenueAgreementPlan struct {
+	summary RevenueAgreement
+	months  []RevenueMonth // 从首个服务月或首笔收款所在月至区间结束
+	entries []RevenueLedgerEntry
+	opening RevenueBalance
+}
+
+// GetRevenueSchedule 获取收入确认计划：按服务月确认收入，汇总递延收入和应收未收
+func GetRevenueSchedule(c *gin.Context) {
+	filter, ok := parseRevenueFilter(c)
+	if !ok {
+		return
+	}
+
+	schedule, _, err := buildRevenueSchedule(filter)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to build revenue schedule: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, schedule)
+}
+
+// GetAgreementRevenue 获取单份协议的收入确认明细，未指定区间时覆盖整个服务期
+func GetAgreementRevenue(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid agreement ID")
+		return
+	}
+
+	var agreement models.Agreement
+	if err := config.DB.Preload("Customer").First(&agreement, id).Error; err != nil {
+		ErrorResponse(c, 404, "Agreement not found")
+		return
+	}
+	if agreement.Status == models.AgreementStatusCancelled || agreement.StartDate.IsZero() {
+		ErrorResponse(c, 400, "Revenue is not recognized for cancelled agreements or agreements without a start date")
+		return
+	}
+
+	var payments []models.Payment
+	config.DB.Where("agreement_id = ?", agreement.ID).Order("payment_date ASC, id ASC").Find(&payments)
+	input := revenueAgreementInput{payments: payments}
+	config.DB.Where("payment_id IN (?)", config.DB.Model(&models.Payment{}).Select("id").Where("agreement_id = ?", agreement.ID)).
+		Order("refund_date ASC, id ASC").Find(&input.refunds)
+	config.DB.Where("agreement_id = ?", agreement.ID).Order("effective_date ASC, id ASC").Find(&input.changes)
+
+	// 默认区间：首个服务月（或更早的首笔收款）至服务期结束（未填写结束日期时至当月）
+	start := revenueMonth(agreement.StartDate)
+	if len(payments) > 0 && revenueMonth(payments[0].PaymentDate).Before(start) {
+		start = revenueMonth(payments[0].PaymentDate)
+	}
+	end := revenueMonth(time.Now()).AddDate(0, 1, 0)
+	if !agreement.EndDate.IsZero() {
+		end = revenueMonth(agreement.EndDate).AddDate(0, 1, 0)
+		if len(payments) > 0 {
+			if last := revenueMonth(payments[len(payments)-1].PaymentDate).AddDate(0, 1, 0); last.After(end) {
+				end = last
+			}
+		}
+	}
+
+	filter := revenueFilter{start: start, end: end}
+	if !parseRevenueMonths(c, &filter) {
+		return
+	}
+
+	plan := planAgreementRevenue(agreement, input, filter)
+	plan.summary.Months = revenueMonthsInRange(plan.months, filter)
+
+	SuccessResponse(c, plan.summary)
+}
+
+// GetRevenueLedger 获取区间内的收入确认明细账分录
+func GetRevenueLedger(c *gin.Context) {
+	filter, ok := parseRevenueFilter(c)
+	if !ok {
+		return
+	}
+
+	_, entries, err := buildRevenueSchedule(filter)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to build revenue ledger: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, entries)
+}
+
+// ExportRevenueLedger 导出收入确认明细账（明细账、月度汇总、协议汇总三个工作表）
+func ExportRevenueLedger(c *gin.Context) {
+	filter, ok := parseRevenueFilter(c)
+	if !ok {
+		return
+	}
+
+	schedule, entries, err := buildRevenueSchedule(filter)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to build revenue ledger: "+err.Error())
+		return
+	}
+
+	content, err := revenueWorkbook(schedule, entries)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to export revenue ledger: "+err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("收入确认明细账_%s_%s.xlsx", schedule.StartMonth, schedule.EndMonth)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Data(200, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", content)
+}
+
+// ============ 辅助函数 ============
+
+// parseRevenueFilter 解析筛选条件，区间默认为当年1月至当月
+func parseRevenueFilter(c *gin.Context) (revenueFilter, bool) {
+	now := time.Now()
+	filter := revenueFilter{
+		customerID:  c.Query("customer_id"),
+		agreementID: c.Query("agreement_id"),
+		start:       time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.Local),
+		end:         revenueMonth(now).AddDate(0, 1, 0),
+	}
+	return filter, parseRevenueMonths(c, &filter)
+}
+
+// parseRevenueMonths 解析 start_month/end_month（YYYY-MM），覆盖 filter 中的默认区间
+func parseRevenueMonths(c *gin.Context, filter *revenueFilter) bool {
+	if value := c.Query("start_month"); value != "" {
+		t, err := time.ParseInLocation("2006-01", value, time.Local)
+		if err != nil {
+			ErrorResponse(c, 400, "Invalid start_month, expected YYYY-MM")
+			return false
+		}
+		filter.start = t
+	}
+	if value := c.Query("end_month"); value != "" {
+		t, err := time.ParseInLocation("2006-01", value, time.Local)
+		if err != nil {
+			ErrorResponse(c, 400, "Invalid end_month, expected YYYY-MM")
+			return false
+		}
+		filter.end = t.AddDate(0, 1, 0)
+	}
+	if !filter.start.Before(filter.end) {
+		ErrorResponse(c, 400, "start_month must not be after end_month")
+		return false
+	}
+	return true
+}
+
+// revenueMonth 返回 t 所在月的第一天
+func revenueMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+}
+
+// buildRevenueSchedule 计算筛选范围内所有协议的收入确认计划及明细账分录
+func buildRevenueSchedule(filter revenueFilter) (*RevenueSchedule, []RevenueLedgerEntry, error) {
+	schedule := &RevenueSchedule{
+		StartMonth: filter.start.Format("2006-01"),
+		EndMonth:   filter.end.AddDate(0, -1, 0).Format("2006-01"),
+		Agreements: []RevenueAgreement{},
+	}
+	entries := []RevenueLedgerEntry{}
+
+	query := config.DB.Preload("Customer").Order("id ASC")
+	if filter.customerID != "" {
+		query = query.Where("customer_id = ?", filter.customerID)
+	}
+	if filter.agreementID != "" {
+		query = query.Where("id = ?", filter.agreementID)
+	}
+	var agreements []models.Agreement
+	if err := query.Find(&agreements).Error; err != nil {
+		return nil, nil, err
+	}
+
+	paymentQuery := config.DB.Preload("Customer").Where("payment_date < ?", filter.end).Order("payment_date ASC, id ASC")
+	if filter.customerID != "" {
+		paymentQuery = paymentQuery.Where("customer_id = ?", filter.customerID)
+	}
+	if filter.agreementID != "" {
+		paymentQuery = paymentQuery.Where("agreement_id = ?", filter.agreementID)
+	}
+	var payments []models.Payment
+	if err := paymentQuery.Find(&payments).Error; err != nil {
+		return nil, nil, err
+	}
+	inputs := map[uint]*revenueAgreementInput{}
+	input := func(agreementID uint) *revenueAgreementInput {
+		if inputs[agreementID] == nil {
+			inputs[agreementID] = &revenueAgreementInput{}
+		}
+		return inputs[agreementID]
+	}
+	paymentByID := map[uint]*models.Payment{}
+	for i, payment := range payments {
+		input(payment.AgreementID).payments = append(input(payment.AgreementID).payments, payment)
+		paymentByID[payment.ID] = &payments[i]
+	}
+
+	// 退款按原收款关联的协议处理
+	var refunds []models.PaymentRefund
+	if len(payments) > 0 {
+		refundQuery := config.DB.Where("refund_date < ?", filter.end).Order("refund_date ASC, id ASC")
+		if filter.customerID != "" {
+			refundQuery = refundQuery.Where("customer_id = ?", filter.customerID)
+		}
+		if err := refundQuery.Find(&refunds).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	var matchedRefunds []models.PaymentRefund
+	for _, refund := range refunds {
+		if payment := paymentByID[refund.PaymentID]; payment != nil {
+			input(payment.AgreementID).refunds = append(input(payment.AgreementID).refunds, refund)
+			matchedRefunds = append(matchedRefunds, refund)
+		}
+	}
+
+	if len(agreements) > 0 {
+		ids := make([]uint, len(agreements))
+		for i, agreement := range agreements {
+			ids[i] = agreement.ID
+		}
+		var changes []models.AgreementPriceChange
+		if err := config.DB.Where("agreement_id IN ?", ids).Order("effective_date ASC, id ASC").Find(&changes).Error; err != nil {
+			return nil, nil, err
+		}
+		for _, change := range changes {
+			input(change.AgreementID).changes = append(input(change.AgreementID).changes, change)
+		}
+	}
+
+	months := map[string]*RevenueMonth{}
+	for m := filter.start; m.Before(filter.end); m = m.AddDate(0, 1, 0) {
+		schedule.Months = append(schedule.Months, RevenueMonth{Month: m.Format("2006-01")})
+	}
+	for i := range schedule.Months {
+		months[schedule.Months[i].Month] = &schedule.Months[i]
+	}
+
+	scheduled := map[uint]bool{}
+	for _, agreement := range agreements {
+		if agreement.Status == models.AgreementStatusCancelled || agreement.StartDate.IsZero() {
+			continue
+		}
+		scheduled[agreement.ID] = true
+
+		plan := planAgreementRevenue(agreement, *input(agreement.ID), filter)
+		if plan.summary.RecognizedToDate == 0 && plan.summary.CollectedToDate == 0 {
+			continue
+		}
+		schedule.Agreements = append(schedule.Agreements, plan.summary)
+		schedule.Opening.Deferred += plan.opening.Deferred
+		schedule.Opening.Unbilled += plan.opening.Unbilled
+		for _, month := range revenueMonthsInRange(plan.months, filter) {
+			total := months[month.Month]
+			total.Recognized += month.Recognized
+			total.Collected += month.Collected
+			total.RecognizedToDate += month.RecognizedToDate
+			total.CollectedToDate += month.CollectedToDate
+			total.Deferred += month.Deferred
+			total.Unbilled += month.Unbilled
+		}
+		for _, entry := range plan.entries {
+			if !entry.Date.Before(filter.start) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	// 无法按协议确认收入的收款只记收款分录
+	for _, payment := range payments {
+		if scheduled[payment.AgreementID] || payment.PaymentDate.Before(filter.start) {
+			continue
+		}
+		schedule.Unallocated.Count++
+		schedule.Unallocated.Amount += payment.Amount
+		entries = append(entries, revenueReceiptEntry(payment, nil, AccountDeferred, payment.Amount, "收到款项（未关联协议）"))
+	}
+	for _, refund := range matchedRefunds {
+		payment := paymentByID[refund.PaymentID]
+		if scheduled[payment.AgreementID] || refund.RefundDate.Before(filter.start) {
+			continue
+		}
+		schedule.Unallocated.Amount -= refund.Amount
+		customerName := ""
+		if payment.Customer != nil {
+			customerName = payment.Customer.Name
+		}
+		entries = append(entries, revenueRefundEntry(refund, customerName, nil, AccountDeferred, refund.Amount, "退款（未关联协议）"))
+	}
+
+	for i := range schedule.Months {
+		month := &schedule.Months[i]
+		month.Recognized = roundMoney(month.Recognized)
+		month.Collected = roundMoney(month.Collected)
+		month.RecognizedToDate = roundMoney(month.RecognizedToDate)
+		month.CollectedToDate = roundMoney(month.CollectedToDate)
+		month.Deferred = roundMoney(month.Deferred)
+		month.Unbilled = roundMoney(month.Unbilled)
+		schedule.Recognized += month.Recognized
+		schedule.Collected += month.Collected
+	}
+	if n := len(schedule.Months); n > 0 {
+		schedule.Closing = RevenueBalance{Deferred: schedule.Months[n-1].Deferred, Unbilled: schedule.Months[n-1].Unbilled}
+	}
+	schedule.Recognized = roundMoney(schedule.Recognized)
+	schedule.Collected = roundMoney(schedule.Collected)
+	schedule.Opening.Deferred = roundMoney(schedule.Opening.Deferred)
+	schedule.Opening.Unbilled = roundMoney(schedule.Opening.Unbilled)
+	schedule.Unallocated.Amount = roundMoney(schedule.Unallocated.Amount)
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Date.Before(entries[j].Date) })
+
+	return schedule, entries, nil
+}
+
+// planAgreementRevenue 计算单份协议截至区间结束的收入确认情况
+// 从开始日期起每满一个服务月确认一个月的服务费（季度÷3，年度÷12），计入该服务月开始所在的自然月，
+// 服务费按服务月开始日适用的价格（见价格变更）计算，按月折算的舍入差额计入每个收费周期的最后一个服务月；
+// 一次性费用在首个服务月（开始日期所在月）一次确认；
+// 收款先冲减应收账款，余额计入预收账款；退款先冲减预收账款，不足部分重新计入应收账款；
+// 月末确认收入时先冲减预收账款，不足部分计入应收账款
+func planAgreementRevenue(agreement models.Agreement, input revenueAgreementInput, filter revenueFilter) revenueAgreementPlan {
+	payments := input.payments
+	monthly := roundMoney(monthlyFee(agreement.FeeType, agreement.Amount))
+	plan := revenueAgreementPlan{summary: RevenueAgreement{
+		AgreementID:     agreement.ID,
+		AgreementNumber: agreement.AgreementNumber,
+		CustomerID:      agreement.CustomerID,
+		FeeType:         agreement.FeeType,
+		Amount:          agreement.Amount,
+		OneTimeAmount:   agreement.OneTimeAmount,
+		MonthlyRevenue:  monthly,
+		TermStart:       agreement.StartDate,
+	}}
+	if agreement.Customer != nil {
+		plan.summary.CustomerName = agreement.Customer.Name
+	}
+
+	// 各自然月确认的服务费
+	serviceMonths := map[time.Time]float64{}
+	var contractValue float64
+	first := revenueMonth(agreement.StartDate)
+	for i := 0; ; i++ {
+		begin := agreement.StartDate.AddDate(0, i, 0)
+		if !agreement.EndDate.IsZero() && begin.After(agreement.EndDate) {
+			plan.summary.TermMonths = i
+			break
+		}
+		month := first.AddDate(0, i, 0)
+		if agreement.EndDate.IsZero() && !month.Before(filter.end) {
+			break
+		}
+		fee := serviceMonthFee(agreement.FeeType, agreementPriceAt(&agreement, input.changes, begin), i)
+		if i == 0 {
+			fee += agreement.OneTimeAmount
+		}
+		serviceMonths[month] += fee
+		contractValue += fee
+	}
+	if !agreement.EndDate.IsZero() {
+		termEnd := agreement.EndDate
+		value := roundMoney(contractValue)
+		plan.summary.TermEnd = &termEnd
+		plan.summary.ContractValue = &value
+	}
+
+	if len(payments) > 0 && revenueMonth(payments[0].PaymentDate).Before(first) {
+		first = revenueMonth(payments[0].PaymentDate)
+	}
+
+	var deferred, unbilled, recognizedToDate, collectedToDate float64
+	next, nextRefund := 0, 0
+	for month := first; month.Before(filter.end); month = month.AddDate(0, 1, 0) {
+		if month.Equal(filter.start) {
+			plan.opening = RevenueBalance{Deferred: roundMoney(deferred), Unbilled: roundMoney(unbilled)}
+		}
+		row := RevenueMonth{Month: month.Format("2006-01")}
+
+		monthEnd := month.AddDate(0, 1, 0)
+		for ; next < len(payments) && payments[next].PaymentDate.Before(monthEnd); next++ {
+			payment := payments[next]
+			row.Collected += payment.Amount
+			toReceivable := math.Min(payment.Amount, unbilled)
+			if toReceivable > 0 {
+				unbilled = roundMoney(unbilled - toReceivable)
+				plan.entries = append(plan.entries, revenueReceiptEntry(payment, &agreement, AccountReceivable, toReceivable, "收到服务费（冲减应收）"))
+			}
+			if rest := roundMoney(payment.Amount - toReceivable); rest > 0 {
+				deferred = roundMoney(deferred + rest)
+				plan.entries = append(plan.entries, revenueReceiptEntry(payment, &agreement, AccountDeferred, rest, "预收服务费"))
+			}
+		}
+		for ; nextRefund < len(input.refunds) && input.refunds[nextRefund].RefundDate.Before(monthEnd); nextRefund++ {
+			refund := input.refunds[nextRefund]
+			row.Collected -= refund.Amount
+			fromDeferred := math.Min(refund.Amount, deferred)
+			if fromDeferred > 0 {
+				deferred = roundMoney(deferred - fromDeferred)
+				plan.entries = append(plan.entries, revenueRefundEntry(refund, plan.summary.CustomerName, &agreement, AccountDeferred, fromDeferred, "退还预收服务费"))
+			}
+			if rest := roundMoney(refund.Amount - fromDeferred); rest > 0 {
+				unbilled = roundMoney(unbilled + rest)
+				plan.entries = append(plan.entries, revenueRefundEntry(refund, plan.summary.CustomerName, &agreement, AccountReceivable, rest, "退还服务费（转回应收）"))
+			}
+		}
+
+		if fee, ok := serviceMonths[month]; ok {
+			row.Recognized = roundMoney(fee)
+			date := monthEnd.AddDate(0, 0, -1)
+			summary := fmt.Sprintf("确认%s服务收入", row.Month)
+			fromDeferred := math.Min(row.Recognized, deferred)
+			if fromDeferred > 0 {
+				deferred = roundMoney(deferred - fromDeferred)
+				plan.entries = append(plan.entries, revenueRecognitionEntry(date, &agreement, plan.summary.CustomerName, AccountDeferred, fromDeferred, summary))
+			}
+			if rest := roundMoney(row.Recognized - fromDeferred); rest > 0 {
+				unbilled = roundMoney(unbilled + rest)
+				plan.entries = append(plan.entries, revenueRecognitionEntry(date, &agreement, plan.summary.CustomerName, AccountReceivable, rest, summary))
+			}
+		}
+
+		recognizedToDate += row.Recognized
+		collectedToDate += row.Collected
+		row.Collected = roundMoney(row.Collected)
+		row.RecognizedToDate = roundMoney(recognizedToDate)
+		row.CollectedToDate = roundMoney(collectedToDate)
+		row.Deferred = deferred
+		row.Unbilled = unbilled
+		plan.months = append(plan.months, row)
+
+		if !month.Before(filter.start) {
+			plan.summary.Recognized += row.Recognized
+			plan.summary.Collected += row.Collected
+		}
+	}
+
+	plan.summary.Recognized = roundMoney(plan.summary.Recognized)
+	plan.summary.Collected = roundMoney(plan.summary.Collected)
+	plan.summary.RecognizedToDate = roundMoney(recognizedToDate)
+	plan.summary.CollectedToDate = roundMoney(collectedToDate)
+	plan.summary.Deferred = deferred
+	plan.summary.Unbilled = unbilled
+	return plan
+}
+
+// revenueMonthsInRange 截取区间内的月份，协议在区间开始后才有数据时前面补0
+func revenueMonthsInRange(months []RevenueMonth, filter revenueFilter) []RevenueMonth {
+	byMonth := make(map[string]RevenueMonth, len(months))
+	for _, month := range months {
+		byMonth[month.Month] = month
+	}
+	var result []RevenueMonth
+	for m := filter.start; m.Before(filter.end); m = m.AddDate(0, 1, 0) {
+		label := m.Format("2006-01")
+		if month, ok := byMonth[label]; ok {
+			result = append(result, month)
+		} else {
+			result = append(result, RevenueMonth{Month: label})
+		}
+	}
+	return result
+}
+
+// revenueReceiptEntry 收款分录：借 银行存款/库存现金，贷 credit
+func revenueReceiptEntry(payment models.Payment, agreement *models.Agreement, credit string, amount float64, summary string) RevenueLedgerEntry {
+	paymentID := payment.ID
+	entry := RevenueLedgerEntry{
+		Date:       payment.PaymentDate,
+		Summary:    summary,
+		CustomerID: payment.CustomerID,
+		PaymentID:  &paymentID,
+		Debit:      AccountBank,
+		Credit:     credit,
+		Amount:     roundMoney(amount),
+	}
+	switch payment.PaymentMethod {
+	case "现金":
+		entry.Debit = AccountCash
+	case models.PaymentMethodBalance:
+		entry.Debit = AccountDeposit
+	}
+	if payment.Customer != nil {
+		entry.CustomerName = payment.Customer.Name
+	}
+	if agreement != nil {
+		entry.AgreementID = agreement.ID
+		entry.AgreementNumber = agreement.AgreementNumber
+	}
+	return entry
+}
+
+// revenueRefundEntry 退款分录：借 预收账款/应收账款，贷 银行存款/库存现金（退回余额时贷 其他应付款）
+func revenueRefundEntry(refund models.PaymentRefund, customerName string, agreement *models.Agreement, debit string, amount float64, summary string) RevenueLedgerEntry {
+	paymentID, refundID := refund.PaymentID, refund.ID
+	entry := RevenueLedgerEntry{
+		Date:         refund.RefundDate,
+		Summary:      summary + "：" + refund.Reason,
+		CustomerID:   refund.CustomerID,
+		CustomerName: customerName,
+		PaymentID:    &paymentID,
+		RefundID:     &refundID,
+		Debit:        debit,
+		Credit:       AccountBank,
+		Amount:       roundMoney(amount),
+	}
+	switch {
+	case refund.ToBalance:
+		entry.Credit = AccountDeposit
+	case refund.Method == "现金":
+		entry.Credit = AccountCash
+	}
+	if agreement != nil {
+		entry.AgreementID = agreement.ID
+		entry.AgreementNumber = agreement.AgreementNumber
+	}
+	return entry
+}
+
+// revenueRecognitionEntry 收入确认分录：借 预收账款/应收账款，贷 主营业务收入
+func revenueRecognitionEntry(date time.Time, agreement *models.Agreement, customerName, debit string, amount float64, summary string) RevenueLedgerEntry {
+	return RevenueLedgerEntry{
+		Date:            date,
+		Summary:         summary,
+		CustomerID:      agreement.CustomerID,
+		CustomerName:    customerName,
+		AgreementID:     agreement.ID,
+		AgreementNumber: agreement.AgreementNumber,
+		Debit:           debit,
+		Credit:          AccountRevenue,
+		Amount:          roundMoney(amount),
+	}
+}
+
+// roundMoney 金额保留两位小数
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// serviceMonthFee 第 index 个服务月（从0开始）确认的服务费：按月折算后保留两位小数，
+// 收费周期（季度3个月，年度12个月）的最后一个服务月确认剩余部分，使整个周期合计等于服务费
+func serviceMonthFee(feeType models.FeeType, price float64, index int) float64 {
+	monthly := roundMoney(monthlyFee(feeType, price))
+	months := int(feeTypeMonths(feeType))
+	if index%months == months-1 {
+		return roundMoney(price - monthly*float64(months-1))
+	}
+	return monthly
+}
+
+// revenueWorkbook 生成收入确认明细账Excel
+func revenueWorkbook(schedule *RevenueSchedule, entries []RevenueLedgerEntry) ([]byte, error) {
+	excelService := import_export.NewExcelService()
+	defer excelService.Close()
+	file := excelService.GetFile()
+
+	ledgerSheet := "收入确认明细账"
+	file.SetSheetName("Sheet1", ledgerSheet)
+	if err := excelService.SetSheetHeader(ledgerSheet, []string{"日期", "摘要", "客户", "协议编号", "借方科目", "贷方科目", "金额", "收款记录ID"}); err != nil {
+		return nil, err
+	}
+	rows := make([][]interface{}, len(entries))
+	for i, entry := range entries {
+		var paymentID interface{} = ""
+		if entry.PaymentID != nil {
+			paymentID = *entry.PaymentID
+		}
+		rows[i] = []interface{}{entry.Date.Format("2006-01-02"), entry.Summary, entry.CustomerName, entry.AgreementNumber,
+			entry.Debit, entry.Credit, entry.Amount, paymentID}
+	}
+	if err := excelService.WriteRows(ledgerSheet, 2, rows); err != nil {
+		return nil, err
+	}
+	if len(rows) > 0 {
+		excelService.SetBorderStyle(ledgerSheet, "A2", fmt.Sprintf("H%d", len(rows)+1))
+	}
+
+	monthSheet := "月度汇总"
+	excelService.CreateSheet(monthSheet)
+	if err := excelService.SetSheetHeader(monthSheet, []string{"月份", "确认收入", "收款", "累计确认收入", "累计收款", "月末递延收入", "月末应收未收"}); err != nil {
+		return nil, err
+	}
+	months := make([][]interface{}, 0, len(schedule.Months)+1)
+	for _, m := range schedule.Months {
+		months = append(months, []interface{}{m.Month, m.Recognized, m.Collected, m.RecognizedToDate, m.CollectedToDate, m.Deferred, m.Unbilled})
+	}
+	months = append(months, []interface{}{"合计", schedule.Recognized, schedule.Collected, "", "", schedule.Closing.Deferred, schedule.Closing.Unbilled})
+	if err := excelService.WriteRows(monthSheet, 2, months); err != nil {
+		return nil, err
+	}
+	excelService.SetBorderStyle(monthSheet, "A2", fmt.Sprintf("G%d", len(months)+1))
+
+	agreementSheet := "协议汇总"
+	excelService.CreateSheet(agreementSheet)
+	headers := []string{"协议编号", "客户", "收费类型", "服务费", "月确认收入", "服务开始", "服务结束", "服务月数",
+		"协议总价值", "区间确认收入", "区间收款", "累计确认收入", "累计收款", "递延收入", "应收未收"}
+	if err := excelService.SetSheetHeader(agreementSheet, headers); err != nil {
+		return nil, err
+	}
+	var agreements [][]interface{}
+	for _, a := range schedule.Agreements {
+		var termEnd, termMonths, contractValue interface{} = "", "", ""
+		if a.TermEnd != nil {
+			termEnd = a.TermEnd.Format("2006-01-02")
+			termMonths = a.TermMonths
+		}
+		if a.ContractValue != nil {
+			contractValue = *a.ContractValue
+		}
+		agreements = append(agreements, []interface{}{a.AgreementNumber, a.CustomerName, string(a.FeeType), a.Amount, a.MonthlyRevenue,
+			a.TermStart.Format("2006-01-02"), termEnd, termMonths, contractValue, a.Recognized, a.Collected,
+			a.RecognizedToDate, a.CollectedToDate, a.Deferred, a.Unbilled})
+	}
+	if err := excelService.WriteRows(agreementSheet, 2, agreements); err != nil {
+		return nil, err
+	}
+	if len(agreements) > 0 {
+		endCell, _ := excelize.CoordinatesToCellName(len(headers), len(agreements)+1)
+		excelService.SetBorderStyle(agreementSheet, "A2", endCell)
+	}
+
+	excelService.SetActiveSheet(ledgerSheet)
+
+	buf, err := file.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
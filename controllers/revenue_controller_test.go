@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"erp/models"
+	"testing"
+	"time"
+)
+
+// localDate 测试用的本地日期
+func localDate(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+}
+
+func TestServiceMonthFee(t *testing.T) {
+	tests := []struct {
+		name    string
+		feeType models.FeeType
+		price   float64
+		index   int
+		want    float64
+	}{
+		{"月度", models.FeeTypeMonthly, 99.99, 0, 99.99},
+		{"季度首月", models.FeeTypeQuarterly, 100, 0, 33.33},
+		{"季度末月", models.FeeTypeQuarterly, 100, 2, 33.34},
+		{"第二个季度末月", models.FeeTypeQuarterly, 100, 5, 33.34},
+		{"年度中间月", models.FeeTypeYearly, 1000, 10, 83.33},
+		{"年度末月", models.FeeTypeYearly, 1000, 11, 83.37},
+		{"第二年首月", models.FeeTypeYearly, 1000, 12, 83.33},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serviceMonthFee(tt.feeType, tt.price, tt.index); got != tt.want {
+				t.Errorf("serviceMonthFee(%s, %v, %d) = %v, want %v", tt.feeType, tt.price, tt.index, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanAgreementRevenue(t *testing.T) {
+	year := revenueFilter{start: localDate(2024, 1, 1), end: localDate(2025, 1, 1)}
+
+	tests := []struct {
+		name           string
+		agreement      models.Agreement
+		input          revenueAgreementInput
+		filter         revenueFilter
+		wantRecognized []float64 // 各月确认收入，从首个服务月开始
+		wantValue      *float64
+		wantTermMonths int
+		wantDeferred   float64
+		wantUnbilled   float64
+		wantCollected  float64
+	}{
+		{
+			name: "年度服务费舍入差额计入末月",
+			agreement: models.Agreement{FeeType: models.FeeTypeYearly, Amount: 1000,
+				StartDate: localDate(2024, 1, 1), EndDate: localDate(2024, 12, 31)},
+			filter: year,
+			wantRecognized: []float64{83.33, 83.33, 83.33, 83.33, 83.33, 83.33,
+				83.33, 83.33, 83.33, 83.33, 83.33, 83.37},
+			wantValue:      floatPtr(1000),
+			wantTermMonths: 12,
+			wantUnbilled:   1000,
+		},
+		{
+			name: "季度服务费按季度补足差额",
+			agreement: models.Agreement{FeeType: models.FeeTypeQuarterly, Amount: 100,
+				StartDate: localDate(2024, 1, 15), EndDate: localDate(2024, 7, 14)},
+			filter:         year,
+			wantRecognized: []float64{33.33, 33.33, 33.34, 33.33, 33.33, 33.34},
+			wantValue:      floatPtr(200),
+			wantTermMonths: 6,
+			wantUnbilled:   200,
+		},
+		{
+			name: "预收全年后部分退款，退款先冲减预收",
+			agreement: models.Agreement{FeeType: models.FeeTypeYearly, Amount: 1200,
+				StartDate: localDate(2024, 1, 1), EndDate: localDate(2024, 12, 31)},
+			input: revenueAgreementInput{
+				payments: []models.Payment{{ID: 1, Amount: 1200, PaymentDate: localDate(2024, 1, 10)}},
+				refunds:  []models.PaymentRefund{{ID: 1, PaymentID: 1, Amount: 300, RefundDate: localDate(2024, 6, 15)}},
+			},
+			filter: year,
+			wantRecognized: []float64{100, 100, 100, 100, 100, 100,
+				100, 100, 100, 100, 100, 100},
+			wantValue:      floatPtr(1200),
+			wantTermMonths: 12,
+			wantUnbilled:   300,
+			wantCollected:  900,
+		},
+		{
+			name: "退款超过预收余额时转回应收",
+			agreement: models.Agreement{FeeType: models.FeeTypeMonthly, Amount: 100,
+				StartDate: localDate(2024, 1, 1), EndDate: localDate(2024, 2, 28)},
+			input: revenueAgreementInput{
+				payments: []models.Payment{{ID: 1, Amount: 100, PaymentDate: localDate(2024, 1, 5)}},
+				refunds:  []models.PaymentRefund{{ID: 1, PaymentID: 1, Amount: 100, RefundDate: localDate(2024, 2, 5)}},
+			},
+			filter:         revenueFilter{start: localDate(2024, 1, 1), end: localDate(2024, 3, 1)},
+			wantRecognized: []float64{100, 100},
+			wantValue:      floatPtr(200),
+			wantTermMonths: 2,
+			wantUnbilled:   200,
+		},
+		{
+			name: "价格变更生效后按新价格确认",
+			agreement: models.Agreement{FeeType: models.FeeTypeMonthly, Amount: 150,
+				StartDate: localDate(2024, 1, 1), EndDate: localDate(2024, 4, 30)},
+			input: revenueAgreementInput{
+				payments: []models.Payment{{ID: 1, Amount: 600, PaymentDate: localDate(2024, 1, 1)}},
+				changes: []models.AgreementPriceChange{
+					{EffectiveDate: localDate(2024, 3, 1), OldAmount: 100, NewAmount: 150, Status: models.PriceChangeApplied},
+				},
+			},
+			filter:         revenueFilter{start: localDate(2024, 1, 1), end: localDate(2024, 5, 1)},
+			wantRecognized: []float64{100, 100, 150, 150},
+			wantValue:      floatPtr(500),
+			wantTermMonths: 4,
+			wantDeferred:   100,
+			wantCollected:  600,
+		},
+		{
+			name: "一次性费用在首个服务月确认",
+			agreement: models.Agreement{FeeType: models.FeeTypeMonthly, Amount: 100, OneTimeAmount: 500,
+				StartDate: localDate(2024, 1, 20), EndDate: localDate(2024, 4, 19)},
+			input: revenueAgreementInput{
+				payments: []models.Payment{{ID: 1, Amount: 700, PaymentDate: localDate(2024, 1, 20)}},
+			},
+			filter:         year,
+			wantRecognized: []float64{600, 100, 100},
+			wantValue:      floatPtr(800),
+			wantTermMonths: 3,
+			wantUnbilled:   100,
+			wantCollected:  700,
+		},
+		{
+			name: "未填写结束日期按月持续确认至区间结束",
+			agreement: models.Agreement{FeeType: models.FeeTypeQuarterly, Amount: 300,
+				StartDate: localDate(2024, 10, 1)},
+			filter:         year,
+			wantRecognized: []float64{100, 100, 100},
+			wantUnbilled:   300,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planAgreementRevenue(tt.agreement, tt.input, tt.filter)
+
+			var recognized []float64
+			for _, month := range plan.months {
+				if month.Recognized != 0 {
+					recognized = append(recognized, month.Recognized)
+				}
+			}
+			if len(recognized) != len(tt.wantRecognized) {
+				t.Fatalf("recognized months = %v, want %v", recognized, tt.wantRecognized)
+			}
+			for i := range recognized {
+				if recognized[i] != tt.wantRecognized[i] {
+					t.Errorf("month %d recognized = %v, want %v", i+1, recognized[i], tt.wantRecognized[i])
+				}
+			}
+
+			summary := plan.summary
+			if (summary.ContractValue == nil) != (tt.wantValue == nil) ||
+				(summary.ContractValue != nil && *summary.ContractValue != *tt.wantValue) {
+				t.Errorf("contract value = %v, want %v", floatValue(summary.ContractValue), floatValue(tt.wantValue))
+			}
+			if summary.TermMonths != tt.wantTermMonths {
+				t.Errorf("term months = %d, want %d", summary.TermMonths, tt.wantTermMonths)
+			}
+			if summary.Deferred != tt.wantDeferred {
+				t.Errorf("deferred = %v, want %v", summary.Deferred, tt.wantDeferred)
+			}
+			if summary.Unbilled != tt.wantUnbilled {
+				t.Errorf("unbilled = %v, want %v", summary.Unbilled, tt.wantUnbilled)
+			}
+			if summary.CollectedToDate != tt.wantCollected {
+				t.Errorf("collected to date = %v, want %v", summary.CollectedToDate, tt.wantCollected)
+			}
+			if got := roundMoney(summary.RecognizedToDate + summary.Deferred - summary.Unbilled); got != summary.CollectedToDate {
+				t.Errorf("recognized + deferred - unbilled = %v, want collected %v", got, summary.CollectedToDate)
+			}
+		})
+	}
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+func floatValue(value *float64) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
@@ -0,0 +1,855 @@
+package controllers
+
+import (
+	"encoding/json"
+	"erp/config"
+	"erp/models"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ============ 服务价格目录 ============
+
+// GetServicePrices 获取服务价格目录
+func GetServicePrices(c *gin.Context) {
+	query := config.DB.Model(&models.ServicePrice{})
+
+	// 按适用客户类型筛选，包含不限客户类型的项目
+	if customerType := c.Query("customer_type"); customerType != "" {
+		query = query.Where("customer_type = ? OR customer_type = ''", customerType)
+	}
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if c.Query("include_disabled") != "true" {
+		query = query.Where("disabled = ?", false)
+	}
+
+	var prices []models.ServicePrice
+	if err := query.Order("category ASC, id ASC").Find(&prices).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch service prices: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, prices)
+}
+
+// CreateServicePrice 创建服务价格
+func CreateServicePrice(c *gin.Context) {
+	var price models.ServicePrice
+	if err := c.ShouldBindJSON(&price); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if err := validateServicePrice(&price); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	price.ID = 0
+	price.Version = 0
+	if err := config.DB.Create(&price).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to create service price: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, price)
+}
+
+// UpdateServicePrice 更新服务价格，已生成的报价单不受影响
+func UpdateServicePrice(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid service price ID")
+		return
+	}
+
+	var price models.ServicePrice
+	if err := config.DB.First(&price, id).Error; err != nil {
+		ErrorResponse(c, 404, "Service price not found")
+		return
+	}
+
+	var updateData models.ServicePrice
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if err := validateServicePrice(&updateData); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if !matchVersion(c, price.Version, updateData.Version) {
+		return
+	}
+
+	updateData.ID = price.ID
+	updateData.CreatedAt = price.CreatedAt
+	updateData.Version = price.Version + 1
+	if !updateVersioned(c, config.DB.Model(&price).Select("*"), price.Version, &updateData) {
+		return
+	}
+
+	config.DB.First(&price, id)
+
+	setETag(c, price.Version)
+	SuccessResponse(c, price)
+}
+
+// DeleteServicePrice 删除服务价格，报价明细中保留项目名称和价格
+func DeleteServicePrice(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid service price ID")
+		return
+	}
+
+	if err := config.DB.Delete(&models.ServicePrice{}, id).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to delete service price: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "Service price deleted successfully"})
+}
+
+// ============ 销售线索 ============
+
+// GetLeads 获取销售线索列表
+func GetLeads(c *gin.Context) {
+	var leads []models.Lead
+	var total int64
+
+	query := config.DB.Model(&models.Lead{}).Preload("Owner")
+
+	// 按名称/联系人/电话搜索
+	if keyword := c.Query("keyword"); keyword != "" {
+		query = query.Where("name LIKE ? OR contact_name LIKE ? OR contact_phone LIKE ?",
+			"%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%")
+	}
+	if stage := c.Query("stage"); stage != "" {
+		query = query.Where("stage = ?", stage)
+	}
+	if source := c.Query("source"); source != "" {
+		query = query.Where("source = ?", source)
+	}
+	if ownerID := c.Query("owner_id"); ownerID != "" {
+		query = query.Where("owner_id = ?", ownerID)
+	}
+
+	query.Count(&total)
+
+	if err := query.Order("id DESC").Find(&leads).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch leads: "+err.Error())
+		return
+	}
+
+	SuccessPaginatedResponse(c, total, leads)
+}
+
+// CreateLead 创建销售线索
+func CreateLead(c *gin.Context) {
+	var lead models.Lead
+	if err := c.ShouldBindJSON(&lead); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if lead.Stage == "" {
+		lead.Stage = models.LeadStageNew
+	}
+	if err := validateLead(&lead, ""); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	lead.ID = 0
+	lead.Version = 0
+	lead.CustomerID = nil
+	lead.ConvertedAt = nil
+	if err := config.DB.Create(&lead).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to create lead: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, lead)
+}
+
+// GetLead 获取销售线索详情，含报价单
+func GetLead(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid lead ID")
+		return
+	}
+
+	var lead models.Lead
+	if err := config.DB.Preload("Owner").Preload("Quotations", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).Preload("Quotations.Items").First(&lead, id).Error; err != nil {
+		ErrorResponse(c, 404, "Lead not found")
+		return
+	}
+
+	setETag(c, lead.Version)
+	SuccessResponse(c, lead)
+}
+
+// UpdateLead 更新销售线索，转化信息只能通过转化接口设置
+func UpdateLead(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid lead ID")
+		return
+	}
+
+	var lead models.Lead
+	if err := config.DB.First(&lead, id).Error; err != nil {
+		ErrorResponse(c, 404, "Lead not found")
+		return
+	}
+
+	var updateData models.Lead
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if updateData.Stage == "" {
+		updateData.Stage = lead.Stage
+	}
+	if err := validateLead(&updateData, lead.Stage); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if !matchVersion(c, lead.Version, updateData.Version) {
+		return
+	}
+
+	updateData.ID = lead.ID
+	updateData.CustomerID = lead.CustomerID
+	updateData.ConvertedAt = lead.ConvertedAt
+	updateData.CreatedAt = lead.CreatedAt
+	updateData.Version = lead.Version + 1
+	if !updateVersioned(c, config.DB.Model(&lead).Select("*"), lead.Version, &updateData) {
+		return
+	}
+
+	config.DB.Preload("Owner").First(&lead, id)
+
+	setETag(c, lead.Version)
+	SuccessResponse(c, lead)
+}
+
+// leadPatchFields 销售线索可通过 PATCH 修改的字段
+var leadPatchFields = patchFields{
+	"name":           "name",
+	"customer_type":  "customer_type",
+	"source":         "source",
+	"contact_name":   "contact_name",
+	"contact_phone":  "contact_phone",
+	"contact_wechat": "contact_wechat",
+	"stage":          "stage",
+	"owner_id":       "owner_id",
+	"remark":         "remark",
+	"lost_reason":    "lost_reason",
+	"version":        "",
+}
+
+// PatchLead 部分更新销售线索（JSON Merge Patch）
+func PatchLead(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid lead ID")
+		return
+	}
+
+	var lead models.Lead
+	if err := config.DB.First(&lead, id).Error; err != nil {
+		ErrorResponse(c, 404, "Lead not found")
+		return
+	}
+
+	var patched models.Lead
+	columns, ok := bindMergePatch(c, lead, &patched, leadPatchFields)
+	if !ok {
+		return
+	}
+
+	if err := validateLead(&patched, lead.Stage); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if !matchVersion(c, lead.Version, patched.Version) {
+		return
+	}
+
+	patched.Version = lead.Version + 1
+	if !updateVersioned(c, config.DB.Model(&lead).Select(append(columns, "version")), lead.Version, &patched) {
+		return
+	}
+
+	config.DB.Preload("Owner").First(&lead, id)
+
+	setETag(c, lead.Version)
+	SuccessResponse(c, lead)
+}
+
+// DeleteLead 删除销售线索及其报价单，已转化的线索不能删除
+func DeleteLead(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid lead ID")
+		return
+	}
+
+	var lead models.Lead
+	if err := config.DB.First(&lead, id).Error; err != nil {
+		ErrorResponse(c, 404, "Lead not found")
+		return
+	}
+	if lead.Stage == models.LeadStageWon {
+		ErrorResponse(c, 400, "Converted lead cannot be deleted")
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var quotationIDs []uint
+		tx.Model(&models.Quotation{}).Where("lead_id = ?", lead.ID).Pluck("id", &quotationIDs)
+		if len(quotationIDs) > 0 {
+			if err := tx.Where("quotation_id IN ?", quotationIDs).Delete(&models.QuotationItem{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&models.Quotation{}, quotationIDs).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&lead).Error
+	})
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to delete lead: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "Lead deleted successfully"})
+}
+
+// ============ 线索转化 ============
+
+// LeadPersonInput 转化时的人员信息：指定已有人员，或按身份证号查找/新建人员
+type LeadPersonInput struct {
+	PersonID uint   `json:"person_id"` // 已有人员ID
+	Name     string `json:"name"`
+	Phone    string `json:"phone"`
+	IDCard   string `json:"id_card"`
+}
+
+// LeadInvestorInput 转化时的自然人投资人
+type LeadInvestorInput struct {
+	LeadPersonInput
+	ShareRatio float64 `json:"share_ratio"` // 持股比例
+}
+
+// LeadConvertRequest 线索转化请求，客户信息未填写时取线索上的信息
+type LeadConvertRequest struct {
+	QuotationID       uint                `json:"quotation_id"` // 报价单，默认最近一份已接受的报价
+	CustomerID        uint                `json:"customer_id"`  // 已登记的潜在客户，指定时转为该客户而不新建
+	Name              string              `json:"name"`
+	Type              models.CustomerType `json:"type"`
+	TaxNumber         string              `json:"tax_number"`
+	Phone             string              `json:"phone"`
+	Address           string              `json:"address"`
+	RegisteredCapital float64             `json:"registered_capital"`
+	ServicePersonIDs  []uint              `json:"service_person_ids"` // 默认为线索跟进人（须为服务人员）
+	Representative    *LeadPersonInput    `json:"representative"`
+	Investors         []LeadInvestorInput `json:"investors"`
+	AgreementNumber   string              `json:"agreement_number"` // 协议编号，默认自动生成
+	StartDate         string              `json:"start_date" binding:"required"`
+	EndDate           string              `json:"end_date"`
+	Version           uint                `json:"version"` // 线索版本号
+}
+
+// LeadConvertResult 线索转化结果
+type LeadConvertResult struct {
+	Lead      models.Lead      `json:"lead"`
+	Customer  models.Customer  `json:"customer"`
+	Agreement models.Agreement `json:"agreement"`
+	Quotation models.Quotation `json:"quotation"`
+	People    []models.Person  `json:"people"` // 法定代表人及投资人（含已有人员）
+}
+
+// ConvertLead 将线索转化为客户：一次创建客户、法定代表人/投资人和首份协议，协议金额取自报价单；
+// 指定已登记的潜在客户时不新建客户，该客户转为建账中
+func ConvertLead(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid lead ID")
+		return
+	}
+
+	var lead models.Lead
+	if err := config.DB.First(&lead, id).Error; err != nil {
+		ErrorResponse(c, 404, "Lead not found")
+		return
+	}
+	if lead.Stage == models.LeadStageWon {
+		ErrorResponse(c, 400, "Lead has already been converted")
+		return
+	}
+
+	var req LeadConvertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	// 报价单
+	var quotation models.Quotation
+	quotationQuery := config.DB.Preload("Items", orderByID).Where("lead_id = ?", lead.ID)
+	if req.QuotationID != 0 {
+		quotationQuery = quotationQuery.Where("id = ?", req.QuotationID)
+	} else {
+		quotationQuery = quotationQuery.Where("status = ?", models.QuotationStatusAccepted).Order("id DESC")
+	}
+	if err := quotationQuery.First(&quotation).Error; err != nil {
+		if req.QuotationID != 0 {
+			ErrorResponse(c, 404, "Quotation not found for this lead")
+		} else {
+			ErrorResponse(c, 400, "No accepted quotation, please specify quotation_id")
+		}
+		return
+	}
+	if quotation.Status == models.QuotationStatusRejected {
+		ErrorResponse(c, 400, "Quotation has been rejected")
+		return
+	}
+
+	// 客户信息，转化已有潜在客户时未填写的项保留客户原有信息
+	customer := models.Customer{
+		Name:              firstNonEmpty(req.Name, lead.Name),
+		Type:              req.Type,
+		TaxNumber:         req.TaxNumber,
+		Phone:             firstNonEmpty(req.Phone, lead.ContactPhone),
+		Address:           req.Address,
+		RegisteredCapital: req.RegisteredCapital,
+		Status:            models.CustomerStatusOnboarding,
+	}
+	var prospect *models.Customer
+	if req.CustomerID != 0 {
+		prospect = &models.Customer{}
+		if err := config.DB.First(prospect, req.CustomerID).Error; err != nil {
+			ErrorResponse(c, 404, "Customer not found")
+			return
+		}
+		if prospect.Status != models.CustomerStatusProspect {
+			ErrorResponse(c, 400, fmt.Sprintf("Customer %d is %s, only prospects can be converted", prospect.ID, prospect.Status))
+			return
+		}
+		customer = *prospect
+		customer.Name = firstNonEmpty(req.Name, prospect.Name, lead.Name)
+		customer.Type = models.CustomerType(firstNonEmpty(string(req.Type), string(prospect.Type)))
+		customer.TaxNumber = firstNonEmpty(req.TaxNumber, prospect.TaxNumber)
+		customer.Phone = firstNonEmpty(req.Phone, prospect.Phone, lead.ContactPhone)
+		customer.Address = firstNonEmpty(req.Address, prospect.Address)
+		if req.RegisteredCapital != 0 {
+			customer.RegisteredCapital = req.RegisteredCapital
+		}
+		customer.Status = models.CustomerStatusOnboarding
+	}
+	if customer.Type == "" {
+		customer.Type = lead.CustomerType
+	}
+	if customer.Type == "" {
+		ErrorResponse(c, 400, "Customer type is required")
+		return
+	}
+	if err := validateCustomerType(customer.Type); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	servicePersonIDs := req.ServicePersonIDs
+	if servicePersonIDs == nil && prospect != nil && prospect.ServicePersonIDs != "" {
+		servicePersonIDs = StringToIDs(prospect.ServicePersonIDs)
+	}
+	if servicePersonIDs == nil && lead.OwnerID != nil && isServicePerson(*lead.OwnerID) {
+		servicePersonIDs = []uint{*lead.OwnerID}
+	}
+	for _, personID := range servicePersonIDs {
+		if !isServicePerson(personID) {
+			ErrorResponse(c, 400, fmt.Sprintf("Person %d is not a service person", personID))
+			return
+		}
+	}
+	customer.ServicePersonIDs = IDsToString(servicePersonIDs)
+
+	// 人员须指定已有人员ID，或提供姓名和身份证号
+	personInputs := make([]LeadPersonInput, 0, len(req.Investors)+1)
+	if req.Representative != nil {
+		personInputs = append(personInputs, *req.Representative)
+	}
+	for _, investor := range req.Investors {
+		personInputs = append(personInputs, investor.LeadPersonInput)
+	}
+	for _, input := range personInputs {
+		if input.PersonID != 0 {
+			var count int64
+			config.DB.Model(&models.Person{}).Where("id = ?", input.PersonID).Count(&count)
+			if count == 0 {
+				ErrorResponse(c, 400, fmt.Sprintf("Person %d not found", input.PersonID))
+				return
+			}
+		} else if input.Name == "" || input.IDCard == "" {
+			ErrorResponse(c, 400, "Representative and investors require person_id, or name and id_card")
+			return
+		}
+	}
+
+	// 协议期间
+	startDate, err := time.ParseInLocation("2006-01-02", req.StartDate, time.Local)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid start_date, expected YYYY-MM-DD")
+		return
+	}
+	var endDate time.Time
+	if req.EndDate != "" {
+		if endDate, err = time.ParseInLocation("2006-01-02", req.EndDate, time.Local); err != nil {
+			ErrorResponse(c, 400, "Invalid end_date, expected YYYY-MM-DD")
+			return
+		}
+		if endDate.Before(startDate) {
+			ErrorResponse(c, 400, "end_date must not be before start_date")
+			return
+		}
+	}
+
+	if !matchVersion(c, lead.Version, req.Version) {
+		return
+	}
+
+	operatorID := CurrentPersonID(c)
+	today := startOfDay(time.Now())
+	reason := fmt.Sprintf("线索 #%d 转化", lead.ID)
+	result := LeadConvertResult{People: []models.Person{}}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		update := tx.Model(&models.Lead{}).Where("id = ? AND version = ?", lead.ID, lead.Version).
+			Updates(map[string]interface{}{"stage": models.LeadStageWon, "converted_at": now, "version": lead.Version + 1})
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return errVersionConflict
+		}
+
+		// 法定代表人和投资人
+		if req.Representative != nil {
+			person, err := resolveLeadPerson(tx, *req.Representative, models.PersonTypeRepresentative)
+			if err != nil {
+				return err
+			}
+			customer.RepresentativeID = &person.ID
+			result.People = appendLeadPerson(result.People, person)
+		}
+		if len(req.Investors) > 0 {
+			infos := make([]models.InvestorInfo, 0, len(req.Investors))
+			for _, investor := range req.Investors {
+				person, err := resolveLeadPerson(tx, investor.LeadPersonInput, models.PersonTypeInvestor)
+				if err != nil {
+					return err
+				}
+				infos = append(infos, models.InvestorInfo{
+					InvestorType: models.InvestorTypePerson,
+					PersonID:     person.ID,
+					ShareRatio:   investor.ShareRatio,
+				})
+				result.People = appendLeadPerson(result.People, person)
+			}
+			investors, _ := json.Marshal(infos)
+			customer.Investors = investors
+		}
+
+		if prospect == nil {
+			if err := tx.Create(&customer).Error; err != nil {
+				return fmt.Errorf("create customer: %w", err)
+			}
+			if err := recordInitialCustomerStatus(tx, &customer, operatorID); err != nil {
+				return err
+			}
+		} else {
+			update := tx.Model(&models.Customer{}).Where("id = ? AND version = ?", prospect.ID, prospect.Version).
+				Updates(map[string]interface{}{
+					"name":               customer.Name,
+					"type":               customer.Type,
+					"tax_number":         customer.TaxNumber,
+					"phone":              customer.Phone,
+					"address":            customer.Address,
+					"registered_capital": customer.RegisteredCapital,
+					"service_person_ids": customer.ServicePersonIDs,
+					"representative_id":  customer.RepresentativeID,
+					"investors":          customer.Investors,
+					"status":             customer.Status,
+					"status_changed_at":  today,
+					"version":            prospect.Version + 1,
+				})
+			if update.Error != nil {
+				return update.Error
+			}
+			if update.RowsAffected == 0 {
+				return errVersionConflict
+			}
+			if err := tx.Create(&models.CustomerStatusChange{
+				CustomerID:    customer.ID,
+				FromStatus:    prospect.Status,
+				ToStatus:      customer.Status,
+				EffectiveDate: today,
+				Reason:        reason,
+				OperatorID:    operatorID,
+			}).Error; err != nil {
+				return err
+			}
+			if err := unlinkRemovedRelations(tx, prospect, &customer); err != nil {
+				return err
+			}
+		}
+
+		// 首份协议，收费方式和金额取自报价单
+		agreementNumber := req.AgreementNumber
+		if agreementNumber == "" {
+			agreementNumber = nextSerialNumber(tx, &models.Agreement{}, "agreement_number", "HT")
+		}
+		result.Agreement = models.Agreement{
+			CustomerID:      customer.ID,
+			AgreementNumber: agreementNumber,
+			StartDate:       startDate,
+			EndDate:         endDate,
+			FeeType:         quotation.FeeType,
+			Amount:          quotation.Amount,
+			OneTimeAmount:   quotation.OneTimeAmount,
+			Status:          models.AgreementStatusActive,
+			Items:           quotationAgreementItems(&quotation),
+		}
+		if err := tx.Create(&result.Agreement).Error; err != nil {
+			return fmt.Errorf("create agreement: %w", err)
+		}
+		customer.AgreementIDs = IDsToString(appendUniqueID(StringToIDs(customer.AgreementIDs), result.Agreement.ID))
+		if err := tx.Model(&models.Customer{}).Where("id = ?", customer.ID).Update("agreement_ids", customer.AgreementIDs).Error; err != nil {
+			return err
+		}
+
+		// 同步人员反向关联
+		if err := syncPersonRelations(tx, &customer); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Lead{}).Where("id = ?", lead.ID).Update("customer_id", customer.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Quotation{}).Where("id = ?", quotation.ID).Updates(map[string]interface{}{
+			"status":       models.QuotationStatusAccepted,
+			"agreement_id": result.Agreement.ID,
+			"version":      bumpVersion(),
+		}).Error
+	})
+	if err == errVersionConflict {
+		ErrorResponse(c, 409, err.Error())
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to convert lead: "+err.Error())
+		return
+	}
+
+	config.DB.First(&result.Customer, customer.ID)
+	config.DB.First(&result.Lead, lead.ID)
+	config.DB.Preload("Items").First(&result.Quotation, quotation.ID)
+	for i := range result.People {
+		config.DB.First(&result.People[i], result.People[i].ID)
+	}
+
+	if prospect == nil {
+		publishEvent(models.WebhookEventCustomerCreated, result.Customer)
+	} else {
+		publishEvent(models.WebhookEventCustomerUpdated, result.Customer, StringToIDs(prospect.ServicePersonIDs)...)
+		publishEvent(models.WebhookEventCustomerStatus, gin.H{
+			"customer_id":    customer.ID,
+			"from_status":    prospect.Status,
+			"to_status":      customer.Status,
+			"effective_date": today,
+			"reason":         reason,
+		})
+	}
+	publishEvent(models.WebhookEventAgreementCreated, result.Agreement)
+
+	setETag(c, result.Lead.Version)
+	SuccessResponse(c, result)
+}
+
+// ============ 辅助函数 ============
+
+// validateServicePrice 校验服务价格
+func validateServicePrice(price *models.ServicePrice) error {
+	if price.Name == "" {
+		return fmt.Errorf("Name is required")
+	}
+	if price.Price < 0 {
+		return fmt.Errorf("Price must not be negative")
+	}
+	if price.CustomerType != "" {
+		if err := validateCustomerType(price.CustomerType); err != nil {
+			return err
+		}
+	}
+	return validateItemFeeType(price.FeeType)
+}
+
+// validateLead 校验销售线索，from 为修改前的阶段（新建时为空）
+func validateLead(lead *models.Lead, from models.LeadStage) error {
+	if lead.Name == "" || lead.ContactName == "" {
+		return fmt.Errorf("Name and contact_name are required")
+	}
+	if lead.CustomerType != "" {
+		if err := validateCustomerType(lead.CustomerType); err != nil {
+			return err
+		}
+	}
+	switch lead.Stage {
+	case models.LeadStageNew, models.LeadStageContacted, models.LeadStageQuoted, models.LeadStageNegotiating, models.LeadStageLost:
+	case models.LeadStageWon:
+		if from != models.LeadStageWon {
+			return fmt.Errorf("Use the convert endpoint to convert a lead")
+		}
+	default:
+		return fmt.Errorf("Invalid stage: %s", lead.Stage)
+	}
+	if from == models.LeadStageWon && lead.Stage != models.LeadStageWon {
+		return fmt.Errorf("Converted lead cannot change stage")
+	}
+	if lead.Stage == models.LeadStageLost && lead.LostReason == "" {
+		return fmt.Errorf("lost_reason is required when the lead is lost")
+	}
+	if lead.OwnerID != nil {
+		var count int64
+		config.DB.Model(&models.Person{}).Where("id = ?", *lead.OwnerID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("Owner person %d not found", *lead.OwnerID)
+		}
+	}
+	return nil
+}
+
+// validateCustomerType 校验客户类型
+func validateCustomerType(customerType models.CustomerType) error {
+	switch customerType {
+	case models.CustomerTypeLimitedCompany, models.CustomerTypeSoleProprietorship,
+		models.CustomerTypePartnership, models.CustomerTypeIndividualBusiness:
+		return nil
+	}
+	return fmt.Errorf("Invalid customer type: %s", customerType)
+}
+
+// validateFeeType 校验收费类型
+func validateFeeType(feeType models.FeeType) error {
+	switch feeType {
+	case models.FeeTypeMonthly, models.FeeTypeQuarterly, models.FeeTypeYearly:
+		return nil
+	}
+	return fmt.Errorf("Invalid fee type: %s", feeType)
+}
+
+// resolveLeadPerson 按人员ID或身份证号查找人员，不存在时按给定类型新建
+func resolveLeadPerson(tx *gorm.DB, input LeadPersonInput, personType models.PersonType) (*models.Person, error) {
+	var person models.Person
+	if input.PersonID != 0 {
+		if err := tx.First(&person, input.PersonID).Error; err != nil {
+			return nil, err
+		}
+		return &person, nil
+	}
+	if tx.Where("id_card = ?", input.IDCard).First(&person).Error == nil {
+		return &person, nil
+	}
+	person = models.Person{Type: personType, Name: input.Name, Phone: input.Phone, IDCard: input.IDCard}
+	if err := tx.Create(&person).Error; err != nil {
+		return nil, fmt.Errorf("create %s: %w", personType, err)
+	}
+	return &person, nil
+}
+
+// appendLeadPerson 追加人员，同一人同时担任法定代表人和投资人时只保留一条
+func appendLeadPerson(people []models.Person, person *models.Person) []models.Person {
+	for _, existing := range people {
+		if existing.ID == person.ID {
+			return people
+		}
+	}
+	return append(people, *person)
+}
+
+// nextSerialNumber 生成当天的流水编号：前缀 + 日期 + "-" + 三位序号，如 BJ20240315-001
+func nextSerialNumber(db *gorm.DB, model interface{}, column, prefix string) string {
+	base := prefix + time.Now().Format("20060102") + "-"
+	var count int64
+	db.Model(model).Where(column+" LIKE ?", base+"%").Count(&count)
+	for seq := count + 1; ; seq++ {
+		number := fmt.Sprintf("%s%03d", base, seq)
+		var exists int64
+		db.Model(model).Where(column+" = ?", number).Count(&exists)
+		if exists == 0 {
+			return number
+		}
+	}
+}
+
+// quotationAgreementItems 按报价明细生成协议明细，报价单优惠按金额比例分摊到周期性明细（尾差计入最后一项），
+// 使协议金额与报价金额一致
+func quotationAgreementItems(quotation *models.Quotation) []models.AgreementItem {
+	items := make([]models.AgreementItem, 0, len(quotation.Items))
+	last := -1
+	remaining := quotation.Discount
+	for _, line := range quotation.Items {
+		item := models.AgreementItem{
+			ServicePriceID: line.ServicePriceID,
+			Name:           line.Name,
+			Description:    line.Description,
+			FeeType:        line.FeeType,
+			Quantity:       line.Quantity,
+			UnitPrice:      line.UnitPrice,
+			Amount:         line.Amount,
+		}
+		if item.FeeType == "" {
+			item.FeeType = quotation.FeeType
+		}
+		if item.FeeType != models.FeeTypeOneTime && quotation.Discount > 0 && quotation.Subtotal > 0 {
+			item.Discount = roundMoney(quotation.Discount * line.Amount / quotation.Subtotal)
+			remaining = roundMoney(remaining - item.Discount)
+			last = len(items)
+		}
+		items = append(items, item)
+	}
+	if last >= 0 {
+		items[last].Discount = roundMoney(items[last].Discount + remaining)
+	}
+	for i := range items {
+		items[i].Amount = roundMoney(items[i].Quantity*items[i].UnitPrice - items[i].Discount)
+	}
+	return items
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -10,35 +10,50 @@ import (
 
 // OverviewStats 首页概览统计
 type OverviewStats struct {
-	CustomerCount      int64   `json:"customer_count"`
+	CustomerCount      int64   `json:"customer_count"` // 在服务客户数（建账中/服务中/暂停服务）
+	CustomersByStatus  map[string]int64 `json:"customers_by_status"` // 按生命周期状态统计
 	PendingTaskCount   int64   `json:"pending_task_count"`
 	ActiveAgreementCount int64 `json:"active_agreement_count"`
 	MonthlyPayment     float64 `json:"monthly_payment"`
 	YearlyPayment      float64 `json:"yearly_payment"`
 }
 
-// TaskStats 任务统计
+// TaskStats 任务统计（按流程状态分类汇总）
 type TaskStats struct {
 	Pending      int64 `json:"pending"`
 	InProgress   int64 `json:"in_progress"`
 	Completed    int64 `json:"completed"`
+	Cancelled    int64            `json:"cancelled"`
+	ByStatus     map[string]int64 `json:"by_status"` // 按具体状态统计
 }
 
 // PaymentStats 收款统计
 type PaymentStats struct {
-	TotalAmount   float64 `json:"total_amount"`
-	Count         int64   `json:"count"`
+	TotalAmount    float64 `json:"total_amount"`
+	Count          int64   `json:"count"`
+	RefundedAmount float64 `json:"refunded_amount"` // 期内退款（按退款日期）
+	NetAmount      float64 `json:"net_amount"`      // 收款减退款
 }
 
 // GetOverview 获取首页概览统计
 func GetOverview(c *gin.Context) {
-	var stats OverviewStats
+	stats := OverviewStats{CustomersByStatus: make(map[string]int64)}
 
-	// 客户总数
-	config.DB.Model(&models.Customer{}).Count(&stats.CustomerCount)
+	// 在服务客户数，潜在客户和已终止客户不计入
+	config.DB.Model(&models.Customer{}).Where("status IN ?", inServiceCustomerStatuses()).Count(&stats.CustomerCount)
+
+	// 按生命周期状态统计客户数
+	var statusRows []struct {
+		Status string
+		Count  int64
+	}
+	config.DB.Model(&models.Customer{}).Select("status, COUNT(*) AS count").Group("status").Scan(&statusRows)
+	for _, row := range statusRows {
+		stats.CustomersByStatus[row.Status] = row.Count
+	}
 
 	// 待办任务数
-	config.DB.Model(&models.Task{}).Where("status != ?", "completed").Count(&stats.PendingTaskCount)
+	config.DB.Model(&models.Task{}).Where(openTaskCondition()).Count(&stats.PendingTaskCount)
 
 	// 有效协议数
 	config.DB.Model(&models.Agreement{}).Where("status = ?", "active").Count(&stats.ActiveAgreementCount)
@@ -63,11 +78,32 @@ func GetOverview(c *gin.Context) {
 
 // GetTaskStats 获取任务统计
 func GetTaskStats(c *gin.Context) {
-	var stats TaskStats
+	stats := TaskStats{ByStatus: make(map[string]int64)}
 
-	config.DB.Model(&models.Task{}).Where("status = ?", "pending").Count(&stats.Pending)
-	config.DB.Model(&models.Task{}).Where("status = ?", "in_progress").Count(&stats.InProgress)
-	config.DB.Model(&models.Task{}).Where("status = ?", "completed").Count(&stats.Completed)
+	// 按任务类型和状态分组，再按各类型流程的状态分类汇总
+	var rows []struct {
+		Type   string
+		Status string
+		Count  int64
+	}
+	config.DB.Model(&models.Task{}).
+		Select("type, status, COUNT(*) AS count").
+		Group("type, status").
+		Scan(&rows)
+
+	for _, row := range rows {
+		stats.ByStatus[row.Status] += row.Count
+		switch taskStateCategory(row.Type, row.Status) {
+		case models.TaskStateCategoryPending:
+			stats.Pending += row.Count
+		case models.TaskStateCategoryInProgress:
+			stats.InProgress += row.Count
+		case models.TaskStateCategoryCompleted:
+			stats.Completed += row.Count
+		case models.TaskStateCategoryCancelled:
+			stats.Cancelled += row.Count
+		}
+	}
 
 	SuccessResponse(c, stats)
 }
@@ -97,5 +133,19 @@ func GetPaymentStats(c *gin.Context) {
 	query.Count(&stats.Count)
 	query.Select("COALESCE(SUM(amount), 0)").Scan(&stats.TotalAmount)
 
+	refundQuery := config.DB.Model(&models.PaymentRefund{})
+	if startDate != "" {
+		if t, err := time.Parse("2006-01-02", startDate); err == nil {
+			refundQuery = refundQuery.Where("refund_date >= ?", t)
+		}
+	}
+	if endDate != "" {
+		if t, err := time.Parse("2006-01-02", endDate); err == nil {
+			refundQuery = refundQuery.Where("refund_date <= ?", t)
+		}
+	}
+	refundQuery.Select("COALESCE(SUM(amount), 0)").Scan(&stats.RefundedAmount)
+	stats.NetAmount = roundMoney(stats.TotalAmount - stats.RefundedAmount)
+
 	SuccessResponse(c, stats)
 }
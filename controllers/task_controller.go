@@ -3,10 +3,13 @@ package controllers
 import (
 	"erp/config"
 	"erp/models"
+	"errors"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // CreateTask 创建任务
@@ -17,11 +20,54 @@ func CreateTask(c *gin.Context) {
 		return
 	}
 
+	if task.Priority == "" {
+		task.Priority = models.TaskPriorityNormal
+	}
+	if !isValidTaskPriority(task.Priority) {
+		ErrorResponse(c, 400, "Invalid task priority")
+		return
+	}
+	if task.CreatorID == nil {
+		task.CreatorID = CurrentPersonID(c)
+	}
+
+	// 状态须为任务流程中定义的状态，未指定时取流程初始状态
+	workflow := loadTaskWorkflow(task.Type)
+	if task.Status == "" {
+		task.Status = workflow.InitialState
+	}
+	if workflow.state(task.Status) == nil {
+		ErrorResponse(c, 400, "Invalid task status: "+task.Status)
+		return
+	}
+	if taskStateCategory(task.Type, task.Status) == models.TaskStateCategoryCompleted && task.CompletedAt == nil {
+		now := time.Now()
+		task.CompletedAt = &now
+	}
+
+	// 指定了负责人时校验，否则按客户的服务人员自动分配
+	reason := "创建时指定"
+	if task.AssigneeID != nil {
+		if !isServicePerson(*task.AssigneeID) {
+			ErrorResponse(c, 400, "Assignee must be a service person")
+			return
+		}
+	} else {
+		task.AssigneeID = autoAssignTask(task.CustomerID)
+		reason = "按客户服务人员自动分配"
+	}
+
 	if err := config.DB.Create(&task).Error; err != nil {
 		ErrorResponse(c, 500, "Failed to create task: "+err.Error())
 		return
 	}
 
+	if task.AssigneeID != nil {
+		recordTaskAssignment(task.ID, nil, task.AssigneeID, task.CreatorID, reason)
+	}
+
+	publishEvent(models.WebhookEventTaskCreated, task)
+
 	SuccessResponse(c, task)
 }
 
@@ -34,8 +80,10 @@ func GetTasks(c *gin.Context) {
 	keyword := c.Query("keyword")
 	status := c.Query("status")
 	customerID := c.Query("customer_id")
+	assigneeID := c.Query("assignee_id")
+	priority := c.Query("priority")
 
-	query := config.DB.Model(&models.Task{}).Preload("Customer")
+	query := config.DB.Model(&models.Task{}).Preload("Customer").Preload("Assignee")
 
 	// 搜索功能
 	if keyword != "" {
@@ -52,6 +100,24 @@ func GetTasks(c *gin.Context) {
 		query = query.Where("customer_id = ?", customerID)
 	}
 
+	// 按负责人筛选
+	if assigneeID != "" {
+		query = query.Where("assignee_id = ?", assigneeID)
+	}
+
+	// 按优先级筛选
+	if priority != "" {
+		query = query.Where("priority = ?", priority)
+	}
+
+	// 按任务模板及申报期间筛选
+	if templateID := c.Query("template_id"); templateID != "" {
+		query = query.Where("template_id = ?", templateID)
+	}
+	if period := c.Query("period"); period != "" {
+		query = query.Where("period = ?", period)
+	}
+
 	// 获取总数
 	query.Count(&total)
 
@@ -61,6 +127,9 @@ func GetTasks(c *gin.Context) {
 		return
 	}
 
+	// 加载检查项完成进度
+	loadTaskProgress(tasks)
+
 	SuccessPaginatedResponse(c, total, tasks)
 }
 
@@ -73,12 +142,16 @@ func GetTask(c *gin.Context) {
 	}
 
 	var task models.Task
-	if err := config.DB.Preload("Customer").First(&task, id).Error; err != nil {
+	if err := config.DB.Preload("Customer").Preload("Assignee").Preload("Creator").First(&task, id).Error; err != nil {
 		ErrorResponse(c, 404, "Task not found")
 		return
 	}
 
-	SuccessResponse(c, task)
+	tasks := []models.Task{task}
+	loadTaskProgress(tasks)
+
+	setETag(c, task.Version)
+	SuccessResponse(c, tasks[0])
 }
 
 // UpdateTask 更新任务
@@ -101,18 +174,200 @@ func UpdateTask(c *gin.Context) {
 		return
 	}
 
-	// 如果状态变为已完成，设置完成时间
-	if updateData.Status == "completed" && task.Status != "completed" {
-		now := time.Now()
-		updateData.CompletedAt = &now
+	if updateData.Priority != "" && !isValidTaskPriority(updateData.Priority) {
+		ErrorResponse(c, 400, "Invalid task priority")
+		return
+	}
+
+	// 负责人变更需校验并记录分配历史
+	assigneeChanged := updateData.AssigneeID != nil &&
+		(task.AssigneeID == nil || *task.AssigneeID != *updateData.AssigneeID)
+	if assigneeChanged && !isServicePerson(*updateData.AssigneeID) {
+		ErrorResponse(c, 400, "Assignee must be a service person")
+		return
+	}
+	previousAssignee := copyID(task.AssigneeID)
+
+	if !matchVersion(c, task.Version, updateData.Version) {
+		return
 	}
 
-	// 更新字段
-	config.DB.Model(&task).Updates(updateData)
+	// 变更任务类型时，当前状态须在新类型的流程中存在；状态流转按原类型的流程校验，不能同时变更状态
+	if updateData.Type != "" && updateData.Type != task.Type {
+		if updateData.Status != "" && updateData.Status != task.Status {
+			ErrorResponse(c, 400, "Task type and status cannot be changed in the same request")
+			return
+		}
+		if loadTaskWorkflow(updateData.Type).state(task.Status) == nil {
+			ErrorResponse(c, 400, "Current status is not defined in the workflow of task type "+updateData.Type)
+			return
+		}
+	}
+
+	to := updateData.Status
+	updateData.Status = ""
+	updateData.StartedAt = nil
+	updateData.CompletedAt = nil
+	updateData.StatusChangedAt = nil
+
+	// 状态流转与字段更新在同一事务中执行，任一步失败则整体回滚
+	var transition *models.TaskTransition
+	var transitionErr error
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// 状态变更按任务流程校验并记录（时间戳由流程自动维护）
+		if to != "" && to != task.Status {
+			if transition, transitionErr = applyTaskTransition(tx, &task, TaskTransitionRequest{To: to}, CurrentPersonID(c)); transitionErr != nil {
+				return transitionErr
+			}
+		}
+
+		// 更新字段（以读取时的版本为条件，防止覆盖他人的修改）
+		current := task.Version
+		updateData.Version = current + 1
+		result := tx.Model(&task).Where("version = ?", current).Updates(updateData)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVersionConflict
+		}
+		return nil
+	})
+	if !respondTaskUpdateError(c, err, transitionErr) {
+		return
+	}
+	if transition != nil {
+		publishEvent(models.WebhookEventTaskTransitioned, transition)
+	}
+
+	if assigneeChanged {
+		recordTaskAssignment(task.ID, previousAssignee, updateData.AssigneeID, CurrentPersonID(c), "更新任务时变更")
+	}
 
 	// 重新获取更新后的数据
-	config.DB.Preload("Customer").First(&task, id)
+	config.DB.Preload("Customer").Preload("Assignee").First(&task, id)
+
+	publishEvent(models.WebhookEventTaskUpdated, task)
+
+	setETag(c, task.Version)
+	SuccessResponse(c, task)
+}
+
+// taskPatchFields 任务可通过 PATCH 修改的字段，状态变更按任务流程执行
+var taskPatchFields = patchFields{
+	"customer_id": "customer_id",
+	"title":       "title",
+	"description": "description",
+	"type":        "type",
+	"status":      "status",
+	"priority":    "priority",
+	"assignee_id": "assignee_id",
+	"due_date":    "due_date",
+	"version":     "",
+}
+
+// PatchTask 部分更新任务（JSON Merge Patch），值为 null 的字段被清空（如取消负责人、截止日期）
+func PatchTask(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid task ID")
+		return
+	}
+
+	var task models.Task
+	if err := config.DB.First(&task, id).Error; err != nil {
+		ErrorResponse(c, 404, "Task not found")
+		return
+	}
+
+	var patched models.Task
+	columns, ok := bindMergePatch(c, task, &patched, taskPatchFields)
+	if !ok {
+		return
+	}
+
+	if patched.Title == "" || patched.CustomerID == 0 || patched.Status == "" {
+		ErrorResponse(c, 400, "Title, customer and status are required")
+		return
+	}
+	if patched.Priority != task.Priority && !isValidTaskPriority(patched.Priority) {
+		ErrorResponse(c, 400, "Invalid task priority")
+		return
+	}
 
+	// 负责人变更需校验并记录分配历史
+	assigneeChanged := (task.AssigneeID == nil) != (patched.AssigneeID == nil) ||
+		(task.AssigneeID != nil && *task.AssigneeID != *patched.AssigneeID)
+	if assigneeChanged && patched.AssigneeID != nil && !isServicePerson(*patched.AssigneeID) {
+		ErrorResponse(c, 400, "Assignee must be a service person")
+		return
+	}
+	previousAssignee := copyID(task.AssigneeID)
+
+	if !matchVersion(c, task.Version, patched.Version) {
+		return
+	}
+
+	// 变更任务类型时，当前状态须在新类型的流程中存在；状态流转按原类型的流程校验，不能同时变更状态
+	if patched.Type != task.Type {
+		if patched.Status != task.Status {
+			ErrorResponse(c, 400, "Task type and status cannot be changed in the same request")
+			return
+		}
+		if loadTaskWorkflow(patched.Type).state(task.Status) == nil {
+			ErrorResponse(c, 400, "Current status is not defined in the workflow of task type "+patched.Type)
+			return
+		}
+	}
+
+	var fieldColumns []string
+	for _, column := range columns {
+		if column != "status" {
+			fieldColumns = append(fieldColumns, column)
+		}
+	}
+
+	// 状态流转与字段更新在同一事务中执行，任一步失败则整体回滚
+	var transition *models.TaskTransition
+	var transitionErr error
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// 状态变更按任务流程校验并记录
+		if patched.Status != task.Status {
+			if transition, transitionErr = applyTaskTransition(tx, &task, TaskTransitionRequest{To: patched.Status}, CurrentPersonID(c)); transitionErr != nil {
+				return transitionErr
+			}
+		}
+		if len(fieldColumns) == 0 {
+			return nil
+		}
+
+		current := task.Version
+		patched.Version = current + 1
+		result := tx.Model(&task).Select(append(fieldColumns, "version")).Where("version = ?", current).Updates(&patched)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVersionConflict
+		}
+		return nil
+	})
+	if !respondTaskUpdateError(c, err, transitionErr) {
+		return
+	}
+	if transition != nil {
+		publishEvent(models.WebhookEventTaskTransitioned, transition)
+	}
+
+	if assigneeChanged {
+		recordTaskAssignment(task.ID, previousAssignee, patched.AssigneeID, CurrentPersonID(c), "更新任务时变更")
+	}
+
+	config.DB.Preload("Customer").Preload("Assignee").First(&task, id)
+
+	publishEvent(models.WebhookEventTaskUpdated, task)
+
+	setETag(c, task.Version)
 	SuccessResponse(c, task)
 }
 
@@ -124,10 +379,267 @@ func DeleteTask(c *gin.Context) {
 		return
 	}
 
+	var task models.Task
+	config.DB.First(&task, id)
+
 	if err := config.DB.Delete(&models.Task{}, id).Error; err != nil {
 		ErrorResponse(c, 500, "Failed to delete task: "+err.Error())
 		return
 	}
 
+	// 清理检查项、评论和附件
+	deleteTaskDetails(uint(id))
+
+	publishEvent(models.WebhookEventTaskDeleted, gin.H{
+		"id":          uint(id),
+		"customer_id": task.CustomerID,
+		"assignee_id": task.AssigneeID,
+		"creator_id":  task.CreatorID,
+	})
+
 	SuccessResponse(c, gin.H{"message": "Task deleted successfully"})
 }
+
+// AssignTaskRequest 任务分配请求
+type AssignTaskRequest struct {
+	AssigneeID uint   `json:"assignee_id" binding:"required"` // 新负责人
+	Reason     string `json:"reason"`                         // 分配原因
+}
+
+// AssignTask 重新分配任务负责人
+func AssignTask(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid task ID")
+		return
+	}
+
+	var task models.Task
+	if err := config.DB.First(&task, id).Error; err != nil {
+		ErrorResponse(c, 404, "Task not found")
+		return
+	}
+
+	var req AssignTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if !isServicePerson(req.AssigneeID) {
+		ErrorResponse(c, 400, "Assignee must be a service person")
+		return
+	}
+
+	if task.AssigneeID != nil && *task.AssigneeID == req.AssigneeID {
+		ErrorResponse(c, 400, "Task is already assigned to this person")
+		return
+	}
+
+	if !matchVersion(c, task.Version, 0) {
+		return
+	}
+
+	previousAssignee := copyID(task.AssigneeID)
+	if !updateVersioned(c, config.DB.Model(&task), task.Version, map[string]interface{}{
+		"assignee_id": req.AssigneeID,
+		"version":     task.Version + 1,
+	}) {
+		return
+	}
+	recordTaskAssignment(task.ID, previousAssignee, &req.AssigneeID, CurrentPersonID(c), req.Reason)
+
+	config.DB.Preload("Customer").Preload("Assignee").First(&task, id)
+	setETag(c, task.Version)
+
+	SuccessResponse(c, task)
+}
+
+// GetTaskAssignments 获取任务分配历史
+func GetTaskAssignments(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid task ID")
+		return
+	}
+
+	var assignments []models.TaskAssignment
+	if err := config.DB.Preload("FromPerson").Preload("ToPerson").
+		Where("task_id = ?", id).Order("created_at ASC").Find(&assignments).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch task assignments: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, assignments)
+}
+
+// MyTasks 我的任务（按逾期/今天/本周/以后分组）
+type MyTasks struct {
+	Overdue  []models.Task `json:"overdue"`   // 已逾期
+	Today    []models.Task `json:"today"`     // 今天到期
+	ThisWeek []models.Task `json:"this_week"` // 本周内到期（不含今天）
+	Later    []models.Task `json:"later"`     // 本周之后到期或未设置截止日期
+}
+
+// GetMyTasks 获取当前人员负责的未完成任务
+func GetMyTasks(c *gin.Context) {
+	personID := CurrentPersonID(c)
+	if personID == nil {
+		ErrorResponse(c, 401, "Missing X-Person-ID header")
+		return
+	}
+
+	var tasks []models.Task
+	if err := config.DB.Preload("Customer").
+		Where("assignee_id = ?", *personID).Where(openTaskCondition()).
+		Order("due_date IS NULL, due_date ASC").
+		Find(&tasks).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch tasks: "+err.Error())
+		return
+	}
+	loadTaskProgress(tasks)
+
+	// 计算时间边界（周一为一周的开始）
+	now := time.Now()
+	startOfToday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	startOfTomorrow := startOfToday.AddDate(0, 0, 1)
+	daysToNextMonday := (8 - int(now.Weekday())) % 7
+	if daysToNextMonday == 0 {
+		daysToNextMonday = 7
+	}
+	startOfNextWeek := startOfToday.AddDate(0, 0, daysToNextMonday)
+
+	result := MyTasks{
+		Overdue:  []models.Task{},
+		Today:    []models.Task{},
+		ThisWeek: []models.Task{},
+		Later:    []models.Task{},
+	}
+	for _, task := range tasks {
+		switch {
+		case task.DueDate == nil:
+			result.Later = append(result.Later, task)
+		case task.DueDate.Before(startOfToday):
+			result.Overdue = append(result.Overdue, task)
+		case task.DueDate.Before(startOfTomorrow):
+			result.Today = append(result.Today, task)
+		case task.DueDate.Before(startOfNextWeek):
+			result.ThisWeek = append(result.ThisWeek, task)
+		default:
+			result.Later = append(result.Later, task)
+		}
+	}
+
+	SuccessResponse(c, result)
+}
+
+// ============ 辅助函数 ============
+
+// isValidTaskPriority 校验任务优先级
+func isValidTaskPriority(priority models.TaskPriority) bool {
+	switch priority {
+	case models.TaskPriorityLow, models.TaskPriorityNormal, models.TaskPriorityHigh, models.TaskPriorityUrgent:
+		return true
+	}
+	return false
+}
+
+// isServicePerson 判断人员是否可作为任务负责人（服务人员或混合角色）
+func isServicePerson(personID uint) bool {
+	var count int64
+	config.DB.Model(&models.Person{}).
+		Where("id = ? AND type IN ?", personID,
+			[]models.PersonType{models.PersonTypeServicePerson, models.PersonTypeMixed}).
+		Count(&count)
+	return count > 0
+}
+
+// autoAssignTask 按客户的服务人员自动分配负责人，选择未完成任务最少的人员
+func autoAssignTask(customerID uint) *uint {
+	var customer models.Customer
+	if config.DB.First(&customer, customerID).Error != nil {
+		return nil
+	}
+
+	var assignee *uint
+	var minOpen int64
+	for _, personID := range StringToIDs(customer.ServicePersonIDs) {
+		if !isServicePerson(personID) {
+			continue
+		}
+		var open int64
+		config.DB.Model(&models.Task{}).
+			Where("assignee_id = ?", personID).Where(openTaskCondition()).
+			Count(&open)
+		if assignee == nil || open < minOpen {
+			id := personID
+			assignee = &id
+			minOpen = open
+		}
+	}
+	return assignee
+}
+
+// recordTaskAssignment 记录任务分配历史并推送 task.assigned 事件
+func recordTaskAssignment(taskID uint, from, to, operator *uint, reason string) {
+	assignment := models.TaskAssignment{
+		TaskID:       taskID,
+		FromPersonID: from,
+		ToPersonID:   to,
+		OperatorID:   operator,
+		Reason:       reason,
+	}
+	config.DB.Create(&assignment)
+
+	publishEvent(models.WebhookEventTaskAssigned, assignment)
+}
+
+// respondTaskUpdateError 输出任务更新事务的错误：版本冲突409，流转校验失败400，其他500
+// 无错误时返回 true
+func respondTaskUpdateError(c *gin.Context, err, transitionErr error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errVersionConflict):
+		ErrorResponse(c, 409, err.Error())
+	case err == transitionErr:
+		ErrorResponse(c, 400, err.Error())
+	default:
+		ErrorResponse(c, 500, "Failed to update: "+err.Error())
+	}
+	return false
+}
+
+// copyID 复制ID指针，避免更新记录时被覆盖
+func copyID(id *uint) *uint {
+	if id == nil {
+		return nil
+	}
+	value := *id
+	return &value
+}
+
+// createSystemTask 创建系统生成的任务（如到期提醒），使用流程初始状态并按客户服务人员自动分配
+// 同一模板、客户和期间的任务已存在时不创建，返回 false
+func createSystemTask(task *models.Task) (bool, error) {
+	if task.Priority == "" {
+		task.Priority = models.TaskPriorityNormal
+	}
+	task.Status = loadTaskWorkflow(task.Type).InitialState
+	task.AssigneeID = autoAssignTask(task.CustomerID)
+
+	result := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(task)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	if task.AssigneeID != nil {
+		recordTaskAssignment(task.ID, nil, task.AssigneeID, nil, "按客户服务人员自动分配")
+	}
+
+	publishEvent(models.WebhookEventTaskCreated, task)
+	return true, nil
+}
@@ -0,0 +1,535 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// mentionPattern 评论中的 @姓名
+var mentionPattern = regexp.MustCompile(`@([^\s@,，:：;；]+)`)
+
+// ============ 检查项 ============
+
+// GetTaskChecklist 获取任务检查项
+func GetTaskChecklist(c *gin.Context) {
+	taskID, ok := parseTaskIDParam(c)
+	if !ok {
+		return
+	}
+
+	var items []models.TaskChecklistItem
+	if err := config.DB.Where("task_id = ?", taskID).Order("sort_order ASC, id ASC").Find(&items).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch checklist: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, items)
+}
+
+// CreateTaskChecklistItem 添加任务检查项（未指定排序时追加到末尾）
+func CreateTaskChecklistItem(c *gin.Context) {
+	taskID, ok := parseTaskIDParam(c)
+	if !ok {
+		return
+	}
+
+	var item models.TaskChecklistItem
+	if err := c.ShouldBindJSON(&item); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+	if item.Title == "" {
+		ErrorResponse(c, 400, "Checklist item title is required")
+		return
+	}
+
+	item.TaskID = taskID
+	if item.SortOrder == 0 {
+		var maxOrder int
+		config.DB.Model(&models.TaskChecklistItem{}).
+			Where("task_id = ?", taskID).
+			Select("COALESCE(MAX(sort_order), 0)").
+			Scan(&maxOrder)
+		item.SortOrder = maxOrder + 1
+	}
+	if item.Completed {
+		now := time.Now()
+		item.CompletedAt = &now
+		item.CompletedBy = CurrentPersonID(c)
+	}
+
+	if err := config.DB.Create(&item).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to create checklist item: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, item)
+}
+
+// UpdateTaskChecklistItemRequest 更新检查项请求
+type UpdateTaskChecklistItemRequest struct {
+	Title     string `json:"title"`
+	SortOrder *int   `json:"sort_order"`
+	Completed *bool  `json:"completed"`
+	Version   uint   `json:"version"` // 更新时所基于的版本号（也可使用 If-Match 请求头）
+}
+
+// UpdateTaskChecklistItem 更新任务检查项（标题、排序、完成状态）
+func UpdateTaskChecklistItem(c *gin.Context) {
+	taskID, ok := parseTaskIDParam(c)
+	if !ok {
+		return
+	}
+
+	var item models.TaskChecklistItem
+	if err := config.DB.Where("task_id = ?", taskID).First(&item, c.Param("item_id")).Error; err != nil {
+		ErrorResponse(c, 404, "Checklist item not found")
+		return
+	}
+
+	var req UpdateTaskChecklistItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Title != "" {
+		updates["title"] = req.Title
+	}
+	if req.SortOrder != nil {
+		updates["sort_order"] = *req.SortOrder
+	}
+	if req.Completed != nil && *req.Completed != item.Completed {
+		updates["completed"] = *req.Completed
+		if *req.Completed {
+			updates["completed_at"] = time.Now()
+			updates["completed_by"] = CurrentPersonID(c)
+		} else {
+			updates["completed_at"] = nil
+			updates["completed_by"] = nil
+		}
+	}
+
+	if !matchVersion(c, item.Version, req.Version) {
+		return
+	}
+
+	if len(updates) > 0 {
+		updates["version"] = item.Version + 1
+		if !updateVersioned(c, config.DB.Model(&item), item.Version, updates) {
+			return
+		}
+	}
+
+	config.DB.First(&item, item.ID)
+
+	setETag(c, item.Version)
+	SuccessResponse(c, item)
+}
+
+// DeleteTaskChecklistItem 删除任务检查项
+func DeleteTaskChecklistItem(c *gin.Context) {
+	taskID, ok := parseTaskIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Where("task_id = ? AND id = ?", taskID, c.Param("item_id")).
+		Delete(&models.TaskChecklistItem{}).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to delete checklist item: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "Checklist item deleted successfully"})
+}
+
+// ReorderTaskChecklistRequest 检查项排序请求
+type ReorderTaskChecklistRequest struct {
+	ItemIDs []uint `json:"item_ids" binding:"required"` // 按新顺序排列的检查项ID
+}
+
+// ReorderTaskChecklist 调整任务检查项顺序
+func ReorderTaskChecklist(c *gin.Context) {
+	taskID, ok := parseTaskIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req ReorderTaskChecklistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		for i, itemID := range req.ItemIDs {
+			result := tx.Model(&models.TaskChecklistItem{}).
+				Where("task_id = ? AND id = ?", taskID, itemID).
+				Update("sort_order", i+1)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("Checklist item %d not found", itemID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		ErrorResponse(c, 400, "Failed to reorder checklist: "+err.Error())
+		return
+	}
+
+	var items []models.TaskChecklistItem
+	config.DB.Where("task_id = ?", taskID).Order("sort_order ASC, id ASC").Find(&items)
+
+	SuccessResponse(c, items)
+}
+
+// ============ 评论 ============
+
+// GetTaskComments 获取任务评论（按回复关系组织为树）
+func GetTaskComments(c *gin.Context) {
+	taskID, ok := parseTaskIDParam(c)
+	if !ok {
+		return
+	}
+
+	var comments []models.TaskComment
+	if err := config.DB.Preload("Author").Where("task_id = ?", taskID).Order("created_at ASC").Find(&comments).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch comments: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, buildCommentTree(comments))
+}
+
+// CreateTaskCommentRequest 发表评论请求
+type CreateTaskCommentRequest struct {
+	Content    string `json:"content" binding:"required"`
+	ParentID   *uint  `json:"parent_id"`   // 回复的评论ID
+	MentionIDs []uint `json:"mention_ids"` // 额外@的人员ID
+}
+
+// CreateTaskComment 发表任务评论，内容中的 @姓名 会解析为@人员
+func CreateTaskComment(c *gin.Context) {
+	taskID, ok := parseTaskIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req CreateTaskCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if req.ParentID != nil {
+		var count int64
+		config.DB.Model(&models.TaskComment{}).Where("id = ? AND task_id = ?", *req.ParentID, taskID).Count(&count)
+		if count == 0 {
+			ErrorResponse(c, 400, "Parent comment not found")
+			return
+		}
+	}
+
+	comment := models.TaskComment{
+		TaskID:     taskID,
+		ParentID:   req.ParentID,
+		AuthorID:   CurrentPersonID(c),
+		Content:    req.Content,
+		MentionIDs: IDsToString(resolveMentions(req.Content, req.MentionIDs)),
+	}
+	if err := config.DB.Create(&comment).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to create comment: "+err.Error())
+		return
+	}
+
+	config.DB.Preload("Author").First(&comment, comment.ID)
+
+	SuccessResponse(c, comment)
+}
+
+// DeleteTaskComment 删除任务评论（同时删除其下的回复）
+func DeleteTaskComment(c *gin.Context) {
+	taskID, ok := parseTaskIDParam(c)
+	if !ok {
+		return
+	}
+
+	var comment models.TaskComment
+	if err := config.DB.Where("task_id = ?", taskID).First(&comment, c.Param("comment_id")).Error; err != nil {
+		ErrorResponse(c, 404, "Comment not found")
+		return
+	}
+
+	// 收集所有后代回复
+	ids := []uint{comment.ID}
+	for parents := []uint{comment.ID}; len(parents) > 0; {
+		var children []uint
+		config.DB.Model(&models.TaskComment{}).Where("parent_id IN ?", parents).Pluck("id", &children)
+		ids = append(ids, children...)
+		parents = children
+	}
+
+	if err := config.DB.Delete(&models.TaskComment{}, ids).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to delete comment: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "Comment deleted successfully"})
+}
+
+// GetMyMentions 获取@当前人员的评论
+func GetMyMentions(c *gin.Context) {
+	personID := CurrentPersonID(c)
+	if personID == nil {
+		ErrorResponse(c, 401, "Missing X-Person-ID header")
+		return
+	}
+
+	id := strconv.Itoa(int(*personID))
+	var comments []models.TaskComment
+	if err := config.DB.Preload("Author").
+		Where("mention_ids = ? OR mention_ids LIKE ? OR mention_ids LIKE ? OR mention_ids LIKE ?",
+			id, id+",%", "%,"+id, "%,"+id+",%").
+		Order("created_at DESC").
+		Find(&comments).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch mentions: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, comments)
+}
+
+// ============ 附件 ============
+
+// GetTaskAttachments 获取任务附件列表
+func GetTaskAttachments(c *gin.Context) {
+	taskID, ok := parseTaskIDParam(c)
+	if !ok {
+		return
+	}
+
+	var attachments []models.TaskAttachment
+	if err := config.DB.Where("task_id = ?", taskID).Order("created_at ASC").Find(&attachments).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch attachments: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, attachments)
+}
+
+// UploadTaskAttachment 上传任务附件
+func UploadTaskAttachment(c *gin.Context) {
+	taskID, ok := parseTaskIDParam(c)
+	if !ok {
+		return
+	}
+
+	blob, err := storeDocumentBlob(c)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	attachment := models.TaskAttachment{
+		TaskID:      taskID,
+		FileName:    blob.FileName,
+		StorageKey:  blob.StorageKey,
+		ContentType: blob.ContentType,
+		Size:        blob.Size,
+		UploadedBy:  CurrentPersonID(c),
+	}
+	if err := config.DB.Create(&attachment).Error; err != nil {
+		discardDocumentBlob(blob)
+		ErrorResponse(c, 500, "Failed to save attachment: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, attachment)
+}
+
+// DownloadTaskAttachment 下载任务附件
+func DownloadTaskAttachment(c *gin.Context) {
+	taskID, ok := parseTaskIDParam(c)
+	if !ok {
+		return
+	}
+
+	var attachment models.TaskAttachment
+	if err := config.DB.Where("task_id = ?", taskID).First(&attachment, c.Param("attachment_id")).Error; err != nil {
+		ErrorResponse(c, 404, "Attachment not found")
+		return
+	}
+
+	if attachment.StorageKey == "" {
+		// 早期上传的附件仍保存在本地目录
+		c.FileAttachment(attachment.StoredPath, attachment.FileName)
+		return
+	}
+	serveStoredBlob(c, attachment.StorageKey, attachment.FileName, attachment.ContentType, attachment.Size)
+}
+
+// DeleteTaskAttachment 删除任务附件
+func DeleteTaskAttachment(c *gin.Context) {
+	taskID, ok := parseTaskIDParam(c)
+	if !ok {
+		return
+	}
+
+	var attachment models.TaskAttachment
+	if err := config.DB.Where("task_id = ?", taskID).First(&attachment, c.Param("attachment_id")).Error; err != nil {
+		ErrorResponse(c, 404, "Attachment not found")
+		return
+	}
+
+	if err := config.DB.Delete(&attachment).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to delete attachment: "+err.Error())
+		return
+	}
+	removeTaskAttachmentFile(attachment)
+
+	SuccessResponse(c, gin.H{"message": "Attachment deleted successfully"})
+}
+
+// ============ 辅助函数 ============
+
+// parseTaskIDParam 解析并校验路径中的任务ID
+func parseTaskIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid task ID")
+		return 0, false
+	}
+
+	var count int64
+	config.DB.Model(&models.Task{}).Where("id = ?", id).Count(&count)
+	if count == 0 {
+		ErrorResponse(c, 404, "Task not found")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// resolveMentions 合并评论中 @姓名 对应的人员和显式指定的人员ID
+func resolveMentions(content string, explicitIDs []uint) []uint {
+	var ids []uint
+	for _, id := range explicitIDs {
+		ids = appendUniqueID(ids, id)
+	}
+
+	var names []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		names = append(names, match[1])
+	}
+	if len(names) > 0 {
+		var personIDs []uint
+		config.DB.Model(&models.Person{}).Where("name IN ?", names).Pluck("id", &personIDs)
+		for _, id := range personIDs {
+			ids = appendUniqueID(ids, id)
+		}
+	}
+	return ids
+}
+
+// buildCommentTree 将评论按回复关系组织为树
+func buildCommentTree(comments []models.TaskComment) []models.TaskComment {
+	children := make(map[uint][]models.TaskComment)
+	var roots []models.TaskComment
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			roots = append(roots, comment)
+		} else {
+			children[*comment.ParentID] = append(children[*comment.ParentID], comment)
+		}
+	}
+
+	var attach func(list []models.TaskComment) []models.TaskComment
+	attach = func(list []models.TaskComment) []models.TaskComment {
+		for i := range list {
+			list[i].Replies = attach(children[list[i].ID])
+		}
+		return list
+	}
+
+	if roots == nil {
+		return []models.TaskComment{}
+	}
+	return attach(roots)
+}
+
+// loadTaskProgress 加载任务的检查项完成情况
+func loadTaskProgress(tasks []models.Task) {
+	if len(tasks) == 0 {
+		return
+	}
+
+	taskIDs := make([]uint, len(tasks))
+	for i, task := range tasks {
+		taskIDs[i] = task.ID
+	}
+
+	var rows []struct {
+		TaskID uint
+		Total  int
+		Done   int
+	}
+	config.DB.Model(&models.TaskChecklistItem{}).
+		Select("task_id, COUNT(*) AS total, SUM(CASE WHEN completed THEN 1 ELSE 0 END) AS done").
+		Where("task_id IN ?", taskIDs).
+		Group("task_id").
+		Scan(&rows)
+
+	progress := make(map[uint]int, len(rows))
+	totals := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		totals[row.TaskID] = row.Total
+		progress[row.TaskID] = row.Done
+	}
+
+	for i := range tasks {
+		total := totals[tasks[i].ID]
+		done := progress[tasks[i].ID]
+		tasks[i].ChecklistTotal = total
+		tasks[i].ChecklistDone = done
+		if total > 0 {
+			tasks[i].Progress = math.Round(float64(done)*10000/float64(total)) / 100
+		}
+	}
+}
+
+// deleteTaskDetails 删除任务的检查项、评论和附件
+func deleteTaskDetails(taskID uint) {
+	var attachments []models.TaskAttachment
+	config.DB.Where("task_id = ?", taskID).Find(&attachments)
+	config.DB.Where("task_id = ?", taskID).Delete(&models.TaskAttachment{})
+	for _, attachment := range attachments {
+		removeTaskAttachmentFile(attachment)
+	}
+
+	config.DB.Where("task_id = ?", taskID).Delete(&models.TaskComment{})
+	config.DB.Where("task_id = ?", taskID).Delete(&models.TaskChecklistItem{})
+}
+
+// removeTaskAttachmentFile 删除附件记录后清理其文件（存储后端中的文件仍被引用时保留）
+func removeTaskAttachmentFile(attachment models.TaskAttachment) {
+	if attachment.StorageKey == "" {
+		os.Remove(attachment.StoredPath)
+		return
+	}
+	if err := deleteUnreferencedBlob(attachment.StorageKey); err != nil {
+		log.Printf("Failed to delete attachment file %s: %v", attachment.StorageKey, err)
+	}
+}
@@ -0,0 +1,394 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultTemplateDueDay 任务模板未指定截止日时，取生成月份的15日（常规申报期截止日）
+const defaultTemplateDueDay = 15
+
+// TemplateTaskItem 模板生成结果中的单个客户
+type TemplateTaskItem struct {
+	CustomerID   uint      `json:"customer_id"`
+	CustomerName string    `json:"customer_name"`
+	Period       string    `json:"period"`   // 申报期间
+	Title        string    `json:"title"`    // 任务标题
+	DueDate      time.Time `json:"due_date"` // 截止日期
+	TaskID       *uint     `json:"task_id"`  // 生成（或已存在）的任务，预览时新任务为null
+	Skipped      bool      `json:"skipped"`  // 该期间已生成过任务
+}
+
+// TemplateGenerateResult 按模板生成任务的结果
+type TemplateGenerateResult struct {
+	TemplateID uint               `json:"template_id"`
+	Month      string             `json:"month"`
+	DryRun     bool               `json:"dry_run"`
+	Created    int                `json:"created"` // 新生成（预览时为将生成）的任务数
+	Skipped    int                `json:"skipped"` // 已生成过而跳过的客户数
+	Items      []TemplateTaskItem `json:"items"`
+}
+
+// GetTaskTemplates 获取任务模板列表
+func GetTaskTemplates(c *gin.Context) {
+	query := config.DB.Model(&models.TaskTemplate{})
+	if taxType := c.Query("tax_type"); taxType != "" {
+		query = query.Where("tax_type = ?", taxType)
+	}
+	if taxpayerType := c.Query("taxpayer_type"); taxpayerType != "" {
+		query = query.Where("taxpayer_type = ? OR taxpayer_type = ''", taxpayerType)
+	}
+
+	var templates []models.TaskTemplate
+	if err := query.Order("id ASC").Find(&templates).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch task templates: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, templates)
+}
+
+// CreateTaskTemplate 创建任务模板
+func CreateTaskTemplate(c *gin.Context) {
+	var template models.TaskTemplate
+	if err := c.ShouldBindJSON(&template); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if err := validateTaskTemplate(&template); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	template.ID = 0
+	template.Version = 0
+	if err := config.DB.Create(&template).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to create task template: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, template)
+}
+
+// GetTaskTemplate 获取任务模板详情
+func GetTaskTemplate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid task template ID")
+		return
+	}
+
+	var template models.TaskTemplate
+	if err := config.DB.First(&template, id).Error; err != nil {
+		ErrorResponse(c, 404, "Task template not found")
+		return
+	}
+
+	setETag(c, template.Version)
+	SuccessResponse(c, template)
+}
+
+// UpdateTaskTemplate 更新任务模板，已生成的任务不受影响
+func UpdateTaskTemplate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid task template ID")
+		return
+	}
+
+	var template models.TaskTemplate
+	if err := config.DB.First(&template, id).Error; err != nil {
+		ErrorResponse(c, 404, "Task template not found")
+		return
+	}
+
+	var updateData models.TaskTemplate
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if err := validateTaskTemplate(&updateData); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if !matchVersion(c, template.Version, updateData.Version) {
+		return
+	}
+
+	updateData.ID = template.ID
+	updateData.CreatedAt = template.CreatedAt
+	updateData.Version = template.Version + 1
+	if !updateVersioned(c, config.DB.Model(&template).Select("*"), template.Version, &updateData) {
+		return
+	}
+
+	config.DB.First(&template, id)
+
+	setETag(c, template.Version)
+	SuccessResponse(c, template)
+}
+
+// DeleteTaskTemplate 删除任务模板，已生成的任务保留并解除与模板的关联
+func DeleteTaskTemplate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid task template ID")
+		return
+	}
+
+	if err := config.DB.Delete(&models.TaskTemplate{}, id).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to delete task template: "+err.Error())
+		return
+	}
+	config.DB.Model(&models.Task{}).Where("template_id = ?", id).Update("template_id", nil)
+
+	SuccessResponse(c, gin.H{"message": "Task template deleted successfully"})
+}
+
+// GenerateTaskTemplateTasks 按模板为符合条件的在服务客户生成指定月份（month=YYYY-MM，默认当月）的任务
+// dry_run=true 时只预览；同一模板、客户、申报期间只生成一次，重复调用不会重复生成
+func GenerateTaskTemplateTasks(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid task template ID")
+		return
+	}
+
+	var template models.TaskTemplate
+	if err := config.DB.First(&template, id).Error; err != nil {
+		ErrorResponse(c, 404, "Task template not found")
+		return
+	}
+
+	month := time.Now()
+	if value := c.Query("month"); value != "" {
+		t, err := time.ParseInLocation("2006-01", value, time.Local)
+		if err != nil {
+			ErrorResponse(c, 400, "Invalid month, expected YYYY-MM")
+			return
+		}
+		month = t
+	}
+
+	result, err := generateTemplateTasks(&template, month, c.Query("dry_run") == "true")
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to generate tasks: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, result)
+}
+
+// GenerateAutoTemplateTasks 为启用自动生成的任务模板生成当月任务
+// 由每日定时任务调用，月中新建档或变更税务档案的客户也会补生成
+func GenerateAutoTemplateTasks() error {
+	var templates []models.TaskTemplate
+	if err := config.DB.Where("auto_generate = ?", true).Order("id ASC").Find(&templates).Error; err != nil {
+		return err
+	}
+
+	created := 0
+	now := time.Now()
+	for i := range templates {
+		result, err := generateTemplateTasks(&templates[i], now, false)
+		if err != nil {
+			return err
+		}
+		created += result.Created
+	}
+
+	if created > 0 {
+		log.Printf("Created %d tasks from task templates", created)
+	}
+	return nil
+}
+
+// ============ 辅助函数 ============
+
+// validateTaskTemplate 校验任务模板并补全默认值
+func validateTaskTemplate(template *models.TaskTemplate) error {
+	if template.Name == "" {
+		return errors.New("Name is required")
+	}
+	if template.Title == "" {
+		return errors.New("Title is required")
+	}
+	if template.Priority == "" {
+		template.Priority = models.TaskPriorityNormal
+	}
+	if !isValidTaskPriority(template.Priority) {
+		return errors.New("Invalid task priority")
+	}
+	if template.TaxpayerType != "" && !isValidTaxpayerType(template.TaxpayerType) {
+		return fmt.Errorf("Invalid taxpayer type: %s", template.TaxpayerType)
+	}
+	if template.TaxType != "" && !isValidTaxType(template.TaxType) {
+		return fmt.Errorf("Invalid tax type: %s", template.TaxType)
+	}
+	if template.Frequency != "" && !isValidFilingFrequency(template.Frequency) {
+		return fmt.Errorf("Invalid filing frequency: %s", template.Frequency)
+	}
+	if template.DueDay == 0 {
+		template.DueDay = defaultTemplateDueDay
+	}
+	if template.DueDay < 1 || template.DueDay > 31 {
+		return errors.New("due_day must be between 1 and 31")
+	}
+	if template.AnnualMonth == 0 {
+		template.AnnualMonth = 1
+	}
+	if template.AnnualMonth < 1 || template.AnnualMonth > 12 {
+		return errors.New("annual_month must be between 1 and 12")
+	}
+	return nil
+}
+
+// generateTemplateTasks 按模板生成 month 所在月份的任务
+// 客户须在服务中，且纳税人类型、申报义务符合模板条件；申报周期在该月有申报期时才生成
+func generateTemplateTasks(template *models.TaskTemplate, month time.Time, dryRun bool) (*TemplateGenerateResult, error) {
+	month = time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.Local)
+	result := &TemplateGenerateResult{
+		TemplateID: template.ID,
+		Month:      month.Format("2006-01"),
+		DryRun:     dryRun,
+		Items:      []TemplateTaskItem{},
+	}
+
+	var customers []models.Customer
+	if err := config.DB.Preload("TaxProfile.Obligations").
+		Where("status IN ?", inServiceCustomerStatuses()).
+		Order("id ASC").Find(&customers).Error; err != nil {
+		return nil, err
+	}
+
+	for _, customer := range customers {
+		frequency, ok := templateFrequency(template, customer.TaxProfile)
+		if !ok {
+			continue
+		}
+		period, label, ok := filingPeriod(frequency, month, template.AnnualMonth)
+		if !ok {
+			continue
+		}
+
+		replacer := strings.NewReplacer("{customer}", customer.Name, "{period}", label, "{tax_type}", string(template.TaxType))
+		item := TemplateTaskItem{
+			CustomerID:   customer.ID,
+			CustomerName: customer.Name,
+			Period:       period,
+			Title:        replacer.Replace(template.Title),
+			DueDate:      templateDueDate(month, template.DueDay),
+		}
+
+		var existing models.Task
+		if config.DB.Select("id").Where("template_id = ? AND customer_id = ? AND period = ?", template.ID, customer.ID, period).
+			First(&existing).Error == nil {
+			item.TaskID = &existing.ID
+			item.Skipped = true
+			result.Skipped++
+			result.Items = append(result.Items, item)
+			continue
+		}
+
+		if !dryRun {
+			templateID := template.ID
+			dueDate := item.DueDate
+			task := models.Task{
+				CustomerID:  customer.ID,
+				Title:       item.Title,
+				Description: replacer.Replace(template.Description),
+				Type:        template.TaskType,
+				Priority:    template.Priority,
+				DueDate:     &dueDate,
+				TemplateID:  &templateID,
+				Period:      period,
+			}
+			created, err := createSystemTask(&task)
+			if err != nil {
+				return result, err
+			}
+			if !created {
+				// 并发生成时已由其他请求创建，按唯一索引忽略
+				config.DB.Select("id").Where("template_id = ? AND customer_id = ? AND period = ?", template.ID, customer.ID, period).
+					First(&existing)
+				item.TaskID = &existing.ID
+				item.Skipped = true
+				result.Skipped++
+				result.Items = append(result.Items, item)
+				continue
+			}
+			item.TaskID = &task.ID
+		}
+		result.Created++
+		result.Items = append(result.Items, item)
+	}
+
+	return result, nil
+}
+
+// templateFrequency 判断客户是否符合模板条件，返回生成周期
+// 模板未指定周期时，关联税种的按客户该税种的申报周期，否则按月
+func templateFrequency(template *models.TaskTemplate, profile *models.CustomerTaxProfile) (models.FilingFrequency, bool) {
+	if template.TaxpayerType != "" && (profile == nil || profile.TaxpayerType != template.TaxpayerType) {
+		return "", false
+	}
+
+	frequency := template.Frequency
+	if template.TaxType != "" {
+		if profile == nil {
+			return "", false
+		}
+		obligation := taxObligationFrequencies(profile.Obligations)[template.TaxType]
+		if obligation == "" {
+			return "", false
+		}
+		if frequency == "" {
+			frequency = obligation
+		}
+	}
+	if frequency == "" {
+		frequency = models.FilingFrequencyMonthly
+	}
+	return frequency, true
+}
+
+// filingPeriod 返回在 month 月申报的所属期间及其显示名称，该月不是申报月时返回false
+// 按月申报上月，按季在1/4/7/10月申报上一季度，按年在 annualMonth 月申报上一年度
+func filingPeriod(frequency models.FilingFrequency, month time.Time, annualMonth int) (string, string, bool) {
+	previous := month.AddDate(0, -1, 0)
+	switch frequency {
+	case models.FilingFrequencyQuarterly:
+		if (int(month.Month())-1)%3 != 0 {
+			return "", "", false
+		}
+		quarter := (int(previous.Month())-1)/3 + 1
+		return fmt.Sprintf("%d-Q%d", previous.Year(), quarter), fmt.Sprintf("%d年第%d季度", previous.Year(), quarter), true
+	case models.FilingFrequencyYearly:
+		if int(month.Month()) != annualMonth {
+			return "", "", false
+		}
+		year := month.Year() - 1
+		return strconv.Itoa(year), fmt.Sprintf("%d年度", year), true
+	}
+	return previous.Format("2006-01"), fmt.Sprintf("%d年%d月", previous.Year(), int(previous.Month())), true
+}
+
+// templateDueDate 生成月份中的截止日，超出月末时取月末
+func templateDueDate(month time.Time, dueDay int) time.Time {
+	lastDay := month.AddDate(0, 1, -1).Day()
+	if dueDay > lastDay {
+		dueDay = lastDay
+	}
+	return time.Date(month.Year(), month.Month(), dueDay, 0, 0, 0, 0, time.Local)
+}
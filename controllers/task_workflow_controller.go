@@ -0,0 +1,623 @@
+package controllers
+
+import (
+	"encoding/json"
+	"erp/config"
+	"erp/models"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// taskWorkflowDefinition 解析后的任务流程
+type taskWorkflowDefinition struct {
+	TaskType     string                      `json:"task_type"`
+	Name         string                      `json:"name"`
+	InitialState string                      `json:"initial_state"`
+	States       []models.WorkflowState      `json:"states"`
+	Transitions  []models.WorkflowTransition `json:"transitions"`
+}
+
+// defaultTaskWorkflow 默认任务流程，未配置流程的任务类型使用
+func defaultTaskWorkflow() *taskWorkflowDefinition {
+	return &taskWorkflowDefinition{
+		Name:         "默认流程",
+		InitialState: "pending",
+		States: []models.WorkflowState{
+			{Key: "pending", Name: "待处理", Category: models.TaskStateCategoryPending},
+			{Key: "in_progress", Name: "进行中", Category: models.TaskStateCategoryInProgress},
+			{Key: "completed", Name: "已完成", Category: models.TaskStateCategoryCompleted},
+			{Key: "cancelled", Name: "已取消", Category: models.TaskStateCategoryCancelled},
+		},
+		Transitions: []models.WorkflowTransition{
+			{From: "pending", To: "in_progress", Name: "开始处理"},
+			{From: "in_progress", To: "pending", Name: "退回待处理"},
+			{From: "pending", To: "completed", Name: "直接完成"},
+			{From: "in_progress", To: "completed", Name: "完成"},
+			{From: "completed", To: "in_progress", Name: "重新打开", RequiredFields: []string{"comment"}},
+			{From: "pending", To: "cancelled", Name: "取消", RequiredFields: []string{"comment"}},
+			{From: "in_progress", To: "cancelled", Name: "取消", RequiredFields: []string{"comment"}},
+			{From: "cancelled", To: "pending", Name: "恢复", RequiredFields: []string{"comment"}},
+		},
+	}
+}
+
+// CreateTaskWorkflow 创建任务流程配置
+func CreateTaskWorkflow(c *gin.Context) {
+	var workflow models.TaskWorkflow
+	if err := c.ShouldBindJSON(&workflow); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	def, err := parseTaskWorkflow(&workflow)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	if err := checkWorkflowTaskStates(workflow.TaskType, def); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if err := config.DB.Create(&workflow).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to create task workflow: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, workflow)
+}
+
+// GetTaskWorkflows 获取任务流程配置列表（含默认流程）
+func GetTaskWorkflows(c *gin.Context) {
+	var workflows []models.TaskWorkflow
+	if err := config.DB.Order("task_type ASC").Find(&workflows).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch task workflows: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{
+		"default":   defaultTaskWorkflow(),
+		"workflows": workflows,
+	})
+}
+
+// GetTaskWorkflow 获取任务流程配置详情
+func GetTaskWorkflow(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid task workflow ID")
+		return
+	}
+
+	var workflow models.TaskWorkflow
+	if err := config.DB.First(&workflow, id).Error; err != nil {
+		ErrorResponse(c, 404, "Task workflow not found")
+		return
+	}
+
+	setETag(c, workflow.Version)
+	SuccessResponse(c, workflow)
+}
+
+// UpdateTaskWorkflow 更新任务流程配置
+func UpdateTaskWorkflow(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid task workflow ID")
+		return
+	}
+
+	var workflow models.TaskWorkflow
+	if err := config.DB.First(&workflow, id).Error; err != nil {
+		ErrorResponse(c, 404, "Task workflow not found")
+		return
+	}
+
+	var updateData models.TaskWorkflow
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	// 合并后整体校验，避免只修改部分字段导致流程不完整
+	merged := workflow
+	if updateData.TaskType != "" {
+		merged.TaskType = updateData.TaskType
+	}
+	if updateData.Name != "" {
+		merged.Name = updateData.Name
+	}
+	if updateData.InitialState != "" {
+		merged.InitialState = updateData.InitialState
+	}
+	if updateData.States != nil {
+		merged.States = updateData.States
+	}
+	if updateData.Transitions != nil {
+		merged.Transitions = updateData.Transitions
+	}
+	def, err := parseTaskWorkflow(&merged)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	if err := checkWorkflowChange(&workflow, def); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if !matchVersion(c, workflow.Version, updateData.Version) {
+		return
+	}
+
+	// 更新字段（以读取时的版本为条件，防止覆盖他人的修改）
+	updateData.Version = workflow.Version + 1
+	if !updateVersioned(c, config.DB.Model(&workflow), workflow.Version, updateData) {
+		return
+	}
+
+	// 重新获取更新后的数据
+	config.DB.First(&workflow, id)
+
+	setETag(c, workflow.Version)
+	SuccessResponse(c, workflow)
+}
+
+// taskWorkflowPatchFields 任务流程可通过 PATCH 修改的字段
+var taskWorkflowPatchFields = patchFields{
+	"task_type":     "task_type",
+	"name":          "name",
+	"initial_state": "initial_state",
+	"states":        "states",
+	"transitions":   "transitions",
+	"version":       "",
+}
+
+// PatchTaskWorkflow 部分更新任务流程（JSON Merge Patch），合并后整体校验
+func PatchTaskWorkflow(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid task workflow ID")
+		return
+	}
+
+	var workflow models.TaskWorkflow
+	if err := config.DB.First(&workflow, id).Error; err != nil {
+		ErrorResponse(c, 404, "Task workflow not found")
+		return
+	}
+
+	var patched models.TaskWorkflow
+	columns, ok := bindMergePatch(c, workflow, &patched, taskWorkflowPatchFields)
+	if !ok {
+		return
+	}
+
+	def, err := parseTaskWorkflow(&patched)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+	if err := checkWorkflowChange(&workflow, def); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if !matchVersion(c, workflow.Version, patched.Version) {
+		return
+	}
+
+	patched.Version = workflow.Version + 1
+	if !updateVersioned(c, config.DB.Model(&workflow).Select(append(columns, "version")), workflow.Version, &patched) {
+		return
+	}
+
+	config.DB.First(&workflow, id)
+
+	setETag(c, workflow.Version)
+	SuccessResponse(c, workflow)
+}
+
+// DeleteTaskWorkflow 删除任务流程配置（该类型的任务回退到默认流程）
+func DeleteTaskWorkflow(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid task workflow ID")
+		return
+	}
+
+	var workflow models.TaskWorkflow
+	if err := config.DB.First(&workflow, id).Error; err != nil {
+		ErrorResponse(c, 404, "Task workflow not found")
+		return
+	}
+	if err := checkWorkflowTaskStates(workflow.TaskType, defaultTaskWorkflow()); err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if err := config.DB.Delete(&models.TaskWorkflow{}, id).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to delete task workflow: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "Task workflow deleted successfully"})
+}
+
+// TaskTransitionRequest 任务状态流转请求
+type TaskTransitionRequest struct {
+	To      string                 `json:"to" binding:"required"` // 目标状态
+	Comment string                 `json:"comment"`               // 备注
+	Data    map[string]interface{} `json:"data"`                  // 流转规则要求的其他字段
+}
+
+// TransitionTask 执行任务状态流转
+func TransitionTask(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid task ID")
+		return
+	}
+
+	var task models.Task
+	if err := config.DB.First(&task, id).Error; err != nil {
+		ErrorResponse(c, 404, "Task not found")
+		return
+	}
+
+	var req TaskTransitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if !matchVersion(c, task.Version, 0) {
+		return
+	}
+
+	transition, err := transitionTask(&task, req, CurrentPersonID(c))
+	if errors.Is(err, errVersionConflict) {
+		ErrorResponse(c, 409, err.Error())
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	config.DB.Preload("Customer").Preload("Assignee").First(&task, id)
+	setETag(c, task.Version)
+
+	SuccessResponse(c, gin.H{
+		"task":       task,
+		"transition": transition,
+	})
+}
+
+// GetTaskTransitions 获取任务当前可执行的流转及流转历史
+func GetTaskTransitions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid task ID")
+		return
+	}
+
+	var task models.Task
+	if err := config.DB.First(&task, id).Error; err != nil {
+		ErrorResponse(c, 404, "Task not found")
+		return
+	}
+
+	def := loadTaskWorkflow(task.Type)
+	current := task.Status
+	if current == "" {
+		current = def.InitialState
+	}
+
+	available := []models.WorkflowTransition{}
+	for _, t := range def.Transitions {
+		if (t.From == current || t.From == "*") && t.To != current {
+			available = append(available, t)
+		}
+	}
+
+	var history []models.TaskTransition
+	config.DB.Where("task_id = ?", id).Order("created_at ASC").Find(&history)
+
+	SuccessResponse(c, gin.H{
+		"workflow":  def.Name,
+		"status":    current,
+		"available": available,
+		"history":   history,
+	})
+}
+
+// ============ 辅助函数 ============
+
+// parseTaskWorkflow 解析并校验任务流程配置
+func parseTaskWorkflow(workflow *models.TaskWorkflow) (*taskWorkflowDefinition, error) {
+	def := &taskWorkflowDefinition{
+		TaskType:     workflow.TaskType,
+		Name:         workflow.Name,
+		InitialState: workflow.InitialState,
+	}
+	if workflow.TaskType == "" {
+		return nil, fmt.Errorf("Task type is required")
+	}
+	if err := json.Unmarshal(workflow.States, &def.States); err != nil {
+		return nil, fmt.Errorf("Invalid states: %v", err)
+	}
+	if err := json.Unmarshal(workflow.Transitions, &def.Transitions); err != nil {
+		return nil, fmt.Errorf("Invalid transitions: %v", err)
+	}
+	if len(def.States) == 0 {
+		return nil, fmt.Errorf("Workflow must have at least one state")
+	}
+
+	keys := make(map[string]bool)
+	for _, state := range def.States {
+		if state.Key == "" || state.Key == "*" {
+			return nil, fmt.Errorf("Invalid state key: %q", state.Key)
+		}
+		if keys[state.Key] {
+			return nil, fmt.Errorf("Duplicate state: %s", state.Key)
+		}
+		switch state.Category {
+		case models.TaskStateCategoryPending, models.TaskStateCategoryInProgress,
+			models.TaskStateCategoryCompleted, models.TaskStateCategoryCancelled:
+		default:
+			return nil, fmt.Errorf("Invalid category for state %s: %s", state.Key, state.Category)
+		}
+		keys[state.Key] = true
+	}
+
+	if !keys[def.InitialState] {
+		return nil, fmt.Errorf("Initial state %s is not defined", def.InitialState)
+	}
+	for _, t := range def.Transitions {
+		if t.From != "*" && !keys[t.From] {
+			return nil, fmt.Errorf("Transition from undefined state: %s", t.From)
+		}
+		if !keys[t.To] {
+			return nil, fmt.Errorf("Transition to undefined state: %s", t.To)
+		}
+	}
+
+	return def, nil
+}
+
+// checkWorkflowChange 校验流程修改后现有任务的状态仍有定义：本类型的任务按新流程，
+// 修改任务类型时原类型的任务回退到默认流程
+func checkWorkflowChange(workflow *models.TaskWorkflow, def *taskWorkflowDefinition) error {
+	if err := checkWorkflowTaskStates(def.TaskType, def); err != nil {
+		return err
+	}
+	if workflow.TaskType != def.TaskType {
+		return checkWorkflowTaskStates(workflow.TaskType, defaultTaskWorkflow())
+	}
+	return nil
+}
+
+// checkWorkflowTaskStates 校验该类型现有任务的状态均在流程中有定义，避免任务停留在流程未定义的状态
+func checkWorkflowTaskStates(taskType string, def *taskWorkflowDefinition) error {
+	var statuses []string
+	if err := config.DB.Model(&models.Task{}).Where("type = ?", taskType).Distinct().Pluck("status", &statuses).Error; err != nil {
+		return err
+	}
+	var missing []string
+	for _, status := range statuses {
+		if def.state(status) == nil {
+			missing = append(missing, status)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Tasks of type %s are in states not defined by the workflow: %s, move them to other states first",
+			taskType, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// loadTaskWorkflow 加载任务类型对应的流程，未配置或配置无效时使用默认流程
+func loadTaskWorkflow(taskType string) *taskWorkflowDefinition {
+	if taskType != "" {
+		var workflow models.TaskWorkflow
+		if config.DB.Where("task_type = ?", taskType).First(&workflow).Error == nil {
+			if def, err := parseTaskWorkflow(&workflow); err == nil {
+				return def
+			}
+		}
+	}
+	return defaultTaskWorkflow()
+}
+
+// state 查找流程状态
+func (d *taskWorkflowDefinition) state(key string) *models.WorkflowState {
+	for i := range d.States {
+		if d.States[i].Key == key {
+			return &d.States[i]
+		}
+	}
+	return nil
+}
+
+// findTransition 查找从 from 到 to 的流转规则
+func (d *taskWorkflowDefinition) findTransition(from, to string) *models.WorkflowTransition {
+	for i := range d.Transitions {
+		t := &d.Transitions[i]
+		if (t.From == from || t.From == "*") && t.To == to {
+			return t
+		}
+	}
+	return nil
+}
+
+// transitionTask 按任务流程校验并执行状态流转，自动维护时间戳并记录流转历史
+func transitionTask(task *models.Task, req TaskTransitionRequest, operatorID *uint) (*models.TaskTransition, error) {
+	var record *models.TaskTransition
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		record, err = applyTaskTransition(tx, task, req, operatorID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	publishEvent(models.WebhookEventTaskTransitioned, record)
+
+	return record, nil
+}
+
+// applyTaskTransition 在事务中执行状态流转，不发布事件（由调用方在提交后发布）
+func applyTaskTransition(tx *gorm.DB, task *models.Task, req TaskTransitionRequest, operatorID *uint) (*models.TaskTransition, error) {
+	def := loadTaskWorkflow(task.Type)
+
+	from := task.Status
+	if from == "" {
+		from = def.InitialState
+	}
+	if from == req.To {
+		return nil, fmt.Errorf("Task is already in state %s", req.To)
+	}
+
+	rule := def.findTransition(from, req.To)
+	if rule == nil {
+		return nil, fmt.Errorf("Transition from %s to %s is not allowed", from, req.To)
+	}
+
+	// 校验必填字段：comment 取请求备注，任务自身字段取任务当前值，其余取请求 data
+	for _, field := range rule.RequiredFields {
+		var missing bool
+		switch field {
+		case "comment":
+			missing = req.Comment == ""
+		case "assignee_id":
+			missing = task.AssigneeID == nil
+		case "due_date":
+			missing = task.DueDate == nil
+		case "description":
+			missing = task.Description == ""
+		default:
+			value, ok := req.Data[field]
+			missing = !ok || value == nil || value == ""
+		}
+		if missing {
+			return nil, fmt.Errorf("Field %s is required for transition %s", field, rule.Name)
+		}
+	}
+
+	// 按目标状态分类自动维护时间戳
+	now := time.Now()
+	nextVersion := task.Version + 1
+	updates := map[string]interface{}{
+		"status":            req.To,
+		"status_changed_at": now,
+		"version":           nextVersion,
+	}
+	switch def.state(req.To).Category {
+	case models.TaskStateCategoryInProgress:
+		if task.StartedAt == nil {
+			updates["started_at"] = now
+		}
+		updates["completed_at"] = nil
+	case models.TaskStateCategoryCompleted:
+		updates["completed_at"] = now
+	default:
+		updates["completed_at"] = nil
+	}
+
+	record := &models.TaskTransition{
+		TaskID:     task.ID,
+		FromStatus: from,
+		ToStatus:   req.To,
+		OperatorID: operatorID,
+		Comment:    req.Comment,
+	}
+	if len(req.Data) > 0 {
+		data, _ := json.Marshal(req.Data)
+		record.Data = datatypes.JSON(data)
+	}
+
+	// 以读取时的版本为条件更新，防止并发流转
+	result := tx.Model(&models.Task{}).Where("id = ? AND version = ?", task.ID, task.Version).Updates(updates)
+	if result.Error != nil {
+		return nil, fmt.Errorf("Failed to transition task: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, errVersionConflict
+	}
+	if err := tx.Create(record).Error; err != nil {
+		return nil, fmt.Errorf("Failed to transition task: %v", err)
+	}
+	task.Status = req.To
+	task.Version = nextVersion
+
+	return record, nil
+}
+
+// taskStateCategory 获取任务状态所属分类
+func taskStateCategory(taskType, status string) models.TaskStateCategory {
+	def := loadTaskWorkflow(taskType)
+	if status == "" {
+		status = def.InitialState
+	}
+	if state := def.state(status); state != nil {
+		return state.Category
+	}
+	return models.TaskStateCategoryPending
+}
+
+// openTaskCondition 构造“未关闭任务”的查询条件。各任务类型按各自流程判断状态是否属于
+// 已完成/已取消分类，未配置流程的类型使用默认流程，避免某流程的关闭状态误伤其他流程的任务
+func openTaskCondition() clause.Expr {
+	closedKeys := func(def *taskWorkflowDefinition) []string {
+		var keys []string
+		for _, state := range def.States {
+			if state.Category == models.TaskStateCategoryCompleted || state.Category == models.TaskStateCategoryCancelled {
+				keys = append(keys, state.Key)
+				if state.Key == def.InitialState {
+					keys = append(keys, "")
+				}
+			}
+		}
+		return keys
+	}
+
+	var conditions []string
+	var args []interface{}
+	var configuredTypes []string
+
+	var workflows []models.TaskWorkflow
+	config.DB.Find(&workflows)
+	for i := range workflows {
+		def, err := parseTaskWorkflow(&workflows[i])
+		if err != nil {
+			// 配置无效的类型按默认流程处理（与 loadTaskWorkflow 一致）
+			continue
+		}
+		configuredTypes = append(configuredTypes, workflows[i].TaskType)
+		if keys := closedKeys(def); len(keys) > 0 {
+			conditions = append(conditions, "(COALESCE(type, '') = ? AND COALESCE(status, '') IN ?)")
+			args = append(args, workflows[i].TaskType, keys)
+		}
+	}
+
+	defaultClosed := closedKeys(defaultTaskWorkflow())
+	if len(configuredTypes) > 0 {
+		conditions = append(conditions, "(COALESCE(type, '') NOT IN ? AND COALESCE(status, '') IN ?)")
+		args = append(args, configuredTypes, defaultClosed)
+	} else {
+		conditions = append(conditions, "COALESCE(status, '') IN ?")
+		args = append(args, defaultClosed)
+	}
+
+	return clause.Expr{SQL: "NOT (" + strings.Join(conditions, " OR ") + ")", Vars: args}
+}
@@ -0,0 +1,363 @@
+package controllers
+
+import (
+	"encoding/json"
+	"erp/config"
+	"erp/models"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// taxTypes 支持的税种，同时决定申报义务的展示顺序
+var taxTypes = []models.TaxType{
+	models.TaxTypeVAT,
+	models.TaxTypeSurcharge,
+	models.TaxTypeCorporateIncome,
+	models.TaxTypeIndividual,
+	models.TaxTypeStamp,
+	models.TaxTypeSocialInsurance,
+}
+
+// TaxObligationInput 申报义务
+type TaxObligationInput struct {
+	TaxType   models.TaxType         `json:"tax_type" binding:"required"`
+	Frequency models.FilingFrequency `json:"frequency"` // 申报周期，默认按纳税人类型和税种取常见周期
+}
+
+// CustomerTaxProfileRequest 设置客户税务档案请求（整体替换申报义务）
+type CustomerTaxProfileRequest struct {
+	TaxpayerType  models.TaxpayerType  `json:"taxpayer_type" binding:"required"`
+	TaxBureau     string               `json:"tax_bureau"`
+	TaxOfficer    string               `json:"tax_officer"`
+	Obligations   []TaxObligationInput `json:"obligations"`
+	EffectiveDate string               `json:"effective_date"` // 生效日期 YYYY-MM-DD，默认今天
+	Reason        string               `json:"reason"`         // 变更原因
+	Version       uint                 `json:"version"`        // 税务档案版本号，首次建档时忽略
+}
+
+// GetCustomerTaxProfile 获取客户税务档案
+func GetCustomerTaxProfile(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid customer ID")
+		return
+	}
+
+	profile, err := loadTaxProfile(config.DB, uint(id))
+	if err != nil {
+		ErrorResponse(c, 404, "Tax profile not found")
+		return
+	}
+
+	setETag(c, profile.Version)
+	SuccessResponse(c, profile)
+}
+
+// UpdateCustomerTaxProfile 设置客户税务档案，首次调用时建档
+// 有实际变更时记录变更历史并推送 customer.tax_profile_changed 事件，未变更时直接返回当前档案
+func UpdateCustomerTaxProfile(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid customer ID")
+		return
+	}
+
+	var customer models.Customer
+	if err := config.DB.First(&customer, id).Error; err != nil {
+		ErrorResponse(c, 404, "Customer not found")
+		return
+	}
+
+	var req CustomerTaxProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if !isValidTaxpayerType(req.TaxpayerType) {
+		ErrorResponse(c, 400, "Invalid taxpayer type: "+string(req.TaxpayerType))
+		return
+	}
+	obligations, err := buildTaxObligations(customer.ID, req.TaxpayerType, req.Obligations)
+	if err != nil {
+		ErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	today := startOfDay(time.Now())
+	effective, err := parseDayOrToday(req.EffectiveDate)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid effective_date, expected YYYY-MM-DD")
+		return
+	}
+	if effective.After(today) {
+		ErrorResponse(c, 400, "effective_date cannot be in the future")
+		return
+	}
+
+	current, err := loadTaxProfile(config.DB, customer.ID)
+	exists := err == nil
+	if exists {
+		if !matchVersion(c, current.Version, req.Version) {
+			return
+		}
+		if effective.Before(current.EffectiveDate) {
+			ErrorResponse(c, 400, "effective_date cannot be earlier than the previous change on "+current.EffectiveDate.Format("2006-01-02"))
+			return
+		}
+	}
+
+	updated := models.CustomerTaxProfile{
+		CustomerID:    customer.ID,
+		TaxpayerType:  req.TaxpayerType,
+		TaxBureau:     req.TaxBureau,
+		TaxOfficer:    req.TaxOfficer,
+		EffectiveDate: effective,
+		Obligations:   obligations,
+	}
+	changes := taxProfileChanges(current, &updated)
+	if exists && len(changes) == 0 {
+		setETag(c, current.Version)
+		SuccessResponse(c, current)
+		return
+	}
+
+	changesJSON, _ := json.Marshal(changes)
+	change := models.CustomerTaxProfileChange{
+		CustomerID:     customer.ID,
+		ToTaxpayerType: req.TaxpayerType,
+		Changes:        changesJSON,
+		EffectiveDate:  effective,
+		Reason:         req.Reason,
+		OperatorID:     CurrentPersonID(c),
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if exists {
+			change.FromTaxpayerType = current.TaxpayerType
+			update := tx.Model(&models.CustomerTaxProfile{}).Where("id = ? AND version = ?", current.ID, current.Version).
+				Updates(map[string]interface{}{
+					"taxpayer_type":  updated.TaxpayerType,
+					"tax_bureau":     updated.TaxBureau,
+					"tax_officer":    updated.TaxOfficer,
+					"effective_date": effective,
+					"version":        current.Version + 1,
+				})
+			if update.Error != nil {
+				return update.Error
+			}
+			if update.RowsAffected == 0 {
+				return errVersionConflict
+			}
+			if err := tx.Where("customer_id = ?", customer.ID).Delete(&models.TaxObligation{}).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Omit("Obligations").Create(&updated).Error; err != nil {
+			return err
+		}
+
+		if len(obligations) > 0 {
+			if err := tx.Create(&obligations).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&change).Error
+	})
+	if err == errVersionConflict {
+		ErrorResponse(c, 409, err.Error())
+		return
+	}
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to save tax profile: "+err.Error())
+		return
+	}
+
+	profile, _ := loadTaxProfile(config.DB, customer.ID)
+
+	publishEvent(models.WebhookEventTaxProfile, gin.H{
+		"customer_id":        customer.ID,
+		"from_taxpayer_type": change.FromTaxpayerType,
+		"to_taxpayer_type":   change.ToTaxpayerType,
+		"changes":            changes,
+		"effective_date":     effective,
+		"reason":             req.Reason,
+	})
+
+	setETag(c, profile.Version)
+	SuccessResponse(c, profile)
+}
+
+// GetCustomerTaxProfileHistory 获取客户税务档案变更记录
+func GetCustomerTaxProfileHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid customer ID")
+		return
+	}
+
+	var changes []models.CustomerTaxProfileChange
+	if err := config.DB.Preload("Operator").Where("customer_id = ?", id).
+		Order("effective_date ASC, id ASC").Find(&changes).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch tax profile history: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, changes)
+}
+
+// ============ 辅助函数 ============
+
+// loadTaxProfile 加载客户税务档案及申报义务
+func loadTaxProfile(db *gorm.DB, customerID uint) (*models.CustomerTaxProfile, error) {
+	var profile models.CustomerTaxProfile
+	if err := db.Preload("Obligations", orderByID).Where("customer_id = ?", customerID).First(&profile).Error; err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// buildTaxObligations 校验申报义务并补全默认申报周期，按 taxTypes 的顺序排列
+func buildTaxObligations(customerID uint, taxpayerType models.TaxpayerType, inputs []TaxObligationInput) ([]models.TaxObligation, error) {
+	byType := map[models.TaxType]models.FilingFrequency{}
+	for _, input := range inputs {
+		if !isValidTaxType(input.TaxType) {
+			return nil, fmt.Errorf("Invalid tax type: %s", input.TaxType)
+		}
+		if _, ok := byType[input.TaxType]; ok {
+			return nil, fmt.Errorf("Duplicate tax type: %s", input.TaxType)
+		}
+		frequency := input.Frequency
+		if frequency == "" {
+			frequency = defaultFilingFrequency(taxpayerType, input.TaxType)
+		}
+		if !isValidFilingFrequency(frequency) {
+			return nil, fmt.Errorf("Invalid filing frequency: %s", frequency)
+		}
+		byType[input.TaxType] = frequency
+	}
+
+	obligations := []models.TaxObligation{}
+	for _, taxType := range taxTypes {
+		if frequency, ok := byType[taxType]; ok {
+			obligations = append(obligations, models.TaxObligation{CustomerID: customerID, TaxType: taxType, Frequency: frequency})
+		}
+	}
+	return obligations, nil
+}
+
+// defaultFilingFrequency 税种的常见申报周期：一般纳税人增值税及附加税按月、小规模纳税人按季，
+// 企业所得税和印花税按季，个税和社保按月
+func defaultFilingFrequency(taxpayerType models.TaxpayerType, taxType models.TaxType) models.FilingFrequency {
+	switch taxType {
+	case models.TaxTypeVAT, models.TaxTypeSurcharge:
+		if taxpayerType == models.TaxpayerTypeGeneral {
+			return models.FilingFrequencyMonthly
+		}
+		return models.FilingFrequencyQuarterly
+	case models.TaxTypeCorporateIncome, models.TaxTypeStamp:
+		return models.FilingFrequencyQuarterly
+	}
+	return models.FilingFrequencyMonthly
+}
+
+// taxProfileChanges 对比税务档案的变更项，current 为空时（首次建档）列出所有非空项
+func taxProfileChanges(current, updated *models.CustomerTaxProfile) []models.TaxProfileFieldChange {
+	if current == nil {
+		current = &models.CustomerTaxProfile{}
+	}
+	changes := []models.TaxProfileFieldChange{}
+	compare := func(field, from, to string) {
+		if from != to {
+			changes = append(changes, models.TaxProfileFieldChange{Field: field, From: from, To: to})
+		}
+	}
+	compare("纳税人类型", string(current.TaxpayerType), string(updated.TaxpayerType))
+	compare("主管税务机关", current.TaxBureau, updated.TaxBureau)
+	compare("税务专管员", current.TaxOfficer, updated.TaxOfficer)
+
+	from := taxObligationFrequencies(current.Obligations)
+	to := taxObligationFrequencies(updated.Obligations)
+	for _, taxType := range taxTypes {
+		compare(string(taxType), string(from[taxType]), string(to[taxType]))
+	}
+	return changes
+}
+
+// taxObligationFrequencies 按税种索引申报周期
+func taxObligationFrequencies(obligations []models.TaxObligation) map[models.TaxType]models.FilingFrequency {
+	frequencies := make(map[models.TaxType]models.FilingFrequency, len(obligations))
+	for _, obligation := range obligations {
+		frequencies[obligation.TaxType] = obligation.Frequency
+	}
+	return frequencies
+}
+
+// filterCustomersByTax 按税务档案筛选客户：纳税人类型、主管税务机关（模糊）、税种及申报周期
+// 同时指定税种和申报周期时须为同一项申报义务；param 读取筛选参数（查询参数或批量操作的 filter）
+func filterCustomersByTax(query *gorm.DB, param func(string) string) *gorm.DB {
+	taxpayerType := param("taxpayer_type")
+	taxBureau := param("tax_bureau")
+	if taxpayerType != "" || taxBureau != "" {
+		profiles := config.DB.Model(&models.CustomerTaxProfile{}).Select("customer_id")
+		if taxpayerType != "" {
+			profiles = profiles.Where("taxpayer_type = ?", taxpayerType)
+		}
+		if taxBureau != "" {
+			profiles = profiles.Where("tax_bureau LIKE ?", "%"+taxBureau+"%")
+		}
+		query = query.Where("id IN (?)", profiles)
+	}
+
+	taxType := param("tax_type")
+	frequency := param("filing_frequency")
+	if taxType != "" || frequency != "" {
+		obligations := config.DB.Model(&models.TaxObligation{}).Select("customer_id")
+		if taxType != "" {
+			obligations = obligations.Where("tax_type = ?", taxType)
+		}
+		if frequency != "" {
+			obligations = obligations.Where("frequency = ?", frequency)
+		}
+		query = query.Where("id IN (?)", obligations)
+	}
+	return query
+}
+
+// monthlyFilingCount 申报义务折算到每月的申报次数
+func monthlyFilingCount(frequency models.FilingFrequency) float64 {
+	switch frequency {
+	case models.FilingFrequencyQuarterly:
+		return 1.0 / 3
+	case models.FilingFrequencyYearly:
+		return 1.0 / 12
+	}
+	return 1
+}
+
+// isValidTaxpayerType 校验纳税人类型
+func isValidTaxpayerType(taxpayerType models.TaxpayerType) bool {
+	return taxpayerType == models.TaxpayerTypeSmallScale || taxpayerType == models.TaxpayerTypeGeneral
+}
+
+// isValidTaxType 校验税种
+func isValidTaxType(taxType models.TaxType) bool {
+	for _, t := range taxTypes {
+		if t == taxType {
+			return true
+		}
+	}
+	return false
+}
+
+// isValidFilingFrequency 校验申报周期
+func isValidFilingFrequency(frequency models.FilingFrequency) bool {
+	switch frequency {
+	case models.FilingFrequencyMonthly, models.FilingFrequencyQuarterly, models.FilingFrequencyYearly:
+		return true
+	}
+	return false
+}
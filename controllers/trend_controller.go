@@ -0,0 +1,597 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 趋势统计指标
+const (
+	TrendMetricPaymentAmount   = "payment_amount"   // 收款金额（减去退款）
+	TrendMetricPaymentCount    = "payment_count"    // 收款笔数
+	TrendMetricNewCustomers    = "new_customers"    // 新增客户
+	TrendMetricTasksCreated    = "tasks_created"    // 新建任务
+	TrendMetricTasksCompleted  = "tasks_completed"  // 完成任务
+	TrendMetricAgreementStarts = "agreement_starts" // 协议开始
+	TrendMetricAgreementEnds   = "agreement_ends"   // 协议结束
+)
+
+// 趋势统计分组维度
+const (
+	TrendGroupCustomerType  = "customer_type"
+	TrendGroupServicePerson = "service_person"
+	TrendGroupPaymentMethod = "payment_method"
+)
+
+// 趋势统计对比方式
+const (
+	TrendComparePrevious = "previous" // 与上一个等长区间对比（环比）
+	TrendCompareYear     = "year"     // 与去年同期对比（同比）
+)
+
+// trendMaxBuckets 单次查询的最大时间段数
+const trendMaxBuckets = 400
+
+// TrendBucket 趋势统计的一个时间段
+type TrendBucket struct {
+	Label      string    `json:"label"` // 2024-01-15 / 2024-W03 / 2024-01 / 2024-Q1
+	Start      time.Time `json:"start"`
+	Value      float64   `json:"value"`
+	Previous   *float64  `json:"previous,omitempty"`    // 对比区间对应时间段的值
+	ChangeRate *float64  `json:"change_rate,omitempty"` // 变化率（%），对比值为0时为null
+}
+
+// TrendSeries 按维度分组的趋势序列
+type TrendSeries struct {
+	Key           string        `json:"key"`
+	Name          string        `json:"name"`
+	Total         float64       `json:"total"`
+	PreviousTotal *float64      `json:"previous_total,omitempty"`
+	ChangeRate    *float64      `json:"change_rate,omitempty"`
+	Buckets       []TrendBucket `json:"buckets"`
+}
+
+// TrendStats 趋势统计结果
+type TrendStats struct {
+	Metric        string        `json:"metric"`
+	Granularity   string        `json:"granularity"`
+	GroupBy       string        `json:"group_by,omitempty"`
+	Compare       string        `json:"compare,omitempty"`
+	StartDate     time.Time     `json:"start_date"`
+	EndDate       time.Time     `json:"end_date"` // 最后一个时间段的最后一天
+	Total         float64       `json:"total"`
+	PreviousTotal *float64      `json:"previous_total,omitempty"`
+	ChangeRate    *float64      `json:"change_rate,omitempty"`
+	Buckets       []TrendBucket `json:"buckets"`
+	Series        []TrendSeries `json:"series,omitempty"` // 指定 group_by 时按维度拆分
+}
+
+// trendPoint 参与统计的一条数据：发生时间、数值及所属分组
+type trendPoint struct {
+	At    time.Time
+	Value float64
+	Group string
+}
+
+// GetTrendStats 获取按时间段汇总的趋势统计，用于首页图表
+func GetTrendStats(c *gin.Context) {
+	metric := c.Query("metric")
+	groupBy := c.Query("group_by")
+	compare := c.Query("compare")
+
+	switch metric {
+	case TrendMetricPaymentAmount, TrendMetricPaymentCount, TrendMetricNewCustomers, TrendMetricTasksCreated,
+		TrendMetricTasksCompleted, TrendMetricAgreementStarts, TrendMetricAgreementEnds:
+	default:
+		ErrorResponse(c, 400, "Invalid metric: "+metric)
+		return
+	}
+
+	switch groupBy {
+	case "", TrendGroupCustomerType, TrendGroupServicePerson:
+	case TrendGroupPaymentMethod:
+		if metric != TrendMetricPaymentAmount && metric != TrendMetricPaymentCount {
+			ErrorResponse(c, 400, "payment_method grouping only applies to payment metrics")
+			return
+		}
+	default:
+		ErrorResponse(c, 400, "Invalid group_by: "+groupBy)
+		return
+	}
+
+	if compare != "" && compare != TrendComparePrevious && compare != TrendCompareYear {
+		ErrorResponse(c, 400, "Invalid compare, expected previous or year")
+		return
+	}
+
+	granularity := c.DefaultQuery("granularity", "month")
+	starts, ok := parseTrendRange(c, granularity)
+	if !ok {
+		return
+	}
+	end := trendBucketNext(granularity, starts[len(starts)-1])
+
+	stats := TrendStats{
+		Metric:      metric,
+		Granularity: granularity,
+		GroupBy:     groupBy,
+		Compare:     compare,
+		StartDate:   starts[0],
+		EndDate:     end.AddDate(0, 0, -1),
+	}
+
+	current, currentTotal, err := loadTrendBuckets(metric, groupBy, granularity, starts)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to load statistics: "+err.Error())
+		return
+	}
+
+	var previous map[string][]float64
+	var previousTotal []float64
+	if compare != "" {
+		previousStarts := make([]time.Time, len(starts))
+		for i, start := range starts {
+			previousStarts[i] = trendCompareStart(granularity, compare, start, len(starts))
+		}
+		previous, previousTotal, err = loadTrendBuckets(metric, groupBy, granularity, previousStarts)
+		if err != nil {
+			ErrorResponse(c, 500, "Failed to load statistics: "+err.Error())
+			return
+		}
+	}
+
+	stats.Buckets, stats.Total, stats.PreviousTotal, stats.ChangeRate =
+		trendSeriesBuckets(starts, granularity, currentTotal, previousTotal, compare != "")
+
+	if groupBy != "" {
+		keys := make([]string, 0, len(current))
+		seen := map[string]bool{}
+		for key := range current {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+		for key := range previous {
+			if !seen[key] {
+				keys = append(keys, key)
+			}
+		}
+		names := trendGroupNames(groupBy, keys)
+
+		stats.Series = make([]TrendSeries, 0, len(keys))
+		for _, key := range keys {
+			series := TrendSeries{Key: key, Name: names[key]}
+			series.Buckets, series.Total, series.PreviousTotal, series.ChangeRate =
+				trendSeriesBuckets(starts, granularity, current[key], previous[key], compare != "")
+			stats.Series = append(stats.Series, series)
+		}
+		sort.Slice(stats.Series, func(i, j int) bool {
+			if stats.Series[i].Total != stats.Series[j].Total {
+				return stats.Series[i].Total > stats.Series[j].Total
+			}
+			return stats.Series[i].Key < stats.Series[j].Key
+		})
+	}
+
+	SuccessResponse(c, stats)
+}
+
+// ============ 辅助函数 ============
+
+// parseTrendRange 解析统计区间并按粒度对齐，返回各时间段的开始时间
+// 未指定时默认：按日最近30天，按周最近12周，按月最近12个月，按季度最近8个季度
+func parseTrendRange(c *gin.Context, granularity string) ([]time.Time, bool) {
+	defaults := map[string]int{"day": 30, "week": 12, "month": 12, "quarter": 8}
+	count, ok := defaults[granularity]
+	if !ok {
+		ErrorResponse(c, 400, "Invalid granularity, expected day, week, month or quarter")
+		return nil, false
+	}
+
+	last := trendBucketStart(granularity, time.Now())
+	if value := c.Query("end_date"); value != "" {
+		t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			ErrorResponse(c, 400, "Invalid end_date, expected YYYY-MM-DD")
+			return nil, false
+		}
+		last = trendBucketStart(granularity, t)
+	}
+
+	first := last
+	for i := 1; i < count; i++ {
+		first = trendBucketPrev(granularity, first)
+	}
+	if value := c.Query("start_date"); value != "" {
+		t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			ErrorResponse(c, 400, "Invalid start_date, expected YYYY-MM-DD")
+			return nil, false
+		}
+		first = trendBucketStart(granularity, t)
+	}
+	if first.After(last) {
+		ErrorResponse(c, 400, "start_date must not be after end_date")
+		return nil, false
+	}
+
+	var starts []time.Time
+	for t := first; !t.After(last); t = trendBucketNext(granularity, t) {
+		if len(starts) == trendMaxBuckets {
+			ErrorResponse(c, 400, fmt.Sprintf("Too many periods, at most %d per request", trendMaxBuckets))
+			return nil, false
+		}
+		starts = append(starts, t)
+	}
+	return starts, true
+}
+
+// trendBucketStart 返回 t 所在时间段的开始时间（周从周一开始）
+func trendBucketStart(granularity string, t time.Time) time.Time {
+	day := startOfDay(t.In(time.Local))
+	switch granularity {
+	case "week":
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "month":
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.Local)
+	case "quarter":
+		return time.Date(day.Year(), day.Month()-(day.Month()-1)%3, 1, 0, 0, 0, 0, time.Local)
+	}
+	return day
+}
+
+// trendBucketNext 返回下一个时间段的开始时间
+func trendBucketNext(granularity string, start time.Time) time.Time {
+	return trendBucketShift(granularity, start, 1)
+}
+
+// trendBucketPrev 返回上一个时间段的开始时间
+func trendBucketPrev(granularity string, start time.Time) time.Time {
+	return trendBucketShift(granularity, start, -1)
+}
+
+// trendBucketShift 按时间段数平移
+func trendBucketShift(granularity string, start time.Time, n int) time.Time {
+	switch granularity {
+	case "week":
+		return start.AddDate(0, 0, 7*n)
+	case "month":
+		return start.AddDate(0, n, 0)
+	case "quarter":
+		return start.AddDate(0, 3*n, 0)
+	}
+	return start.AddDate(0, 0, n)
+}
+
+// trendCompareStart 对比区间中与 start 对应的时间段：环比前移整个区间长度，同比前移一年（按周时为52周）
+func trendCompareStart(granularity, compare string, start time.Time, buckets int) time.Time {
+	if compare == TrendComparePrevious {
+		return trendBucketShift(granularity, start, -buckets)
+	}
+	if granularity == "week" {
+		return start.AddDate(0, 0, -7*52)
+	}
+	return start.AddDate(-1, 0, 0)
+}
+
+// trendBucketLabel 时间段标签
+func trendBucketLabel(granularity string, start time.Time) string {
+	switch granularity {
+	case "week":
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case "month":
+		return start.Format("2006-01")
+	case "quarter":
+		return fmt.Sprintf("%d-Q%d", start.Year(), (int(start.Month())+2)/3)
+	}
+	return start.Format("2006-01-02")
+}
+
+// loadTrendBuckets 加载各时间段的分组值及合计
+// 按服务人员分组时同一客户可计入多人、收款按比例拆分，合计改用不分组的数据，避免重复计数
+func loadTrendBuckets(metric, groupBy, granularity string, starts []time.Time) (map[string][]float64, []float64, error) {
+	end := trendBucketNext(granularity, starts[len(starts)-1])
+	points, err := loadTrendPoints(metric, groupBy, starts[0], end)
+	if err != nil {
+		return nil, nil, err
+	}
+	groups := bucketTrendPoints(points, starts, granularity)
+	if groupBy != TrendGroupServicePerson {
+		return groups, sumTrendGroups(groups, len(starts)), nil
+	}
+
+	points, err = loadTrendPoints(metric, "", starts[0], end)
+	if err != nil {
+		return nil, nil, err
+	}
+	return groups, sumTrendGroups(bucketTrendPoints(points, starts, granularity), len(starts)), nil
+}
+
+// bucketTrendPoints 将数据按分组和时间段汇总
+func bucketTrendPoints(points []trendPoint, starts []time.Time, granularity string) map[string][]float64 {
+	index := make(map[time.Time]int, len(starts))
+	for i, start := range starts {
+		index[start] = i
+	}
+	groups := map[string][]float64{}
+	for _, point := range points {
+		i, ok := index[trendBucketStart(granularity, point.At)]
+		if !ok {
+			continue
+		}
+		if groups[point.Group] == nil {
+			groups[point.Group] = make([]float64, len(starts))
+		}
+		groups[point.Group][i] += point.Value
+	}
+	return groups
+}
+
+// sumTrendGroups 合计各分组的值
+func sumTrendGroups(groups map[string][]float64, buckets int) []float64 {
+	total := make([]float64, buckets)
+	for _, values := range groups {
+		for i, value := range values {
+			total[i] += value
+		}
+	}
+	return total
+}
+
+// trendSeriesBuckets 生成时间段列表及合计，compare 为 true 时附带对比值和变化率
+func trendSeriesBuckets(starts []time.Time, granularity string, values, previous []float64, compare bool) ([]TrendBucket, float64, *float64, *float64) {
+	buckets := make([]TrendBucket, len(starts))
+	var total, previousTotal float64
+	for i, start := range starts {
+		bucket := TrendBucket{Label: trendBucketLabel(granularity, start), Start: start}
+		if values != nil {
+			bucket.Value = math.Round(values[i]*100) / 100
+		}
+		total += bucket.Value
+		if compare {
+			var prev float64
+			if previous != nil {
+				prev = math.Round(previous[i]*100) / 100
+			}
+			previousTotal += prev
+			bucket.Previous = &prev
+			bucket.ChangeRate = trendChangeRate(bucket.Value, prev)
+		}
+		buckets[i] = bucket
+	}
+
+	total = math.Round(total*100) / 100
+	if !compare {
+		return buckets, total, nil, nil
+	}
+	previousTotal = math.Round(previousTotal*100) / 100
+	return buckets, total, &previousTotal, trendChangeRate(total, previousTotal)
+}
+
+// trendChangeRate 计算变化率（%），对比值为0时返回nil
+func trendChangeRate(value, previous float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	rate := math.Round((value-previous)*10000/previous) / 100
+	return &rate
+}
+
+// loadTrendPoints 加载 [start, end) 内的指标数据，按 groupBy 标记分组（不分组时分组为空）
+// 收款金额减去按退款日期计入的退款；按服务人员分组时：收款和退款按业绩归属比例拆分，任务按负责人，客户和协议计入客户的每位服务人员
+func loadTrendPoints(metric, groupBy string, start, end time.Time) ([]trendPoint, error) {
+	customers := map[uint]models.Customer{}
+	if groupBy == TrendGroupCustomerType || groupBy == TrendGroupServicePerson {
+		var rows []models.Customer
+		if err := config.DB.Select("id", "type", "service_person_ids").Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			customers[row.ID] = row
+		}
+	}
+
+	// customerGroups 客户所属的分组，按服务人员分组时每位服务人员各计一次
+	customerGroups := func(customerID uint) []string {
+		switch groupBy {
+		case TrendGroupCustomerType:
+			return []string{string(customers[customerID].Type)}
+		case TrendGroupServicePerson:
+			ids := StringToIDs(customers[customerID].ServicePersonIDs)
+			if len(ids) == 0 {
+				return []string{"0"}
+			}
+			groups := make([]string, len(ids))
+			for i, id := range ids {
+				groups[i] = strconv.FormatUint(uint64(id), 10)
+			}
+			return groups
+		}
+		return []string{""}
+	}
+
+	var points []trendPoint
+	switch metric {
+	case TrendMetricPaymentAmount, TrendMetricPaymentCount:
+		columns := []string{"id", "customer_id", "amount", "attribution_overridden", "payment_date", "payment_method"}
+		var payments []models.Payment
+		if err := config.DB.Select(columns).
+			Where("payment_date >= ? AND payment_date < ?", start, end).Find(&payments).Error; err != nil {
+			return nil, err
+		}
+
+		// 收款金额减去区间内的退款（按退款日期），退款按原收款的方式、客户和业绩归属分组
+		var refunds []models.PaymentRefund
+		paymentByID := make(map[uint]models.Payment, len(payments))
+		for _, payment := range payments {
+			paymentByID[payment.ID] = payment
+		}
+		if metric == TrendMetricPaymentAmount {
+			if err := config.DB.Select("id", "payment_id", "amount", "refund_date").
+				Where("refund_date >= ? AND refund_date < ?", start, end).Find(&refunds).Error; err != nil {
+				return nil, err
+			}
+			var missing []uint
+			for _, refund := range refunds {
+				if _, ok := paymentByID[refund.PaymentID]; !ok && !containsID(missing, refund.PaymentID) {
+					missing = append(missing, refund.PaymentID)
+				}
+			}
+			if len(missing) > 0 {
+				var earlier []models.Payment
+				if err := config.DB.Select(columns).Where("id IN ?", missing).Find(&earlier).Error; err != nil {
+					return nil, err
+				}
+				for _, payment := range earlier {
+					paymentByID[payment.ID] = payment
+				}
+			}
+		}
+
+		shares := map[uint][]models.PaymentAttribution{}
+		if groupBy == TrendGroupServicePerson && len(paymentByID) > 0 {
+			ids := make([]uint, 0, len(paymentByID))
+			for id := range paymentByID {
+				ids = append(ids, id)
+			}
+			var attributions []models.PaymentAttribution
+			config.DB.Where("payment_id IN ?", ids).Find(&attributions)
+			for _, a := range attributions {
+				shares[a.PaymentID] = append(shares[a.PaymentID], a)
+			}
+		}
+
+		addPayment := func(payment models.Payment, at time.Time, value float64) {
+			switch groupBy {
+			case TrendGroupPaymentMethod:
+				method := payment.PaymentMethod
+				if method == "" {
+					method = "未填写"
+				}
+				points = append(points, trendPoint{At: at, Value: value, Group: method})
+			case TrendGroupServicePerson:
+				paymentShares := shares[payment.ID]
+				if len(paymentShares) == 0 && !payment.AttributionOverridden {
+					paymentShares = evenShares(StringToIDs(customers[payment.CustomerID].ServicePersonIDs))
+				}
+				if len(paymentShares) == 0 {
+					points = append(points, trendPoint{At: at, Value: value, Group: "0"})
+				}
+				for _, share := range paymentShares {
+					points = append(points, trendPoint{
+						At:    at,
+						Value: value * share.Share / 100,
+						Group: strconv.FormatUint(uint64(share.PersonID), 10),
+					})
+				}
+			default:
+				for _, group := range customerGroups(payment.CustomerID) {
+					points = append(points, trendPoint{At: at, Value: value, Group: group})
+				}
+			}
+		}
+		for _, payment := range payments {
+			value := payment.Amount
+			if metric == TrendMetricPaymentCount {
+				value = 1
+			}
+			addPayment(payment, payment.PaymentDate, value)
+		}
+		for _, refund := range refunds {
+			addPayment(paymentByID[refund.PaymentID], refund.RefundDate, -refund.Amount)
+		}
+
+	case TrendMetricNewCustomers:
+		var rows []models.Customer
+		if err := config.DB.Select("id", "created_at").
+			Where("created_at >= ? AND created_at < ?", start, end).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			for _, group := range customerGroups(row.ID) {
+				points = append(points, trendPoint{At: row.CreatedAt, Value: 1, Group: group})
+			}
+		}
+
+	case TrendMetricTasksCreated, TrendMetricTasksCompleted:
+		column := "created_at"
+		if metric == TrendMetricTasksCompleted {
+			column = "completed_at"
+		}
+		var tasks []models.Task
+		if err := config.DB.Select("customer_id", "assignee_id", "created_at", "completed_at").
+			Where(column+" >= ? AND "+column+" < ?", start, end).Find(&tasks).Error; err != nil {
+			return nil, err
+		}
+		for _, task := range tasks {
+			at := task.CreatedAt
+			if metric == TrendMetricTasksCompleted {
+				at = *task.CompletedAt
+			}
+			groups := customerGroups(task.CustomerID)
+			if groupBy == TrendGroupServicePerson {
+				groups = []string{"0"}
+				if task.AssigneeID != nil {
+					groups = []string{strconv.FormatUint(uint64(*task.AssigneeID), 10)}
+				}
+			}
+			for _, group := range groups {
+				points = append(points, trendPoint{At: at, Value: 1, Group: group})
+			}
+		}
+
+	case TrendMetricAgreementStarts, TrendMetricAgreementEnds:
+		column := "start_date"
+		if metric == TrendMetricAgreementEnds {
+			column = "end_date"
+		}
+		var agreements []models.Agreement
+		if err := config.DB.Select("customer_id", "start_date", "end_date").
+			Where("status <> ? AND "+column+" >= ? AND "+column+" < ?", models.AgreementStatusCancelled, start, end).
+			Find(&agreements).Error; err != nil {
+			return nil, err
+		}
+		for _, agreement := range agreements {
+			at := agreement.StartDate
+			if metric == TrendMetricAgreementEnds {
+				at = agreement.EndDate
+			}
+			for _, group := range customerGroups(agreement.CustomerID) {
+				points = append(points, trendPoint{At: at, Value: 1, Group: group})
+			}
+		}
+	}
+
+	return points, nil
+}
+
+// trendGroupNames 分组的显示名称：服务人员为姓名，未分配服务人员的为“未分配”
+func trendGroupNames(groupBy string, keys []string) map[string]string {
+	names := make(map[string]string, len(keys))
+	for _, key := range keys {
+		names[key] = key
+	}
+	if groupBy != TrendGroupServicePerson {
+		return names
+	}
+
+	var people []models.Person
+	config.DB.Select("id", "name").Find(&people)
+	for _, person := range people {
+		key := strconv.FormatUint(uint64(person.ID), 10)
+		if _, ok := names[key]; ok {
+			names[key] = person.Name
+		}
+	}
+	if _, ok := names["0"]; ok {
+		names["0"] = "未分配"
+	}
+	return names
+}
@@ -0,0 +1,416 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"erp/services/webhook"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// webhookSubscriptionRequest 创建/更新订阅的请求
+type webhookSubscriptionRequest struct {
+	Name       string   `json:"name"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+	Active     *bool    `json:"active"`
+	Version    uint     `json:"version"` // 更新时所基于的版本号（也可使用 If-Match 请求头）
+}
+
+// webhookSubscriptionWithSecret 创建订阅和轮换密钥时返回的订阅，包含签名密钥
+type webhookSubscriptionWithSecret struct {
+	models.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// GetWebhookEventTypes 获取可订阅的事件类型
+func GetWebhookEventTypes(c *gin.Context) {
+	SuccessResponse(c, models.WebhookEventTypes)
+}
+
+// GetWebhookSubscriptions 获取Webhook订阅列表
+func GetWebhookSubscriptions(c *gin.Context) {
+	var subscriptions []models.WebhookSubscription
+	var total int64
+
+	query := config.DB.Model(&models.WebhookSubscription{})
+	if active := c.Query("active"); active != "" {
+		query = query.Where("active = ?", active == "true")
+	}
+
+	query.Count(&total)
+
+	if err := query.Order("id ASC").Find(&subscriptions).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch webhook subscriptions: "+err.Error())
+		return
+	}
+
+	SuccessPaginatedResponse(c, total, subscriptions)
+}
+
+// GetWebhookSubscription 获取单个Webhook订阅
+func GetWebhookSubscription(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid webhook ID")
+		return
+	}
+
+	var subscription models.WebhookSubscription
+	if err := config.DB.First(&subscription, id).Error; err != nil {
+		ErrorResponse(c, 404, "Webhook subscription not found")
+		return
+	}
+
+	setETag(c, subscription.Version)
+	SuccessResponse(c, subscription)
+}
+
+// CreateWebhookSubscription 创建Webhook订阅，未指定密钥时自动生成
+func CreateWebhookSubscription(c *gin.Context) {
+	var req webhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	subscription := models.WebhookSubscription{
+		Name:   req.Name,
+		URL:    req.URL,
+		Secret: req.Secret,
+		Active: true,
+	}
+	if req.Active != nil {
+		subscription.Active = *req.Active
+	}
+	if subscription.Secret == "" {
+		subscription.Secret = webhook.NewSecret()
+	}
+	if len(req.EventTypes) == 0 {
+		req.EventTypes = []string{"*"}
+	}
+	subscription.EventTypes = strings.Join(req.EventTypes, ",")
+
+	if msg := validateWebhookSubscription(&subscription); msg != "" {
+		ErrorResponse(c, 400, msg)
+		return
+	}
+
+	if err := config.DB.Create(&subscription).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to create webhook subscription: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, webhookSubscriptionWithSecret{subscription, subscription.Secret})
+}
+
+// UpdateWebhookSubscription 更新Webhook订阅，仅更新请求中提供的字段
+func UpdateWebhookSubscription(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid webhook ID")
+		return
+	}
+
+	var subscription models.WebhookSubscription
+	if err := config.DB.First(&subscription, id).Error; err != nil {
+		ErrorResponse(c, 404, "Webhook subscription not found")
+		return
+	}
+
+	var req webhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if !matchVersion(c, subscription.Version, req.Version) {
+		return
+	}
+	current := subscription.Version
+
+	if req.Name != "" {
+		subscription.Name = req.Name
+	}
+	if req.URL != "" {
+		subscription.URL = req.URL
+	}
+	if req.Secret != "" {
+		subscription.Secret = req.Secret
+	}
+	if req.EventTypes != nil {
+		subscription.EventTypes = strings.Join(req.EventTypes, ",")
+	}
+	if req.Active != nil {
+		subscription.Active = *req.Active
+	}
+
+	if msg := validateWebhookSubscription(&subscription); msg != "" {
+		ErrorResponse(c, 400, msg)
+		return
+	}
+
+	subscription.Version = current + 1
+	if !updateVersioned(c, config.DB.Model(&models.WebhookSubscription{ID: subscription.ID}).Select("*"), current, &subscription) {
+		return
+	}
+
+	setETag(c, subscription.Version)
+	SuccessResponse(c, subscription)
+}
+
+// webhookPatchFields Webhook订阅可通过 PATCH 修改的字段，event_types 为逗号分隔字符串
+// 签名密钥不在响应中返回，通过轮换接口修改
+var webhookPatchFields = patchFields{
+	"name":        "name",
+	"url":         "url",
+	"event_types": "event_types",
+	"active":      "active",
+	"version":     "",
+}
+
+// PatchWebhookSubscription 部分更新Webhook订阅（JSON Merge Patch）
+func PatchWebhookSubscription(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid webhook ID")
+		return
+	}
+
+	var subscription models.WebhookSubscription
+	if err := config.DB.First(&subscription, id).Error; err != nil {
+		ErrorResponse(c, 404, "Webhook subscription not found")
+		return
+	}
+
+	var patched models.WebhookSubscription
+	columns, ok := bindMergePatch(c, subscription, &patched, webhookPatchFields)
+	if !ok {
+		return
+	}
+
+	if msg := validateWebhookSubscription(&patched); msg != "" {
+		ErrorResponse(c, 400, msg)
+		return
+	}
+
+	if !matchVersion(c, subscription.Version, patched.Version) {
+		return
+	}
+
+	patched.Version = subscription.Version + 1
+	if !updateVersioned(c, config.DB.Model(&subscription).Select(append(columns, "version")), subscription.Version, &patched) {
+		return
+	}
+
+	config.DB.First(&subscription, id)
+
+	setETag(c, subscription.Version)
+	SuccessResponse(c, subscription)
+}
+
+// DeleteWebhookSubscription 删除Webhook订阅（软删除），投递记录保留，未完成的投递不再进行
+func DeleteWebhookSubscription(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid webhook ID")
+		return
+	}
+
+	var subscription models.WebhookSubscription
+	if err := config.DB.First(&subscription, id).Error; err != nil {
+		ErrorResponse(c, 404, "Webhook subscription not found")
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.WebhookDelivery{}).
+			Where("subscription_id = ? AND status = ?", subscription.ID, models.WebhookDeliveryPending).
+			Updates(map[string]interface{}{
+				"status":     models.WebhookDeliveryFailed,
+				"last_error": "subscription deleted",
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&subscription).Error
+	})
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to delete webhook subscription: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "Webhook subscription deleted successfully"})
+}
+
+// RotateWebhookSecret 重新生成订阅的签名密钥，响应中返回新密钥
+func RotateWebhookSecret(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid webhook ID")
+		return
+	}
+
+	var subscription models.WebhookSubscription
+	if err := config.DB.First(&subscription, id).Error; err != nil {
+		ErrorResponse(c, 404, "Webhook subscription not found")
+		return
+	}
+
+	if !matchVersion(c, subscription.Version, 0) {
+		return
+	}
+
+	current := subscription.Version
+	secret := webhook.NewSecret()
+	if !updateVersioned(c, config.DB.Model(&subscription), current, map[string]interface{}{
+		"secret":  secret,
+		"version": current + 1,
+	}) {
+		return
+	}
+
+	config.DB.First(&subscription, id)
+
+	setETag(c, subscription.Version)
+	SuccessResponse(c, webhookSubscriptionWithSecret{subscription, subscription.Secret})
+}
+
+// PingWebhookSubscription 向订阅地址发送测试事件
+func PingWebhookSubscription(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid webhook ID")
+		return
+	}
+
+	var subscription models.WebhookSubscription
+	if err := config.DB.First(&subscription, id).Error; err != nil {
+		ErrorResponse(c, 404, "Webhook subscription not found")
+		return
+	}
+
+	delivery, err := config.Webhooks.Ping(&subscription)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to ping webhook: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, delivery)
+}
+
+// GetWebhookDeliveries 获取订阅的投递记录
+func GetWebhookDeliveries(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid webhook ID")
+		return
+	}
+
+	var deliveries []models.WebhookDelivery
+	var total int64
+
+	query := config.DB.Model(&models.WebhookDelivery{}).Where("subscription_id = ?", id)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if eventType := c.Query("event_type"); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+
+	query.Count(&total)
+
+	if err := query.Order("created_at DESC").Find(&deliveries).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch webhook deliveries: "+err.Error())
+		return
+	}
+
+	SuccessPaginatedResponse(c, total, deliveries)
+}
+
+// GetWebhookDelivery 获取单条投递记录
+func GetWebhookDelivery(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid delivery ID")
+		return
+	}
+
+	var delivery models.WebhookDelivery
+	if err := config.DB.First(&delivery, id).Error; err != nil {
+		ErrorResponse(c, 404, "Webhook delivery not found")
+		return
+	}
+
+	SuccessResponse(c, delivery)
+}
+
+// RedeliverWebhook 以原请求体重新投递（生成新的投递记录）
+func RedeliverWebhook(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid delivery ID")
+		return
+	}
+
+	var original models.WebhookDelivery
+	if err := config.DB.First(&original, id).Error; err != nil {
+		ErrorResponse(c, 404, "Webhook delivery not found")
+		return
+	}
+
+	delivery, err := config.Webhooks.Redeliver(original.ID)
+	if err != nil {
+		ErrorResponse(c, 400, "Failed to redeliver webhook: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, delivery)
+}
+
+// ============ 辅助函数 ============
+
+// validateWebhookSubscription 校验订阅地址和事件过滤条件，返回错误信息
+func validateWebhookSubscription(subscription *models.WebhookSubscription) string {
+	u, err := url.Parse(subscription.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "Invalid webhook URL: " + subscription.URL
+	}
+
+	var filters []string
+	for _, filter := range strings.Split(subscription.EventTypes, ",") {
+		filter = strings.TrimSpace(filter)
+		if filter == "" {
+			continue
+		}
+		if !isValidWebhookEventFilter(filter) {
+			return "Invalid webhook event type: " + filter
+		}
+		filters = append(filters, filter)
+	}
+	if len(filters) == 0 {
+		return "At least one event type is required"
+	}
+	subscription.EventTypes = strings.Join(filters, ",")
+	return ""
+}
+
+// isValidWebhookEventFilter 事件过滤条件须为 "*"、已知事件类型或已知前缀加 ".*"
+func isValidWebhookEventFilter(filter string) bool {
+	if filter == "*" {
+		return true
+	}
+	for _, eventType := range models.WebhookEventTypes {
+		if filter == eventType {
+			return true
+		}
+		if strings.HasSuffix(filter, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(filter, "*")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,527 @@
+package controllers
+
+import (
+	"erp/config"
+	"erp/models"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// workloadDefaultDays 未指定统计区间时，按时完成率统计最近的天数
+const workloadDefaultDays = 90
+
+// workloadNoTaxProfile 按纳税人类型统计时，未建税务档案的客户归入此类
+const workloadNoTaxProfile = "未建档"
+
+// PersonWorkload 服务人员工作量
+type PersonWorkload struct {
+	PersonID                uint                    `json:"person_id"`
+	Name                    string                  `json:"name"`
+	CustomerCount           int64                   `json:"customer_count"`             // 服务客户数
+	CustomersByType         map[string]int64        `json:"customers_by_type"`          // 按客户类型统计
+	CustomersByTaxpayerType map[string]int64        `json:"customers_by_taxpayer_type"` // 按纳税人类型统计，未建税务档案的计入"未建档"
+	MonthlyFilings          float64                 `json:"monthly_filings"`            // 服务客户的申报义务折算到每月的申报次数
+	OpenTasks               int64                   `json:"open_tasks"`                 // 未完成任务数
+	OverdueTasks            int64                   `json:"overdue_tasks"`              // 已逾期的未完成任务数
+	MonthlyFee              float64                 `json:"monthly_fee"`                // 管理的月度服务费规模（有效协议折算到月，含当月开始的协议的一次性费用）
+	CompletedTasks          int64                   `json:"completed_tasks"`            // 统计区间内完成的任务数
+	OnTimeTasks             int64                   `json:"on_time_tasks"`              // 其中有截止日期且按时完成的任务数
+	OnTimeRate              *float64                `json:"on_time_rate"`               // 按时完成率（%），区间内没有带截止日期的已完成任务时为null
+	Collected               float64                 `json:"collected"`                  // 统计区间内归属的收款金额，减去区间内的退款（按退款日期）
+	Capacity                *models.ServiceCapacity `json:"capacity"`                   // 生效的容量上限，未配置时为null
+	Utilization             *float64                `json:"utilization"`                // 容量使用率（%），取各项上限中最高的比例
+	AtCapacity              bool                    `json:"at_capacity"`                // 是否已达到任一上限
+}
+
+// WorkloadCandidate 新客户的候选服务人员
+type WorkloadCandidate struct {
+	PersonWorkload
+	ProjectedUtilization *float64 `json:"projected_utilization"` // 接手新客户后的容量使用率（%）
+	Available            bool     `json:"available"`             // 接手后是否仍在容量上限内
+}
+
+// WorkloadSuggestion 新客户分配建议
+type WorkloadSuggestion struct {
+	Suggested  *WorkloadCandidate  `json:"suggested"`  // 建议的服务人员，所有人都已满员时为null
+	Candidates []WorkloadCandidate `json:"candidates"` // 按推荐顺序排列的候选人
+}
+
+// GetWorkloadStats 获取服务人员工作量统计
+func GetWorkloadStats(c *gin.Context) {
+	start, end, ok := parseWorkloadPeriod(c)
+	if !ok {
+		return
+	}
+
+	workloads, err := loadWorkloads(c.Query("person_id"), start, end)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to calculate workload: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, workloads)
+}
+
+// SuggestServicePerson 为新客户推荐负载最低的服务人员
+// 依次比较：接手后是否超出容量上限、接手后的容量使用率、客户数、未完成任务数、
+// 同类型客户数、同纳税人类型客户数（多者优先）
+func SuggestServicePerson(c *gin.Context) {
+	monthlyFee := 0.0
+	if value := c.Query("monthly_fee"); value != "" {
+		fee, err := strconv.ParseFloat(value, 64)
+		if err != nil || fee < 0 {
+			ErrorResponse(c, 400, "Invalid monthly_fee")
+			return
+		}
+		monthlyFee = fee
+	}
+	customerType := c.Query("customer_type")
+	taxpayerType := c.Query("taxpayer_type")
+	exclude := StringToIDs(c.Query("exclude"))
+
+	start, end, ok := parseWorkloadPeriod(c)
+	if !ok {
+		return
+	}
+
+	workloads, err := loadWorkloads("", start, end)
+	if err != nil {
+		ErrorResponse(c, 500, "Failed to calculate workload: "+err.Error())
+		return
+	}
+
+	candidates := []WorkloadCandidate{}
+	for _, w := range workloads {
+		if containsID(exclude, w.PersonID) {
+			continue
+		}
+		candidate := WorkloadCandidate{PersonWorkload: w, Available: true}
+		if w.Capacity != nil {
+			projected := capacityUtilization(w.Capacity, w.CustomerCount+1, w.OpenTasks, w.MonthlyFee+monthlyFee)
+			candidate.ProjectedUtilization = projected
+			candidate.Available = projected == nil || *projected <= 100
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Available != b.Available {
+			return a.Available
+		}
+		pa, pb := utilizationValue(a.ProjectedUtilization), utilizationValue(b.ProjectedUtilization)
+		if pa != pb {
+			return pa < pb
+		}
+		if a.CustomerCount != b.CustomerCount {
+			return a.CustomerCount < b.CustomerCount
+		}
+		if a.OpenTasks != b.OpenTasks {
+			return a.OpenTasks < b.OpenTasks
+		}
+		if a.CustomersByType[customerType] != b.CustomersByType[customerType] {
+			return a.CustomersByType[customerType] > b.CustomersByType[customerType]
+		}
+		return a.CustomersByTaxpayerType[taxpayerType] > b.CustomersByTaxpayerType[taxpayerType]
+	})
+
+	suggestion := WorkloadSuggestion{Candidates: candidates}
+	if len(candidates) > 0 && candidates[0].Available {
+		suggestion.Suggested = &candidates[0]
+	}
+
+	SuccessResponse(c, suggestion)
+}
+
+// GetServiceCapacities 获取容量上限配置
+func GetServiceCapacities(c *gin.Context) {
+	var capacities []models.ServiceCapacity
+	if err := config.DB.Order("person_id ASC").Find(&capacities).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to fetch capacities: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, capacities)
+}
+
+// UpdateServiceCapacity 设置人员的容量上限，person_id 为0时设置默认上限
+func UpdateServiceCapacity(c *gin.Context) {
+	personID, err := strconv.ParseUint(c.Param("person_id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid person ID")
+		return
+	}
+
+	if personID != 0 && !isServicePerson(uint(personID)) {
+		ErrorResponse(c, 400, "Person must be a service person")
+		return
+	}
+
+	var req models.ServiceCapacity
+	if err := c.ShouldBindJSON(&req); err != nil {
+		ErrorResponse(c, 400, "Invalid request data: "+err.Error())
+		return
+	}
+
+	if req.MaxCustomers < 0 || req.MaxOpenTasks < 0 || req.MaxMonthlyFee < 0 {
+		ErrorResponse(c, 400, "Capacity limits cannot be negative")
+		return
+	}
+
+	var capacity models.ServiceCapacity
+	values := map[string]interface{}{
+		"max_customers":   req.MaxCustomers,
+		"max_open_tasks":  req.MaxOpenTasks,
+		"max_monthly_fee": req.MaxMonthlyFee,
+	}
+	if config.DB.Where("person_id = ?", personID).First(&capacity).Error == nil {
+		if !matchVersion(c, capacity.Version, req.Version) {
+			return
+		}
+		values["version"] = capacity.Version + 1
+		if !updateVersioned(c, config.DB.Model(&capacity), capacity.Version, values) {
+			return
+		}
+	} else {
+		capacity = models.ServiceCapacity{
+			PersonID:      uint(personID),
+			MaxCustomers:  req.MaxCustomers,
+			MaxOpenTasks:  req.MaxOpenTasks,
+			MaxMonthlyFee: req.MaxMonthlyFee,
+		}
+		if err := config.DB.Create(&capacity).Error; err != nil {
+			ErrorResponse(c, 500, "Failed to save capacity: "+err.Error())
+			return
+		}
+	}
+
+	config.DB.First(&capacity, capacity.ID)
+
+	setETag(c, capacity.Version)
+	SuccessResponse(c, capacity)
+}
+
+// DeleteServiceCapacity 删除人员的容量上限（恢复使用默认上限）
+func DeleteServiceCapacity(c *gin.Context) {
+	personID, err := strconv.ParseUint(c.Param("person_id"), 10, 32)
+	if err != nil {
+		ErrorResponse(c, 400, "Invalid person ID")
+		return
+	}
+
+	if err := config.DB.Where("person_id = ?", personID).Delete(&models.ServiceCapacity{}).Error; err != nil {
+		ErrorResponse(c, 500, "Failed to delete capacity: "+err.Error())
+		return
+	}
+
+	SuccessResponse(c, gin.H{"message": "Capacity deleted successfully"})
+}
+
+// ============ 辅助函数 ============
+
+// parseWorkloadPeriod 解析按时完成率的统计区间 [start_date, end_date]，默认最近90天
+func parseWorkloadPeriod(c *gin.Context) (time.Time, time.Time, bool) {
+	today := startOfDay(time.Now())
+	start := today.AddDate(0, 0, -workloadDefaultDays)
+	end := today.AddDate(0, 0, 1)
+
+	if value := c.Query("start_date"); value != "" {
+		t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			ErrorResponse(c, 400, "Invalid start_date, expected YYYY-MM-DD")
+			return start, end, false
+		}
+		start = t
+	}
+	if value := c.Query("end_date"); value != "" {
+		t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			ErrorResponse(c, 400, "Invalid end_date, expected YYYY-MM-DD")
+			return start, end, false
+		}
+		end = t.AddDate(0, 0, 1)
+	}
+	return start, end, true
+}
+
+// loadWorkloads 统计服务人员（含混合角色）的工作量，personID 非空时只统计该人员
+func loadWorkloads(personID string, start, end time.Time) ([]PersonWorkload, error) {
+	query := config.DB.Where("type IN ?", []models.PersonType{models.PersonTypeServicePerson, models.PersonTypeMixed})
+	if personID != "" {
+		query = query.Where("id = ?", personID)
+	}
+	var people []models.Person
+	if err := query.Order("id ASC").Find(&people).Error; err != nil {
+		return nil, err
+	}
+
+	workloads := make([]PersonWorkload, len(people))
+	index := make(map[uint]*PersonWorkload, len(people))
+	for i, person := range people {
+		workloads[i] = PersonWorkload{
+			PersonID:                person.ID,
+			Name:                    person.Name,
+			CustomersByType:         map[string]int64{},
+			CustomersByTaxpayerType: map[string]int64{},
+		}
+		index[person.ID] = &workloads[i]
+	}
+
+	// 在服务客户数及月度服务费：共同服务的客户计入每位服务人员
+	var customers []models.Customer
+	config.DB.Select("id", "type", "service_person_ids").Where("status IN ?", inServiceCustomerStatuses()).Find(&customers)
+	monthlyFees := activeMonthlyFees()
+	taxpayerTypes, monthlyFilings := customerTaxWorkloads()
+	for _, customer := range customers {
+		taxpayerType := string(taxpayerTypes[customer.ID])
+		if taxpayerType == "" {
+			taxpayerType = workloadNoTaxProfile
+		}
+		for _, id := range StringToIDs(customer.ServicePersonIDs) {
+			if w, ok := index[id]; ok {
+				w.CustomerCount++
+				w.CustomersByType[string(customer.Type)]++
+				w.CustomersByTaxpayerType[taxpayerType]++
+				w.MonthlyFilings += monthlyFilings[customer.ID]
+				w.MonthlyFee += monthlyFees[customer.ID]
+			}
+		}
+	}
+
+	// 未完成任务及逾期任务
+	today := startOfDay(time.Now())
+	var openTasks []models.Task
+	config.DB.Select("assignee_id", "due_date").
+		Where("assignee_id IS NOT NULL").Where(openTaskCondition()).
+		Find(&openTasks)
+	for _, task := range openTasks {
+		if w, ok := index[*task.AssigneeID]; ok {
+			w.OpenTasks++
+			if task.DueDate != nil && task.DueDate.Before(today) {
+				w.OverdueTasks++
+			}
+		}
+	}
+
+	// 统计区间内完成的任务，完成时间不晚于截止日期当天视为按时
+	var completedTasks []models.Task
+	config.DB.Select("assignee_id", "due_date", "completed_at").
+		Where("assignee_id IS NOT NULL AND completed_at >= ? AND completed_at < ?", start, end).
+		Find(&completedTasks)
+	withDueDate := map[uint]int64{}
+	for _, task := range completedTasks {
+		w, ok := index[*task.AssigneeID]
+		if !ok {
+			continue
+		}
+		w.CompletedTasks++
+		if task.DueDate != nil {
+			withDueDate[w.PersonID]++
+			if task.CompletedAt.Before(startOfDay(*task.DueDate).AddDate(0, 0, 1)) {
+				w.OnTimeTasks++
+			}
+		}
+	}
+
+	collected, err := periodCollections(start, end)
+	if err != nil {
+		return nil, err
+	}
+	for id, amount := range collected {
+		if w, ok := index[id]; ok {
+			w.Collected = math.Round(amount*100) / 100
+		}
+	}
+
+	capacities := map[uint]*models.ServiceCapacity{}
+	var rows []models.ServiceCapacity
+	config.DB.Find(&rows)
+	for i := range rows {
+		capacities[rows[i].PersonID] = &rows[i]
+	}
+
+	for i := range workloads {
+		w := &workloads[i]
+		w.MonthlyFee = math.Round(w.MonthlyFee*100) / 100
+		w.MonthlyFilings = math.Round(w.MonthlyFilings*100) / 100
+		if total := withDueDate[w.PersonID]; total > 0 {
+			rate := math.Round(float64(w.OnTimeTasks)*10000/float64(total)) / 100
+			w.OnTimeRate = &rate
+		}
+
+		w.Capacity = capacities[w.PersonID]
+		if w.Capacity == nil {
+			w.Capacity = capacities[0]
+		}
+		if w.Capacity != nil {
+			w.Utilization = capacityUtilization(w.Capacity, w.CustomerCount, w.OpenTasks, w.MonthlyFee)
+			w.AtCapacity = w.Utilization != nil && *w.Utilization >= 100
+		}
+	}
+
+	return workloads, nil
+}
+
+// activeMonthlyFees 按客户汇总有效协议折算到每月的服务费（季度费用/3，年度费用/12），
+// 当月开始的协议另计入其一次性费用
+func activeMonthlyFees() map[uint]float64 {
+	var agreements []models.Agreement
+	config.DB.Select("customer_id", "fee_type", "amount", "one_time_amount", "start_date").
+		Where("status = ?", models.AgreementStatusActive).
+		Find(&agreements)
+
+	month := revenueMonth(time.Now())
+	fees := map[uint]float64{}
+	for _, agreement := range agreements {
+		fees[agreement.CustomerID] += monthlyFee(agreement.FeeType, agreement.Amount)
+		if revenueMonth(agreement.StartDate).Equal(month) {
+			fees[agreement.CustomerID] += agreement.OneTimeAmount
+		}
+	}
+	return fees
+}
+
+// periodCollections 按服务人员汇总 [start, end) 内归属的收款金额，减去同期的退款（按退款日期），
+// 退款按原收款的业绩归属冲减；未设置归属的收款按客户当前服务人员平均分配
+func periodCollections(start, end time.Time) (map[uint]float64, error) {
+	columns := []string{"id", "customer_id", "amount", "attribution_overridden"}
+	var payments []models.Payment
+	if err := config.DB.Select(columns).
+		Where("payment_date >= ? AND payment_date < ?", start, end).Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	var refunds []models.PaymentRefund
+	if err := config.DB.Select("payment_id", "amount").
+		Where("refund_date >= ? AND refund_date < ?", start, end).Find(&refunds).Error; err != nil {
+		return nil, err
+	}
+
+	paymentByID := make(map[uint]models.Payment, len(payments))
+	for _, payment := range payments {
+		paymentByID[payment.ID] = payment
+	}
+	var missing []uint
+	for _, refund := range refunds {
+		if _, ok := paymentByID[refund.PaymentID]; !ok && !containsID(missing, refund.PaymentID) {
+			missing = append(missing, refund.PaymentID)
+		}
+	}
+	if len(missing) > 0 {
+		var earlier []models.Payment
+		if err := config.DB.Select(columns).Where("id IN ?", missing).Find(&earlier).Error; err != nil {
+			return nil, err
+		}
+		for _, payment := range earlier {
+			paymentByID[payment.ID] = payment
+		}
+	}
+	if len(paymentByID) == 0 {
+		return map[uint]float64{}, nil
+	}
+
+	paymentIDs := make([]uint, 0, len(paymentByID))
+	var customerIDs []uint
+	for _, payment := range paymentByID {
+		paymentIDs = append(paymentIDs, payment.ID)
+		customerIDs = appendUniqueID(customerIDs, payment.CustomerID)
+	}
+	var attributions []models.PaymentAttribution
+	if err := config.DB.Where("payment_id IN ?", paymentIDs).Find(&attributions).Error; err != nil {
+		return nil, err
+	}
+	shares := map[uint][]models.PaymentAttribution{}
+	for _, a := range attributions {
+		shares[a.PaymentID] = append(shares[a.PaymentID], a)
+	}
+	var customers []models.Customer
+	if err := config.DB.Select("id", "service_person_ids").Where("id IN ?", customerIDs).Find(&customers).Error; err != nil {
+		return nil, err
+	}
+	servicePersons := make(map[uint][]uint, len(customers))
+	for _, customer := range customers {
+		servicePersons[customer.ID] = StringToIDs(customer.ServicePersonIDs)
+	}
+
+	collected := map[uint]float64{}
+	attribute := func(payment models.Payment, amount float64) {
+		paymentShares := shares[payment.ID]
+		if len(paymentShares) == 0 && !payment.AttributionOverridden {
+			paymentShares = evenShares(servicePersons[payment.CustomerID])
+		}
+		for _, share := range paymentShares {
+			collected[share.PersonID] += amount * share.Share / 100
+		}
+	}
+	for _, payment := range payments {
+		attribute(payment, payment.Amount)
+	}
+	for _, refund := range refunds {
+		attribute(paymentByID[refund.PaymentID], -refund.Amount)
+	}
+	return collected, nil
+}
+
+// customerTaxWorkloads 按客户返回纳税人类型，以及申报义务折算到每月的申报次数（按季/3，按年/12）
+func customerTaxWorkloads() (map[uint]models.TaxpayerType, map[uint]float64) {
+	var profiles []models.CustomerTaxProfile
+	config.DB.Select("customer_id", "taxpayer_type").Find(&profiles)
+	taxpayerTypes := make(map[uint]models.TaxpayerType, len(profiles))
+	for _, profile := range profiles {
+		taxpayerTypes[profile.CustomerID] = profile.TaxpayerType
+	}
+
+	var obligations []models.TaxObligation
+	config.DB.Select("customer_id", "frequency").Find(&obligations)
+	filings := map[uint]float64{}
+	for _, obligation := range obligations {
+		filings[obligation.CustomerID] += monthlyFilingCount(obligation.Frequency)
+	}
+	return taxpayerTypes, filings
+}
+
+// monthlyFee 将协议服务费折算为每月金额
+func monthlyFee(feeType models.FeeType, amount float64) float64 {
+	switch feeType {
+	case models.FeeTypeQuarterly:
+		return amount / 3
+	case models.FeeTypeYearly:
+		return amount / 12
+	}
+	return amount
+}
+
+// capacityUtilization 计算容量使用率（%），取各项已配置上限中最高的比例，均未配置时返回nil
+func capacityUtilization(capacity *models.ServiceCapacity, customers, openTasks int64, monthlyFee float64) *float64 {
+	var ratios []float64
+	if capacity.MaxCustomers > 0 {
+		ratios = append(ratios, float64(customers)/float64(capacity.MaxCustomers))
+	}
+	if capacity.MaxOpenTasks > 0 {
+		ratios = append(ratios, float64(openTasks)/float64(capacity.MaxOpenTasks))
+	}
+	if capacity.MaxMonthlyFee > 0 {
+		ratios = append(ratios, monthlyFee/capacity.MaxMonthlyFee)
+	}
+	if len(ratios) == 0 {
+		return nil
+	}
+
+	highest := ratios[0]
+	for _, r := range ratios[1:] {
+		highest = math.Max(highest, r)
+	}
+	utilization := math.Round(highest*10000) / 100
+	return &utilization
+}
+
+// utilizationValue 未配置上限的使用率按0比较
+func utilizationValue(utilization *float64) float64 {
+	if utilization == nil {
+		return 0
+	}
+	return *utilization
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"erp/config"
+	"erp/controllers"
 	"erp/routes"
+	"erp/services/scheduler"
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,6 +17,45 @@ func main() {
 		log.Fatal("Failed to initialize database:", err)
 	}
 
+	// 为早于业绩归属功能的收款写入归属，使历史提成不随服务人员交接而改变
+	if err := controllers.BackfillPaymentAttributions(); err != nil {
+		log.Fatal("Failed to backfill payment attributions:", err)
+	}
+
+	// 初始化文件存储
+	if err := config.InitStorage(); err != nil {
+		log.Fatal("Failed to initialize storage:", err)
+	}
+
+	// 初始化通知服务
+	config.InitNotification()
+
+	// 初始化Webhook事件推送和实时事件日志
+	config.InitWebhooks()
+	config.InitEvents()
+
+	// 每日定时任务：证照到期提醒、任务/协议到期通知
+	scheduler.RunDaily("credential-expiry-scan", 8, func() error {
+		_, err := controllers.ScanExpiringCredentials()
+		return err
+	})
+	scheduler.RunDaily("notification-event-scan", 8, controllers.ScanNotificationEvents)
+
+	// 每日按任务模板生成当月的周期性任务（已生成的不重复生成）
+	scheduler.RunDaily("task-template-generate", 6, controllers.GenerateAutoTemplateTasks)
+
+	// 每日使到期的协议价格变更生效
+	scheduler.RunDaily("agreement-price-changes", 1, controllers.ApplyDuePriceChanges)
+
+	// 每日清理过期的实时事件日志
+	scheduler.RunDaily("event-log-prune", 3, config.Events.Prune)
+
+	// 每分钟投递邮件/Webhook发件箱
+	scheduler.RunEvery("notification-outbox", time.Minute, config.Notifier.ProcessOutbox)
+
+	// 每10秒投递Webhook事件
+	scheduler.RunEvery("webhook-deliveries", 10*time.Second, config.Webhooks.ProcessPending)
+
 	// 创建Gin实例
 	r := gin.Default()
 
@@ -21,8 +63,9 @@ func main() {
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Person-ID, Last-Event-ID, If-Match")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
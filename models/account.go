@@ -0,0 +1,82 @@
+package models
+
+import "time"
+
+// PaymentMethodBalance 使用客户预存余额抵扣服务费的收款方式
+const PaymentMethodBalance = "余额抵扣"
+
+// AccountEntryType 客户账户流水类型
+type AccountEntryType string
+
+const (
+	AccountEntryDeposit    AccountEntryType = "预存" // 客户预存款项，增加余额
+	AccountEntryAdjustment AccountEntryType = "调整" // 手工调整（如老客户优惠返还、差错更正），金额可正可负
+	AccountEntryWithdrawal AccountEntryType = "退还" // 余额退还给客户，减少余额
+	AccountEntryApply      AccountEntryType = "抵扣" // 余额抵扣服务费，生成收款记录，减少余额
+	AccountEntryRefund     AccountEntryType = "退款" // 收款退款退回余额，增加余额
+)
+
+// PriceChangeKind 协议价格变更类型
+type PriceChangeKind string
+
+const (
+	PriceChangeAdjustment PriceChangeKind = "调价" // 服务费调整（如年中涨价）
+	PriceChangeDiscount   PriceChangeKind = "优惠" // 优惠折扣，变更后金额不能高于变更前
+)
+
+// PriceChangeStatus 协议价格变更状态
+type PriceChangeStatus string
+
+const (
+	PriceChangePending PriceChangeStatus = "待生效" // 生效日期未到
+	PriceChangeApplied PriceChangeStatus = "已生效" // 已更新协议金额
+)
+
+// CustomerAccountEntry 客户账户流水，金额增加余额为正、减少余额为负
+type CustomerAccountEntry struct {
+	ID            uint             `json:"id" gorm:"primaryKey"`
+	CustomerID    uint             `json:"customer_id" gorm:"not null;index"` // 客户
+	Type          AccountEntryType `json:"type" gorm:"not null"`              // 流水类型
+	Amount        float64          `json:"amount" gorm:"not null"`            // 金额，正数增加余额、负数减少余额
+	Balance       float64          `json:"balance" gorm:"not null"`           // 本笔流水后的余额
+	EntryDate     time.Time        `json:"entry_date"`                        // 业务日期
+	PaymentMethod string           `json:"payment_method"`                    // 预存/退还的收付款方式
+	PaymentID     *uint            `json:"payment_id" gorm:"index"`           // 抵扣生成的收款记录，或退款对应的收款记录
+	RefundID      *uint            `json:"refund_id"`                         // 退回余额的退款记录
+	Remark        string           `json:"remark"`                            // 说明
+	OperatorID    *uint            `json:"operator_id"`                       // 操作人
+	CreatedAt     time.Time        `json:"created_at"`
+}
+
+// PaymentRefund 收款退款记录
+type PaymentRefund struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	PaymentID  uint      `json:"payment_id" gorm:"not null;index"` // 收款记录
+	CustomerID uint      `json:"customer_id" gorm:"not null;index"`
+	Amount     float64   `json:"amount" gorm:"not null"` // 退款金额
+	RefundDate time.Time `json:"refund_date"`            // 退款日期
+	Method     string    `json:"method"`                 // 退款方式（转账/现金），退回余额时为余额抵扣
+	ToBalance  bool      `json:"to_balance"`             // 是否退回客户账户余额
+	Reason     string    `json:"reason" gorm:"not null"` // 退款原因
+	OperatorID *uint     `json:"operator_id"`            // 操作人
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AgreementPriceChange 协议价格变更，生效日期到达后更新协议金额
+// 协议有明细时调整指定明细的单价和优惠，协议金额按明细重新计算
+type AgreementPriceChange struct {
+	ID              uint              `json:"id" gorm:"primaryKey"`
+	AgreementID     uint              `json:"agreement_id" gorm:"not null;index"` // 协议
+	AgreementItemID *uint             `json:"agreement_item_id"`                  // 调整的协议明细，协议无明细时为空
+	Kind            PriceChangeKind   `json:"kind" gorm:"not null"`               // 调价/优惠
+	EffectiveDate   time.Time         `json:"effective_date"`                     // 生效日期，当日开始的服务月按新价格确认收入
+	OldAmount       float64           `json:"old_amount"`                         // 变更前协议金额（每个收费周期）
+	NewAmount       float64           `json:"new_amount"`                         // 变更后协议金额
+	UnitPrice       *float64          `json:"unit_price"`                         // 明细变更后的单价
+	Discount        *float64          `json:"discount"`                           // 明细变更后的优惠
+	Reason          string            `json:"reason"`                             // 变更原因
+	Status          PriceChangeStatus `json:"status" gorm:"not null;default:待生效"` // 状态
+	AppliedAt       *time.Time        `json:"applied_at"`                         // 生效时间
+	OperatorID      *uint             `json:"operator_id"`                        // 操作人
+	CreatedAt       time.Time         `json:"created_at"`
+}
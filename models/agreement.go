@@ -9,6 +9,7 @@ const (
 	FeeTypeMonthly   FeeType = "月度"   // 月度
 	FeeTypeQuarterly  FeeType = "季度"   // 季度
 	FeeTypeYearly    FeeType = "年度"   // 年度
+	FeeTypeOneTime   FeeType = "一次性" // 一次性收费，仅用于协议明细和报价明细（如工商注册）
 )
 
 // AgreementStatus 协议状态
@@ -28,12 +29,29 @@ type Agreement struct {
 	StartDate       time.Time        `json:"start_date"`                    // 协议开始日期
 	EndDate         time.Time        `json:"end_date"`                      // 协议结束日期
 	FeeType         FeeType          `json:"fee_type"`                      // 收费类型
-	Amount          float64          `json:"amount"`                        // 服务费金额
+	Amount          float64          `json:"amount"`                        // 服务费金额，有明细时为周期性明细按收费类型折算的合计
+	OneTimeAmount   float64          `json:"one_time_amount"`               // 一次性费用合计，由明细计算
 	Status          AgreementStatus  `json:"status"`                        // 协议状态
+	Version         uint             `json:"version" gorm:"not null;default:1"` // 版本号（乐观锁）
 	CreatedAt       time.Time        `json:"created_at"`
 	UpdatedAt       time.Time        `json:"updated_at"`
 
 	// 关联
 	Customer *Customer `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
 	Payments []Payment `json:"payments,omitempty" gorm:"foreignKey:AgreementID"`
+	Items    []AgreementItem `json:"items,omitempty" gorm:"foreignKey:AgreementID"`
+}
+
+// AgreementItem 协议明细，每项服务有各自的收费周期、数量、单价和优惠
+type AgreementItem struct {
+	ID             uint    `json:"id" gorm:"primaryKey"`
+	AgreementID    uint    `json:"agreement_id" gorm:"not null;index"` // 协议
+	ServicePriceID *uint   `json:"service_price_id"`                   // 服务目录项目，自定义项目为空
+	Name           string  `json:"name" gorm:"not null"`               // 服务项目
+	Description    string  `json:"description"`                        // 说明
+	FeeType        FeeType `json:"fee_type" gorm:"not null"`           // 收费周期（月度/季度/年度/一次性）
+	Quantity       float64 `json:"quantity" gorm:"not null"`           // 数量
+	UnitPrice      float64 `json:"unit_price" gorm:"not null"`         // 每个收费周期的单价
+	Discount       float64 `json:"discount"`                           // 优惠金额（每个收费周期）
+	Amount         float64 `json:"amount" gorm:"not null"`             // 金额 = 数量 × 单价 - 优惠
 }
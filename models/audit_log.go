@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// AuditLog 操作日志，记录批量操作等对数据的修改
+type AuditLog struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	BatchID    string         `json:"batch_id" gorm:"index"`                     // 批次ID，同一次批量操作的日志相同
+	OperatorID *uint          `json:"operator_id" gorm:"index"`                  // 操作人
+	Action     string         `json:"action" gorm:"not null"`                    // 操作，如 customer.replace_service_person
+	EntityType string         `json:"entity_type" gorm:"index:idx_audit_entity"` // 对象类型：customer/task/payment
+	EntityID   uint           `json:"entity_id" gorm:"index:idx_audit_entity"`   // 对象ID
+	Before     datatypes.JSON `json:"before"`                                    // 修改前的字段值
+	After      datatypes.JSON `json:"after"`                                     // 修改后的字段值，删除时为空
+	CreatedAt  time.Time      `json:"created_at" gorm:"index"`
+}
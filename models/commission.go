@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// AgreementKind 协议签约类型
+type AgreementKind string
+
+const (
+	AgreementKindNew     AgreementKind = "新签" // 客户的首份协议
+	AgreementKindRenewal AgreementKind = "续签" // 客户已有更早开始的协议
+)
+
+// CommissionRule 提成规则，条件为空表示不限
+// 收款匹配收款日期在有效期内的规则，匹配多条时取条件最多的规则，条件数相同时取优先级高者
+// 已适用于以前月份的规则不能修改比例和条件，需设置失效日期后新建规则
+type CommissionRule struct {
+	ID            uint          `json:"id" gorm:"primaryKey"`
+	Name          string        `json:"name" gorm:"not null"`              // 规则名称
+	CustomerType  CustomerType  `json:"customer_type"`                     // 客户类型
+	FeeType       FeeType       `json:"fee_type"`                          // 协议收费类型
+	AgreementKind AgreementKind `json:"agreement_kind"`                    // 新签/续签
+	Rate          float64       `json:"rate" gorm:"not null"`              // 提成比例（%）
+	Priority      int           `json:"priority"`                          // 优先级，越大越优先
+	Remark        string        `json:"remark"`                            // 备注
+	EffectiveFrom *time.Time    `json:"effective_from"`                    // 生效日期，按收款日期匹配；为空表示不限（早于生效日期设置前的规则）
+	EffectiveTo   *time.Time    `json:"effective_to"`                      // 失效日期（含当天），为空表示长期有效
+	Version       uint          `json:"version" gorm:"not null;default:1"` // 版本号（乐观锁）
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+// PaymentAttribution 收款的业绩归属，同一笔收款可按比例分给多名服务人员
+type PaymentAttribution struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	PaymentID uint      `json:"payment_id" gorm:"not null;uniqueIndex:idx_payment_attribution"`      // 收款记录
+	PersonID  uint      `json:"person_id" gorm:"not null;uniqueIndex:idx_payment_attribution;index"` // 服务人员
+	Share     float64   `json:"share" gorm:"not null"`                                               // 分成比例（%），同一笔收款合计100
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// 关联
+	Person *Person `json:"person,omitempty" gorm:"foreignKey:PersonID"`
+}
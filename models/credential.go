@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// CredentialType 证照类型
+type CredentialType string
+
+const (
+	CredentialTypeBusinessLicense CredentialType = "营业执照"
+	CredentialTypeTaxCertificate  CredentialType = "税务数字证书" // CA证书/UKey
+	CredentialTypeIDCard          CredentialType = "身份证"
+	CredentialTypeOther           CredentialType = "其他"
+)
+
+// DefaultCredentialReminderDays 默认提前提醒天数
+const DefaultCredentialReminderDays = 30
+
+// Credential 证照记录（营业执照、税务数字证书、身份证等），归属于客户或人员
+type Credential struct {
+	ID             uint              `json:"id" gorm:"primaryKey"`
+	OwnerType      DocumentOwnerType `json:"owner_type" gorm:"not null;index:idx_credential_owner"` // 归属对象类型（客户/人员）
+	OwnerID        uint              `json:"owner_id" gorm:"not null;index:idx_credential_owner"`   // 归属对象ID
+	Type           CredentialType    `json:"type" gorm:"not null"`                                  // 证照类型
+	Name           string            `json:"name"`                                                  // 名称，如「电子税务局CA证书」
+	Number         string            `json:"number"`                                                // 证照编号
+	IssueDate      *time.Time        `json:"issue_date"`                                            // 签发日期
+	ExpiryDate     time.Time         `json:"expiry_date" gorm:"not null;index"`                     // 到期日期
+	ReminderDays   int               `json:"reminder_days"`                                         // 提前提醒天数
+	CustomerID     *uint             `json:"customer_id"`                                           // 人员证照的提醒任务关联的客户，未指定时取其担任法人的首个企业
+	DocumentID     *uint             `json:"document_id"`                                           // 关联的扫描件文档
+	ReminderTaskID *uint             `json:"reminder_task_id"`                                      // 已生成的提醒任务，到期日期变更后清空
+	Remark         string            `json:"remark"`                                                // 备注
+	Version        uint              `json:"version" gorm:"not null;default:1"`                     // 版本号（乐观锁）
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
+
+// ExpiryReminderSource 到期提醒的来源
+const (
+	ExpiryReminderSourceCredential = "credential" // 证照，来源ID为证照ID
+	ExpiryReminderSourceDocument   = "document"   // 文档，来源ID为文档组ID（各版本共用）
+)
+
+// ExpiryReminder 已生成的到期提醒，按 来源+到期日期 唯一，防止重复扫描生成重复的提醒任务
+type ExpiryReminder struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	SourceType string    `json:"source_type" gorm:"not null;uniqueIndex:idx_expiry_reminder"` // 来源类型
+	SourceID   uint      `json:"source_id" gorm:"not null;uniqueIndex:idx_expiry_reminder"`   // 来源ID
+	ExpiryDate string    `json:"expiry_date" gorm:"not null;uniqueIndex:idx_expiry_reminder"` // 提醒的到期日期（YYYY-MM-DD）
+	TaskID     *uint     `json:"task_id" gorm:"index"`                                        // 提醒任务
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -1,27 +1,58 @@
 package models
 
 import (
-	"time"
 	"gorm.io/datatypes"
+	"time"
 )
 
 // CustomerType 客户类型
 type CustomerType string
 
 const (
-	CustomerTypeLimitedCompany     CustomerType = "有限公司"      // 有限公司
-	CustomerTypeSoleProprietorship CustomerType = "个人独资企业"  // 个人独资企业
-	CustomerTypePartnership        CustomerType = "合伙企业"          // 合伙企业
+	CustomerTypeLimitedCompany     CustomerType = "有限公司"   // 有限公司
+	CustomerTypeSoleProprietorship CustomerType = "个人独资企业" // 个人独资企业
+	CustomerTypePartnership        CustomerType = "合伙企业"   // 合伙企业
 	CustomerTypeIndividualBusiness CustomerType = "个体工商户"  // 个体工商户
 )
 
+// CustomerStatus 客户生命周期状态
+type CustomerStatus string
+
+const (
+	CustomerStatusProspect   CustomerStatus = "潜在客户" // 尚未签约
+	CustomerStatusOnboarding CustomerStatus = "建账中"  // 已签约，正在交接资料、建账
+	CustomerStatusActive     CustomerStatus = "服务中"  // 正常服务
+	CustomerStatusSuspended  CustomerStatus = "暂停服务" // 暂停服务（如欠费、停业）
+	CustomerStatusTerminated CustomerStatus = "已终止"  // 终止合作
+)
+
+// InvestorType 投资人类型
+type InvestorType string
+
+const (
+	InvestorTypePerson   InvestorType = "自然人"   // 自然人（Person）
+	InvestorTypeCustomer InvestorType = "本系统客户" // 企业股东，且为本系统客户（Customer）
+	InvestorTypeEntity   InvestorType = "外部法人"  // 企业股东，非本系统客户（LegalEntity）
+)
+
 // InvestorInfo 投资人信息（JSON结构）
 type InvestorInfo struct {
-	PersonID          uint              `json:"person_id"`
-	ShareRatio        float64           `json:"share_ratio"`         // 持股比例
+	InvestorType      InvestorType       `json:"investor_type,omitempty"` // 投资人类型，为空时视为自然人
+	PersonID          uint               `json:"person_id"`
+	CustomerID        uint               `json:"customer_id,omitempty"`        // 企业股东为本系统客户时的客户ID
+	EntityID          uint               `json:"entity_id,omitempty"`          // 企业股东为外部法人时的实体ID
+	ShareRatio        float64            `json:"share_ratio"`                  // 持股比例
 	InvestmentRecords []InvestmentRecord `json:"investment_records,omitempty"` // 出资记录（可选）
 }
 
+// ResolvedType 返回投资人类型，未指定时按自然人处理（兼容旧数据）
+func (i InvestorInfo) ResolvedType() InvestorType {
+	if i.InvestorType == "" {
+		return InvestorTypePerson
+	}
+	return i.InvestorType
+}
+
 // InvestmentRecord 出资记录
 type InvestmentRecord struct {
 	Date   string  `json:"date"`   // 出资日期
@@ -30,27 +61,51 @@ type InvestmentRecord struct {
 
 // Customer 客户信息
 type Customer struct {
-	ID                uint          `json:"id" gorm:"primaryKey"`
-	Name              string        `json:"name" gorm:"not null"` // 公司名称/个人姓名
-	Phone             string        `json:"phone"`                // 联系电话
-	Address           string        `json:"address"`              // 地址
-	TaxNumber         string        `json:"tax_number"`           // 税号
-	Type              CustomerType  `json:"type" gorm:"not null"` // 客户类型
-	RepresentativeID  *uint         `json:"representative_id"`    // 法定代表人ID
-	Investors         datatypes.JSON `json:"investors"`           // 投资人JSON数组
-	ServicePersonIDs  string        `json:"service_person_ids"`  // 服务人员ID，逗号分隔: "5,6"
-	AgreementIDs      string        `json:"agreement_ids"`       // 代理协议ID，逗号分隔: "1,3,5"
-	RegisteredCapital float64      `json:"registered_capital"`   // 注册资本
-	CreatedAt         time.Time     `json:"created_at"`
-	UpdatedAt         time.Time     `json:"updated_at"`
+	ID                  uint           `json:"id" gorm:"primaryKey"`
+	Name                string         `json:"name" gorm:"not null"`                     // 公司名称/个人姓名
+	Phone               string         `json:"phone"`                                    // 联系电话
+	Address             string         `json:"address"`                                  // 地址
+	TaxNumber           string         `json:"tax_number"`                               // 税号
+	Type                CustomerType   `json:"type" gorm:"not null"`                     // 客户类型
+	RepresentativeID    *uint          `json:"representative_id"`                        // 法定代表人ID
+	Investors           datatypes.JSON `json:"investors"`                                // 投资人JSON数组
+	ServicePersonIDs    string         `json:"service_person_ids"`                       // 服务人员ID，逗号分隔: "5,6"
+	AgreementIDs        string         `json:"agreement_ids"`                            // 代理协议ID，逗号分隔: "1,3,5"
+	InvestedCustomerIDs string         `json:"invested_customer_ids"`                    // 作为企业股东持股的客户ID，逗号分隔: "2,9"
+	RegisteredCapital   float64        `json:"registered_capital"`                       // 注册资本
+	Status              CustomerStatus `json:"status" gorm:"not null;default:服务中;index"` // 生命周期状态
+	StatusChangedAt     *time.Time     `json:"status_changed_at"`                        // 当前状态的生效日期
+	Version             uint           `json:"version" gorm:"not null;default:1"`        // 版本号（乐观锁）
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
 
 	// 关联（通过查询加载，不存储在数据库）
-	Representative *Person     `json:"representative,omitempty" gorm:"-"`
-	InvestorList   []Person    `json:"investor_list,omitempty" gorm:"-"`
-	ServicePersons []Person    `json:"service_persons,omitempty" gorm:"-"`
-	Agreements     []Agreement `json:"agreements_list,omitempty" gorm:"-"`
+	Representative     *Person       `json:"representative,omitempty" gorm:"-"`
+	InvestorList       []Person      `json:"investor_list,omitempty" gorm:"-"`
+	CorporateInvestors []Customer    `json:"corporate_investor_list,omitempty" gorm:"-"`
+	EntityInvestors    []LegalEntity `json:"entity_investor_list,omitempty" gorm:"-"`
+	ServicePersons     []Person      `json:"service_persons,omitempty" gorm:"-"`
+	Agreements         []Agreement   `json:"agreements_list,omitempty" gorm:"-"`
 
 	// 原有关联
-	Tasks    []Task    `json:"tasks,omitempty" gorm:"foreignKey:CustomerID"`
-	Payments []Payment `json:"payments,omitempty" gorm:"foreignKey:CustomerID"`
+	Tasks      []Task              `json:"tasks,omitempty" gorm:"foreignKey:CustomerID"`
+	Payments   []Payment           `json:"payments,omitempty" gorm:"foreignKey:CustomerID"`
+	TaxProfile *CustomerTaxProfile `json:"tax_profile,omitempty" gorm:"foreignKey:CustomerID"`
+}
+
+// CustomerStatusChange 客户状态变更记录，EffectiveDate 为业务上的生效日期（可早于记录时间）
+type CustomerStatusChange struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	CustomerID      uint           `json:"customer_id" gorm:"not null;index"`    // 客户
+	FromStatus      CustomerStatus `json:"from_status"`                          // 原状态，新建客户时为空
+	ToStatus        CustomerStatus `json:"to_status" gorm:"not null"`            // 新状态
+	EffectiveDate   time.Time      `json:"effective_date" gorm:"not null;index"` // 生效日期
+	Reason          string         `json:"reason"`                               // 原因
+	OperatorID      *uint          `json:"operator_id"`                          // 操作人
+	EndedAgreements int            `json:"ended_agreements"`                     // 终止时自动结束/取消的协议数
+	CancelledTasks  int            `json:"cancelled_tasks"`                      // 终止时自动取消的任务数
+	CreatedAt       time.Time      `json:"created_at"`
+
+	// 关联
+	Operator *Person `json:"operator,omitempty" gorm:"foreignKey:OperatorID"`
 }
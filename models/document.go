@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// DocumentOwnerType 文档归属对象类型
+type DocumentOwnerType string
+
+const (
+	DocumentOwnerCustomer  DocumentOwnerType = "客户" // Customer
+	DocumentOwnerAgreement DocumentOwnerType = "协议" // Agreement
+	DocumentOwnerPerson    DocumentOwnerType = "人员" // Person
+)
+
+// DocumentCategory 文档分类
+type DocumentCategory string
+
+const (
+	DocumentCategoryBusinessLicense DocumentCategory = "营业执照"
+	DocumentCategoryAgreement       DocumentCategory = "签约协议"
+	DocumentCategoryIDCard          DocumentCategory = "身份证"
+	DocumentCategoryTaxCertificate  DocumentCategory = "税务证明"
+	DocumentCategoryOther           DocumentCategory = "其他"
+)
+
+// DocumentCategories 所有文档分类
+var DocumentCategories = []DocumentCategory{
+	DocumentCategoryBusinessLicense,
+	DocumentCategoryAgreement,
+	DocumentCategoryIDCard,
+	DocumentCategoryTaxCertificate,
+	DocumentCategoryOther,
+}
+
+// Document 文档（每个版本一条记录，同一文档的各版本共享 GroupID）
+type Document struct {
+	ID          uint              `json:"id" gorm:"primaryKey"`
+	GroupID     uint              `json:"group_id" gorm:"index"`                               // 文档ID（首个版本的ID）
+	Version     int               `json:"version" gorm:"not null;default:1"`                   // 版本号，从1开始
+	IsLatest    bool              `json:"is_latest" gorm:"index"`                              // 是否为最新版本
+	OwnerType   DocumentOwnerType `json:"owner_type" gorm:"not null;index:idx_document_owner"` // 归属对象类型
+	OwnerID     uint              `json:"owner_id" gorm:"not null;index:idx_document_owner"`   // 归属对象ID
+	Category    DocumentCategory  `json:"category" gorm:"not null"`                            // 分类
+	Title       string            `json:"title"`                                               // 标题
+	FileName    string            `json:"file_name"`                                           // 原始文件名
+	ContentType string            `json:"content_type"`                                        // 文件类型
+	Size        int64             `json:"size"`                                                // 文件大小（字节）
+	SHA256      string            `json:"sha256" gorm:"index"`                                 // 文件内容摘要，用于去重
+	StorageKey  string            `json:"-"`                                                   // 存储后端中的对象key
+	ExpiryDate  *time.Time        `json:"expiry_date"`                                         // 到期日期（证照有效期）
+	Remark      string            `json:"remark"`                                              // 备注
+	UploadedBy  *uint             `json:"uploaded_by"`                                         // 上传人
+	Revision    uint              `json:"revision" gorm:"not null;default:1"`                  // 元数据修订号（乐观锁）
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// EventLog 实时事件日志，供 SSE 推送和断线续传（Last-Event-ID）使用
+type EventLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"` // 事件ID，即 SSE 的 id
+	Type       string    `json:"type" gorm:"not null"` // 事件类型，与 Webhook 事件相同，如 customer.updated
+	EntityType string    `json:"entity_type"`          // 对象类型：customer/agreement/payment/task/import
+	EntityID   uint      `json:"entity_id"`            // 对象ID
+	CustomerID uint      `json:"customer_id"`          // 所属客户ID
+	PersonIDs  string    `json:"person_ids"`           // 可见人员ID，格式 ",5,6,"
+	Broadcast  bool      `json:"broadcast"`            // 是否所有人可见（不属于具体客户的事件，如导入完成）
+	Data       string    `json:"data"`                 // 对象JSON
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// HandoverStatus 交接状态
+type HandoverStatus string
+
+const (
+	HandoverStatusInProgress HandoverStatus = "进行中" // 已转移客户和任务，交接清单未全部确认
+	HandoverStatusCompleted  HandoverStatus = "已完成" // 交接清单已全部确认
+)
+
+// HandoverItemType 交接清单项类型
+type HandoverItemType string
+
+const (
+	HandoverItemCustomer   HandoverItemType = "客户" // Customer
+	HandoverItemTask       HandoverItemType = "任务" // Task
+	HandoverItemDocument   HandoverItemType = "文档" // Document
+	HandoverItemCredential HandoverItemType = "证照" // Credential
+)
+
+// Handover 服务人员工作交接记录（离职、调岗时将其客户和未完成任务转给接手人员）
+type Handover struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	FromPersonID    uint           `json:"from_person_id" gorm:"not null;index"` // 移交人
+	SuccessorIDs    string         `json:"successor_ids"`                        // 接手人员ID，逗号分隔: "5,6"
+	Reason          string         `json:"reason"`                               // 交接原因
+	OperatorID      *uint          `json:"operator_id"`                          // 操作人
+	BatchID         string         `json:"batch_id" gorm:"index"`                // 操作日志批次号
+	CustomerCount   int            `json:"customer_count"`                       // 转移的客户数
+	TaskCount       int            `json:"task_count"`                           // 转移的任务数
+	DocumentCount   int            `json:"document_count"`                       // 需移交的文档数
+	CredentialCount int            `json:"credential_count"`                     // 需移交的证照数
+	Status          HandoverStatus `json:"status" gorm:"not null"`               // 交接状态
+	CompletedAt     *time.Time     `json:"completed_at"`                         // 清单全部确认的时间
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+
+	// 关联
+	FromPerson *Person        `json:"from_person,omitempty" gorm:"foreignKey:FromPersonID"`
+	Items      []HandoverItem `json:"items,omitempty" gorm:"foreignKey:HandoverID"`
+}
+
+// HandoverItem 交接清单项
+type HandoverItem struct {
+	ID          uint             `json:"id" gorm:"primaryKey"`
+	HandoverID  uint             `json:"handover_id" gorm:"not null;index"` // 关联交接记录
+	ItemType    HandoverItemType `json:"item_type" gorm:"not null"`         // 类型
+	EntityID    uint             `json:"entity_id"`                         // 客户/任务/文档/证照ID
+	CustomerID  uint             `json:"customer_id"`                       // 所属客户
+	ToPersonID  uint             `json:"to_person_id" gorm:"index"`         // 接手人
+	Title       string           `json:"title" gorm:"not null"`             // 检查项内容
+	SortOrder   int              `json:"sort_order"`                        // 排序（升序）
+	Completed   bool             `json:"completed"`                         // 是否已确认
+	CompletedAt *time.Time       `json:"completed_at"`                      // 确认时间
+	CompletedBy *uint            `json:"completed_by"`                      // 确认人
+	Version     uint             `json:"version" gorm:"not null;default:1"` // 版本号（乐观锁）
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
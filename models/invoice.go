@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// InvoiceType 发票类型
+type InvoiceType string
+
+const (
+	InvoiceTypeNormal  InvoiceType = "普票" // 增值税普通发票
+	InvoiceTypeSpecial InvoiceType = "专票" // 增值税专用发票
+)
+
+// InvoiceStatus 发票状态
+type InvoiceStatus string
+
+const (
+	InvoiceStatusIssued   InvoiceStatus = "已开具" // 正常
+	InvoiceStatusVoided   InvoiceStatus = "已作废" // 作废，不再计入开票金额
+	InvoiceStatusReversed InvoiceStatus = "已红冲" // 已开具红字发票冲销，不再计入开票金额
+)
+
+// Invoice 发票记录，通过 InvoicePayment 与收款多对多关联，通过 invoice_agreements 与协议多对多关联
+type Invoice struct {
+	ID             uint          `json:"id" gorm:"primaryKey"`
+	InvoiceCode    string        `json:"invoice_code" gorm:"uniqueIndex:idx_invoice_code_number"`            // 发票代码，数电票为空
+	InvoiceNumber  string        `json:"invoice_number" gorm:"not null;uniqueIndex:idx_invoice_code_number"` // 发票号码（数电票为20位号码）
+	Type           InvoiceType   `json:"type" gorm:"not null"`                                               // 普票/专票
+	CustomerID     uint          `json:"customer_id" gorm:"not null;index"`                                  // 客户
+	BuyerName      string        `json:"buyer_name"`                                                         // 购买方名称，默认客户名称
+	BuyerTaxNumber string        `json:"buyer_tax_number"`                                                   // 购买方纳税人识别号，默认客户税号
+	Amount         float64       `json:"amount" gorm:"not null"`                                             // 价税合计
+	TaxRate        float64       `json:"tax_rate"`                                                           // 税率，如 0.06
+	TaxAmount      float64       `json:"tax_amount"`                                                         // 税额
+	PretaxAmount   float64       `json:"pretax_amount"`                                                      // 不含税金额
+	IssueDate      time.Time     `json:"issue_date"`                                                         // 开票日期
+	Status         InvoiceStatus `json:"status" gorm:"not null;default:已开具"`                                 // 状态
+	Remark         string        `json:"remark"`                                                             // 备注
+	OperatorID     *uint         `json:"operator_id"`                                                        // 登记人
+	Version        uint          `json:"version" gorm:"not null;default:1"`                                  // 版本号（乐观锁）
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+
+	// 关联
+	Customer   *Customer        `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+	Payments   []InvoicePayment `json:"payments,omitempty" gorm:"foreignKey:InvoiceID"`
+	Agreements []Agreement      `json:"agreements,omitempty" gorm:"many2many:invoice_agreements"`
+}
+
+// InvoicePayment 发票与收款的关联，记录本张发票开具的该笔收款金额
+// 一张发票可对应多笔收款，一笔收款也可分多张发票开具
+type InvoicePayment struct {
+	InvoiceID uint    `json:"invoice_id" gorm:"primaryKey;autoIncrement:false"`
+	PaymentID uint    `json:"payment_id" gorm:"primaryKey;autoIncrement:false;index"`
+	Amount    float64 `json:"amount" gorm:"not null"` // 对应金额
+
+	Payment *Payment `json:"payment,omitempty" gorm:"foreignKey:PaymentID"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// LegalEntity 外部法人实体（不是本系统客户的企业股东）
+type LegalEntity struct {
+	ID                  uint      `json:"id" gorm:"primaryKey"`
+	Name                string    `json:"name" gorm:"not null"`              // 企业名称
+	CreditCode          string    `json:"credit_code" gorm:"unique"`         // 统一社会信用代码
+	Remark              string    `json:"remark"`                            // 备注
+	InvestorCustomerIDs string    `json:"investor_customer_ids"`             // 持股的企业ID，逗号分隔: "1,2,3"
+	Version             uint      `json:"version" gorm:"not null;default:1"` // 版本号（乐观锁）
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
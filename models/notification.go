@@ -0,0 +1,104 @@
+package models
+
+import "time"
+
+// NotificationEvent 通知事件
+type NotificationEvent string
+
+const (
+	NotificationEventTaskDueSoon       NotificationEvent = "task_due_soon"      // 任务3天后到期
+	NotificationEventTaskOverdue       NotificationEvent = "task_overdue"       // 任务已逾期
+	NotificationEventAgreementExpiring NotificationEvent = "agreement_expiring" // 协议即将到期
+	NotificationEventPaymentRecorded   NotificationEvent = "payment_recorded"   // 登记收款
+	NotificationEventHandoverReceived  NotificationEvent = "handover_received"  // 接手其他服务人员的工作
+)
+
+// NotificationEvents 所有通知事件
+var NotificationEvents = []NotificationEvent{
+	NotificationEventTaskDueSoon,
+	NotificationEventTaskOverdue,
+	NotificationEventAgreementExpiring,
+	NotificationEventPaymentRecorded,
+	NotificationEventHandoverReceived,
+}
+
+// NotificationChannel 通知渠道
+type NotificationChannel string
+
+const (
+	NotificationChannelInbox   NotificationChannel = "inbox"   // 站内信
+	NotificationChannelEmail   NotificationChannel = "email"   // 邮件（SMTP）
+	NotificationChannelWebhook NotificationChannel = "webhook" // Webhook
+)
+
+// NotificationEventAll 表示对所有事件生效的偏好设置
+const NotificationEventAll NotificationEvent = "*"
+
+// Notification 站内信
+type Notification struct {
+	ID        uint              `json:"id" gorm:"primaryKey"`
+	PersonID  uint              `json:"person_id" gorm:"not null;index"` // 接收人
+	Event     NotificationEvent `json:"event"`                           // 事件
+	Title     string            `json:"title"`                           // 标题
+	Content   string            `json:"content"`                         // 内容
+	RefType   string            `json:"ref_type"`                        // 关联对象类型：task/agreement/payment
+	RefID     uint              `json:"ref_id"`                          // 关联对象ID
+	Read      bool              `json:"read" gorm:"index"`               // 是否已读
+	ReadAt    *time.Time        `json:"read_at"`                         // 阅读时间
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// NotificationPreference 人员通知偏好，Event 为 "*" 时作为该人员所有事件的默认设置
+type NotificationPreference struct {
+	ID         uint              `json:"id" gorm:"primaryKey"`
+	PersonID   uint              `json:"person_id" gorm:"not null;uniqueIndex:idx_notification_preference"` // 人员
+	Event      NotificationEvent `json:"event" gorm:"not null;uniqueIndex:idx_notification_preference"`     // 事件
+	Channels   string            `json:"channels"`                                                          // 接收渠道，逗号分隔: "inbox,email"，为空表示不接收
+	WebhookURL string            `json:"webhook_url"`                                                       // webhook 渠道的推送地址
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// NotificationTemplate 通知模板（覆盖内置模板），使用 Go text/template 语法
+type NotificationTemplate struct {
+	ID        uint              `json:"id" gorm:"primaryKey"`
+	Event     NotificationEvent `json:"event" gorm:"not null;uniqueIndex"` // 事件
+	Subject   string            `json:"subject"`                           // 标题模板
+	Body      string            `json:"body"`                              // 正文模板
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// OutboxStatus 发件箱状态
+type OutboxStatus string
+
+const (
+	OutboxStatusPending OutboxStatus = "pending" // 待发送（含等待重试）
+	OutboxStatusSent    OutboxStatus = "sent"    // 已发送
+	OutboxStatusFailed  OutboxStatus = "failed"  // 重试次数用尽
+)
+
+// NotificationOutbox 待投递的邮件/Webhook通知
+type NotificationOutbox struct {
+	ID            uint                `json:"id" gorm:"primaryKey"`
+	Channel       NotificationChannel `json:"channel" gorm:"not null"`      // 渠道：email/webhook
+	PersonID      uint                `json:"person_id" gorm:"index"`       // 接收人
+	Event         NotificationEvent   `json:"event"`                        // 事件
+	Recipient     string              `json:"recipient"`                    // 邮箱地址或Webhook地址
+	Subject       string              `json:"subject"`                      // 标题
+	Body          string              `json:"body"`                         // 正文（webhook为JSON）
+	Status        OutboxStatus        `json:"status" gorm:"not null;index"` // 状态
+	Attempts      int                 `json:"attempts"`                     // 已尝试次数
+	NextAttemptAt time.Time           `json:"next_attempt_at" gorm:"index"` // 下次尝试时间
+	LastError     string              `json:"last_error"`                   // 最近一次失败原因
+	SentAt        *time.Time          `json:"sent_at"`                      // 发送成功时间
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+}
+
+// NotificationDispatch 已触发的事件通知记录，用于避免定时扫描重复通知
+type NotificationDispatch struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	DedupKey  string    `json:"dedup_key" gorm:"not null;uniqueIndex"` // 如 task_due_soon:12:2024-02-15:5
+	CreatedAt time.Time `json:"created_at"`
+}
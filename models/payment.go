@@ -4,18 +4,22 @@ import "time"
 
 // Payment 收款记录
 type Payment struct {
-	ID            uint      `json:"id" gorm:"primaryKey"`
-	CustomerID    uint      `json:"customer_id" gorm:"not null"` // 关联客户
-	AgreementID   uint      `json:"agreement_id"`                // 关联协议 (可选)
-	Amount        float64   `json:"amount" gorm:"not null"`      // 收款金额
-	PaymentDate   time.Time `json:"payment_date"`                // 收款日期
-	PaymentMethod string    `json:"payment_method"`              // 收款方式 (转账/现金/支票)
-	Period        string    `json:"period"`                      // 费用所属期间 (如: 2024-01)
-	Remark        string    `json:"remark"`                      // 备注
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID                    uint      `json:"id" gorm:"primaryKey"`
+	CustomerID            uint      `json:"customer_id" gorm:"not null"`       // 关联客户
+	AgreementID           uint      `json:"agreement_id"`                      // 关联协议 (可选)
+	Amount                float64   `json:"amount" gorm:"not null"`            // 收款金额
+	RefundedAmount        float64   `json:"refunded_amount"`                   // 已退款金额，由退款记录汇总
+	AttributionOverridden bool      `json:"attribution_overridden"`            // 业绩归属已手动设置（可为空，即不归属任何人），不再按服务人员自动分配
+	PaymentDate           time.Time `json:"payment_date"`                      // 收款日期
+	PaymentMethod         string    `json:"payment_method"`                    // 收款方式 (转账/现金/支票/余额抵扣)
+	Period                string    `json:"period"`                            // 费用所属期间 (如: 2024-01)
+	Remark                string    `json:"remark"`                            // 备注
+	Version               uint      `json:"version" gorm:"not null;default:1"` // 版本号（乐观锁）
+	CreatedAt             time.Time `json:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at"`
 
 	// 关联
-	Customer  *Customer  `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
-	Agreement *Agreement `json:"agreement,omitempty" gorm:"foreignKey:AgreementID"`
+	Customer  *Customer       `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+	Agreement *Agreement      `json:"agreement,omitempty" gorm:"foreignKey:AgreementID"`
+	Refunds   []PaymentRefund `json:"refunds,omitempty" gorm:"foreignKey:PaymentID"`
 }
@@ -18,11 +18,13 @@ type Person struct {
 	Type                      PersonType `json:"type" gorm:"not null"`
 	Name                      string     `json:"name" gorm:"not null"`
 	Phone                     string     `json:"phone" gorm:"not null"`
+	Email                     string     `json:"email"`                        // 邮箱，用于接收邮件通知
 	IDCard                    string     `json:"id_card" gorm:"unique"`
 	Password                  string     `json:"-" gorm:""`
 	RepresentativeCustomerIDs string     `json:"representative_customer_ids"` // 担任法人的企业ID，逗号分隔: "1,5,8"
 	InvestorCustomerIDs       string     `json:"investor_customer_ids"`        // 持股的企业ID，逗号分隔: "1,2,3"
 	ServiceCustomerIDs        string     `json:"service_customer_ids"`         // 服务的企业ID，逗号分隔: "1,4,7"
+	Version                   uint       `json:"version" gorm:"not null;default:1"` // 版本号（乐观锁）
 	CreatedAt                 time.Time  `json:"created_at"`
 	UpdatedAt                 time.Time  `json:"updated_at"`
 }
@@ -0,0 +1,103 @@
+package models
+
+import "time"
+
+// LeadStage 销售线索阶段
+type LeadStage string
+
+const (
+	LeadStageNew         LeadStage = "新线索" // 新登记的线索
+	LeadStageContacted   LeadStage = "已联系" // 已与联系人沟通
+	LeadStageQuoted      LeadStage = "已报价" // 已发出报价
+	LeadStageNegotiating LeadStage = "洽谈中" // 商谈价格、服务内容
+	LeadStageWon         LeadStage = "已转化" // 已签约并转为客户，只能通过转化接口设置
+	LeadStageLost        LeadStage = "已流失" // 未能签约
+)
+
+// QuotationStatus 报价单状态
+type QuotationStatus string
+
+const (
+	QuotationStatusDraft    QuotationStatus = "草稿"  // 草稿
+	QuotationStatusSent     QuotationStatus = "已发送" // 已发送给客户
+	QuotationStatusAccepted QuotationStatus = "已接受" // 客户已接受
+	QuotationStatusRejected QuotationStatus = "已拒绝" // 客户已拒绝
+)
+
+// ServicePrice 服务价格目录
+type ServicePrice struct {
+	ID           uint         `json:"id" gorm:"primaryKey"`
+	Name         string       `json:"name" gorm:"not null"`              // 服务项目名称
+	Category     string       `json:"category" gorm:"index"`             // 分类（如代理记账、薪资申报、工商年报、工商注册）
+	Unit         string       `json:"unit"`                              // 计量单位（如户、人、次）
+	CustomerType CustomerType `json:"customer_type"`                     // 适用客户类型，为空表示不限
+	FeeType      FeeType      `json:"fee_type" gorm:"not null"`          // 计价周期，可为一次性
+	Price        float64      `json:"price" gorm:"not null"`             // 每个计价周期的价格
+	Description  string       `json:"description"`                       // 服务内容说明
+	Standard     bool         `json:"standard"`                          // 标准服务，生成报价时未指定明细则默认包含
+	Disabled     bool         `json:"disabled"`                          // 是否停用，停用的项目不能加入新报价
+	Version      uint         `json:"version" gorm:"not null;default:1"` // 版本号（乐观锁）
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// Lead 销售线索（潜在客户）
+type Lead struct {
+	ID            uint         `json:"id" gorm:"primaryKey"`
+	Name          string       `json:"name" gorm:"not null"`                    // 企业名称或个人姓名
+	CustomerType  CustomerType `json:"customer_type"`                           // 预计的客户类型
+	Source        string       `json:"source"`                                  // 来源（如转介绍、网络推广、电话咨询）
+	ContactName   string       `json:"contact_name" gorm:"not null"`            // 联系人
+	ContactPhone  string       `json:"contact_phone"`                           // 联系电话
+	ContactWechat string       `json:"contact_wechat"`                          // 联系人微信
+	Stage         LeadStage    `json:"stage" gorm:"not null;default:新线索;index"` // 阶段
+	OwnerID       *uint        `json:"owner_id" gorm:"index"`                   // 跟进人
+	Remark        string       `json:"remark"`                                  // 备注（需求、沟通记录）
+	LostReason    string       `json:"lost_reason"`                             // 流失原因
+	CustomerID    *uint        `json:"customer_id"`                             // 转化后的客户
+	ConvertedAt   *time.Time   `json:"converted_at"`                            // 转化时间
+	Version       uint         `json:"version" gorm:"not null;default:1"`       // 版本号（乐观锁）
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+
+	// 关联
+	Owner      *Person     `json:"owner,omitempty" gorm:"foreignKey:OwnerID"`
+	Quotations []Quotation `json:"quotations,omitempty" gorm:"foreignKey:LeadID"`
+}
+
+// Quotation 报价单，除一次性费用外金额均为每个收费周期的金额
+type Quotation struct {
+	ID              uint            `json:"id" gorm:"primaryKey"`
+	QuotationNumber string          `json:"quotation_number" gorm:"unique;not null"` // 报价单号
+	LeadID          uint            `json:"lead_id" gorm:"not null;index"`           // 销售线索
+	FeeType         FeeType         `json:"fee_type" gorm:"not null"`                // 收费方式
+	Subtotal        float64         `json:"subtotal"`                                // 周期性明细合计
+	Discount        float64         `json:"discount"`                                // 优惠金额，从周期性费用中扣减
+	Amount          float64         `json:"amount"`                                  // 报价金额 = 周期性明细合计 - 优惠金额
+	OneTimeAmount   float64         `json:"one_time_amount"`                         // 一次性费用合计
+	ValidUntil      *time.Time      `json:"valid_until"`                             // 有效期至
+	Status          QuotationStatus `json:"status" gorm:"not null;default:草稿"`       // 状态
+	Remark          string          `json:"remark"`                                  // 备注
+	CreatorID       *uint           `json:"creator_id"`                              // 制单人
+	AgreementID     *uint           `json:"agreement_id"`                            // 转化时据此生成的协议
+	Version         uint            `json:"version" gorm:"not null;default:1"`       // 版本号（乐观锁）
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+
+	// 关联
+	Items []QuotationItem `json:"items,omitempty" gorm:"foreignKey:QuotationID"`
+	Lead  *Lead           `json:"lead,omitempty" gorm:"foreignKey:LeadID"`
+}
+
+// QuotationItem 报价明细，周期性项目的价格已按报价单收费方式折算
+type QuotationItem struct {
+	ID             uint    `json:"id" gorm:"primaryKey"`
+	QuotationID    uint    `json:"quotation_id" gorm:"not null;index"` // 报价单
+	ServicePriceID *uint   `json:"service_price_id"`                   // 价格目录项目，自定义项目为空
+	Name           string  `json:"name" gorm:"not null"`               // 服务项目
+	Description    string  `json:"description"`                        // 说明
+	FeeType        FeeType `json:"fee_type"`                           // 收费周期，周期性项目同报价单，一次性项目为一次性
+	Quantity       float64 `json:"quantity" gorm:"not null"`           // 数量
+	UnitPrice      float64 `json:"unit_price" gorm:"not null"`         // 单价
+	Amount         float64 `json:"amount" gorm:"not null"`             // 金额 = 数量 × 单价
+}
@@ -2,18 +2,59 @@ package models
 
 import "time"
 
+// TaskPriority 任务优先级
+type TaskPriority string
+
+const (
+	TaskPriorityLow    TaskPriority = "低"  // 低
+	TaskPriorityNormal TaskPriority = "中"  // 中
+	TaskPriorityHigh   TaskPriority = "高"  // 高
+	TaskPriorityUrgent TaskPriority = "紧急" // 紧急
+)
+
 // Task 代办任务
 type Task struct {
-	ID          uint       `json:"id" gorm:"primaryKey"`
-	CustomerID  uint       `json:"customer_id" gorm:"not null"` // 关联客户
-	Title       string     `json:"title" gorm:"not null"`       // 任务标题
-	Description string     `json:"description"`                 // 任务描述
-	Status      string     `json:"status"`                      // pending/in_progress/completed
-	DueDate     *time.Time `json:"due_date"`                    // 截止日期
-	CompletedAt *time.Time `json:"completed_at"`                // 完成日期
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	ID              uint         `json:"id" gorm:"primaryKey"`
+	CustomerID      uint         `json:"customer_id" gorm:"not null;uniqueIndex:idx_task_template_period,priority:2"` // 关联客户
+	Title           string       `json:"title" gorm:"not null"`                                                       // 任务标题
+	Description     string       `json:"description"`                                                                 // 任务描述
+	Type            string       `json:"type"`                                                                        // 任务类型，决定适用的任务流程
+	Status          string       `json:"status"`                                                                      // 流程状态，默认流程: pending/in_progress/completed/cancelled
+	Priority        TaskPriority `json:"priority"`                                                                    // 优先级
+	AssigneeID      *uint        `json:"assignee_id"`                                                                 // 负责人（服务人员）
+	CreatorID       *uint        `json:"creator_id"`                                                                  // 创建人
+	DueDate         *time.Time   `json:"due_date"`                                                                    // 截止日期
+	StartedAt       *time.Time   `json:"started_at"`                                                                  // 开始处理时间（首次进入进行中状态）
+	CompletedAt     *time.Time   `json:"completed_at"`                                                                // 完成日期
+	StatusChangedAt *time.Time   `json:"status_changed_at"`                                                           // 最近一次状态变更时间
+	TemplateID      *uint        `json:"template_id" gorm:"uniqueIndex:idx_task_template_period,priority:1"`          // 生成该任务的任务模板
+	Period          string       `json:"period" gorm:"uniqueIndex:idx_task_template_period,priority:3"`               // 模板任务对应的申报期间，如 2026-09、2026-Q3、2025；同一模板、客户和期间只生成一个任务
+	Version         uint         `json:"version" gorm:"not null;default:1"`                                           // 版本号（乐观锁）
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+
+	// 检查项完成情况（通过查询加载，不存储在数据库）
+	ChecklistTotal int     `json:"checklist_total" gorm:"-"`
+	ChecklistDone  int     `json:"checklist_done" gorm:"-"`
+	Progress       float64 `json:"progress" gorm:"-"` // 完成百分比(0-100)
 
 	// 关联
 	Customer *Customer `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+	Assignee *Person   `json:"assignee,omitempty" gorm:"foreignKey:AssigneeID"`
+	Creator  *Person   `json:"creator,omitempty" gorm:"foreignKey:CreatorID"`
+}
+
+// TaskAssignment 任务分配记录
+type TaskAssignment struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	TaskID       uint      `json:"task_id" gorm:"not null;index"` // 关联任务
+	FromPersonID *uint     `json:"from_person_id"`                // 原负责人
+	ToPersonID   *uint     `json:"to_person_id"`                  // 新负责人
+	OperatorID   *uint     `json:"operator_id"`                   // 操作人
+	Reason       string    `json:"reason"`                        // 分配原因
+	CreatedAt    time.Time `json:"created_at"`
+
+	// 关联
+	FromPerson *Person `json:"from_person,omitempty" gorm:"foreignKey:FromPersonID"`
+	ToPerson   *Person `json:"to_person,omitempty" gorm:"foreignKey:ToPersonID"`
 }
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// TaskChecklistItem 任务检查项
+type TaskChecklistItem struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	TaskID      uint       `json:"task_id" gorm:"not null;index"`     // 关联任务
+	Title       string     `json:"title" gorm:"not null"`             // 检查项内容
+	SortOrder   int        `json:"sort_order"`                        // 排序（升序）
+	Completed   bool       `json:"completed"`                         // 是否完成
+	CompletedAt *time.Time `json:"completed_at"`                      // 完成时间
+	CompletedBy *uint      `json:"completed_by"`                      // 完成人
+	Version     uint       `json:"version" gorm:"not null;default:1"` // 版本号（乐观锁）
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// TaskComment 任务评论（支持回复和@人员）
+type TaskComment struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	TaskID     uint      `json:"task_id" gorm:"not null;index"` // 关联任务
+	ParentID   *uint     `json:"parent_id"`                     // 回复的评论ID
+	AuthorID   *uint     `json:"author_id"`                     // 评论人
+	Content    string    `json:"content" gorm:"not null"`       // 评论内容
+	MentionIDs string    `json:"mention_ids"`                   // @的人员ID，逗号分隔: "5,6"
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// 关联
+	Author  *Person       `json:"author,omitempty" gorm:"foreignKey:AuthorID"`
+	Replies []TaskComment `json:"replies,omitempty" gorm:"-"`
+}
+
+// TaskAttachment 任务附件
+type TaskAttachment struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	TaskID      uint      `json:"task_id" gorm:"not null;index"` // 关联任务
+	FileName    string    `json:"file_name"`                     // 原始文件名
+	StorageKey  string    `json:"-" gorm:"index"`                // 存储后端中的key
+	StoredPath  string    `json:"-"`                             // 本地存储路径（早期上传的附件）
+	ContentType string    `json:"content_type"`                  // 文件类型
+	Size        int64     `json:"size"`                          // 文件大小（字节）
+	UploadedBy  *uint     `json:"uploaded_by"`                   // 上传人
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// TaskTemplate 任务模板，按客户税务档案批量生成周期性任务（如纳税申报）
+// 关联税种时只为有该申报义务的客户生成，未指定 Frequency 时按客户该税种的申报周期生成
+type TaskTemplate struct {
+	ID           uint            `json:"id" gorm:"primaryKey"`
+	Name         string          `json:"name" gorm:"not null"`                   // 模板名称
+	TaskType     string          `json:"task_type"`                              // 生成任务的类型，决定适用的任务流程
+	Title        string          `json:"title" gorm:"not null"`                  // 任务标题，支持 {customer}、{period}、{tax_type} 占位符
+	Description  string          `json:"description"`                            // 任务描述，支持同样的占位符
+	Priority     TaskPriority    `json:"priority"`                               // 优先级，默认中
+	TaxpayerType TaxpayerType    `json:"taxpayer_type"`                          // 适用的纳税人类型，空表示不限
+	TaxType      TaxType         `json:"tax_type"`                               // 关联税种，空表示不限
+	Frequency    FilingFrequency `json:"frequency"`                              // 生成周期，空表示按客户该税种的申报周期（未关联税种时按月）
+	DueDay       int             `json:"due_day" gorm:"not null;default:15"`     // 截止日（生成月份的第几天，超出月末按月末）
+	AnnualMonth  int             `json:"annual_month" gorm:"not null;default:1"` // 按年生成的月份
+	AutoGenerate bool            `json:"auto_generate"`                          // 是否由每日定时任务自动生成当月任务
+	Version      uint            `json:"version" gorm:"not null;default:1"`      // 版本号（乐观锁）
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// TaskStateCategory 任务状态分类，用于统计和自动维护时间戳
+type TaskStateCategory string
+
+const (
+	TaskStateCategoryPending    TaskStateCategory = "pending"     // 待处理
+	TaskStateCategoryInProgress TaskStateCategory = "in_progress" // 进行中
+	TaskStateCategoryCompleted  TaskStateCategory = "completed"   // 已完成
+	TaskStateCategoryCancelled  TaskStateCategory = "cancelled"   // 已取消
+)
+
+// WorkflowState 流程状态（JSON结构）
+type WorkflowState struct {
+	Key      string            `json:"key"`      // 状态标识，保存在 Task.Status
+	Name     string            `json:"name"`     // 显示名称
+	Category TaskStateCategory `json:"category"` // 状态分类
+}
+
+// WorkflowTransition 流程流转规则（JSON结构）
+type WorkflowTransition struct {
+	From           string   `json:"from"`                      // 起始状态，"*" 表示任意状态
+	To             string   `json:"to"`                        // 目标状态
+	Name           string   `json:"name"`                      // 操作名称，如 "开始处理"
+	RequiredFields []string `json:"required_fields,omitempty"` // 流转时必填的字段
+}
+
+// TaskWorkflow 任务流程配置（按任务类型）
+type TaskWorkflow struct {
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	TaskType     string         `json:"task_type" gorm:"unique;not null"`  // 任务类型
+	Name         string         `json:"name"`                              // 流程名称
+	InitialState string         `json:"initial_state" gorm:"not null"`     // 初始状态
+	States       datatypes.JSON `json:"states"`                            // 状态JSON数组
+	Transitions  datatypes.JSON `json:"transitions"`                       // 流转规则JSON数组
+	Version      uint           `json:"version" gorm:"not null;default:1"` // 版本号（乐观锁）
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+}
+
+// TaskTransition 任务状态流转记录
+type TaskTransition struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	TaskID     uint           `json:"task_id" gorm:"not null;index"` // 关联任务
+	FromStatus string         `json:"from_status"`                   // 原状态
+	ToStatus   string         `json:"to_status"`                     // 新状态
+	OperatorID *uint          `json:"operator_id"`                   // 操作人
+	Comment    string         `json:"comment"`                       // 备注
+	Data       datatypes.JSON `json:"data"`                          // 流转时提交的字段
+	CreatedAt  time.Time      `json:"created_at"`
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// TaxpayerType 增值税纳税人类型
+type TaxpayerType string
+
+const (
+	TaxpayerTypeSmallScale TaxpayerType = "小规模纳税人"
+	TaxpayerTypeGeneral    TaxpayerType = "一般纳税人"
+)
+
+// TaxType 申报税种（含社保）
+type TaxType string
+
+const (
+	TaxTypeVAT             TaxType = "增值税"
+	TaxTypeSurcharge       TaxType = "附加税"
+	TaxTypeCorporateIncome TaxType = "企业所得税"
+	TaxTypeIndividual      TaxType = "个税"
+	TaxTypeStamp           TaxType = "印花税"
+	TaxTypeSocialInsurance TaxType = "社保"
+)
+
+// FilingFrequency 申报周期
+type FilingFrequency string
+
+const (
+	FilingFrequencyMonthly   FilingFrequency = "按月"
+	FilingFrequencyQuarterly FilingFrequency = "按季"
+	FilingFrequencyYearly    FilingFrequency = "按年"
+)
+
+// CustomerTaxProfile 客户税务档案，每个客户一条
+type CustomerTaxProfile struct {
+	ID            uint         `json:"id" gorm:"primaryKey"`
+	CustomerID    uint         `json:"customer_id" gorm:"not null;uniqueIndex"` // 客户
+	TaxpayerType  TaxpayerType `json:"taxpayer_type" gorm:"not null;index"`     // 纳税人类型
+	TaxBureau     string       `json:"tax_bureau" gorm:"index"`                 // 主管税务机关
+	TaxOfficer    string       `json:"tax_officer"`                             // 税务专管员
+	EffectiveDate time.Time    `json:"effective_date"`                          // 当前档案的生效日期
+	Version       uint         `json:"version" gorm:"not null;default:1"`       // 版本号（乐观锁）
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+
+	// 关联
+	Obligations []TaxObligation `json:"obligations" gorm:"foreignKey:CustomerID;references:CustomerID"`
+}
+
+// TaxObligation 客户的申报义务（税种及申报周期），按客户+税种唯一
+type TaxObligation struct {
+	ID         uint            `json:"id" gorm:"primaryKey"`
+	CustomerID uint            `json:"customer_id" gorm:"not null;uniqueIndex:idx_tax_obligation"` // 客户
+	TaxType    TaxType         `json:"tax_type" gorm:"not null;uniqueIndex:idx_tax_obligation"`    // 税种
+	Frequency  FilingFrequency `json:"frequency" gorm:"not null"`                                  // 申报周期
+}
+
+// TaxProfileFieldChange 税务档案的单项变更（JSON结构）
+type TaxProfileFieldChange struct {
+	Field string `json:"field"` // 变更项，如 "纳税人类型"、"主管税务机关"、税种名称
+	From  string `json:"from"`  // 原值，新增时为空
+	To    string `json:"to"`    // 新值，取消时为空
+}
+
+// CustomerTaxProfileChange 客户税务档案变更记录，EffectiveDate 为业务上的生效日期（可早于记录时间）
+type CustomerTaxProfileChange struct {
+	ID               uint           `json:"id" gorm:"primaryKey"`
+	CustomerID       uint           `json:"customer_id" gorm:"not null;index"`    // 客户
+	FromTaxpayerType TaxpayerType   `json:"from_taxpayer_type"`                   // 原纳税人类型，首次建档时为空
+	ToTaxpayerType   TaxpayerType   `json:"to_taxpayer_type" gorm:"not null"`     // 新纳税人类型
+	Changes          datatypes.JSON `json:"changes"`                              // 变更明细 []TaxProfileFieldChange
+	EffectiveDate    time.Time      `json:"effective_date" gorm:"not null;index"` // 生效日期
+	Reason           string         `json:"reason"`                               // 原因
+	OperatorID       *uint          `json:"operator_id"`                          // 操作人
+	CreatedAt        time.Time      `json:"created_at"`
+
+	// 关联
+	Operator *Person `json:"operator,omitempty" gorm:"foreignKey:OperatorID"`
+}
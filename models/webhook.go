@@ -0,0 +1,106 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 对外推送的事件类型
+const (
+	WebhookEventCustomerCreated  = "customer.created"
+	WebhookEventCustomerUpdated  = "customer.updated"
+	WebhookEventCustomerDeleted  = "customer.deleted"
+	WebhookEventCustomerStatus   = "customer.status_changed"
+	WebhookEventBalanceChanged   = "customer.balance_changed"
+	WebhookEventTaxProfile       = "customer.tax_profile_changed"
+	WebhookEventAgreementCreated = "agreement.created"
+	WebhookEventAgreementUpdated = "agreement.updated"
+	WebhookEventAgreementDeleted = "agreement.deleted"
+	WebhookEventPriceChanged     = "agreement.price_changed"
+	WebhookEventPaymentCreated   = "payment.created"
+	WebhookEventPaymentUpdated   = "payment.updated"
+	WebhookEventPaymentDeleted   = "payment.deleted"
+	WebhookEventPaymentRefunded  = "payment.refunded"
+	WebhookEventInvoiceCreated   = "invoice.created"
+	WebhookEventInvoiceUpdated   = "invoice.updated"
+	WebhookEventInvoiceDeleted   = "invoice.deleted"
+	WebhookEventTaskCreated      = "task.created"
+	WebhookEventTaskUpdated      = "task.updated"
+	WebhookEventTaskDeleted      = "task.deleted"
+	WebhookEventTaskAssigned     = "task.assigned"
+	WebhookEventTaskTransitioned = "task.transitioned"
+	WebhookEventImportCompleted  = "import.completed"
+	WebhookEventPersonHandover   = "person.handover"
+	WebhookEventPing             = "ping"
+)
+
+// WebhookEventTypes 可订阅的事件类型
+var WebhookEventTypes = []string{
+	WebhookEventCustomerCreated,
+	WebhookEventCustomerUpdated,
+	WebhookEventCustomerDeleted,
+	WebhookEventCustomerStatus,
+	WebhookEventBalanceChanged,
+	WebhookEventTaxProfile,
+	WebhookEventAgreementCreated,
+	WebhookEventAgreementUpdated,
+	WebhookEventAgreementDeleted,
+	WebhookEventPriceChanged,
+	WebhookEventPaymentCreated,
+	WebhookEventPaymentUpdated,
+	WebhookEventPaymentDeleted,
+	WebhookEventPaymentRefunded,
+	WebhookEventInvoiceCreated,
+	WebhookEventInvoiceUpdated,
+	WebhookEventInvoiceDeleted,
+	WebhookEventTaskCreated,
+	WebhookEventTaskUpdated,
+	WebhookEventTaskDeleted,
+	WebhookEventTaskAssigned,
+	WebhookEventTaskTransitioned,
+	WebhookEventImportCompleted,
+	WebhookEventPersonHandover,
+}
+
+// WebhookSubscription Webhook订阅，删除为软删除以保留投递记录
+type WebhookSubscription struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	Name       string         `json:"name"`                              // 名称
+	URL        string         `json:"url" gorm:"not null"`               // 推送地址
+	Secret     string         `json:"-"`                                 // 签名密钥（HMAC-SHA256），仅在创建和轮换时返回
+	EventTypes string         `json:"event_types"`                       // 订阅的事件，逗号分隔，支持 "*" 和 "task.*"
+	Active     bool           `json:"active"`                            // 是否启用
+	Version    uint           `json:"version" gorm:"not null;default:1"` // 版本号（乐观锁）
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// WebhookDeliveryStatus 投递状态
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending WebhookDeliveryStatus = "pending" // 待投递（含等待重试）
+	WebhookDeliverySuccess WebhookDeliveryStatus = "success" // 投递成功
+	WebhookDeliveryFailed  WebhookDeliveryStatus = "failed"  // 重试次数用尽
+)
+
+// WebhookDelivery Webhook投递记录
+type WebhookDelivery struct {
+	ID             uint                  `json:"id" gorm:"primaryKey"`
+	SubscriptionID uint                  `json:"subscription_id" gorm:"not null;index"` // 订阅
+	EventID        string                `json:"event_id" gorm:"index"`                 // 事件ID，同一事件推送到多个订阅时相同
+	EventType      string                `json:"event_type"`                            // 事件类型
+	Payload        string                `json:"payload"`                               // 请求体（JSON）
+	Status         WebhookDeliveryStatus `json:"status" gorm:"not null;index"`          // 状态
+	Attempts       int                   `json:"attempts"`                              // 已尝试次数
+	NextAttemptAt  time.Time             `json:"next_attempt_at" gorm:"index"`          // 下次尝试时间
+	ResponseStatus int                   `json:"response_status"`                       // 最近一次响应状态码
+	ResponseBody   string                `json:"response_body"`                         // 最近一次响应内容（截断）
+	LastError      string                `json:"last_error"`                            // 最近一次失败原因
+	DeliveredAt    *time.Time            `json:"delivered_at"`                          // 投递成功时间
+	RedeliveryOf   *uint                 `json:"redelivery_of"`                         // 手动重新投递时的原记录ID
+	CreatedAt      time.Time             `json:"created_at"`
+	UpdatedAt      time.Time             `json:"updated_at"`
+}
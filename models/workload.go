@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// ServiceCapacity 服务人员容量上限，PersonID 为0的记录为默认上限，各项为0表示不限制
+type ServiceCapacity struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	PersonID      uint      `json:"person_id" gorm:"not null;uniqueIndex"` // 人员，0表示默认
+	MaxCustomers  int       `json:"max_customers"`                         // 最多服务客户数
+	MaxOpenTasks  int       `json:"max_open_tasks"`                        // 最多未完成任务数
+	MaxMonthlyFee float64   `json:"max_monthly_fee"`                       // 最大月度服务费规模（元）
+	Version       uint      `json:"version" gorm:"not null;default:1"`     // 版本号（乐观锁）
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
@@ -25,8 +25,13 @@ func SetupRoutes(r *gin.Engine) {
 			people.POST("", controllers.CreatePerson)
 			people.GET("/:id", controllers.GetPerson)
 			people.PUT("/:id", controllers.UpdatePerson)
+			people.PATCH("/:id", controllers.PatchPerson)
 			people.DELETE("/:id", controllers.DeletePerson)
 			people.GET("/:id/customers", controllers.GetPersonCustomers)
+			people.GET("/:id/graph", controllers.GetPersonGraph)
+			people.GET("/:id/graph/export", controllers.ExportPersonGraph)
+			people.POST("/:id/handover/preview", controllers.PreviewHandover)
+			people.POST("/:id/handover", controllers.CreateHandover)
 		}
 
 		// 客户管理路由
@@ -34,11 +39,32 @@ func SetupRoutes(r *gin.Engine) {
 		{
 			customers.GET("", controllers.GetCustomers)
 			customers.POST("", controllers.CreateCustomer)
+			customers.POST("/bulk", controllers.BulkCustomers)
 			customers.GET("/:id", controllers.GetCustomer)
 			customers.PUT("/:id", controllers.UpdateCustomer)
+			customers.PATCH("/:id", controllers.PatchCustomer)
 			customers.DELETE("/:id", controllers.DeleteCustomer)
 			customers.GET("/:id/tasks", controllers.GetCustomerTasks)
 			customers.GET("/:id/payments", controllers.GetCustomerPayments)
+			customers.POST("/:id/status", controllers.ChangeCustomerStatus)
+			customers.GET("/:id/status-history", controllers.GetCustomerStatusHistory)
+			customers.GET("/:id/account", controllers.GetCustomerAccount)
+			customers.POST("/:id/account/entries", controllers.CreateAccountEntry)
+			customers.POST("/:id/account/apply", controllers.ApplyCustomerBalance)
+			customers.GET("/:id/tax-profile", controllers.GetCustomerTaxProfile)
+			customers.PUT("/:id/tax-profile", controllers.UpdateCustomerTaxProfile)
+			customers.GET("/:id/tax-profile/history", controllers.GetCustomerTaxProfileHistory)
+		}
+
+		// 外部法人实体路由（非本系统客户的企业股东）
+		legalEntities := api.Group("/legal-entities")
+		{
+			legalEntities.GET("", controllers.GetLegalEntities)
+			legalEntities.POST("", controllers.CreateLegalEntity)
+			legalEntities.GET("/:id", controllers.GetLegalEntity)
+			legalEntities.PUT("/:id", controllers.UpdateLegalEntity)
+			legalEntities.PATCH("/:id", controllers.PatchLegalEntity)
+			legalEntities.DELETE("/:id", controllers.DeleteLegalEntity)
 		}
 
 		// 任务管理路由
@@ -46,9 +72,152 @@ func SetupRoutes(r *gin.Engine) {
 		{
 			tasks.GET("", controllers.GetTasks)
 			tasks.POST("", controllers.CreateTask)
+			tasks.POST("/bulk", controllers.BulkTasks)
 			tasks.GET("/:id", controllers.GetTask)
 			tasks.PUT("/:id", controllers.UpdateTask)
+			tasks.PATCH("/:id", controllers.PatchTask)
 			tasks.DELETE("/:id", controllers.DeleteTask)
+			tasks.PUT("/:id/assign", controllers.AssignTask)
+			tasks.GET("/:id/assignments", controllers.GetTaskAssignments)
+			tasks.POST("/:id/transition", controllers.TransitionTask)
+			tasks.GET("/:id/transitions", controllers.GetTaskTransitions)
+
+			// 检查项
+			tasks.GET("/:id/checklist", controllers.GetTaskChecklist)
+			tasks.POST("/:id/checklist", controllers.CreateTaskChecklistItem)
+			tasks.POST("/:id/checklist/reorder", controllers.ReorderTaskChecklist)
+			tasks.PUT("/:id/checklist/:item_id", controllers.UpdateTaskChecklistItem)
+			tasks.PATCH("/:id/checklist/:item_id", controllers.UpdateTaskChecklistItem)
+			tasks.DELETE("/:id/checklist/:item_id", controllers.DeleteTaskChecklistItem)
+
+			// 评论
+			tasks.GET("/:id/comments", controllers.GetTaskComments)
+			tasks.POST("/:id/comments", controllers.CreateTaskComment)
+			tasks.DELETE("/:id/comments/:comment_id", controllers.DeleteTaskComment)
+
+			// 附件
+			tasks.GET("/:id/attachments", controllers.GetTaskAttachments)
+			tasks.POST("/:id/attachments", controllers.UploadTaskAttachment)
+			tasks.GET("/:id/attachments/:attachment_id/download", controllers.DownloadTaskAttachment)
+			tasks.DELETE("/:id/attachments/:attachment_id", controllers.DeleteTaskAttachment)
+		}
+
+		// 任务流程配置路由
+		taskWorkflows := api.Group("/task-workflows")
+		{
+			taskWorkflows.GET("", controllers.GetTaskWorkflows)
+			taskWorkflows.POST("", controllers.CreateTaskWorkflow)
+			taskWorkflows.GET("/:id", controllers.GetTaskWorkflow)
+			taskWorkflows.PUT("/:id", controllers.UpdateTaskWorkflow)
+			taskWorkflows.PATCH("/:id", controllers.PatchTaskWorkflow)
+			taskWorkflows.DELETE("/:id", controllers.DeleteTaskWorkflow)
+		}
+
+		// 任务模板路由（按客户税务档案批量生成周期性任务）
+		taskTemplates := api.Group("/task-templates")
+		{
+			taskTemplates.GET("", controllers.GetTaskTemplates)
+			taskTemplates.POST("", controllers.CreateTaskTemplate)
+			taskTemplates.GET("/:id", controllers.GetTaskTemplate)
+			taskTemplates.PUT("/:id", controllers.UpdateTaskTemplate)
+			taskTemplates.DELETE("/:id", controllers.DeleteTaskTemplate)
+			taskTemplates.POST("/:id/generate", controllers.GenerateTaskTemplateTasks)
+		}
+
+		// 当前人员路由（通过 X-Person-ID 请求头识别）
+		me := api.Group("/me")
+		{
+			me.GET("/tasks", controllers.GetMyTasks)
+			me.GET("/mentions", controllers.GetMyMentions)
+			me.GET("/notifications", controllers.GetMyNotifications)
+			me.GET("/notifications/unread-count", controllers.GetMyUnreadNotificationCount)
+			me.PUT("/notifications/read-all", controllers.MarkAllNotificationsRead)
+			me.PUT("/notifications/:id/read", controllers.MarkNotificationRead)
+			me.GET("/notification-preferences", controllers.GetMyNotificationPreferences)
+			me.PUT("/notification-preferences", controllers.UpdateMyNotificationPreferences)
+		}
+
+		// 文档管理路由
+		documents := api.Group("/documents")
+		{
+			documents.GET("", controllers.GetDocuments)
+			documents.POST("", controllers.UploadDocument)
+			documents.GET("/categories", controllers.GetDocumentCategories)
+			documents.GET("/:id", controllers.GetDocument)
+			documents.PUT("/:id", controllers.UpdateDocument)
+			documents.PATCH("/:id", controllers.PatchDocument)
+			documents.DELETE("/:id", controllers.DeleteDocument)
+			documents.GET("/:id/versions", controllers.GetDocumentVersions)
+			documents.POST("/:id/versions", controllers.UploadDocumentVersion)
+			documents.GET("/:id/download-url", controllers.GetDocumentDownloadURL)
+			documents.GET("/:id/download", controllers.DownloadDocument)
+		}
+
+		// 证照管理路由
+		credentials := api.Group("/credentials")
+		{
+			credentials.GET("", controllers.GetCredentials)
+			credentials.POST("", controllers.CreateCredential)
+			credentials.GET("/expiring", controllers.GetExpiringItems)
+			credentials.POST("/scan", controllers.ScanCredentials)
+			credentials.GET("/:id", controllers.GetCredential)
+			credentials.PUT("/:id", controllers.UpdateCredential)
+			credentials.PATCH("/:id", controllers.PatchCredential)
+			credentials.DELETE("/:id", controllers.DeleteCredential)
+		}
+
+		// 通知管理路由
+		notifications := api.Group("/notifications")
+		{
+			notifications.GET("/templates", controllers.GetNotificationTemplates)
+			notifications.PUT("/templates/:event", controllers.UpdateNotificationTemplate)
+			notifications.DELETE("/templates/:event", controllers.DeleteNotificationTemplate)
+			notifications.GET("/outbox", controllers.GetNotificationOutbox)
+			notifications.POST("/outbox/:id/retry", controllers.RetryNotificationOutbox)
+			notifications.POST("/scan", controllers.ScanNotifications)
+		}
+
+		// 实时事件推送路由（SSE）
+		events := api.Group("/events")
+		{
+			events.GET("/stream", controllers.StreamEvents)
+		}
+
+		// 工作交接路由
+		handovers := api.Group("/handovers")
+		{
+			handovers.GET("", controllers.GetHandovers)
+			handovers.GET("/:id", controllers.GetHandover)
+			handovers.PUT("/:id/items/:item_id", controllers.UpdateHandoverItem)
+			handovers.PATCH("/:id/items/:item_id", controllers.UpdateHandoverItem)
+		}
+
+		// 操作日志路由
+		auditLogs := api.Group("/audit-logs")
+		{
+			auditLogs.GET("", controllers.GetAuditLogs)
+		}
+
+		// Webhook订阅路由
+		webhooks := api.Group("/webhooks")
+		{
+			webhooks.GET("", controllers.GetWebhookSubscriptions)
+			webhooks.POST("", controllers.CreateWebhookSubscription)
+			webhooks.GET("/events", controllers.GetWebhookEventTypes)
+			webhooks.GET("/:id", controllers.GetWebhookSubscription)
+			webhooks.PUT("/:id", controllers.UpdateWebhookSubscription)
+			webhooks.PATCH("/:id", controllers.PatchWebhookSubscription)
+			webhooks.DELETE("/:id", controllers.DeleteWebhookSubscription)
+			webhooks.POST("/:id/ping", controllers.PingWebhookSubscription)
+			webhooks.POST("/:id/rotate-secret", controllers.RotateWebhookSecret)
+			webhooks.GET("/:id/deliveries", controllers.GetWebhookDeliveries)
+		}
+
+		// Webhook投递记录路由
+		webhookDeliveries := api.Group("/webhook-deliveries")
+		{
+			webhookDeliveries.GET("/:id", controllers.GetWebhookDelivery)
+			webhookDeliveries.POST("/:id/redeliver", controllers.RedeliverWebhook)
 		}
 
 		// 协议管理路由
@@ -58,7 +227,26 @@ func SetupRoutes(r *gin.Engine) {
 			agreements.POST("", controllers.CreateAgreement)
 			agreements.GET("/:id", controllers.GetAgreement)
 			agreements.PUT("/:id", controllers.UpdateAgreement)
+			agreements.PATCH("/:id", controllers.PatchAgreement)
 			agreements.DELETE("/:id", controllers.DeleteAgreement)
+			agreements.GET("/:id/revenue", controllers.GetAgreementRevenue)
+			agreements.GET("/:id/items", controllers.GetAgreementItems)
+			agreements.PUT("/:id/items", controllers.UpdateAgreementItems)
+			agreements.GET("/:id/price-changes", controllers.GetAgreementPriceChanges)
+			agreements.POST("/:id/price-changes", controllers.CreateAgreementPriceChange)
+			agreements.DELETE("/:id/price-changes/:changeId", controllers.DeleteAgreementPriceChange)
+		}
+
+		// 协议价格变更路由
+		priceChanges := api.Group("/price-changes")
+		{
+			priceChanges.GET("", controllers.GetPriceChanges)
+		}
+
+		// 客户预存余额路由
+		customerBalances := api.Group("/customer-balances")
+		{
+			customerBalances.GET("", controllers.GetCustomerBalances)
 		}
 
 		// 收款管理路由
@@ -66,9 +254,89 @@ func SetupRoutes(r *gin.Engine) {
 		{
 			payments.GET("", controllers.GetPayments)
 			payments.POST("", controllers.CreatePayment)
+			payments.POST("/bulk", controllers.BulkPayments)
 			payments.GET("/:id", controllers.GetPayment)
 			payments.PUT("/:id", controllers.UpdatePayment)
+			payments.PATCH("/:id", controllers.PatchPayment)
 			payments.DELETE("/:id", controllers.DeletePayment)
+			payments.GET("/:id/attributions", controllers.GetPaymentAttributions)
+			payments.PUT("/:id/attributions", controllers.UpdatePaymentAttributions)
+			payments.GET("/:id/refunds", controllers.GetPaymentRefunds)
+			payments.POST("/:id/refunds", controllers.CreatePaymentRefund)
+		}
+
+		// 发票管理路由
+		invoices := api.Group("/invoices")
+		{
+			invoices.GET("", controllers.GetInvoices)
+			invoices.POST("", controllers.CreateInvoice)
+			invoices.GET("/uninvoiced-payments", controllers.GetUninvoicedPayments)
+			invoices.GET("/unpaid", controllers.GetUnpaidInvoices)
+			invoices.GET("/reconciliation/export", controllers.ExportInvoiceReconciliation)
+			invoices.GET("/:id", controllers.GetInvoice)
+			invoices.PUT("/:id", controllers.UpdateInvoice)
+			invoices.DELETE("/:id", controllers.DeleteInvoice)
+		}
+
+		// 收入确认路由
+		revenue := api.Group("/revenue")
+		{
+			revenue.GET("/schedule", controllers.GetRevenueSchedule)
+			revenue.GET("/ledger", controllers.GetRevenueLedger)
+			revenue.GET("/ledger/export", controllers.ExportRevenueLedger)
+		}
+
+		// 提成规则路由
+		commissionRules := api.Group("/commission-rules")
+		{
+			commissionRules.GET("", controllers.GetCommissionRules)
+			commissionRules.POST("", controllers.CreateCommissionRule)
+			commissionRules.GET("/:id", controllers.GetCommissionRule)
+			commissionRules.PUT("/:id", controllers.UpdateCommissionRule)
+			commissionRules.PATCH("/:id", controllers.PatchCommissionRule)
+			commissionRules.DELETE("/:id", controllers.DeleteCommissionRule)
+		}
+
+		// 提成结算路由
+		commissions := api.Group("/commissions")
+		{
+			commissions.GET("/statements", controllers.GetCommissionStatements)
+			commissions.GET("/statements/:person_id", controllers.GetCommissionStatement)
+			commissions.GET("/export", controllers.ExportCommissionStatements)
+		}
+
+		// 服务价格目录路由
+		servicePrices := api.Group("/service-prices")
+		{
+			servicePrices.GET("", controllers.GetServicePrices)
+			servicePrices.POST("", controllers.CreateServicePrice)
+			servicePrices.PUT("/:id", controllers.UpdateServicePrice)
+			servicePrices.DELETE("/:id", controllers.DeleteServicePrice)
+		}
+
+		// 销售线索路由
+		leads := api.Group("/leads")
+		{
+			leads.GET("", controllers.GetLeads)
+			leads.POST("", controllers.CreateLead)
+			leads.GET("/:id", controllers.GetLead)
+			leads.PUT("/:id", controllers.UpdateLead)
+			leads.PATCH("/:id", controllers.PatchLead)
+			leads.DELETE("/:id", controllers.DeleteLead)
+			leads.POST("/:id/quotations", controllers.CreateQuotation)
+			leads.POST("/:id/convert", controllers.ConvertLead)
+		}
+
+		// 报价单路由
+		quotations := api.Group("/quotations")
+		{
+			quotations.GET("", controllers.GetQuotations)
+			quotations.GET("/:id", controllers.GetQuotation)
+			quotations.PUT("/:id", controllers.UpdateQuotation)
+			quotations.PUT("/:id/status", controllers.UpdateQuotationStatus)
+			quotations.DELETE("/:id", controllers.DeleteQuotation)
+			quotations.GET("/:id/pdf", controllers.ExportQuotationPDF)
+			quotations.GET("/:id/export", controllers.ExportQuotationExcel)
 		}
 
 		// 统计分析路由
@@ -77,6 +345,21 @@ func SetupRoutes(r *gin.Engine) {
 			statistics.GET("/overview", controllers.GetOverview)
 			statistics.GET("/tasks", controllers.GetTaskStats)
 			statistics.GET("/payments", controllers.GetPaymentStats)
+			statistics.GET("/trends", controllers.GetTrendStats)
+			statistics.GET("/churn", controllers.GetCustomerChurnStats)
+			statistics.GET("/retention", controllers.GetCustomerRetentionStats)
+			statistics.GET("/workload", controllers.GetWorkloadStats)
+			statistics.GET("/workload/suggest", controllers.SuggestServicePerson)
+			statistics.GET("/workload/capacities", controllers.GetServiceCapacities)
+			statistics.PUT("/workload/capacities/:person_id", controllers.UpdateServiceCapacity)
+			statistics.DELETE("/workload/capacities/:person_id", controllers.DeleteServiceCapacity)
+		}
+
+		// 经营报表路由
+		reports := api.Group("/reports")
+		{
+			reports.GET("", controllers.GetPeriodReport)
+			reports.GET("/export", controllers.ExportPeriodReport)
 		}
 
 		// 导入导出路由
@@ -89,6 +372,7 @@ func SetupRoutes(r *gin.Engine) {
 		{
 			importAPI.POST("/people", importExportCtrl.ImportPeople)
 			importAPI.POST("/customers", importExportCtrl.ImportCustomers)
+			importAPI.POST("/invoices", controllers.ImportInvoices)
 		}
 
 		export := api.Group("/export")
@@ -0,0 +1,164 @@
+package eventlog
+
+import (
+	"encoding/json"
+	"erp/models"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Retention 事件日志保留时长，超过后由定时任务清理
+const Retention = 7 * 24 * time.Hour
+
+// broadcastEntityTypes 不属于具体客户、所有人可见的对象类型（如导入完成）
+// 其他事件只对计算出的可见人员推送，没有可见人员时不推送给任何人
+var broadcastEntityTypes = map[string]bool{
+	"import": true,
+}
+
+// scopeFields 从对象JSON中提取的可见范围字段
+type scopeFields struct {
+	ID               uint   `json:"id"`
+	TaskID           uint   `json:"task_id"`
+	CustomerID       uint   `json:"customer_id"`
+	ServicePersonIDs string `json:"service_person_ids"`
+	AssigneeID       *uint  `json:"assignee_id"`
+	CreatorID        *uint  `json:"creator_id"`
+	FromPersonID     *uint  `json:"from_person_id"`
+	ToPersonID       *uint  `json:"to_person_id"`
+}
+
+// Recorder 记录实时事件并按人员可见范围读取
+type Recorder struct {
+	db *gorm.DB
+}
+
+// NewRecorder 创建事件记录器
+func NewRecorder(db *gorm.DB) *Recorder {
+	return &Recorder{db: db}
+}
+
+// Record 记录事件，可见范围为所属客户的服务人员以及任务的负责人、创建人
+// extraPersonIDs 为额外的可见人员，如客户服务人员变更时的原服务人员
+func (r *Recorder) Record(eventType string, data interface{}, extraPersonIDs ...uint) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	var fields scopeFields
+	json.Unmarshal(payload, &fields)
+
+	entry := models.EventLog{
+		Type:       eventType,
+		EntityType: strings.SplitN(eventType, ".", 2)[0],
+		EntityID:   fields.ID,
+		CustomerID: fields.CustomerID,
+		Data:       string(payload),
+	}
+	entry.Broadcast = broadcastEntityTypes[entry.EntityType]
+
+	switch entry.EntityType {
+	case "customer":
+		entry.CustomerID = fields.ID
+	case "task":
+		// 分配记录和流转记录以 task_id 关联任务
+		if fields.TaskID != 0 {
+			entry.EntityID = fields.TaskID
+		}
+		var task models.Task
+		if r.db.Select("customer_id", "assignee_id", "creator_id").First(&task, entry.EntityID).Error == nil {
+			entry.CustomerID = task.CustomerID
+			fields.AssigneeID = firstNonNil(fields.AssigneeID, task.AssigneeID)
+			fields.CreatorID = firstNonNil(fields.CreatorID, task.CreatorID)
+		}
+	}
+
+	// 客户事件的数据中已包含服务人员，其他对象按所属客户查询
+	servicePersonIDs := fields.ServicePersonIDs
+	if entry.EntityType != "customer" && entry.CustomerID != 0 {
+		r.db.Model(&models.Customer{}).Where("id = ?", entry.CustomerID).Select("service_person_ids").Scan(&servicePersonIDs)
+	}
+
+	personIDs := append(parseIDs(servicePersonIDs), extraPersonIDs...)
+	for _, id := range []*uint{fields.AssigneeID, fields.CreatorID, fields.FromPersonID, fields.ToPersonID} {
+		if id != nil {
+			personIDs = append(personIDs, *id)
+		}
+	}
+	entry.PersonIDs = joinIDs(personIDs)
+
+	return r.db.Create(&entry).Error
+}
+
+// Since 获取ID大于 lastID 且人员可见的事件
+func (r *Recorder) Since(personID, lastID uint, limit int) ([]models.EventLog, error) {
+	var events []models.EventLog
+	err := r.db.Where("id > ?", lastID).
+		Where("broadcast = ? OR person_ids LIKE ?", true, "%,"+strconv.FormatUint(uint64(personID), 10)+",%").
+		Order("id ASC").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// LatestID 获取最新事件ID，没有事件时返回0
+func (r *Recorder) LatestID() uint {
+	var id uint
+	r.db.Model(&models.EventLog{}).Select("COALESCE(MAX(id), 0)").Scan(&id)
+	return id
+}
+
+// OldestID 获取仍保留的最早事件ID，没有事件时返回0
+func (r *Recorder) OldestID() uint {
+	var id uint
+	r.db.Model(&models.EventLog{}).Select("COALESCE(MIN(id), 0)").Scan(&id)
+	return id
+}
+
+// Prune 清理超过保留时长的事件
+func (r *Recorder) Prune() error {
+	return r.db.Where("created_at < ?", time.Now().Add(-Retention)).Delete(&models.EventLog{}).Error
+}
+
+// parseIDs 解析逗号分隔的ID，忽略无效项
+func parseIDs(s string) []uint {
+	var ids []uint
+	for _, part := range strings.Split(s, ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// joinIDs 将ID去重后拼接为 ",5,6," 格式，便于 LIKE 匹配
+func joinIDs(ids []uint) string {
+	seen := make(map[uint]bool, len(ids))
+	var parts []string
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		parts = append(parts, strconv.FormatUint(uint64(id), 10))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "," + strings.Join(parts, ",") + ","
+}
+
+// firstNonNil 返回第一个非nil的值
+func firstNonNil(values ...*uint) *uint {
+	for _, v := range values {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
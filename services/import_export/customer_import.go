@@ -1,7 +1,10 @@
 package import_export
 
 import (
+	"encoding/json"
+	"erp/models"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -9,14 +12,21 @@ import (
 	"gorm.io/gorm"
 )
 
+// idCardPattern 居民身份证号格式（18位或15位）
+var idCardPattern = regexp.MustCompile(`^(\d{17}[\dXx]|\d{15})$`)
+
+// creditCodePattern 统一社会信用代码格式（18位，不含 I、O、S、V、Z）
+var creditCodePattern = regexp.MustCompile(`^[0-9A-HJ-NPQRTUWXY]{2}\d{6}[0-9A-HJ-NPQRTUWXY]{10}$`)
+
 // CustomerImportService 客户导入服务
 type CustomerImportService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	events eventPublisher
 }
 
 // NewCustomerImportService 创建客户导入服务
 func NewCustomerImportService(db *gorm.DB) *CustomerImportService {
-	return &CustomerImportService{db: db}
+	return &CustomerImportService{db: db, events: newEventPublisher(db)}
 }
 
 // ImportCustomersFromExcel 从Excel导入客户
@@ -81,6 +91,8 @@ func (s *CustomerImportService) ImportCustomersFromExcel(filePath string, strate
 		}
 	}
 
+	s.events.importCompleted("customers", result)
+
 	return result, nil
 }
 
@@ -94,16 +106,18 @@ type CustomerRowData struct {
 	RegisteredCapital float64
 	RepresentativeName   string
 	RepresentativeIDCard string
-	InvestorsInfo      string // 格式: 姓名:身份证号:持股比例;...
+	InvestorsInfo      string // 格式: 姓名:身份证号:持股比例;... 企业股东: 名称:统一社会信用代码:持股比例[:企业];...
 	ServicePeopleInfo  string // 格式: 姓名,姓名,姓名
 	AgreementsInfo     string // 格式: 有效期起:有效期止:收费类型:收费金额|...
+	Version            uint   // 导出时的版本号（可选），更新已存在客户时用于冲突检测
 }
 
 // InvestorInfo 投资人信息
 type InvestorInfo struct {
 	Name        string
-	IDCard      string
+	IDCard      string  // 自然人为身份证号，企业股东为统一社会信用代码
 	ShareRatio  float64
+	Corporate   bool    // 是否为企业股东
 }
 
 // AgreementInfo 协议信息
@@ -137,6 +151,15 @@ func (s *CustomerImportService) parseCustomerRow(row []string, colIndex map[stri
 		AgreementsInfo:     getCell("协议信息"),
 	}
 
+	// 解析版本号
+	if versionStr := getCell("版本"); versionStr != "" {
+		version, err := strconv.ParseUint(versionStr, 10, 32)
+		if err != nil {
+			return nil, &ImportError{Row: rowNum, Column: "版本", Message: "版本必须是整数"}
+		}
+		data.Version = uint(version)
+	}
+
 	// 解析注册资本
 	capitalStr := getCell("注册资本")
 	if capitalStr != "" {
@@ -189,7 +212,7 @@ func (s *CustomerImportService) importCustomer(data *CustomerRowData, strategy I
 
 	// 查询是否已存在
 	var existingCustomer map[string]interface{}
-	err := tx.Raw("SELECT id FROM customers WHERE tax_number = ?", data.TaxNumber).Scan(&existingCustomer).Error
+	err := tx.Raw("SELECT id, version FROM customers WHERE tax_number = ?", data.TaxNumber).Scan(&existingCustomer).Error
 	isConflict := err == nil && existingCustomer != nil
 
 	var customerID int64
@@ -200,19 +223,30 @@ func (s *CustomerImportService) importCustomer(data *CustomerRowData, strategy I
 			tx.Rollback()
 			return nil
 		case StrategyUpdate:
+			// 导入文件中的版本与当前版本不一致说明导出后记录已被修改
+			currentVersion, _ := existingCustomer["version"].(int64)
+			if data.Version != 0 && int64(data.Version) != currentVersion {
+				tx.Rollback()
+				return versionConflictError(rowNum, currentVersion, data.Version)
+			}
 			// 更新已存在的记录
-			err := tx.Table("customers").
-				Where("tax_number = ?", data.TaxNumber).
+			res := tx.Table("customers").
+				Where("tax_number = ? AND version = ?", data.TaxNumber, currentVersion).
 				Updates(map[string]interface{}{
 					"name":                data.Name,
 					"phone":               data.Phone,
 					"address":             data.Address,
 					"type":                data.CustomerType,
 					"registered_capital":  data.RegisteredCapital,
-				}).Error
-			if err != nil {
+					"version":             gorm.Expr("version + 1"),
+				})
+			if res.Error != nil {
 				tx.Rollback()
-				return &ImportError{Row: rowNum, Column: "", Message: fmt.Sprintf("更新客户失败: %v", err)}
+				return &ImportError{Row: rowNum, Column: "", Message: fmt.Sprintf("更新客户失败: %v", res.Error)}
+			}
+			if res.RowsAffected == 0 {
+				tx.Rollback()
+				return versionConflictError(rowNum, currentVersion, data.Version)
 			}
 			// 获取更新后的ID
 			tx.Raw("SELECT id FROM customers WHERE tax_number = ?", data.TaxNumber).Scan(&customerID)
@@ -234,6 +268,7 @@ func (s *CustomerImportService) importCustomer(data *CustomerRowData, strategy I
 	}
 
 	// 创建新客户记录
+	customerExisted := customerID != 0
 	if customerID == 0 {
 		err := tx.Table("customers").Create(map[string]interface{}{
 			"name":               data.Name,
@@ -243,7 +278,6 @@ func (s *CustomerImportService) importCustomer(data *CustomerRowData, strategy I
 			"type":               data.CustomerType,
 			"registered_capital": data.RegisteredCapital,
 			"representative_id":  nil,
-			"investor_ids":       "",
 		}).Error
 		if err != nil {
 			tx.Rollback()
@@ -265,7 +299,7 @@ func (s *CustomerImportService) importCustomer(data *CustomerRowData, strategy I
 		tx.Table("customers").Where("id = ?", customerID).Update("representative_id", repID)
 	}
 
-	// 处理投资人
+	// 处理投资人（自然人、本系统客户、外部法人）
 	if data.InvestorsInfo != "" {
 		investors, err := s.parseInvestorsInfo(data.InvestorsInfo, rowNum)
 		if err != nil {
@@ -273,18 +307,19 @@ func (s *CustomerImportService) importCustomer(data *CustomerRowData, strategy I
 			return err
 		}
 
-		var investorIDs []string
+		var investorInfos []models.InvestorInfo
 		for _, investor := range investors {
-			invID, invErr := s.getOrCreateInvestor(tx, investor.Name, investor.IDCard, rowNum)
+			info, invErr := s.resolveInvestor(tx, investor, customerID, rowNum)
 			if invErr != nil {
 				tx.Rollback()
 				return invErr
 			}
-			investorIDs = append(investorIDs, strconv.FormatInt(invID, 10))
+			investorInfos = append(investorInfos, *info)
 		}
 
 		// 更新客户的所有投资人（JSON格式）
-		tx.Table("customers").Where("id = ?", customerID).Update("investor_ids", strings.Join(investorIDs, ","))
+		investorsJSON, _ := json.Marshal(investorInfos)
+		tx.Table("customers").Where("id = ?", customerID).Update("investors", string(investorsJSON))
 	}
 
 	// 处理服务人员（验证必须存在）
@@ -318,12 +353,16 @@ func (s *CustomerImportService) importCustomer(data *CustomerRowData, strategy I
 				} else {
 					oldIDs = oldIDs + "," + strconv.FormatInt(customerID, 10)
 				}
-				tx.Table("people").Where("id = ?", sid).Update("service_customer_ids", oldIDs)
+				tx.Table("people").Where("id = ?", sid).Updates(map[string]interface{}{
+					"service_customer_ids": oldIDs,
+					"version":              gorm.Expr("version + 1"),
+				})
 			}
 		}
 	}
 
 	// 处理协议信息
+	var agreementIDs []int64
 	if data.AgreementsInfo != "" {
 		agreements, err := s.parseAgreementsInfo(data.AgreementsInfo, rowNum)
 		if err != nil {
@@ -359,6 +398,10 @@ func (s *CustomerImportService) importCustomer(data *CustomerRowData, strategy I
 				tx.Rollback()
 				return &ImportError{Row: rowNum, Column: "协议信息", Message: fmt.Sprintf("创建协议失败: %v", err)}
 			}
+
+			var agreementID int64
+			tx.Raw("SELECT last_insert_rowid()").Scan(&agreementID)
+			agreementIDs = append(agreementIDs, agreementID)
 		}
 	}
 
@@ -367,6 +410,22 @@ func (s *CustomerImportService) importCustomer(data *CustomerRowData, strategy I
 		return &ImportError{Row: rowNum, Column: "", Message: fmt.Sprintf("提交事务失败: %v", err)}
 	}
 
+	// 推送客户和协议事件
+	var customer models.Customer
+	if s.db.First(&customer, customerID).Error == nil {
+		eventType := models.WebhookEventCustomerCreated
+		if customerExisted {
+			eventType = models.WebhookEventCustomerUpdated
+		}
+		s.events.publish(eventType, customer)
+	}
+	for _, agreementID := range agreementIDs {
+		var agreement models.Agreement
+		if s.db.First(&agreement, agreementID).Error == nil {
+			s.events.publish(models.WebhookEventAgreementCreated, agreement)
+		}
+	}
+
 	return nil
 }
 
@@ -428,6 +487,95 @@ func (s *CustomerImportService) getOrCreateInvestor(tx *gorm.DB, name, idCard st
 	return newID, nil
 }
 
+// resolveInvestor 将导入的投资人解析为投资人JSON项，并维护反向关联
+// 企业股东的统一社会信用代码与本系统客户税号一致时关联该客户，否则关联（或创建）外部法人
+func (s *CustomerImportService) resolveInvestor(tx *gorm.DB, investor InvestorInfo, customerID int64, rowNum int) (*models.InvestorInfo, *ImportError) {
+	if !investor.Corporate {
+		invID, invErr := s.getOrCreateInvestor(tx, investor.Name, investor.IDCard, rowNum)
+		if invErr != nil {
+			return nil, invErr
+		}
+		appendCustomerID(tx, "people", "investor_customer_ids", invID, customerID)
+		return &models.InvestorInfo{
+			InvestorType: models.InvestorTypePerson,
+			PersonID:     uint(invID),
+			ShareRatio:   investor.ShareRatio,
+		}, nil
+	}
+
+	var corpID int64
+	tx.Raw("SELECT id FROM customers WHERE tax_number = ?", investor.IDCard).Scan(&corpID)
+	if corpID != 0 {
+		if corpID == customerID {
+			return nil, &ImportError{Row: rowNum, Column: "投资人信息", Message: fmt.Sprintf("企业不能作为自身的投资人: %s", investor.Name)}
+		}
+		appendCustomerID(tx, "customers", "invested_customer_ids", corpID, customerID)
+		return &models.InvestorInfo{
+			InvestorType: models.InvestorTypeCustomer,
+			CustomerID:   uint(corpID),
+			ShareRatio:   investor.ShareRatio,
+		}, nil
+	}
+
+	entityID, entErr := s.getOrCreateLegalEntity(tx, investor.Name, investor.IDCard, rowNum)
+	if entErr != nil {
+		return nil, entErr
+	}
+	appendCustomerID(tx, "legal_entities", "investor_customer_ids", entityID, customerID)
+	return &models.InvestorInfo{
+		InvestorType: models.InvestorTypeEntity,
+		EntityID:     uint(entityID),
+		ShareRatio:   investor.ShareRatio,
+	}, nil
+}
+
+// getOrCreateLegalEntity 获取或创建外部法人实体
+func (s *CustomerImportService) getOrCreateLegalEntity(tx *gorm.DB, name, creditCode string, rowNum int) (int64, *ImportError) {
+	// 先查询是否存在
+	var entity map[string]interface{}
+	err := tx.Raw("SELECT id FROM legal_entities WHERE credit_code = ?", creditCode).Scan(&entity).Error
+	if err == nil && entity != nil {
+		return int64(entity["id"].(int64)), nil
+	}
+
+	// 不存在则创建
+	err = tx.Table("legal_entities").Create(map[string]interface{}{
+		"name":                  name,
+		"credit_code":           creditCode,
+		"remark":                "",
+		"investor_customer_ids": "",
+	}).Error
+	if err != nil {
+		return 0, &ImportError{Row: rowNum, Column: "投资人信息", Message: fmt.Sprintf("创建外部法人失败: %v", err)}
+	}
+
+	var newID int64
+	tx.Raw("SELECT last_insert_rowid()").Scan(&newID)
+	return newID, nil
+}
+
+// appendCustomerID 向逗号分隔的客户ID字段追加客户ID（已存在则跳过）
+func appendCustomerID(tx *gorm.DB, table, column string, id, customerID int64) {
+	var current string
+	tx.Raw("SELECT COALESCE("+column+", '') FROM "+table+" WHERE id = ?", id).Scan(&current)
+
+	idStr := strconv.FormatInt(customerID, 10)
+	for _, existing := range strings.Split(current, ",") {
+		if strings.TrimSpace(existing) == idStr {
+			return
+		}
+	}
+	if current == "" {
+		current = idStr
+	} else {
+		current = current + "," + idStr
+	}
+	tx.Table(table).Where("id = ?", id).Updates(map[string]interface{}{
+		column:    current,
+		"version": gorm.Expr("version + 1"),
+	})
+}
+
 // parseInvestorsInfo 解析投资人信息
 func (s *CustomerImportService) parseInvestorsInfo(info string, rowNum int) ([]InvestorInfo, *ImportError) {
 	if info == "" {
@@ -443,9 +591,9 @@ func (s *CustomerImportService) parseInvestorsInfo(info string, rowNum int) ([]I
 			continue
 		}
 
-		// 格式: 姓名:身份证号:持股比例
+		// 格式: 姓名:身份证号:持股比例，企业股东: 名称:统一社会信用代码:持股比例[:企业]
 		fields := strings.Split(part, ":")
-		if len(fields) != 3 {
+		if len(fields) != 3 && len(fields) != 4 {
 			return nil, &ImportError{Row: rowNum, Column: "投资人信息", Message: fmt.Sprintf("投资人信息格式错误，应为: 姓名:身份证号:持股比例;..., 当前: %s", part)}
 		}
 
@@ -462,10 +610,25 @@ func (s *CustomerImportService) parseInvestorsInfo(info string, rowNum int) ([]I
 			return nil, &ImportError{Row: rowNum, Column: "投资人信息", Message: fmt.Sprintf("持股比例必须是数字: %s", shareRatioStr)}
 		}
 
+		// 投资人类型：显式指定，或证件号符合统一社会信用代码格式（且不是身份证号）时视为企业；
+		// 护照、港澳台通行证等其他证件均按自然人处理
+		corporate := !idCardPattern.MatchString(idCard) && creditCodePattern.MatchString(strings.ToUpper(idCard))
+		if len(fields) == 4 {
+			switch strings.TrimSpace(fields[3]) {
+			case "个人", "自然人":
+				corporate = false
+			case "企业":
+				corporate = true
+			default:
+				return nil, &ImportError{Row: rowNum, Column: "投资人信息", Message: fmt.Sprintf("投资人类型必须是: 个人、企业, 当前: %s", fields[3])}
+			}
+		}
+
 		investors = append(investors, InvestorInfo{
 			Name:       name,
 			IDCard:     idCard,
 			ShareRatio: shareRatio,
+			Corporate:  corporate,
 		})
 	}
 
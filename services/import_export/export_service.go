@@ -1,10 +1,13 @@
 package import_export
 
 import (
+	"encoding/json"
+	"erp/models"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -30,7 +33,7 @@ func (s *ExportService) ExportPeopleToExcel() ([]byte, string, error) {
 	excelService.SetActiveSheet(sheetName)
 
 	// 设置表头
-	headers := []string{"姓名", "类型", "电话", "身份证号", "登录密码"}
+	headers := []string{"姓名", "类型", "电话", "身份证号", "登录密码", "版本"}
 	if err := excelService.SetSheetHeader(sheetName, headers); err != nil {
 		return nil, "", fmt.Errorf("设置表头失败: %w", err)
 	}
@@ -38,7 +41,7 @@ func (s *ExportService) ExportPeopleToExcel() ([]byte, string, error) {
 	// 查询所有人员
 	var people []map[string]interface{}
 	err := s.db.Table("people").
-		Select("id, type, name, phone, id_card, password").
+		Select("id, type, name, phone, id_card, password, version").
 		Order("id ASC").
 		Find(&people).Error
 	if err != nil {
@@ -54,6 +57,7 @@ func (s *ExportService) ExportPeopleToExcel() ([]byte, string, error) {
 			person["phone"],
 			person["id_card"],
 			person["password"],
+			person["version"],
 		}
 	}
 
@@ -64,7 +68,7 @@ func (s *ExportService) ExportPeopleToExcel() ([]byte, string, error) {
 	// 设置数据边框
 	if len(data) > 0 {
 		startCell, _ := excelize.CoordinatesToCellName(1, 2)
-		endCell, _ := excelize.CoordinatesToCellName(5, 2+len(data)-1)
+		endCell, _ := excelize.CoordinatesToCellName(6, 2+len(data)-1)
 		excelService.SetBorderStyle(sheetName, startCell, endCell)
 	}
 
@@ -100,7 +104,7 @@ func (s *ExportService) ExportCustomersToExcel() ([]byte, string, error) {
 	// 设置表头
 	headers := []string{
 		"公司名称", "联系电话", "地址", "税号", "客户类型", "注册资本",
-		"法定代表人", "投资人", "服务人员", "协议信息",
+		"法定代表人", "投资人", "服务人员", "协议信息", "版本",
 	}
 	if err := excelService.SetSheetHeader(sheetName, headers); err != nil {
 		return nil, "", fmt.Errorf("设置表头失败: %w", err)
@@ -109,7 +113,7 @@ func (s *ExportService) ExportCustomersToExcel() ([]byte, string, error) {
 	// 查询所有客户
 	var customers []map[string]interface{}
 	err := s.db.Table("customers").
-		Select("id, name, phone, address, tax_number, type, registered_capital, representative_id, investor_ids").
+		Select("id, name, phone, address, tax_number, type, registered_capital, representative_id, investors, version").
 		Order("id ASC").
 		Find(&customers).Error
 	if err != nil {
@@ -132,20 +136,8 @@ func (s *ExportService) ExportCustomersToExcel() ([]byte, string, error) {
 			}
 		}
 
-		// 获取投资人信息
-		investorsInfo := ""
-		if customer["investor_ids"] != nil && customer["investor_ids"].(string) != "" {
-			investorIDs := customer["investor_ids"].(string)
-			var investors []map[string]interface{}
-			s.db.Raw("SELECT id, name, id_card FROM people WHERE id IN ("+investorIDs+")").Scan(&investors)
-			if len(investors) > 0 {
-				var investorStrs []string
-				for _, inv := range investors {
-					investorStrs = append(investorStrs, fmt.Sprintf("%s:%s", inv["name"], inv["id_card"]))
-				}
-				investorsInfo = fmt.Sprintf("%s", investorStrs)
-			}
-		}
+		// 获取投资人信息（格式与导入一致: 姓名:身份证号:持股比例;名称:统一社会信用代码:持股比例:企业）
+		investorsInfo := s.formatInvestors(customer["investors"])
 
 		// 获取服务人员信息
 		serviceNames := ""
@@ -201,6 +193,7 @@ func (s *ExportService) ExportCustomersToExcel() ([]byte, string, error) {
 			investorsInfo,
 			serviceNames,
 			agreementsInfo,
+			customer["version"],
 		}
 	}
 
@@ -241,6 +234,47 @@ func (s *ExportService) ExportCustomersToExcel() ([]byte, string, error) {
 	return content, filename, nil
 }
 
+// formatInvestors 将客户的投资人JSON格式化为导入格式
+func (s *ExportService) formatInvestors(raw interface{}) string {
+	var content []byte
+	switch v := raw.(type) {
+	case string:
+		content = []byte(v)
+	case []byte:
+		content = v
+	default:
+		return ""
+	}
+
+	var investorInfos []models.InvestorInfo
+	if err := json.Unmarshal(content, &investorInfos); err != nil {
+		return ""
+	}
+
+	var investorStrs []string
+	for _, info := range investorInfos {
+		var row map[string]interface{}
+		switch info.ResolvedType() {
+		case models.InvestorTypePerson:
+			s.db.Raw("SELECT name, id_card AS code FROM people WHERE id = ?", info.PersonID).Scan(&row)
+		case models.InvestorTypeCustomer:
+			s.db.Raw("SELECT name, tax_number AS code FROM customers WHERE id = ?", info.CustomerID).Scan(&row)
+		case models.InvestorTypeEntity:
+			s.db.Raw("SELECT name, credit_code AS code FROM legal_entities WHERE id = ?", info.EntityID).Scan(&row)
+		}
+		if row == nil {
+			continue
+		}
+
+		item := fmt.Sprintf("%v:%v:%s", row["name"], row["code"], FormatFloat(info.ShareRatio))
+		if info.ResolvedType() != models.InvestorTypePerson {
+			item += ":企业"
+		}
+		investorStrs = append(investorStrs, item)
+	}
+	return strings.Join(investorStrs, ";")
+}
+
 // FormatInt64 格式化int64为字符串
 func FormatInt64(n int64) string {
 	return strconv.FormatInt(n, 10)
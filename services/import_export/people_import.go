@@ -2,7 +2,12 @@ package import_export
 
 import (
 	"bytes"
+	"erp/models"
+	"erp/services/eventlog"
+	"erp/services/webhook"
 	"fmt"
+	"log"
+	"strconv"
 	"strings"
 
 	"github.com/xuri/excelize/v2"
@@ -25,6 +30,14 @@ type ImportError struct {
 	Message string `json:"message"` // 错误信息
 }
 
+// versionConflictError 导入文件中的版本与数据库当前版本不一致
+func versionConflictError(rowNum int, current int64, version uint) *ImportError {
+	return &ImportError{
+		Row: rowNum, Column: "版本",
+		Message: fmt.Sprintf("版本冲突：该记录已被修改（当前版本 %d，导入文件版本 %d），请重新导出后再导入", current, version),
+	}
+}
+
 // ImportResult 导入结果
 type ImportResult struct {
 	Total   int           `json:"total"`   // 总行数
@@ -35,12 +48,13 @@ type ImportResult struct {
 
 // PeopleImportService 人员导入服务
 type PeopleImportService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	events eventPublisher
 }
 
 // NewPeopleImportService 创建人员导入服务
 func NewPeopleImportService(db *gorm.DB) *PeopleImportService {
-	return &PeopleImportService{db: db}
+	return &PeopleImportService{db: db, events: newEventPublisher(db)}
 }
 
 // ImportPeopleFromExcel 从Excel导入人员
@@ -105,6 +119,8 @@ func (s *PeopleImportService) ImportPeopleFromExcel(filePath string, strategy Im
 		}
 	}
 
+	s.events.importCompleted("people", result)
+
 	return result, nil
 }
 
@@ -115,6 +131,7 @@ type PersonRowData struct {
 	Phone    string
 	IDCard   string
 	Password string
+	Version  uint // 导出时的版本号（可选），更新已存在人员时用于冲突检测
 }
 
 // parsePersonRow 解析人员行数据
@@ -135,6 +152,15 @@ func (s *PeopleImportService) parsePersonRow(row []string, colIndex map[string]i
 		Password: getCell("登录密码"),
 	}
 
+	// 解析版本号
+	if versionStr := getCell("版本"); versionStr != "" {
+		version, err := strconv.ParseUint(versionStr, 10, 32)
+		if err != nil {
+			return nil, &ImportError{Row: rowNum, Column: "版本", Message: "版本必须是整数"}
+		}
+		data.Version = uint(version)
+	}
+
 	// 验证必填字段
 	if data.Name == "" {
 		return nil, &ImportError{Row: rowNum, Column: "姓名", Message: "姓名不能为空"}
@@ -177,7 +203,7 @@ func (s *PeopleImportService) parsePersonRow(row []string, colIndex map[string]i
 func (s *PeopleImportService) importPerson(data *PersonRowData, strategy ImportStrategy, rowNum int, result *ImportResult) *ImportError {
 	// 查询是否已存在
 	var existingPerson map[string]interface{}
-	err := s.db.Raw("SELECT id, type FROM people WHERE id_card = ?", data.IDCard).Scan(&existingPerson).Error
+	err := s.db.Raw("SELECT id, type, version FROM people WHERE id_card = ?", data.IDCard).Scan(&existingPerson).Error
 	isConflict := err == nil && existingPerson != nil
 
 	if isConflict {
@@ -186,17 +212,26 @@ func (s *PeopleImportService) importPerson(data *PersonRowData, strategy ImportS
 			// 跳过已存在的记录
 			return nil
 		case StrategyUpdate:
+			// 导入文件中的版本与当前版本不一致说明导出后记录已被修改
+			currentVersion, _ := existingPerson["version"].(int64)
+			if data.Version != 0 && int64(data.Version) != currentVersion {
+				return versionConflictError(rowNum, currentVersion, data.Version)
+			}
 			// 更新已存在的记录
-			err := s.db.Table("people").
-				Where("id_card = ?", data.IDCard).
+			res := s.db.Table("people").
+				Where("id_card = ? AND version = ?", data.IDCard, currentVersion).
 				Updates(map[string]interface{}{
 					"name":   data.Name,
 					"type":   data.Type,
 					"phone":  data.Phone,
 					"password": data.Password,
-				}).Error
-			if err != nil {
-				return &ImportError{Row: rowNum, Column: "", Message: fmt.Sprintf("更新失败: %v", err)}
+					"version": gorm.Expr("version + 1"),
+				})
+			if res.Error != nil {
+				return &ImportError{Row: rowNum, Column: "", Message: fmt.Sprintf("更新失败: %v", res.Error)}
+			}
+			if res.RowsAffected == 0 {
+				return versionConflictError(rowNum, currentVersion, data.Version)
 			}
 			return nil
 		case StrategyCreateNew:
@@ -274,3 +309,34 @@ func ValidateExcelFile(filename string, content []byte) error {
 
 	return nil
 }
+
+// eventPublisher 导入过程中的事件发布：写入实时事件日志并推送Webhook
+type eventPublisher struct {
+	eventLog *eventlog.Recorder
+	webhooks *webhook.Dispatcher
+}
+
+// newEventPublisher 创建事件发布器
+func newEventPublisher(db *gorm.DB) eventPublisher {
+	return eventPublisher{eventLog: eventlog.NewRecorder(db), webhooks: webhook.NewDispatcher(db)}
+}
+
+// publish 发布事件，失败只记录日志
+func (p eventPublisher) publish(eventType string, data interface{}) {
+	if err := p.eventLog.Record(eventType, data); err != nil {
+		log.Printf("Failed to record event %s: %v", eventType, err)
+	}
+	if err := p.webhooks.Emit(eventType, data); err != nil {
+		log.Printf("Failed to emit webhook event %s: %v", eventType, err)
+	}
+}
+
+// importCompleted 发布导入完成事件
+func (p eventPublisher) importCompleted(importType string, result *ImportResult) {
+	p.publish(models.WebhookEventImportCompleted, map[string]interface{}{
+		"type":    importType,
+		"total":   result.Total,
+		"success": result.Success,
+		"failed":  result.Failed,
+	})
+}
@@ -145,6 +145,7 @@ func (s *TemplateService) GenerateCustomersTemplate() ([]byte, string, error) {
 		{"法定代表人身份证", "法定代表人身份证号", "110101199001011234", "否"},
 		{"投资人信息", "格式：姓名:身份证号:持股比例;姓名:身份证号:持股比例", "李四:110101199002021234:51;王五:110101199003031234:49", "否"},
 		{"", "多个投资人用分号;分隔", "", ""},
+		{"", "企业股东格式：名称:统一社会信用代码:持股比例:企业（与本系统客户税号一致时自动关联该客户）", "某某投资有限公司:91110000MA00ABCD1X:30:企业", ""},
 		{"服务人员信息", "格式：姓名,姓名,姓名（逗号分隔）", "赵六,钱七", "否"},
 		{"", "服务人员必须已存在于系统中", "", ""},
 		{"协议信息", "格式：有效期起:有效期止:收费类型:收费金额", "2024-01-01:2024-12-31:月度:500", "否"},
@@ -186,6 +187,51 @@ func (s *TemplateService) GenerateCustomersTemplate() ([]byte, string, error) {
 	return content, "客户导入模板.xlsx", nil
 }
 
+// GenerateInvoicesTemplate 生成发票导入模板，列名与开票平台导出的发票基础信息一致，可直接导入平台导出文件
+func (s *TemplateService) GenerateInvoicesTemplate() ([]byte, string, error) {
+	defer s.excelService.Close()
+
+	// 导入时读取第一个工作表
+	sheetName := "发票导入"
+	s.excelService.GetFile().SetSheetName("Sheet1", sheetName)
+
+	// 设置表头
+	headers := []string{
+		"发票代码", "发票号码", "数电票号码", "发票票种", "购方识别号", "购买方名称", "开票日期",
+		"金额", "税额", "价税合计", "税率", "发票状态", "备注", "收款记录ID", "协议编号",
+	}
+	if err := s.excelService.SetSheetHeader(sheetName, headers); err != nil {
+		return nil, "", fmt.Errorf("设置表头失败: %w", err)
+	}
+
+	// 添加示例数据
+	sampleData := [][]interface{}{
+		{"", "", "24442000000012345678", "数电票（普通发票）", "91440300MA5XXXXXX1", "深圳某某科技有限公司", "2024-03-15 10:20:30",
+			"2830.19", "169.81", "3000", "6%", "正常", "2024年一季度代理记账费", "12", "HT-2024-001"},
+		{"044002300111", "01234567", "", "增值税专用发票", "91440300MA5XXXXXX2", "深圳某某贸易有限公司", "2024-03-20",
+			"1886.79", "113.21", "2000", "6%", "正常", "", "", ""},
+	}
+	if err := s.excelService.WriteRows(sheetName, 2, sampleData); err != nil {
+		return nil, "", fmt.Errorf("写入示例数据失败: %w", err)
+	}
+	if err := s.excelService.SetBorderStyle(sheetName, "A2", fmt.Sprintf("O%d", 1+len(sampleData))); err != nil {
+		return nil, "", fmt.Errorf("设置边框失败: %w", err)
+	}
+
+	// 保存到临时文件
+	tempFile := filepath.Join(os.TempDir(), "invoices_import_template.xlsx")
+	if err := s.excelService.SaveAs(tempFile); err != nil {
+		return nil, "", fmt.Errorf("保存模板失败: %w", err)
+	}
+	content, err := os.ReadFile(tempFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("读取模板文件失败: %w", err)
+	}
+	os.Remove(tempFile)
+
+	return content, "发票导入模板.xlsx", nil
+}
+
 // DownloadTemplateResponse 下载模板的响应处理
 func (s *TemplateService) DownloadTemplateResponse(c *gin.Context, templateType string) {
 	var content []byte
@@ -197,6 +243,8 @@ func (s *TemplateService) DownloadTemplateResponse(c *gin.Context, templateType
 		content, filename, err = s.GeneratePeopleTemplate()
 	case "customers":
 		content, filename, err = s.GenerateCustomersTemplate()
+	case "invoices":
+		content, filename, err = s.GenerateInvoicesTemplate()
 	default:
 		c.JSON(400, gin.H{"code": 1, "message": "不支持的模板类型"})
 		return
@@ -0,0 +1,96 @@
+package notification
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPConfig 邮件服务器配置
+type SMTPConfig struct {
+	Host     string // 为空时不发送邮件
+	Port     int
+	Username string // 为空时不进行认证（如本地 MailHog/Mailpit）
+	Password string
+	From     string
+}
+
+// EmailSender 通过SMTP发送邮件
+type EmailSender struct {
+	cfg SMTPConfig
+}
+
+// NewEmailSender 创建邮件发送器，未配置SMTP服务器时返回nil
+func NewEmailSender(cfg SMTPConfig) *EmailSender {
+	if cfg.Host == "" {
+		return nil
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 25
+	}
+	return &EmailSender{cfg: cfg}
+}
+
+// Send 发送纯文本邮件
+func (s *EmailSender) Send(to, subject, body string) error {
+	if s == nil {
+		return errors.New("smtp is not configured")
+	}
+
+	// 收件人来自人员资料，解析后再写入邮件头，防止换行注入额外的邮件头
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", to, err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", rcpt.String())
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", s.cfg.Host, s.cfg.Port)
+	return smtp.SendMail(addr, auth, s.cfg.From, []string{rcpt.Address}, msg.Bytes())
+}
+
+// WebhookSender 以JSON POST方式推送通知
+type WebhookSender struct {
+	client *http.Client
+}
+
+// NewWebhookSender 创建Webhook发送器
+func NewWebhookSender() *WebhookSender {
+	return &WebhookSender{client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Send 推送JSON内容，非2xx响应视为失败
+func (s *WebhookSender) Send(url, payload string) error {
+	resp, err := s.client.Post(url, "application/json", strings.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook responded %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
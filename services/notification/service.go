@@ -0,0 +1,291 @@
+package notification
+
+import (
+	"encoding/json"
+	"erp/models"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxAttempts 邮件/Webhook最大投递次数
+	MaxAttempts = 5
+	// retryBaseDelay 首次重试间隔，之后每次翻倍
+	retryBaseDelay = time.Minute
+	// outboxBatchSize 每次处理的发件箱条数
+	outboxBatchSize = 100
+)
+
+// defaultChannels 未设置偏好时的接收渠道
+var defaultChannels = []models.NotificationChannel{models.NotificationChannelInbox, models.NotificationChannelEmail}
+
+// Message 待发送的通知
+type Message struct {
+	Event     models.NotificationEvent
+	PersonIDs []uint                 // 接收人
+	Data      map[string]interface{} // 模板数据
+	RefType   string                 // 关联对象类型
+	RefID     uint                   // 关联对象ID
+	DedupKey  string                 // 去重键，非空时同一接收人只通知一次
+}
+
+// Service 通知服务：按人员偏好写入站内信，并将邮件/Webhook写入发件箱异步投递
+type Service struct {
+	db      *gorm.DB
+	email   *EmailSender
+	webhook *WebhookSender
+}
+
+// NewService 创建通知服务，email 为nil时不发送邮件
+func NewService(db *gorm.DB, email *EmailSender, webhook *WebhookSender) *Service {
+	return &Service{db: db, email: email, webhook: webhook}
+}
+
+// Notify 发送通知，返回实际通知的人数
+func (s *Service) Notify(msg Message) (int, error) {
+	tmpl := s.Template(msg.Event)
+	subject, err := render(tmpl.Subject, msg.Data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to render subject: %w", err)
+	}
+	body, err := render(tmpl.Body, msg.Data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to render body: %w", err)
+	}
+
+	notified := 0
+	for _, personID := range uniqueIDs(msg.PersonIDs) {
+		// 去重记录与站内信/发件箱在同一事务中写入，投递失败时一并回滚，下次可重新通知
+		delivered := false
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if msg.DedupKey != "" {
+				dispatch := models.NotificationDispatch{DedupKey: fmt.Sprintf("%s:%d", msg.DedupKey, personID)}
+				result := tx.Where(dispatch).FirstOrCreate(&dispatch)
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected == 0 {
+					return nil
+				}
+			}
+			delivered = true
+			return s.deliver(tx, personID, msg, subject, body)
+		})
+		if err != nil {
+			return notified, err
+		}
+		if delivered {
+			notified++
+		}
+	}
+	return notified, nil
+}
+
+// deliver 按人员偏好投递到各渠道，写入使用调用方的事务
+func (s *Service) deliver(tx *gorm.DB, personID uint, msg Message, subject, body string) error {
+	var person models.Person
+	if err := tx.First(&person, personID).Error; err != nil {
+		return nil
+	}
+
+	channels, webhookURL := s.Channels(personID, msg.Event)
+	now := time.Now()
+	for _, channel := range channels {
+		switch channel {
+		case models.NotificationChannelInbox:
+			if err := tx.Create(&models.Notification{
+				PersonID: personID,
+				Event:    msg.Event,
+				Title:    subject,
+				Content:  body,
+				RefType:  msg.RefType,
+				RefID:    msg.RefID,
+			}).Error; err != nil {
+				return err
+			}
+
+		case models.NotificationChannelEmail:
+			if person.Email == "" || s.email == nil {
+				continue
+			}
+			if err := s.enqueue(tx, models.NotificationOutbox{
+				Channel:       channel,
+				PersonID:      personID,
+				Event:         msg.Event,
+				Recipient:     person.Email,
+				Subject:       subject,
+				Body:          body,
+				NextAttemptAt: now,
+			}); err != nil {
+				return err
+			}
+
+		case models.NotificationChannelWebhook:
+			if webhookURL == "" {
+				continue
+			}
+			payload, _ := json.Marshal(map[string]interface{}{
+				"event":      msg.Event,
+				"person_id":  personID,
+				"title":      subject,
+				"content":    body,
+				"ref_type":   msg.RefType,
+				"ref_id":     msg.RefID,
+				"created_at": now,
+			})
+			if err := s.enqueue(tx, models.NotificationOutbox{
+				Channel:       channel,
+				PersonID:      personID,
+				Event:         msg.Event,
+				Recipient:     webhookURL,
+				Subject:       subject,
+				Body:          string(payload),
+				NextAttemptAt: now,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// enqueue 写入发件箱
+func (s *Service) enqueue(tx *gorm.DB, item models.NotificationOutbox) error {
+	item.Status = models.OutboxStatusPending
+	return tx.Create(&item).Error
+}
+
+// ProcessOutbox 投递到期的发件箱记录，失败后按指数退避重试，超过最大次数标记为失败
+func (s *Service) ProcessOutbox() error {
+	var items []models.NotificationOutbox
+	if err := s.db.Where("status = ? AND next_attempt_at <= ?", models.OutboxStatusPending, time.Now()).
+		Order("next_attempt_at ASC").
+		Limit(outboxBatchSize).
+		Find(&items).Error; err != nil {
+		return err
+	}
+
+	for i := range items {
+		s.attempt(&items[i])
+	}
+	return nil
+}
+
+// Retry 立即重新投递指定记录（包括已失败的记录）
+func (s *Service) Retry(id uint) (*models.NotificationOutbox, error) {
+	var item models.NotificationOutbox
+	if err := s.db.First(&item, id).Error; err != nil {
+		return nil, err
+	}
+	if item.Status == models.OutboxStatusSent {
+		return &item, fmt.Errorf("notification %d has already been sent", id)
+	}
+
+	item.Attempts = 0
+	s.attempt(&item)
+	return &item, nil
+}
+
+// attempt 投递一次并更新状态
+func (s *Service) attempt(item *models.NotificationOutbox) {
+	var err error
+	switch item.Channel {
+	case models.NotificationChannelEmail:
+		err = s.email.Send(item.Recipient, item.Subject, item.Body)
+	case models.NotificationChannelWebhook:
+		err = s.webhook.Send(item.Recipient, item.Body)
+	default:
+		err = fmt.Errorf("unsupported channel: %s", item.Channel)
+	}
+
+	item.Attempts++
+	now := time.Now()
+	if err == nil {
+		item.Status = models.OutboxStatusSent
+		item.SentAt = &now
+		item.LastError = ""
+	} else {
+		item.LastError = err.Error()
+		if item.Attempts >= MaxAttempts {
+			item.Status = models.OutboxStatusFailed
+		} else {
+			item.Status = models.OutboxStatusPending
+			item.NextAttemptAt = now.Add(retryBaseDelay << (item.Attempts - 1))
+		}
+		log.Printf("Notification %d (%s to %s) attempt %d failed: %v", item.ID, item.Channel, item.Recipient, item.Attempts, err)
+	}
+
+	s.db.Model(item).Select("status", "attempts", "next_attempt_at", "last_error", "sent_at").Updates(item)
+}
+
+// Channels 获取人员对某事件的接收渠道和webhook地址
+// 优先使用该事件的偏好，其次为 "*" 默认偏好，均未设置时使用站内信+邮件
+func (s *Service) Channels(personID uint, event models.NotificationEvent) ([]models.NotificationChannel, string) {
+	var prefs []models.NotificationPreference
+	s.db.Where("person_id = ? AND event IN ?", personID, []models.NotificationEvent{event, models.NotificationEventAll}).Find(&prefs)
+
+	var specific, fallback *models.NotificationPreference
+	for i := range prefs {
+		if prefs[i].Event == event {
+			specific = &prefs[i]
+		} else {
+			fallback = &prefs[i]
+		}
+	}
+
+	pref := specific
+	if pref == nil {
+		pref = fallback
+	}
+	if pref == nil {
+		return defaultChannels, ""
+	}
+
+	webhookURL := pref.WebhookURL
+	if webhookURL == "" && fallback != nil {
+		webhookURL = fallback.WebhookURL
+	}
+	return ParseChannels(pref.Channels), webhookURL
+}
+
+// Template 获取事件的有效模板（自定义模板优先）
+func (s *Service) Template(event models.NotificationEvent) Template {
+	var custom models.NotificationTemplate
+	if s.db.Where("event = ?", event).First(&custom).Error == nil {
+		return Template{Event: event, Subject: custom.Subject, Body: custom.Body, Custom: true}
+	}
+	tmpl := DefaultTemplates[event]
+	tmpl.Event = event
+	return tmpl
+}
+
+// ParseChannels 解析逗号分隔的渠道列表，忽略无效值
+func ParseChannels(s string) []models.NotificationChannel {
+	channels := []models.NotificationChannel{}
+	for _, part := range strings.Split(s, ",") {
+		channel := models.NotificationChannel(strings.TrimSpace(part))
+		switch channel {
+		case models.NotificationChannelInbox, models.NotificationChannelEmail, models.NotificationChannelWebhook:
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// uniqueIDs 去除重复和为0的ID
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	result := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package notification
+
+import (
+	"bytes"
+	"erp/models"
+	"fmt"
+	"text/template"
+)
+
+// Template 通知模板
+type Template struct {
+	Event   models.NotificationEvent `json:"event"`
+	Subject string                   `json:"subject"`
+	Body    string                   `json:"body"`
+	Custom  bool                     `json:"custom"` // 是否为自定义模板
+}
+
+// DefaultTemplates 内置模板，可通过 NotificationTemplate 表按事件覆盖
+var DefaultTemplates = map[models.NotificationEvent]Template{
+	models.NotificationEventTaskDueSoon: {
+		Subject: "任务即将到期：{{.TaskTitle}}",
+		Body:    "任务「{{.TaskTitle}}」（客户：{{.CustomerName}}）将于 {{.DueDate}} 到期，请及时处理。",
+	},
+	models.NotificationEventTaskOverdue: {
+		Subject: "任务已逾期：{{.TaskTitle}}",
+		Body:    "任务「{{.TaskTitle}}」（客户：{{.CustomerName}}）已于 {{.DueDate}} 到期，目前状态为「{{.Status}}」，请尽快处理。",
+	},
+	models.NotificationEventAgreementExpiring: {
+		Subject: "协议即将到期：{{.AgreementNumber}}",
+		Body:    "客户「{{.CustomerName}}」的代理记账协议 {{.AgreementNumber}} 将于 {{.EndDate}} 到期（剩余 {{.DaysLeft}} 天），请及时联系续签。",
+	},
+	models.NotificationEventPaymentRecorded: {
+		Subject: "收款登记：{{.CustomerName}} {{.Amount}}元",
+		Body:    "已登记客户「{{.CustomerName}}」的收款 {{.Amount}} 元（{{.PaymentMethod}}，{{.PaymentDate}}），所属期间 {{.Period}}。",
+	},
+	models.NotificationEventHandoverReceived: {
+		Subject: "工作交接：{{.FromPersonName}} 的工作已转交给您",
+		Body:    "{{.FromPersonName}} 的工作已转交给您：客户 {{.CustomerCount}} 家、未完成任务 {{.TaskCount}} 项。{{if .Reason}}原因：{{.Reason}}。{{end}}请查看交接清单逐项确认。",
+	},
+}
+
+// ValidateTemplate 检查模板语法
+func ValidateTemplate(subject, body string) error {
+	if _, err := template.New("subject").Parse(subject); err != nil {
+		return fmt.Errorf("invalid subject template: %w", err)
+	}
+	if _, err := template.New("body").Parse(body); err != nil {
+		return fmt.Errorf("invalid body template: %w", err)
+	}
+	return nil
+}
+
+// render 渲染模板
+func render(text string, data map[string]interface{}) (string, error) {
+	tmpl, err := template.New("notification").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,147 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// A4 纸张尺寸（单位：pt）
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Document 简单的PDF文档，支持中文文本、直线和矩形
+// 中文使用阅读器内置的 STSong-Light 字体（Adobe-GB1），不嵌入字体文件，
+// 阅读器需安装中文字体支持包（Adobe Reader、浏览器、macOS 预览等默认支持）
+type Document struct {
+	pages   []*bytes.Buffer
+	current *bytes.Buffer
+}
+
+// New 创建空白PDF文档
+func New() *Document {
+	return &Document{}
+}
+
+// AddPage 新增一页，之后的绘制内容写入该页
+func (d *Document) AddPage() {
+	d.current = &bytes.Buffer{}
+	d.pages = append(d.pages, d.current)
+}
+
+// Text 在 (x, y) 处写入文本，坐标以页面左上角为原点，y 为文本基线位置
+func (d *Document) Text(x, y, size float64, text string) {
+	d.ensurePage()
+	fmt.Fprintf(d.current, "BT /F1 %.2f Tf %.2f %.2f Td <%s> Tj ET\n", size, x, PageHeight-y, encodeText(text))
+}
+
+// TextRight 写入右对齐文本，x 为文本右边界
+func (d *Document) TextRight(x, y, size float64, text string) {
+	d.Text(x-TextWidth(text, size), y, size, text)
+}
+
+// TextCenter 写入居中文本，x 为文本中心
+func (d *Document) TextCenter(x, y, size float64, text string) {
+	d.Text(x-TextWidth(text, size)/2, y, size, text)
+}
+
+// Line 绘制直线
+func (d *Document) Line(x1, y1, x2, y2, width float64) {
+	d.ensurePage()
+	fmt.Fprintf(d.current, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, PageHeight-y1, x2, PageHeight-y2)
+}
+
+// FillRect 以灰度填充矩形，gray 取 0（黑）到 1（白），(x, y) 为左上角
+func (d *Document) FillRect(x, y, w, h, gray float64) {
+	d.ensurePage()
+	fmt.Fprintf(d.current, "q %.2f g %.2f %.2f %.2f %.2f re f Q\n", gray, x, PageHeight-y-h, w, h)
+}
+
+// Bytes 生成PDF文件内容
+func (d *Document) Bytes() []byte {
+	d.ensurePage()
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// 1 目录，2 页面树，3-5 字体，之后每页依次为页面对象和内容流
+	const firstPage = 6
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+i*2)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light-UniGB-UCS2-H /Encoding /UniGB-UCS2-H /DescendantFonts [4 0 R] >>")
+	object("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light " +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /FontDescriptor 5 0 R /DW 1000 /W [1 95 500] >>")
+	object("<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] " +
+		"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>")
+
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			PageWidth, PageHeight, firstPage+i*2+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.Bytes()
+}
+
+// TextWidth 计算文本宽度：ASCII字符为半角，其余为全角
+func TextWidth(text string, size float64) float64 {
+	var units float64
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			units += 500
+		} else {
+			units += 1000
+		}
+	}
+	return units * size / 1000
+}
+
+// Truncate 截断文本使其宽度不超过 width，被截断时以省略号结尾
+func Truncate(text string, size, width float64) string {
+	if TextWidth(text, size) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && TextWidth(string(runes)+"…", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+func (d *Document) ensurePage() {
+	if d.current == nil {
+		d.AddPage()
+	}
+}
+
+// encodeText 将文本编码为 UCS-2 大端十六进制，超出基本平面的字符替换为问号
+func encodeText(text string) string {
+	var sb strings.Builder
+	for _, r := range text {
+		if r > 0xFFFF {
+			r = '?'
+		}
+		fmt.Fprintf(&sb, "%04X", r)
+	}
+	return sb.String()
+}
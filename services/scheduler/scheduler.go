@@ -0,0 +1,53 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+)
+
+// Job 定时任务
+type Job func() error
+
+// RunDaily 启动每日定时任务：启动时立即执行一次，之后每天在指定整点执行
+func RunDaily(name string, hour int, job Job) {
+	go func() {
+		run(name, job)
+		for {
+			time.Sleep(time.Until(nextRun(time.Now(), hour)))
+			run(name, job)
+		}
+	}()
+}
+
+// RunEvery 启动固定间隔的定时任务：启动时立即执行一次，之后每隔 interval 执行
+func RunEvery(name string, interval time.Duration, job Job) {
+	go func() {
+		run(name, job)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			run(name, job)
+		}
+	}()
+}
+
+// run 执行任务并记录错误，任务 panic 不影响后续调度
+func run(name string, job Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Scheduled job %s panicked: %v", name, r)
+		}
+	}()
+	if err := job(); err != nil {
+		log.Printf("Scheduled job %s failed: %v", name, err)
+	}
+}
+
+// nextRun 计算下一次在指定整点执行的时间
+func nextRun(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
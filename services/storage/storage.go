@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("object not found")
+
+// Storage 文件存储后端
+// key 为存储内的相对路径（使用 / 分隔），由调用方生成
+type Storage interface {
+	// Put 写入对象，已存在时覆盖
+	Put(key string, r io.Reader, size int64, contentType string) error
+	// Get 读取对象，不存在时返回 ErrNotFound
+	Get(key string) (io.ReadCloser, error)
+	// Delete 删除对象，不存在时不报错
+	Delete(key string) error
+	// Exists 判断对象是否存在
+	Exists(key string) (bool, error)
+}
+
+// Driver 存储驱动类型
+type Driver string
+
+const (
+	DriverLocal Driver = "local" // 本地文件系统
+	DriverS3    Driver = "s3"    // S3兼容对象存储（AWS S3 / MinIO 等）
+)
+
+// Config 存储配置
+type Config struct {
+	Driver    Driver
+	LocalRoot string // 本地存储根目录
+
+	S3Endpoint  string // 如 localhost:9000 或 s3.amazonaws.com
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3UseSSL    bool
+}
+
+// New 根据配置创建存储后端
+func New(cfg Config) (Storage, error) {
+	switch cfg.Driver {
+	case DriverLocal, "":
+		return NewLocalStorage(cfg.LocalRoot)
+	case DriverS3:
+		return NewS3Storage(cfg)
+	default:
+		return nil, errors.New("unsupported storage driver: " + string(cfg.Driver))
+	}
+}
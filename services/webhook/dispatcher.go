@@ -0,0 +1,277 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"erp/models"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxAttempts 最大投递次数
+	MaxAttempts = 6
+	// retryBaseDelay 首次重试间隔，之后每次翻倍（30秒、1分钟、2分钟……）
+	retryBaseDelay = 30 * time.Second
+	// batchSize 每次处理的投递记录数
+	batchSize = 100
+	// maxResponseBody 保存的响应内容长度上限
+	maxResponseBody = 1024
+)
+
+// 请求头
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Event 推送的事件内容
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Dispatcher 将事件写入订阅的投递记录，并负责投递和重试
+type Dispatcher struct {
+	db     *gorm.DB
+	client *http.Client
+}
+
+// NewDispatcher 创建事件分发器
+func NewDispatcher(db *gorm.DB) *Dispatcher {
+	return &Dispatcher{db: db, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Emit 为所有订阅了该事件的启用订阅创建投递记录，由 ProcessPending 异步投递
+func (d *Dispatcher) Emit(eventType string, data interface{}) error {
+	var subscriptions []models.WebhookSubscription
+	if err := d.db.Where("active = ?", true).Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	var matched []models.WebhookSubscription
+	for _, subscription := range subscriptions {
+		if Matches(subscription.EventTypes, eventType) {
+			matched = append(matched, subscription)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	event := Event{ID: newEventID(), Type: eventType, CreatedAt: time.Now(), Data: data}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	now := time.Now()
+	for _, subscription := range matched {
+		if err := d.db.Create(&models.WebhookDelivery{
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      eventType,
+			Payload:        string(payload),
+			Status:         models.WebhookDeliveryPending,
+			NextAttemptAt:  now,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProcessPending 投递到期的记录，失败后按指数退避重试，超过最大次数标记为失败
+// 已停用订阅的记录保持待投递，重新启用后继续投递
+func (d *Dispatcher) ProcessPending() error {
+	var deliveries []models.WebhookDelivery
+	if err := d.db.Joins("JOIN webhook_subscriptions ON webhook_subscriptions.id = webhook_deliveries.subscription_id").
+		Where("webhook_subscriptions.active = ? AND webhook_subscriptions.deleted_at IS NULL", true).
+		Where("webhook_deliveries.status = ? AND webhook_deliveries.next_attempt_at <= ?", models.WebhookDeliveryPending, time.Now()).
+		Order("webhook_deliveries.next_attempt_at ASC").
+		Limit(batchSize).
+		Find(&deliveries).Error; err != nil {
+		return err
+	}
+
+	for i := range deliveries {
+		var subscription models.WebhookSubscription
+		if err := d.db.First(&subscription, deliveries[i].SubscriptionID).Error; err != nil {
+			continue
+		}
+		d.attempt(&subscription, &deliveries[i])
+	}
+	return nil
+}
+
+// Redeliver 以原请求体创建新的投递记录并立即投递
+func (d *Dispatcher) Redeliver(deliveryID uint) (*models.WebhookDelivery, error) {
+	var original models.WebhookDelivery
+	if err := d.db.First(&original, deliveryID).Error; err != nil {
+		return nil, err
+	}
+
+	var subscription models.WebhookSubscription
+	if err := d.db.First(&subscription, original.SubscriptionID).Error; err != nil {
+		return nil, fmt.Errorf("subscription not found")
+	}
+
+	delivery := models.WebhookDelivery{
+		SubscriptionID: original.SubscriptionID,
+		EventID:        original.EventID,
+		EventType:      original.EventType,
+		Payload:        original.Payload,
+		Status:         models.WebhookDeliveryPending,
+		NextAttemptAt:  time.Now(),
+		RedeliveryOf:   &original.ID,
+	}
+	if err := d.db.Create(&delivery).Error; err != nil {
+		return nil, err
+	}
+
+	d.attempt(&subscription, &delivery)
+	return &delivery, nil
+}
+
+// Ping 向订阅发送测试事件并立即投递
+func (d *Dispatcher) Ping(subscription *models.WebhookSubscription) (*models.WebhookDelivery, error) {
+	event := Event{
+		ID:        newEventID(),
+		Type:      models.WebhookEventPing,
+		CreatedAt: time.Now(),
+		Data:      map[string]interface{}{"subscription_id": subscription.ID},
+	}
+	payload, _ := json.Marshal(event)
+
+	delivery := models.WebhookDelivery{
+		SubscriptionID: subscription.ID,
+		EventID:        event.ID,
+		EventType:      event.Type,
+		Payload:        string(payload),
+		Status:         models.WebhookDeliveryPending,
+		NextAttemptAt:  time.Now(),
+	}
+	if err := d.db.Create(&delivery).Error; err != nil {
+		return nil, err
+	}
+
+	d.attempt(subscription, &delivery)
+	return &delivery, nil
+}
+
+// attempt 投递一次并记录结果
+func (d *Dispatcher) attempt(subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) {
+	timestamp := time.Now().Unix()
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		d.record(delivery, 0, "", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "erp-webhook/1.0")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, "sha256="+Sign(subscription.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		d.record(delivery, 0, "", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		d.record(delivery, resp.StatusCode, string(respBody), fmt.Errorf("unexpected response status %s", resp.Status))
+		return
+	}
+	d.record(delivery, resp.StatusCode, string(respBody), nil)
+}
+
+// record 更新投递结果
+func (d *Dispatcher) record(delivery *models.WebhookDelivery, status int, body string, err error) {
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+	delivery.ResponseBody = body
+
+	if err == nil {
+		delivery.Status = models.WebhookDeliverySuccess
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= MaxAttempts {
+			delivery.Status = models.WebhookDeliveryFailed
+		} else {
+			delivery.Status = models.WebhookDeliveryPending
+			delivery.NextAttemptAt = now.Add(retryBaseDelay << (delivery.Attempts - 1))
+		}
+		log.Printf("Webhook delivery %d (%s) attempt %d failed: %v", delivery.ID, delivery.EventType, delivery.Attempts, err)
+	}
+
+	d.db.Model(delivery).
+		Select("status", "attempts", "next_attempt_at", "response_status", "response_body", "last_error", "delivered_at").
+		Updates(delivery)
+}
+
+// Sign 计算签名：HMAC-SHA256(secret, "<timestamp>.<body>") 的十六进制值
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Matches 判断订阅的事件过滤条件是否包含该事件
+// filters 为逗号分隔的事件类型，"*" 匹配全部，"task.*" 匹配 task 下的所有事件
+func Matches(filters, eventType string) bool {
+	for _, filter := range strings.Split(filters, ",") {
+		filter = strings.TrimSpace(filter)
+		switch {
+		case filter == "":
+			continue
+		case filter == "*" || filter == eventType:
+			return true
+		case strings.HasSuffix(filter, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(filter, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+// NewSecret 生成随机签名密钥
+func NewSecret() string {
+	return "whsec_" + randomHex(24)
+}
+
+// newEventID 生成事件ID
+func newEventID() string {
+	return "evt_" + randomHex(12)
+}
+
+// randomHex 生成指定字节数的随机十六进制字符串
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,4 @@
+package utils
+
+// MaxAttachmentSize 附件大小上限（20MB）
+const MaxAttachmentSize = 20 << 20